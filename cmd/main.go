@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -9,10 +10,11 @@ import (
 	"github.com/hbahadorzadeh/ganje/internal/config"
 	"github.com/hbahadorzadeh/ganje/internal/database"
 	"github.com/hbahadorzadeh/ganje/internal/auth"
-	"github.com/hbahadorzadeh/ganje/internal/storage"
 	"github.com/hbahadorzadeh/ganje/internal/messaging"
 	"github.com/hbahadorzadeh/ganje/internal/metrics"
 	"github.com/hbahadorzadeh/ganje/internal/routes"
+	"github.com/hbahadorzadeh/ganje/internal/server"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -26,14 +28,53 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	r, grpcServer, err := setup(cfg)
+	if err != nil {
+		log.Fatalf("Failed to setup server: %v", err)
+	}
+
+	// Start Bazel remote cache gRPC server if configured
+	if grpcServer != nil {
+		go func() {
+			if err := server.ServeBazelGRPC(cfg, grpcServer); err != nil {
+				log.Printf("gRPC server failed to start: %v", err)
+			}
+		}()
+		log.Printf("Starting Bazel remote cache gRPC server on %s:%d", cfg.Server.Host, cfg.Server.GRPCPort)
+	}
+
+	// Start server
+	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+	log.Printf("Starting Ganje server on %s", addr)
+	err = r.Run(addr)
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
+
+// setup creates the services configured in cfg and starts their background work. It returns the
+// HTTP router, and the gRPC server of the Bazel remote cache when a gRPC port is configured.
+func setup(cfg *config.Config) (*gin.Engine, *grpc.Server, error) {
 	// Setup database
 	db, err := database.New(cfg.Database.Driver, cfg.Database.GetConnectionString())
 	if err != nil {
-		log.Fatalf("Failed to setup database: %v", err)
+		return nil, nil, fmt.Errorf("failed to setup database: %w", err)
+	}
+
+	// Setup storage pools
+	pools, err := server.NewStoragePools(cfg, db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup storage: %w", err)
+	}
+	if cfg.Storage.Tiering.Enabled {
+		go server.NewColdStorageMigrator(cfg, db, pools).Run(context.Background())
 	}
 
-	// Setup storage service
-	storageService := storage.NewLocalStorage(cfg.Storage.LocalPath)
+	// Setup storage quotas
+	quota, err := server.NewQuota(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup storage quota: %w", err)
+	}
 
 	// Setup authentication services
 	realmPerms := make(map[string][]auth.Permission)
@@ -80,15 +121,27 @@ func main() {
 		metricsService = metrics.NewMetricsService()
 	}
 
+	// Setup storage scrubbing
+	scrubber, err := server.NewScrubber(cfg, db, pools, metricsService)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup storage scrubber: %w", err)
+	}
+	if cfg.Storage.Scrub.Enabled {
+		go scrubber.Schedule(context.Background(), cfg.Storage.Scrub.Interval())
+	}
+
+	// Setup the Bazel remote cache gRPC server, which serves the repositories in
+	// the configuration; they are stored before the routes of stored repositories are set up
+	var grpcServer *grpc.Server
+	if cfg.Server.GRPCPort > 0 {
+		repoManager := server.NewRepositoryManager(cfg, db, pools, quota, metricsService, messagingService)
+		grpcServer = server.NewBazelGRPCServer(cfg, db, repoManager, authService, messagingService)
+	}
+
 	// Setup routes
 	r := gin.Default()
-	routes.SetupRoutes(r, db, storageService, authService, oidcService, messagingService, metricsService, cfg)
+	routes.SetupRoutes(r, db, pools, quota, scrubber, authService, oidcService, messagingService, metricsService, cfg)
 
-	// Start server
-	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Starting Ganje server on %s", addr)
-	err = r.Run(addr)
-	if err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
+	return r, grpcServer, nil
 }
+
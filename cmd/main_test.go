@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hbahadorzadeh/ganje/internal/auth"
+	"github.com/hbahadorzadeh/ganje/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSetupServesBazelOverGRPC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+server:
+  host: 127.0.0.1
+  port: 8080
+  grpc_port: 9092
+database:
+  driver: sqlite
+storage:
+  type: local
+  local_path: `+filepath.Join(dir, "storage")+`
+auth:
+  jwt_secret: secret
+  realms:
+    - name: builders
+      permissions: [read, write]
+repositories:
+  - name: bazel-cache
+    type: local
+    artifact_type: bazel
+`), 0o644))
+	cfg, err := config.Load(configFile)
+	require.NoError(t, err)
+
+	_, grpcServer, err := setup(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, grpcServer, "grpc_port starts the Bazel remote cache")
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = grpcServer.Serve(lis) }()
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{Username: "builder", Realms: []string{"builders"}}).
+		SignedString([]byte("secret"))
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	cas := repb.NewContentAddressableStorageClient(conn)
+
+	blob := []byte("built by bazel")
+	sum := sha256.Sum256(blob)
+	digest := &repb.Digest{Hash: hex.EncodeToString(sum[:]), SizeBytes: int64(len(blob))}
+
+	missing, err := cas.FindMissingBlobs(ctx, &repb.FindMissingBlobsRequest{InstanceName: "bazel-cache", BlobDigests: []*repb.Digest{digest}})
+	require.NoError(t, err)
+	assert.Len(t, missing.GetMissingBlobDigests(), 1)
+
+	updated, err := cas.BatchUpdateBlobs(ctx, &repb.BatchUpdateBlobsRequest{
+		InstanceName: "bazel-cache",
+		Requests:     []*repb.BatchUpdateBlobsRequest_Request{{Digest: digest, Data: blob}},
+	})
+	require.NoError(t, err)
+	require.Len(t, updated.GetResponses(), 1)
+	assert.Equal(t, int32(codes.OK), updated.GetResponses()[0].GetStatus().GetCode())
+
+	read, err := cas.BatchReadBlobs(ctx, &repb.BatchReadBlobsRequest{InstanceName: "bazel-cache", Digests: []*repb.Digest{digest}})
+	require.NoError(t, err)
+	require.Len(t, read.GetResponses(), 1)
+	assert.Equal(t, blob, read.GetResponses()[0].GetData())
+}
@@ -10,19 +10,32 @@ import (
 type ArtifactType string
 
 const (
-	ArtifactTypeMaven     ArtifactType = "maven"
-	ArtifactTypePyPI      ArtifactType = "pypi"
-	ArtifactTypeHelm      ArtifactType = "helm"
-	ArtifactTypeDocker    ArtifactType = "docker"
-	ArtifactTypeNPM       ArtifactType = "npm"
-	ArtifactTypeGolang    ArtifactType = "golang"
-	ArtifactTypeAnsible   ArtifactType = "ansible"
-	ArtifactTypeTerraform ArtifactType = "terraform"
-	ArtifactTypeGeneric   ArtifactType = "generic"
-	ArtifactTypeCargo     ArtifactType = "cargo"
-	ArtifactTypeNuGet     ArtifactType = "nuget"
-	ArtifactTypeRubyGems  ArtifactType = "rubygems"
-	ArtifactTypeBazel     ArtifactType = "bazel"
+	ArtifactTypeMaven       ArtifactType = "maven"
+	ArtifactTypePyPI        ArtifactType = "pypi"
+	ArtifactTypeHelm        ArtifactType = "helm"
+	ArtifactTypeDocker      ArtifactType = "docker"
+	ArtifactTypeNPM         ArtifactType = "npm"
+	ArtifactTypeGolang      ArtifactType = "golang"
+	ArtifactTypeAnsible     ArtifactType = "ansible"
+	ArtifactTypeTerraform   ArtifactType = "terraform"
+	ArtifactTypeGeneric     ArtifactType = "generic"
+	ArtifactTypeCargo       ArtifactType = "cargo"
+	ArtifactTypeNuGet       ArtifactType = "nuget"
+	ArtifactTypeRubyGems    ArtifactType = "rubygems"
+	ArtifactTypeBazel       ArtifactType = "bazel"
+	ArtifactTypeDebian      ArtifactType = "debian"
+	ArtifactTypeRPM         ArtifactType = "rpm"
+	ArtifactTypeAPK         ArtifactType = "apk"
+	ArtifactTypeConda       ArtifactType = "conda"
+	ArtifactTypeComposer    ArtifactType = "composer"
+	ArtifactTypeHex         ArtifactType = "hex"
+	ArtifactTypeSwift       ArtifactType = "swift"
+	ArtifactTypeConan       ArtifactType = "conan"
+	ArtifactTypeLFS         ArtifactType = "lfs"
+	ArtifactTypePub         ArtifactType = "pub"
+	ArtifactTypeVagrant     ArtifactType = "vagrant"
+	ArtifactTypeCocoaPods   ArtifactType = "cocoapods"
+	ArtifactTypeHuggingFace ArtifactType = "huggingface"
 )
 
 // ArtifactInfo represents metadata about an artifact
@@ -72,6 +72,9 @@ func (f *DefaultFactory) GetSupportedTypes() []ArtifactType {
 	return []ArtifactType{
 		ArtifactTypeMaven, ArtifactTypePyPI, ArtifactTypeHelm, ArtifactTypeDocker, ArtifactTypeNPM, ArtifactTypeGolang,
 		ArtifactTypeAnsible, ArtifactTypeTerraform, ArtifactTypeGeneric, ArtifactTypeCargo,
-		ArtifactTypeNuGet, ArtifactTypeRubyGems, ArtifactTypeBazel,
+		ArtifactTypeNuGet, ArtifactTypeRubyGems, ArtifactTypeBazel, ArtifactTypeDebian, ArtifactTypeRPM,
+		ArtifactTypeAPK, ArtifactTypeConda, ArtifactTypeComposer, ArtifactTypeHex, ArtifactTypeSwift,
+		ArtifactTypeConan, ArtifactTypeLFS, ArtifactTypePub, ArtifactTypeVagrant, ArtifactTypeCocoaPods,
+		ArtifactTypeHuggingFace,
 	}
 }
@@ -1,10 +1,14 @@
 package types
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
@@ -103,23 +107,113 @@ func (a *AnsibleArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
 	return fmt.Sprintf("download/%s-%s-%s.tar.gz", namespace, info.Name, info.Version)
 }
 
-// ValidateArtifact validates the artifact content
+// ValidateArtifact validates the artifact content by reading MANIFEST.json from the collection tarball
 func (a *AnsibleArtifact) ValidateArtifact(content io.Reader) error {
-	// Basic validation - check if content is readable
-	buf := make([]byte, 1024)
-	_, err := content.Read(buf)
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("invalid artifact content: %v", err)
-	}
-	return nil
+	_, err := ReadCollectionManifest(content)
+	return err
 }
 
-// GetMetadata extracts metadata from artifact content
+// GetMetadata extracts metadata from the collection MANIFEST.json
 func (a *AnsibleArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	manifest, err := ReadCollectionManifest(content)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Metadata(), nil
+}
+
+// CollectionInfo is the collection_info section of a collection MANIFEST.json
+type CollectionInfo struct {
+	Namespace    string            `json:"namespace"`
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Authors      []string          `json:"authors,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	License      []string          `json:"license,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Repository   string            `json:"repository,omitempty"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// CollectionManifest represents the MANIFEST.json shipped at the root of a collection tarball
+type CollectionManifest struct {
+	CollectionInfo CollectionInfo `json:"collection_info"`
+	Format         int            `json:"format"`
+}
+
+// Filename returns the canonical artifact filename for the collection
+func (m *CollectionManifest) Filename() string {
+	return fmt.Sprintf("%s-%s-%s.tar.gz", m.CollectionInfo.Namespace, m.CollectionInfo.Name, m.CollectionInfo.Version)
+}
+
+// Metadata flattens the manifest into artifact metadata properties
+func (m *CollectionManifest) Metadata() map[string]string {
+	deps := m.CollectionInfo.Dependencies
+	if deps == nil {
+		deps = map[string]string{}
+	}
+	depsJSON, _ := json.Marshal(deps)
 	return map[string]string{
-		"type": "ansible-collection",
-		"format": "tar.gz",
-	}, nil
+		"type":         "ansible-collection",
+		"format":       "tar.gz",
+		"namespace":    m.CollectionInfo.Namespace,
+		"name":         m.CollectionInfo.Name,
+		"version":      m.CollectionInfo.Version,
+		"filename":     m.Filename(),
+		"description":  m.CollectionInfo.Description,
+		"dependencies": string(depsJSON),
+	}
+}
+
+// DependencyList returns the collection dependencies as sorted "namespace.name:requirement" entries
+func (m *CollectionManifest) DependencyList() []string {
+	deps := make([]string, 0, len(m.CollectionInfo.Dependencies))
+	for name, req := range m.CollectionInfo.Dependencies {
+		deps = append(deps, name+":"+req)
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+var ansibleIdentifierPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ReadCollectionManifest reads and validates MANIFEST.json from a gzipped collection tarball
+func ReadCollectionManifest(content io.Reader) (*CollectionManifest, error) {
+	gz, err := gzip.NewReader(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collection archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("MANIFEST.json not found in collection archive")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection archive: %w", err)
+		}
+		if path.Clean(hdr.Name) != "MANIFEST.json" {
+			continue
+		}
+
+		var manifest CollectionManifest
+		if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("invalid MANIFEST.json: %w", err)
+		}
+		info := manifest.CollectionInfo
+		if !ansibleIdentifierPattern.MatchString(info.Namespace) {
+			return nil, fmt.Errorf("invalid collection namespace: %q", info.Namespace)
+		}
+		if !ansibleIdentifierPattern.MatchString(info.Name) {
+			return nil, fmt.Errorf("invalid collection name: %q", info.Name)
+		}
+		if strings.TrimSpace(info.Version) == "" {
+			return nil, fmt.Errorf("collection version is required")
+		}
+		return &manifest, nil
+	}
 }
 
 // GenerateIndex generates collection metadata per Galaxy NG API v3 `Get a specific collection`
@@ -187,9 +281,13 @@ func (a *AnsibleArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]b
 // GetEndpoints returns Ansible Galaxy standard endpoints
 func (a *AnsibleArtifact) GetEndpoints() []string {
 	return []string{
+		"GET /api/",
 		"GET /api/v3/plugin/ansible/content/published/collections/index/{namespace}/{name}/",
+		"GET /api/v3/collections/{namespace}/{name}/",
+		"GET /api/v3/collections/{namespace}/{name}/versions/",
+		"GET /api/v3/collections/{namespace}/{name}/versions/{version}/",
+		"POST /api/v3/artifacts/collections/",
+		"GET /api/v3/imports/collections/{task_id}/",
 		"GET /download/{namespace}-{name}-{version}.tar.gz",
-		// API v3 uploads are different; keeping placeholder for completeness
-		"POST /api/v3/plugin/ansible/content/published/collections/",
 	}
 }
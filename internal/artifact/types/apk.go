@@ -0,0 +1,547 @@
+package types
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+)
+
+// APKIndexFile is the file name of an Alpine repository index
+const APKIndexFile = "APKINDEX.tar.gz"
+
+var (
+	apkNamePattern    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._+-]*$`)
+	apkSegmentPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+	apkPathPattern    = regexp.MustCompile(`^([^/]+)/([^/]+)/([^/]+)/([^/]+)-([^/-]+-r[0-9]+)\.apk$`)
+)
+
+// APKArtifact implements Alpine package (.apk) handling
+type APKArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewAPKArtifact creates a new APK artifact
+func NewAPKArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &APKArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (a *APKArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeAPK
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (a *APKArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return a.metadata
+}
+
+// GetPath returns the storage path for the package
+func (a *APKArtifact) GetPath() string {
+	props := a.metadata.Properties
+	if props == nil {
+		props = map[string]string{}
+	}
+	return APKPackagePath(props["branch"], props["repo"], props["arch"], a.metadata.Name+"-"+a.metadata.Version+".apk")
+}
+
+// GetIndexPath returns the index path of the package's branch/repo/arch
+func (a *APKArtifact) GetIndexPath() string {
+	return APKIndexPath(path.Dir(a.GetPath()))
+}
+
+// ValidatePath validates an APK package path
+func (a *APKArtifact) ValidatePath(p string) error {
+	if !apkPathPattern.MatchString(p) {
+		return fmt.Errorf("invalid APK package path: %s", p)
+	}
+	return nil
+}
+
+// ParsePath parses package information from a <branch>/<repo>/<arch>/<name>-<version>.apk path
+func (a *APKArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := apkPathPattern.FindStringSubmatch(p)
+	if m == nil {
+		return nil, fmt.Errorf("invalid APK package path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:    m[4],
+		Version: m[5],
+		Type:    artifact.ArtifactTypeAPK,
+		Path:    p,
+		Metadata: map[string]string{
+			"branch": m[1],
+			"repo":   m[2],
+			"arch":   m[3],
+		},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (a *APKArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	return APKPackagePath(info.Metadata["branch"], info.Metadata["repo"], info.Metadata["arch"], info.Name+"-"+info.Version+".apk")
+}
+
+// ValidateArtifact validates that the content is an APK with a readable .PKGINFO
+func (a *APKArtifact) ValidateArtifact(content io.Reader) error {
+	_, err := ReadAPKPackage(content)
+	return err
+}
+
+// GetMetadata extracts metadata from .PKGINFO
+func (a *APKArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	pkg, err := ReadAPKPackage(content)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.Metadata(), nil
+}
+
+// GenerateIndex generates the plain-text APKINDEX for the given packages
+func (a *APKArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	var pkgs []*APKPackage
+	for _, info := range artifacts {
+		pkg, err := APKPackageFromMetadata(info.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", info.Name, err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return APKIndexText(pkgs), nil
+}
+
+// GetEndpoints returns Alpine repository endpoints
+func (a *APKArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /{branch}/{repo}/{arch}/APKINDEX.tar.gz",
+		"GET /{branch}/{repo}/{arch}/{name}-{version}.apk",
+		"GET /keys/{keyname}.rsa.pub",
+		"POST /api/packages/{branch}/{repo}",
+	}
+}
+
+// APKPackagePath returns the storage path of a package within a branch/repo/arch
+func APKPackagePath(branch, repo, arch, filename string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", branch, repo, arch, filename)
+}
+
+// APKIndexPath returns the storage path of the APKINDEX.tar.gz of a <branch>/<repo>/<arch> directory
+func APKIndexPath(dir string) string {
+	return dir + "/" + APKIndexFile
+}
+
+// ValidAPKPathSegment reports whether s can be used as a branch, repo or arch name
+func ValidAPKPathSegment(s string) bool {
+	return apkSegmentPattern.MatchString(s)
+}
+
+// APKPackage holds the .PKGINFO fields listed in APKINDEX
+type APKPackage struct {
+	Name             string
+	Version          string
+	Arch             string
+	Description      string
+	URL              string
+	License          string
+	Origin           string
+	Maintainer       string
+	Commit           string
+	ProviderPriority string
+	BuildDate        int64
+	InstalledSize    int64
+	Depends          []string
+	Provides         []string
+	InstallIf        []string
+	Replaces         []string
+
+	// Checksum is the APKINDEX "C:" value: Q1 followed by the base64 SHA-1 of the control segment
+	Checksum string
+	// Size is the size of the .apk file
+	Size int64
+}
+
+// Filename returns the canonical <name>-<version>.apk file name
+func (p *APKPackage) Filename() string {
+	return p.Name + "-" + p.Version + ".apk"
+}
+
+// Metadata returns the properties persisted with an uploaded package
+func (p *APKPackage) Metadata() map[string]string {
+	lists, _ := json.Marshal(map[string][]string{
+		"depends":    p.Depends,
+		"provides":   p.Provides,
+		"install_if": p.InstallIf,
+		"replaces":   p.Replaces,
+	})
+	return map[string]string{
+		"type":              "apk-package",
+		"format":            "apk",
+		"name":              p.Name,
+		"version":           p.Version,
+		"arch":              p.Arch,
+		"description":       p.Description,
+		"url":               p.URL,
+		"license":           p.License,
+		"origin":            p.Origin,
+		"maintainer":        p.Maintainer,
+		"commit":            p.Commit,
+		"provider_priority": p.ProviderPriority,
+		"builddate":         strconv.FormatInt(p.BuildDate, 10),
+		"installed_size":    strconv.FormatInt(p.InstalledSize, 10),
+		"dependencies":      string(lists),
+		"apk_checksum":      p.Checksum,
+		"filename":          p.Filename(),
+	}
+}
+
+// APKPackageFromMetadata restores a package from the properties produced by Metadata
+func APKPackageFromMetadata(props map[string]string) (*APKPackage, error) {
+	p := &APKPackage{
+		Name:             props["name"],
+		Version:          props["version"],
+		Arch:             props["arch"],
+		Description:      props["description"],
+		URL:              props["url"],
+		License:          props["license"],
+		Origin:           props["origin"],
+		Maintainer:       props["maintainer"],
+		Commit:           props["commit"],
+		ProviderPriority: props["provider_priority"],
+		Checksum:         props["apk_checksum"],
+	}
+	if p.Name == "" || p.Version == "" || p.Arch == "" {
+		return nil, fmt.Errorf("missing .PKGINFO properties")
+	}
+	p.BuildDate, _ = strconv.ParseInt(props["builddate"], 10, 64)
+	p.InstalledSize, _ = strconv.ParseInt(props["installed_size"], 10, 64)
+	p.Size, _ = strconv.ParseInt(props["size"], 10, 64)
+	if props["dependencies"] != "" {
+		var lists map[string][]string
+		if err := json.Unmarshal([]byte(props["dependencies"]), &lists); err != nil {
+			return nil, fmt.Errorf("invalid dependencies: %w", err)
+		}
+		p.Depends, p.Provides, p.InstallIf, p.Replaces = lists["depends"], lists["provides"], lists["install_if"], lists["replaces"]
+	}
+	return p, nil
+}
+
+// ParsePKGINFO parses the "key = value" lines of a .PKGINFO file
+func ParsePKGINFO(data []byte) (*APKPackage, error) {
+	p := &APKPackage{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "pkgname":
+			p.Name = value
+		case "pkgver":
+			p.Version = value
+		case "arch":
+			p.Arch = value
+		case "pkgdesc":
+			p.Description = value
+		case "url":
+			p.URL = value
+		case "license":
+			p.License = value
+		case "origin":
+			p.Origin = value
+		case "maintainer":
+			p.Maintainer = value
+		case "commit":
+			p.Commit = value
+		case "provider_priority":
+			p.ProviderPriority = value
+		case "builddate":
+			p.BuildDate, _ = strconv.ParseInt(value, 10, 64)
+		case "size":
+			p.InstalledSize, _ = strconv.ParseInt(value, 10, 64)
+		case "depend":
+			p.Depends = append(p.Depends, value)
+		case "provides":
+			p.Provides = append(p.Provides, value)
+		case "install_if":
+			p.InstallIf = append(p.InstallIf, strings.Fields(value)...)
+		case "replaces":
+			p.Replaces = append(p.Replaces, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !apkNamePattern.MatchString(p.Name) {
+		return nil, fmt.Errorf("invalid package name %q in .PKGINFO", p.Name)
+	}
+	if p.Version == "" || strings.ContainsAny(p.Version, "/ ") {
+		return nil, fmt.Errorf("invalid package version %q in .PKGINFO", p.Version)
+	}
+	if !apkSegmentPattern.MatchString(p.Arch) {
+		return nil, fmt.Errorf("invalid package arch %q in .PKGINFO", p.Arch)
+	}
+	if p.Origin == "" {
+		p.Origin = p.Name
+	}
+	return p, nil
+}
+
+// apkSegmentReader hashes the raw bytes consumed by a gzip reader so each
+// gzip stream (signature, control, data) of an .apk can be digested separately
+type apkSegmentReader struct {
+	r *bufio.Reader
+	h hash.Hash
+}
+
+func (s *apkSegmentReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.h.Write(p[:n])
+	return n, err
+}
+
+func (s *apkSegmentReader) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+// ReadAPKPackage reads .PKGINFO from an .apk and computes the control segment checksum.
+// An .apk is a concatenation of gzip streams: an optional signature, the control tar
+// holding .PKGINFO, and the data tar.
+func ReadAPKPackage(content io.Reader) (*APKPackage, error) {
+	sr := &apkSegmentReader{r: bufio.NewReader(content)}
+	gz := new(gzip.Reader)
+
+	// The signature segment, when present, precedes the control segment
+	for segment := 0; segment < 2; segment++ {
+		sr.h = sha1.New()
+		if err := gz.Reset(sr); err != nil {
+			return nil, fmt.Errorf("not an APK package: %w", err)
+		}
+		gz.Multistream(false)
+
+		tr := tar.NewReader(gz)
+		var pkginfo []byte
+		signature := false
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid APK package: %w", err)
+			}
+			if strings.HasPrefix(hdr.Name, ".SIGN.") {
+				signature = true
+				break
+			}
+			if hdr.Name == ".PKGINFO" {
+				if pkginfo, err = io.ReadAll(io.LimitReader(tr, 1<<20)); err != nil {
+					return nil, fmt.Errorf("invalid APK package: %w", err)
+				}
+				break
+			}
+		}
+		// Drain the rest of the stream so the digest covers all of it
+		if _, err := io.Copy(io.Discard, gz); err != nil {
+			return nil, fmt.Errorf("invalid APK package: %w", err)
+		}
+		if signature {
+			continue
+		}
+		if pkginfo == nil {
+			return nil, fmt.Errorf("invalid APK package: missing .PKGINFO")
+		}
+		pkg, err := ParsePKGINFO(pkginfo)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Checksum = "Q1" + base64.StdEncoding.EncodeToString(sr.h.Sum(nil))
+		return pkg, nil
+	}
+	return nil, fmt.Errorf("invalid APK package: missing control segment")
+}
+
+// APKIndexText renders the APKINDEX file listing the packages
+func APKIndexText(pkgs []*APKPackage) []byte {
+	sorted := make([]*APKPackage, len(pkgs))
+	copy(sorted, pkgs)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	var buf bytes.Buffer
+	field := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s:%s\n", key, value)
+		}
+	}
+	for _, p := range sorted {
+		field("C", p.Checksum)
+		field("P", p.Name)
+		field("V", p.Version)
+		field("A", p.Arch)
+		field("S", strconv.FormatInt(p.Size, 10))
+		field("I", strconv.FormatInt(p.InstalledSize, 10))
+		field("T", p.Description)
+		field("U", p.URL)
+		field("L", p.License)
+		field("o", p.Origin)
+		field("m", p.Maintainer)
+		field("t", strconv.FormatInt(p.BuildDate, 10))
+		field("c", p.Commit)
+		field("D", strings.Join(p.Depends, " "))
+		field("p", strings.Join(p.Provides, " "))
+		field("i", strings.Join(p.InstallIf, " "))
+		field("r", strings.Join(p.Replaces, " "))
+		field("k", p.ProviderPriority)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// APKSigningKey is an RSA key used to sign APKINDEX files. Name is the public key
+// file name clients install under /etc/apk/keys (e.g. "ganje-5f3a.rsa.pub").
+type APKSigningKey struct {
+	Name string
+	Key  *rsa.PrivateKey
+}
+
+// ParseAPKSigningKey parses a PEM encoded PKCS#1 or PKCS#8 RSA private key
+func ParseAPKSigningKey(pemData []byte, name string) (*APKSigningKey, error) {
+	key, err := parseRSAPrivateKey(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APK signing key: %w", err)
+	}
+	return &APKSigningKey{Name: name, Key: key}, nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded PKCS #1 or PKCS #8 RSA private key
+func parseRSAPrivateKey(pemData []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA key")
+	}
+	return key, nil
+}
+
+// PublicKeyPEM returns the PEM encoded public key in the format apk expects under /etc/apk/keys
+func (k *APKSigningKey) PublicKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(&k.Key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// BuildAPKIndex builds APKINDEX.tar.gz. When key is set, a signature segment over the
+// compressed index is prepended the way abuild-sign does.
+func BuildAPKIndex(pkgs []*APKPackage, description string, key *APKSigningKey, modTime time.Time) ([]byte, error) {
+	index, err := apkTarGz(modTime, true, []apkTarEntry{
+		{name: "DESCRIPTION", data: []byte(description)},
+		{name: "APKINDEX", data: APKIndexText(pkgs)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return index, nil
+	}
+
+	digest := sha1.Sum(index)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key.Key, crypto.SHA1, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign APKINDEX: %w", err)
+	}
+	// The signature tar has no end-of-archive marker so both segments read as one tar
+	sig, err := apkTarGz(modTime, false, []apkTarEntry{{name: ".SIGN.RSA." + key.Name, data: signature}})
+	if err != nil {
+		return nil, err
+	}
+	return append(sig, index...), nil
+}
+
+type apkTarEntry struct {
+	name string
+	data []byte
+}
+
+// apkTarGz writes entries as one gzip stream; terminate controls the tar end-of-archive blocks
+func apkTarGz(modTime time.Time, terminate bool, entries []apkTarEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:    e.name,
+			Mode:    0644,
+			Size:    int64(len(e.data)),
+			ModTime: modTime,
+			Uname:   "root",
+			Gname:   "root",
+			Format:  tar.FormatUSTAR,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if terminate {
+		err = tw.Close()
+	} else {
+		err = tw.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
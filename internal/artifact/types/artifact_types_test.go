@@ -1,12 +1,32 @@
 package types
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
 	yaml "gopkg.in/yaml.v3"
 )
 
@@ -759,5 +779,1282 @@ func TestAnsibleArtifact(t *testing.T) {
 		eps := a.GetEndpoints()
 		assert.Contains(t, eps, "GET /api/v3/plugin/ansible/content/published/collections/index/{namespace}/{name}/")
 		assert.Contains(t, eps, "GET /download/{namespace}-{name}-{version}.tar.gz")
+		assert.Contains(t, eps, "GET /api/v3/collections/{namespace}/{name}/versions/{version}/")
+		assert.Contains(t, eps, "POST /api/v3/artifacts/collections/")
 	})
+
+	t.Run("ReadCollectionManifest", func(t *testing.T) {
+		manifest := `{"collection_info":{"namespace":"acme","name":"tools","version":"2.1.0","dependencies":{"community.general":">=5.0.0"}},"format":1}`
+		archive := buildTarGz(t, map[string]string{
+			"./MANIFEST.json":  manifest,
+			"./plugins/foo.py": "print('hi')",
+		})
+
+		m, err := ReadCollectionManifest(bytes.NewReader(archive))
+		assert.NoError(t, err)
+		assert.Equal(t, "acme", m.CollectionInfo.Namespace)
+		assert.Equal(t, "tools", m.CollectionInfo.Name)
+		assert.Equal(t, "2.1.0", m.CollectionInfo.Version)
+		assert.Equal(t, "acme-tools-2.1.0.tar.gz", m.Filename())
+		assert.Equal(t, []string{"community.general:>=5.0.0"}, m.DependencyList())
+
+		meta, err := a.GetMetadata(bytes.NewReader(archive))
+		assert.NoError(t, err)
+		assert.Equal(t, "acme", meta["namespace"])
+		assert.JSONEq(t, `{"community.general":">=5.0.0"}`, meta["dependencies"])
+	})
+
+	t.Run("ValidateArtifact rejects missing or invalid manifest", func(t *testing.T) {
+		assert.Error(t, a.ValidateArtifact(strings.NewReader("not a tarball")))
+		assert.Error(t, a.ValidateArtifact(bytes.NewReader(buildTarGz(t, map[string]string{"README.md": "x"}))))
+		bad := buildTarGz(t, map[string]string{"MANIFEST.json": `{"collection_info":{"namespace":"Bad-NS","name":"tools","version":"1.0.0"}}`})
+		assert.Error(t, a.ValidateArtifact(bytes.NewReader(bad)))
+	})
+}
+
+func TestDebianArtifact(t *testing.T) {
+	deb := &DebianArtifact{}
+	control := "Package: libfoo1\nSource: foo (1.2-1)\nVersion: 1:1.2-1\nArchitecture: amd64\nMaintainer: Dev <dev@example.com>\nDepends: libc6 (>= 2.31)\nDescription: foo library\n Longer description\n .\n second paragraph\n"
+
+	t.Run("ReadDebControl", func(t *testing.T) {
+		c, err := ReadDebControl(bytes.NewReader(buildDeb(t, "control.tar.gz", buildTarGz(t, map[string]string{"./control": control}))))
+		assert.NoError(t, err)
+		assert.Equal(t, "libfoo1", c.Package)
+		assert.Equal(t, "1:1.2-1", c.Version)
+		assert.Equal(t, "amd64", c.Architecture)
+		assert.Equal(t, "foo", c.Source())
+		assert.Equal(t, "libfoo1_1.2-1_amd64.deb", c.Filename())
+		poolPath, err := c.PoolPath("main")
+		assert.NoError(t, err)
+		assert.Equal(t, "pool/main/f/foo/libfoo1_1.2-1_amd64.deb", poolPath)
+		poolPath, err = DebianPoolPath("main", "libbar", "libbar", "1.0", "all")
+		assert.NoError(t, err)
+		assert.Equal(t, "pool/main/libb/libbar/libbar_1.0_all.deb", poolPath)
+		assert.Equal(t, "foo library\n Longer description\n .\n second paragraph", c.Get("Description"))
+	})
+
+	t.Run("Hostile source names are rejected", func(t *testing.T) {
+		hostile := strings.Replace(control, "Source: foo (1.2-1)", "Source: ../../../../tmp/x", 1)
+		_, err := ReadDebControl(bytes.NewReader(buildDeb(t, "control.tar.gz", buildTarGz(t, map[string]string{"./control": hostile}))))
+		assert.Error(t, err)
+
+		for _, args := range [][2]string{{"main", "../../../../tmp/x"}, {"main", "foo/../../.."}, {"..", "foo"}, {"main/../..", "foo"}} {
+			_, err := DebianPoolPath(args[0], args[1], "foo", "1.0", "all")
+			assert.Error(t, err, args)
+		}
+	})
+
+	t.Run("ReadDebControl uncompressed", func(t *testing.T) {
+		var tarBuf bytes.Buffer
+		tw := tar.NewWriter(&tarBuf)
+		_ = tw.WriteHeader(&tar.Header{Name: "control", Mode: 0644, Size: int64(len(control))})
+		_, _ = tw.Write([]byte(control))
+		_ = tw.Close()
+		c, err := ReadDebControl(bytes.NewReader(buildDeb(t, "control.tar", tarBuf.Bytes())))
+		assert.NoError(t, err)
+		assert.Equal(t, "libfoo1", c.Package)
+	})
+
+	t.Run("ValidateArtifact", func(t *testing.T) {
+		assert.Error(t, deb.ValidateArtifact(strings.NewReader("not an archive")))
+		assert.Error(t, deb.ValidateArtifact(bytes.NewReader(buildDeb(t, "control.tar.gz", buildTarGz(t, map[string]string{"./control": "Package: x\n"})))))
+	})
+
+	t.Run("ParsePath", func(t *testing.T) {
+		info, err := deb.ParsePath("pool/main/h/hello/hello_2.10-3_arm64.deb")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", info.Name)
+		assert.Equal(t, "2.10-3", info.Version)
+		assert.Equal(t, "arm64", info.Metadata["architecture"])
+		_, err = deb.ParsePath("dists/stable/Release")
+		assert.Error(t, err)
+	})
+
+	t.Run("GenerateIndex", func(t *testing.T) {
+		index, err := deb.GenerateIndex([]*artifact.ArtifactInfo{{
+			Name:    "libfoo1",
+			Version: "1:1.2-1",
+			Metadata: map[string]string{
+				"control":  control + "SHA256: forged\n",
+				"filename": "pool/main/libf/foo/libfoo1_1.2-1_amd64.deb",
+				"size":     "1234",
+				"md5":      "m",
+				"sha1":     "s1",
+				"sha256":   "s256",
+			},
+		}})
+		assert.NoError(t, err)
+		text := string(index)
+		assert.True(t, strings.HasPrefix(text, "Package: libfoo1\n"))
+		assert.Contains(t, text, "Filename: pool/main/libf/foo/libfoo1_1.2-1_amd64.deb\nSize: 1234\nMD5sum: m\nSHA1: s1\nSHA256: s256\nDescription: foo library\n Longer description\n")
+		assert.NotContains(t, text, "forged")
+		assert.True(t, strings.HasSuffix(text, "second paragraph\n\n"))
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		release := &DebianRelease{
+			Origin: "apt", Label: "apt", Suite: "stable", Codename: "stable",
+			Date:          time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Architectures: []string{"amd64"},
+			Components:    []string{"main"},
+			Files:         []DebianIndexFile{{Path: "main/binary-amd64/Packages", Content: []byte("")}},
+		}
+		text := string(release.Bytes())
+		assert.Contains(t, text, "Date: Tue, 02 Jan 2024 03:04:05 UTC\n")
+		assert.Contains(t, text, "SHA256:\n e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 main/binary-amd64/Packages\n")
+		assert.Contains(t, text, "MD5Sum:\n d41d8cd98f00b204e9800998ecf8427e 0 main/binary-amd64/Packages\n")
+	})
+}
+
+// buildDeb assembles a minimal .deb (ar archive) around a control archive
+func buildDeb(t *testing.T, controlName string, controlArchive []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{controlName, controlArchive},
+		{"data.tar.gz", buildTarGz(t, map[string]string{"./usr/share/doc/foo/README": "foo"})},
+	}
+	for _, m := range members {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", m.name, 0, 0, 0, "100644", len(m.data))
+		buf.Write(m.data)
+		if len(m.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRPMArtifact(t *testing.T) {
+	rpm := &RPMArtifact{}
+	pkgBytes := buildRPM(t, "x86_64", "hello-2.10-3.src.rpm")
+
+	t.Run("ReadRPMHeader", func(t *testing.T) {
+		pkg, err := ReadRPMHeader(bytes.NewReader(pkgBytes))
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", pkg.Name)
+		assert.Equal(t, "1", pkg.Epoch)
+		assert.Equal(t, "2.10", pkg.Version)
+		assert.Equal(t, "3", pkg.Release)
+		assert.Equal(t, "x86_64", pkg.Arch)
+		assert.Equal(t, "hello-2.10-3.x86_64.rpm", pkg.Filename())
+		assert.Equal(t, int64(4096), pkg.ArchiveSize)
+		assert.Equal(t, int64(96+16+16+8), pkg.HeaderStart)
+		assert.Equal(t, int64(len(pkgBytes)-len("payload")), pkg.HeaderEnd)
+
+		assert.Equal(t, []RPMDependency{
+			{Name: "hello", Flags: "EQ", Epoch: "1", Version: "2.10", Release: "3"},
+			{Name: "greeting"},
+		}, pkg.Provides)
+		assert.Equal(t, []RPMDependency{
+			{Name: "libc.so.6()(64bit)"},
+			{Name: "glibc", Flags: "GE", Epoch: "0", Version: "2.31"},
+			{Name: "/bin/sh", Pre: true},
+		}, pkg.Requires, "rpmlib() requirements are dropped")
+		assert.Equal(t, []RPMFile{
+			{Path: "/usr/bin/hello"},
+			{Path: "/usr/share/doc/hello", Type: "dir"},
+			{Path: "/usr/share/doc/hello/README"},
+		}, pkg.Files)
+		assert.Equal(t, []RPMChangelog{{Author: "Dev <dev@example.com> - 2.10-3", Date: 1700000000, Text: "- fix <escaping> & more"}}, pkg.Changelogs)
+	})
+
+	t.Run("Source package", func(t *testing.T) {
+		pkg, err := ReadRPMHeader(bytes.NewReader(buildRPM(t, "x86_64", "")))
+		assert.NoError(t, err)
+		assert.Equal(t, "src", pkg.Arch)
+	})
+
+	t.Run("ValidateArtifact", func(t *testing.T) {
+		assert.NoError(t, rpm.ValidateArtifact(bytes.NewReader(pkgBytes)))
+		assert.Error(t, rpm.ValidateArtifact(strings.NewReader("not an rpm")))
+		assert.Error(t, rpm.ValidateArtifact(bytes.NewReader(pkgBytes[:200])))
+	})
+
+	t.Run("ParsePath", func(t *testing.T) {
+		info, err := rpm.ParsePath("Packages/hello-world-2.10-3.el9.noarch.rpm")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello-world", info.Name)
+		assert.Equal(t, "2.10-3.el9", info.Version)
+		assert.Equal(t, "noarch", info.Metadata["arch"])
+		_, err = rpm.ParsePath("repodata/repomd.xml")
+		assert.Error(t, err)
+	})
+
+	t.Run("Metadata round trip", func(t *testing.T) {
+		pkg, err := ReadRPMHeader(bytes.NewReader(pkgBytes))
+		assert.NoError(t, err)
+		restored, err := RPMPackageFromMetadata(pkg.Metadata())
+		assert.NoError(t, err)
+		assert.Equal(t, pkg, restored)
+		_, err = RPMPackageFromMetadata(map[string]string{"name": "x"})
+		assert.Error(t, err)
+	})
+
+	t.Run("GenerateRPMRepodata", func(t *testing.T) {
+		pkg, err := ReadRPMHeader(bytes.NewReader(pkgBytes))
+		assert.NoError(t, err)
+		pkg.Location = "Packages/hello-2.10-3.x86_64.rpm"
+		pkg.Checksum = "abc123"
+		pkg.PackageSize = int64(len(pkgBytes))
+
+		repodata := GenerateRPMRepodata([]*RPMPackage{pkg}, 1700000000)
+		repomd := string(repodata.RepoMD)
+		assert.Contains(t, repomd, "<revision>1700000000</revision>")
+		assert.Len(t, repodata.Files, 3)
+
+		contents := map[string]string{}
+		for _, f := range repodata.Files {
+			assert.Contains(t, repomd, `<checksum type="sha256">`+sha256Hex(f.Content)+`</checksum>`)
+			assert.Contains(t, repomd, `<location href="repodata/`+f.Name+`"/>`)
+			gz, err := gzip.NewReader(bytes.NewReader(f.Content))
+			assert.NoError(t, err)
+			var plain bytes.Buffer
+			_, _ = plain.ReadFrom(gz)
+			assert.Contains(t, repomd, `<open-checksum type="sha256">`+sha256Hex(plain.Bytes())+`</open-checksum>`)
+			contents[f.Name[strings.Index(f.Name, "-")+1:]] = plain.String()
+		}
+
+		primary := contents["primary.xml.gz"]
+		assert.Contains(t, primary, `packages="1"`)
+		assert.Contains(t, primary, `<version epoch="1" ver="2.10" rel="3"/>`)
+		assert.Contains(t, primary, `<checksum type="sha256" pkgid="YES">abc123</checksum>`)
+		assert.Contains(t, primary, `<location href="Packages/hello-2.10-3.x86_64.rpm"/>`)
+		assert.Contains(t, primary, `<rpm:entry name="glibc" flags="GE" epoch="0" ver="2.31"/>`)
+		assert.Contains(t, primary, `<rpm:entry name="/bin/sh" pre="1"/>`)
+		assert.Contains(t, primary, `<file>/usr/bin/hello</file>`)
+		assert.NotContains(t, primary, "README")
+
+		filelists := contents["filelists.xml.gz"]
+		assert.Contains(t, filelists, `<package pkgid="abc123" name="hello" arch="x86_64">`)
+		assert.Contains(t, filelists, `<file type="dir">/usr/share/doc/hello</file>`)
+		assert.Contains(t, filelists, `<file>/usr/share/doc/hello/README</file>`)
+
+		assert.Contains(t, contents["other.xml.gz"], `<changelog author="Dev &lt;dev@example.com&gt; - 2.10-3" date="1700000000">- fix &lt;escaping&gt; &amp; more</changelog>`)
+
+		again := GenerateRPMRepodata([]*RPMPackage{pkg}, 1700000000)
+		assert.Equal(t, repodata.RepoMD, again.RepoMD, "repodata generation is deterministic")
+	})
+}
+
+// buildRPM assembles a minimal RPM (lead, signature header, main header and a fake payload).
+// An empty sourceRPM produces a source package.
+func buildRPM(t *testing.T, arch, sourceRPM string) []byte {
+	t.Helper()
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+
+	tags := []rpmTestTag{
+		{rpmTagName, 6, "hello"},
+		{rpmTagVersion, 6, "2.10"},
+		{rpmTagRelease, 6, "3"},
+		{rpmTagEpoch, 4, []int32{1}},
+		{rpmTagSummary, 9, []string{"greeting tool"}},
+		{rpmTagArch, 6, arch},
+		{rpmTagProvideName, 8, []string{"hello", "greeting"}},
+		{rpmTagProvideFlags, 4, []int32{rpmSenseEqual, 0}},
+		{rpmTagProvideVer, 8, []string{"1:2.10-3", ""}},
+		{rpmTagRequireName, 8, []string{"libc.so.6()(64bit)", "glibc", "rpmlib(CompressedFileNames)", "/bin/sh"}},
+		{rpmTagRequireFlags, 4, []int32{0, rpmSenseGreater | rpmSenseEqual, rpmSenseLess | rpmSenseEqual, 0x200}},
+		{rpmTagRequireVer, 8, []string{"", "2.31", "3.0.4-1", ""}},
+		{rpmTagFileModes, 3, []uint16{0100755, 040755, 0100644}},
+		{rpmTagDirIndexes, 4, []int32{0, 1, 2}},
+		{rpmTagBaseNames, 8, []string{"hello", "hello", "README"}},
+		{rpmTagDirNames, 8, []string{"/usr/bin/", "/usr/share/doc/", "/usr/share/doc/hello/"}},
+		{rpmTagChangelogTime, 4, []int32{1700000000}},
+		{rpmTagChangelogName, 8, []string{"Dev <dev@example.com> - 2.10-3"}},
+		{rpmTagChangelogText, 8, []string{"- fix <escaping> & more"}},
+	}
+	if sourceRPM != "" {
+		tags = append(tags, rpmTestTag{rpmTagSourceRPM, 6, sourceRPM})
+	}
+
+	var buf bytes.Buffer
+	buf.Write(lead)
+	sig := buildRPMHeader([]rpmTestTag{{rpmSigTagPayloadSize, 4, []int32{4096}}})
+	buf.Write(sig)
+	buf.Write(make([]byte, (8-len(sig)%8)%8))
+	buf.Write(buildRPMHeader(tags))
+	buf.WriteString("payload")
+	return buf.Bytes()
+}
+
+type rpmTestTag struct {
+	tag   uint32
+	typ   uint32
+	value interface{}
+}
+
+func buildRPMHeader(tags []rpmTestTag) []byte {
+	var index, store bytes.Buffer
+	align := func(n int) {
+		for store.Len()%n != 0 {
+			store.WriteByte(0)
+		}
+	}
+	for _, tg := range tags {
+		var offset, count int
+		switch v := tg.value.(type) {
+		case string:
+			offset, count = store.Len(), 1
+			store.WriteString(v + "\x00")
+		case []string:
+			offset, count = store.Len(), len(v)
+			for _, s := range v {
+				store.WriteString(s + "\x00")
+			}
+		case []int32:
+			align(4)
+			offset, count = store.Len(), len(v)
+			_ = binary.Write(&store, binary.BigEndian, v)
+		case []uint16:
+			align(2)
+			offset, count = store.Len(), len(v)
+			_ = binary.Write(&store, binary.BigEndian, v)
+		}
+		_ = binary.Write(&index, binary.BigEndian, []uint32{tg.tag, tg.typ, uint32(offset), uint32(count)})
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	_ = binary.Write(&buf, binary.BigEndian, []uint32{uint32(len(tags)), uint32(store.Len())})
+	buf.Write(index.Bytes())
+	buf.Write(store.Bytes())
+	return buf.Bytes()
+}
+
+func TestAPKArtifact(t *testing.T) {
+	apk := &APKArtifact{}
+	pkginfo := "# Generated by abuild\npkgname = hello\npkgver = 2.10-r3\npkgdesc = greeting tool\nurl = https://example.com\nbuilddate = 1700000000\nsize = 4096\narch = x86_64\norigin = hello-src\nlicense = MIT\ndepend = so:libc.musl-x86_64.so.1\ndepend = busybox\nprovides = cmd:hello=2.10-r3\n"
+
+	t.Run("ReadAPKPackage", func(t *testing.T) {
+		for _, signed := range []bool{false, true} {
+			content, control := buildAPK(t, pkginfo, signed)
+			pkg, err := ReadAPKPackage(bytes.NewReader(content))
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", pkg.Name)
+			assert.Equal(t, "2.10-r3", pkg.Version)
+			assert.Equal(t, "x86_64", pkg.Arch)
+			assert.Equal(t, "hello-src", pkg.Origin)
+			assert.Equal(t, int64(4096), pkg.InstalledSize)
+			assert.Equal(t, []string{"so:libc.musl-x86_64.so.1", "busybox"}, pkg.Depends)
+			assert.Equal(t, "hello-2.10-r3.apk", pkg.Filename())
+
+			sum := sha1.Sum(control)
+			assert.Equal(t, "Q1"+base64.StdEncoding.EncodeToString(sum[:]), pkg.Checksum, "checksum covers the control segment only")
+		}
+	})
+
+	t.Run("ValidateArtifact", func(t *testing.T) {
+		assert.Error(t, apk.ValidateArtifact(strings.NewReader("not an apk")))
+		content, _ := buildAPK(t, "pkgname = x\narch = x86_64\n", false)
+		assert.Error(t, apk.ValidateArtifact(bytes.NewReader(content)))
+	})
+
+	t.Run("ParsePath", func(t *testing.T) {
+		info, err := apk.ParsePath("v3.19/main/x86_64/hello-world-2.10-r3.apk")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello-world", info.Name)
+		assert.Equal(t, "2.10-r3", info.Version)
+		assert.Equal(t, "main", info.Metadata["repo"])
+		_, err = apk.ParsePath("v3.19/main/x86_64/APKINDEX.tar.gz")
+		assert.Error(t, err)
+	})
+
+	t.Run("Metadata round trip", func(t *testing.T) {
+		content, _ := buildAPK(t, pkginfo, false)
+		pkg, err := ReadAPKPackage(bytes.NewReader(content))
+		assert.NoError(t, err)
+		restored, err := APKPackageFromMetadata(pkg.Metadata())
+		assert.NoError(t, err)
+		assert.Equal(t, pkg, restored)
+	})
+
+	t.Run("BuildAPKIndex signs the index segment", func(t *testing.T) {
+		content, _ := buildAPK(t, pkginfo, false)
+		pkg, _ := ReadAPKPackage(bytes.NewReader(content))
+		pkg.Size = int64(len(content))
+
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		key := &APKSigningKey{Name: "ganje.rsa.pub", Key: rsaKey}
+		index, err := BuildAPKIndex([]*APKPackage{pkg}, "ganje v3.19/main", key, time.Unix(1700000000, 0))
+		assert.NoError(t, err)
+
+		// First gzip stream: signature; second: DESCRIPTION and APKINDEX
+		r := bytes.NewReader(index)
+		gz, err := gzip.NewReader(r)
+		assert.NoError(t, err)
+		gz.Multistream(false)
+		tr := tar.NewReader(gz)
+		hdr, err := tr.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, ".SIGN.RSA.ganje.rsa.pub", hdr.Name)
+		signature, _ := io.ReadAll(tr)
+		_, _ = io.Copy(io.Discard, gz)
+
+		rest := index[len(index)-r.Len():]
+		digest := sha1.Sum(rest)
+		assert.NoError(t, rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA1, digest[:], signature))
+
+		gz, err = gzip.NewReader(bytes.NewReader(rest))
+		assert.NoError(t, err)
+		files := map[string]string{}
+		tr = tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			data, _ := io.ReadAll(tr)
+			files[hdr.Name] = string(data)
+		}
+		assert.Equal(t, "ganje v3.19/main", files["DESCRIPTION"])
+		assert.Equal(t, "C:"+pkg.Checksum+"\nP:hello\nV:2.10-r3\nA:x86_64\nS:"+fmt.Sprint(len(content))+"\nI:4096\nT:greeting tool\nU:https://example.com\nL:MIT\no:hello-src\nt:1700000000\nD:so:libc.musl-x86_64.so.1 busybox\np:cmd:hello=2.10-r3\n\n", files["APKINDEX"])
+
+		pub, err := key.PublicKeyPEM()
+		assert.NoError(t, err)
+		assert.Contains(t, string(pub), "BEGIN PUBLIC KEY")
+		der := x509.MarshalPKCS1PrivateKey(rsaKey)
+		parsed, err := ParseAPKSigningKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}), "k.rsa.pub")
+		assert.NoError(t, err)
+		assert.True(t, parsed.Key.Equal(rsaKey))
+	})
+}
+
+// buildAPK assembles an .apk from gzip segments and returns it with its control segment
+func buildAPK(t *testing.T, pkginfo string, signed bool) ([]byte, []byte) {
+	t.Helper()
+	segment := func(name, content string, terminate bool) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = tw.Write([]byte(content))
+		if terminate {
+			_ = tw.Close()
+		} else {
+			_ = tw.Flush()
+		}
+		_ = gz.Close()
+		return buf.Bytes()
+	}
+
+	var apk bytes.Buffer
+	if signed {
+		apk.Write(segment(".SIGN.RSA.builder.rsa.pub", "signature", false))
+	}
+	control := segment(".PKGINFO", pkginfo, false)
+	apk.Write(control)
+	apk.Write(segment("usr/bin/hello", "#!/bin/sh\necho hello\n", true))
+	return apk.Bytes(), control
+}
+
+// condaTarBz2Fixture is hello-1.0.2-h7f98852_0.tar.bz2 holding only info/index.json; the
+// standard library cannot write bzip2 so it was produced with Python's tarfile and bz2 modules
+const condaTarBz2Fixture = "QlpoOTFBWSZTWboR9MAAAL3fgMyAUAf/8wIiJAr/999KCAgwANqtiKeg0p6nqaPKAGg0Ghso9TQeiBqmIyNTTIwjExGmEwIwmIEoiTBNPSNAAAMgaGgZLKZBgIFbwgIS1TQixwvoCCoZByKKoqCtUHiSabLUObCA+mxH38vT3GmB4zAGfWCYGANDrMdKuiczEIlO1q53gSlgUKsbrUCwT755VoLS8nUObct6GzX+dUwhDIyKDRQfY7mVUgKVvWSA4dz1qBK5DWvU9mJVxHqW0SUwMjkD6fVQ3wnbcCQPaHWdjkuCDIJSWowY8NGL0OulYxUslwurelikImMxENajz5AyxdIiB/F3JFOFCQuhH0wA"
+
+func TestCondaArtifact(t *testing.T) {
+	conda := &CondaArtifact{}
+	index := `{"name":"numpy","version":"1.26.4","build":"py312h_0","build_number":0,"subdir":"linux-64","depends":["python >=3.12,<3.13"],"timestamp":1700000000000}`
+
+	t.Run("ReadCondaPackage .conda", func(t *testing.T) {
+		content := buildConda(t, index)
+		pkg, err := ReadCondaPackage(bytes.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+		assert.Equal(t, "numpy", pkg.Name)
+		assert.Equal(t, "1.26.4", pkg.Version)
+		assert.Equal(t, "py312h_0", pkg.Build)
+		assert.Equal(t, "linux-64", pkg.Subdir)
+		assert.Equal(t, "numpy-1.26.4-py312h_0.conda", pkg.Filename())
+	})
+
+	t.Run("ReadCondaPackage .tar.bz2", func(t *testing.T) {
+		content, err := base64.StdEncoding.DecodeString(condaTarBz2Fixture)
+		assert.NoError(t, err)
+		pkg, err := ReadCondaPackage(bytes.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+		assert.Equal(t, "hello-1.0.2-h7f98852_0.tar.bz2", pkg.Filename())
+		assert.Equal(t, CondaFormatTarBz2, pkg.Format)
+	})
+
+	t.Run("ValidateArtifact", func(t *testing.T) {
+		assert.Error(t, conda.ValidateArtifact(strings.NewReader("not a package")))
+		assert.Error(t, conda.ValidateArtifact(bytes.NewReader(buildConda(t, `{"name":"numpy","version":"1.0","build":"0","subdir":"../etc"}`))))
+		assert.Error(t, conda.ValidateArtifact(bytes.NewReader(buildConda(t, `{"name":"numpy","version":"1-0","build":"0","subdir":"noarch"}`))))
+		assert.NoError(t, conda.ValidateArtifact(bytes.NewReader(buildConda(t, index))))
+	})
+
+	t.Run("ParsePath", func(t *testing.T) {
+		info, err := conda.ParsePath("linux-64/numpy-1.26.4-py312h_0.conda")
+		assert.NoError(t, err)
+		assert.Equal(t, "numpy", info.Name)
+		assert.Equal(t, "1.26.4", info.Version)
+		assert.Equal(t, "py312h_0", info.Metadata["build"])
+		assert.Equal(t, "linux-64/numpy-1.26.4-py312h_0.conda", conda.GeneratePath(info))
+		_, err = conda.ParsePath("linux-64/repodata.json")
+		assert.Error(t, err)
+	})
+
+	t.Run("GenerateCondaRepodata", func(t *testing.T) {
+		content := buildConda(t, index)
+		pkg, _ := ReadCondaPackage(bytes.NewReader(content), int64(len(content)))
+		pkg.MD5, pkg.SHA256, pkg.Size = "m", "s", int64(len(content))
+		older, _ := CondaPackageFromMetadata(pkg.Metadata())
+		older.Version = "1.9.0"
+		older.Index = []byte(`{"name":"numpy","version":"1.9.0","build":"py312h_0","subdir":"linux-64"}`)
+		older.Format = CondaFormatTarBz2
+
+		var repodata struct {
+			Info          map[string]string                 `json:"info"`
+			Packages      map[string]map[string]interface{} `json:"packages"`
+			PackagesConda map[string]map[string]interface{} `json:"packages.conda"`
+		}
+		data, err := GenerateCondaRepodata("linux-64", []*CondaPackage{pkg, older}, false)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(data, &repodata))
+		assert.Equal(t, "linux-64", repodata.Info["subdir"])
+		entry := repodata.PackagesConda["numpy-1.26.4-py312h_0.conda"]
+		assert.Equal(t, "s", entry["sha256"])
+		assert.Equal(t, float64(len(content)), entry["size"])
+		assert.Equal(t, []interface{}{"python >=3.12,<3.13"}, entry["depends"], "index.json fields are kept")
+		assert.Contains(t, repodata.Packages, "numpy-1.9.0-py312h_0.tar.bz2")
+
+		// 1.26.4 is newer than 1.9.0
+		data, err = GenerateCondaRepodata("linux-64", []*CondaPackage{pkg, older}, true)
+		assert.NoError(t, err)
+		repodata.Packages, repodata.PackagesConda = nil, nil
+		assert.NoError(t, json.Unmarshal(data, &repodata))
+		assert.Empty(t, repodata.Packages)
+		assert.Len(t, repodata.PackagesConda, 1)
+	})
+}
+
+// buildConda returns a .conda archive whose info-*.tar.zst member holds index
+func buildConda(t *testing.T, index string) []byte {
+	t.Helper()
+	var info bytes.Buffer
+	zw, err := zstd.NewWriter(&info)
+	assert.NoError(t, err)
+	tw := tar.NewWriter(zw)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "info/index.json", Mode: 0644, Size: int64(len(index))}))
+	_, _ = tw.Write([]byte(index))
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, zw.Close())
+
+	var pkg bytes.Buffer
+	archive := zip.NewWriter(&pkg)
+	for name, content := range map[string][]byte{
+		"metadata.json":    []byte(`{"conda_pkg_format_version": 2}`),
+		"info-pkg.tar.zst": info.Bytes(),
+		"pkg-pkg.tar.zst":  {},
+	} {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		assert.NoError(t, err)
+		_, _ = w.Write(content)
+	}
+	assert.NoError(t, archive.Close())
+	return pkg.Bytes()
+}
+
+func TestComposerArtifact(t *testing.T) {
+	composer := &ComposerArtifact{}
+
+	t.Run("NormalizeComposerVersion", func(t *testing.T) {
+		for version, expected := range map[string]string{
+			"1.2.3":     "1.2.3.0",
+			"v1.2":      "1.2.0.0",
+			"2.0.0-rc1": "2.0.0.0-RC1",
+			"1.0.0-b2":  "1.0.0.0-beta2",
+			"1.0-dev":   "1.0.0.0-dev",
+			"1.x-dev":   "1.9999999.9999999.9999999-dev",
+			"dev-main":  "dev-main",
+		} {
+			normalized, err := NormalizeComposerVersion(version)
+			assert.NoError(t, err, version)
+			assert.Equal(t, expected, normalized, version)
+		}
+		_, err := NormalizeComposerVersion("latest")
+		assert.Error(t, err)
+	})
+
+	t.Run("ReadComposerPackage", func(t *testing.T) {
+		content := buildComposerZip(t, "acme-logger-1a2b3c/", `{"name":"acme/logger","description":"PSR-3 logger","version":"1.4.0","require":{"php":">=8.1"}}`)
+		pkg, err := ReadComposerPackage(bytes.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/logger", pkg.Name)
+		assert.Equal(t, "1.4.0", pkg.Version)
+		assert.Equal(t, "1.4.0.0", pkg.VersionNormalized)
+		assert.Equal(t, "dists/acme/logger/1.4.0/acme-logger-1.4.0.zip", ComposerDistPath(pkg.Name, pkg.Version))
+
+		content = buildComposerZip(t, "", `{"name":"acme/logger"}`)
+		pkg, err = ReadComposerPackage(bytes.NewReader(content), int64(len(content)))
+		assert.NoError(t, err)
+		assert.Empty(t, pkg.Version, "the version may be supplied at upload time")
+	})
+
+	t.Run("ValidateArtifact", func(t *testing.T) {
+		assert.Error(t, composer.ValidateArtifact(strings.NewReader("not a zip")))
+		assert.Error(t, composer.ValidateArtifact(bytes.NewReader(buildComposerZip(t, "", `{"name":"Acme/Logger"}`))))
+		assert.Error(t, composer.ValidateArtifact(bytes.NewReader(buildComposerZip(t, "a/b/", `{"name":"acme/logger"}`))), "composer.json must be at most one directory deep")
+		assert.NoError(t, composer.ValidateArtifact(bytes.NewReader(buildComposerZip(t, "", `{"name":"acme/logger"}`))))
+	})
+
+	t.Run("ParsePath", func(t *testing.T) {
+		info, err := composer.ParsePath("dists/acme/logger/1.4.0/acme-logger-1.4.0.zip")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/logger", info.Name)
+		assert.Equal(t, "1.4.0", info.Version)
+		assert.Equal(t, info.Path, composer.GeneratePath(info))
+	})
+
+	t.Run("GenerateComposerMetadata", func(t *testing.T) {
+		var pkgs []*ComposerPackage
+		for _, v := range []string{"1.0.0", "1.10.0", "1.2.0-beta1"} {
+			pkg := &ComposerPackage{Name: "acme/logger", Manifest: []byte(`{"name":"acme/logger","require":{"php":">=8.1"}}`), Shasum: "abc"}
+			assert.NoError(t, pkg.SetVersion(v))
+			pkgs = append(pkgs, pkg)
+		}
+		data, err := GenerateComposerMetadata("acme/logger", pkgs, func(p *ComposerPackage) string { return "https://repo/" + p.Version + ".zip" })
+		assert.NoError(t, err)
+
+		var metadata struct {
+			Packages map[string][]struct {
+				Version           string            `json:"version"`
+				VersionNormalized string            `json:"version_normalized"`
+				Require           map[string]string `json:"require"`
+				Dist              map[string]string `json:"dist"`
+			} `json:"packages"`
+		}
+		assert.NoError(t, json.Unmarshal(data, &metadata))
+		versions := metadata.Packages["acme/logger"]
+		if assert.Len(t, versions, 3) {
+			assert.Equal(t, "1.10.0", versions[0].Version)
+			assert.Equal(t, "1.2.0.0-beta1", versions[1].VersionNormalized)
+			assert.Equal(t, ">=8.1", versions[0].Require["php"])
+			assert.Equal(t, map[string]string{"type": "zip", "url": "https://repo/1.10.0.zip", "shasum": "abc"}, versions[0].Dist)
+		}
+	})
+}
+
+// buildComposerZip returns a zip archive holding composer.json under dir and a source file
+func buildComposerZip(t *testing.T, dir, manifest string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		dir + "composer.json":  manifest,
+		dir + "src/Logger.php": "<?php\n",
+	} {
+		w, err := archive.Create(name)
+		assert.NoError(t, err)
+		_, _ = w.Write([]byte(content))
+	}
+	assert.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+const hexMetadataConfig = `{<<"name">>,<<"plug_auth">>}.
+{<<"version">>,<<"1.2.0">>}.
+{<<"app">>,<<"plug_auth">>}.
+{<<"description">>,<<"Authentication \"plugs\"">>}.
+{<<"licenses">>,[<<"MIT">>]}.
+{<<"build_tools">>,[<<"mix">>]}.
+% dependencies
+{<<"requirements">>,
+ [{<<"plug">>,
+   [{<<"app">>,<<"plug">>},
+    {<<"optional">>,false},
+    {<<"requirement">>,<<"~> 1.14">>},
+    {<<"repository">>,<<"hexpm">>}]},
+  {<<"jason">>,
+   [{<<"app">>,<<"jason">>},
+    {<<"optional">>,true},
+    {<<"requirement">>,<<"~> 1.0">>}]}]}.
+`
+
+func TestHexArtifact(t *testing.T) {
+	hexArtifact := &HexArtifact{}
+
+	t.Run("ReadHexTarball", func(t *testing.T) {
+		tarball := buildHexTarball(t, hexMetadataConfig, true)
+		release, err := ReadHexTarball(bytes.NewReader(tarball))
+		assert.NoError(t, err)
+		assert.Equal(t, "plug_auth", release.Name)
+		assert.Equal(t, "1.2.0", release.Version)
+		assert.Equal(t, `Authentication "plugs"`, release.Description)
+		assert.Equal(t, []string{"MIT"}, release.Licenses)
+		assert.Equal(t, []HexRequirement{
+			{Name: "jason", App: "jason", Requirement: "~> 1.0", Optional: true},
+			{Name: "plug", App: "plug", Requirement: "~> 1.14", Repository: "hexpm"},
+		}, release.Requirements)
+
+		outer := sha256.Sum256(tarball)
+		assert.Equal(t, outer[:], release.OuterChecksum)
+
+		restored, err := HexReleaseFromMetadata(release.Metadata())
+		assert.NoError(t, err)
+		assert.Equal(t, release, restored)
+	})
+
+	t.Run("Legacy requirements", func(t *testing.T) {
+		release, err := ParseHexMetadata([]byte(`{<<"name">>,<<"legacy">>}.
+{<<"version">>,<<"0.1.0">>}.
+{<<"requirements">>,[[{<<"name">>,<<"cowboy">>},{<<"app">>,<<"cowboy">>},{<<"optional">>,false},{<<"requirement">>,<<"~> 2.0">>}]]}.`))
+		assert.NoError(t, err)
+		assert.Equal(t, "legacy", release.App, "app defaults to the package name")
+		assert.Equal(t, []HexRequirement{{Name: "cowboy", App: "cowboy", Requirement: "~> 2.0"}}, release.Requirements)
+	})
+
+	t.Run("ValidateArtifact", func(t *testing.T) {
+		assert.NoError(t, hexArtifact.ValidateArtifact(bytes.NewReader(buildHexTarball(t, hexMetadataConfig, false))))
+		assert.Error(t, hexArtifact.ValidateArtifact(strings.NewReader("not a tarball")))
+		assert.Error(t, hexArtifact.ValidateArtifact(bytes.NewReader(buildHexTarball(t, `{<<"name">>,<<"Bad-Name">>}.`, false))))
+
+		tampered := buildHexTarball(t, strings.Replace(hexMetadataConfig, "1.2.0", "1.2.1", 1), true)
+		tampered = bytes.Replace(tampered, []byte("1.2.1"), []byte("1.2.0"), 1)
+		assert.Error(t, hexArtifact.ValidateArtifact(bytes.NewReader(tampered)), "CHECKSUM must match the contents")
+	})
+
+	t.Run("ParsePath", func(t *testing.T) {
+		info, err := hexArtifact.ParsePath("tarballs/plug_auth-1.2.0-rc.1.tar")
+		assert.NoError(t, err)
+		assert.Equal(t, "plug_auth", info.Name)
+		assert.Equal(t, "1.2.0-rc.1", info.Version)
+		assert.Equal(t, info.Path, hexArtifact.GeneratePath(info))
+	})
+
+	t.Run("Signed registry resources", func(t *testing.T) {
+		release, err := ReadHexTarball(bytes.NewReader(buildHexTarball(t, hexMetadataConfig, true)))
+		assert.NoError(t, err)
+		older := *release
+		older.Version = "1.10.0"
+
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		resource, err := SignHexResource(HexPackagePayload("acme", "plug_auth", []*HexRelease{&older, release}), key)
+		assert.NoError(t, err)
+
+		payload := verifyHexResource(t, resource, &key.PublicKey)
+		fields := decodeProtoFields(t, payload)
+		assert.Equal(t, []string{"plug_auth"}, fields[2])
+		assert.Equal(t, []string{"acme"}, fields[3])
+		if assert.Len(t, fields[1], 2) {
+			first := decodeProtoFields(t, []byte(fields[1][0]))
+			assert.Equal(t, []string{"1.2.0"}, first[1], "releases are listed in ascending order")
+			assert.Equal(t, []string{string(release.InnerChecksum)}, first[2])
+			assert.Len(t, first[3], 2)
+			dep := decodeProtoFields(t, []byte(first[3][1]))
+			assert.Equal(t, []string{"plug"}, dep[1])
+			assert.Equal(t, []string{"hexpm"}, dep[5])
+		}
+
+		fields = decodeProtoFields(t, verifyHexResource(t, mustSignHex(t, HexVersionsPayload("acme", map[string][]string{"plug_auth": {"1.10.0", "1.2.0"}}), key), &key.PublicKey))
+		pkg := decodeProtoFields(t, []byte(fields[1][0]))
+		assert.Equal(t, []string{"1.2.0", "1.10.0"}, pkg[2])
+	})
+}
+
+func mustSignHex(t *testing.T, payload []byte, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	resource, err := SignHexResource(payload, key)
+	assert.NoError(t, err)
+	return resource
+}
+
+// verifyHexResource gunzips a Signed message, checks its signature and returns the payload
+func verifyHexResource(t *testing.T, resource []byte, pub *rsa.PublicKey) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(resource))
+	assert.NoError(t, err)
+	signed, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	fields := decodeProtoFields(t, signed)
+	if !assert.Len(t, fields[1], 1) || !assert.Len(t, fields[2], 1) {
+		t.FailNow()
+	}
+	payload := []byte(fields[1][0])
+	digest := sha512.Sum512(payload)
+	assert.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA512, digest[:], []byte(fields[2][0])))
+	return payload
+}
+
+// decodeProtoFields returns the length-delimited fields of a protobuf message by field number
+func decodeProtoFields(t *testing.T, b []byte) map[protowire.Number][]string {
+	t.Helper()
+	fields := map[protowire.Number][]string{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		assert.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			assert.GreaterOrEqual(t, n, 0)
+			fields[num] = append(fields[num], string(v))
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			assert.GreaterOrEqual(t, n, 0)
+			b = b[n:]
+		}
+	}
+	return fields
+}
+
+// buildHexTarball assembles a version 3 package tarball around metadata.config
+func buildHexTarball(t *testing.T, metadata string, withChecksum bool) []byte {
+	t.Helper()
+	var contents bytes.Buffer
+	gz := gzip.NewWriter(&contents)
+	tw := tar.NewWriter(gz)
+	source := "defmodule PlugAuth do\nend\n"
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "lib/plug_auth.ex", Mode: 0644, Size: int64(len(source))}))
+	_, _ = tw.Write([]byte(source))
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+
+	inner := sha256.New()
+	inner.Write([]byte("3"))
+	inner.Write([]byte(metadata))
+	inner.Write(contents.Bytes())
+
+	var buf bytes.Buffer
+	outer := tar.NewWriter(&buf)
+	files := []struct {
+		name string
+		data []byte
+	}{{"VERSION", []byte("3")}}
+	if withChecksum {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{"CHECKSUM", []byte(strings.ToUpper(hex.EncodeToString(inner.Sum(nil))))})
+	}
+	files = append(files, []struct {
+		name string
+		data []byte
+	}{{"metadata.config", []byte(metadata)}, {"contents.tar.gz", contents.Bytes()}}...)
+	for _, f := range files {
+		assert.NoError(t, outer.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))}))
+		_, _ = outer.Write(f.data)
+	}
+	assert.NoError(t, outer.Close())
+	return buf.Bytes()
+}
+
+func TestSwiftArtifact(t *testing.T) {
+	swiftArtifact := &SwiftArtifact{}
+
+	t.Run("Paths", func(t *testing.T) {
+		assert.Equal(t, "mona/linkedlist/1.1.1.zip", SwiftArchivePath("mona", "LinkedList", "1.1.1"))
+		info, err := swiftArtifact.ParsePath("mona/linkedlist/1.1.1.zip")
+		assert.NoError(t, err)
+		assert.Equal(t, "mona.linkedlist", info.Name)
+		assert.Equal(t, "1.1.1", info.Version)
+		assert.Error(t, swiftArtifact.ValidatePath("Mona/LinkedList/1.1.1.zip"))
+
+		assert.True(t, ValidSwiftScope("mona-labs"))
+		assert.False(t, ValidSwiftScope("-mona"))
+		assert.True(t, ValidSwiftName("Linked_List"))
+		assert.True(t, ValidSwiftVersion("2.0.0-beta.1+build.5"))
+		assert.False(t, ValidSwiftVersion("2.0"))
+	})
+
+	t.Run("ReadSwiftSourceArchive", func(t *testing.T) {
+		archive := buildSwiftArchive(t, "LinkedList/", map[string]string{
+			"Package.swift":           "// swift-tools-version:5.0\n",
+			"Package@swift-5.7.swift": "// swift-tools-version:5.7\n",
+			"Sources/Package.swift":   "// not a manifest\n",
+		})
+		manifests, err := ReadSwiftSourceArchive(bytes.NewReader(archive), int64(len(archive)))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"Package.swift":           "// swift-tools-version:5.0\n",
+			"Package@swift-5.7.swift": "// swift-tools-version:5.7\n",
+		}, manifests)
+
+		assert.Equal(t, "Package@swift-5.7.swift", SwiftManifestFor(manifests, "5.7.1"))
+		assert.Equal(t, "", SwiftManifestFor(manifests, "5.8"))
+
+		noManifest := buildSwiftArchive(t, "", map[string]string{"README.md": "# LinkedList\n"})
+		_, err = ReadSwiftSourceArchive(bytes.NewReader(noManifest), int64(len(noManifest)))
+		assert.Error(t, err)
+	})
+
+	t.Run("NormalizeSwiftRepositoryURL", func(t *testing.T) {
+		for _, u := range []string{
+			"https://github.com/mona/LinkedList",
+			"https://github.com/mona/LinkedList.git",
+			"git@github.com:mona/LinkedList.git",
+			"ssh://git@github.com/mona/LinkedList/",
+		} {
+			assert.Equal(t, "github.com/mona/linkedlist", NormalizeSwiftRepositoryURL(u), u)
+		}
+	})
+
+	t.Run("Release properties", func(t *testing.T) {
+		urls, err := ParseSwiftReleaseMetadata([]byte(`{"repositoryURLs":["https://github.com/mona/LinkedList"]}`))
+		assert.NoError(t, err)
+		release := &SwiftRelease{
+			Scope:          "mona",
+			Name:           "LinkedList",
+			Version:        "1.1.1",
+			Checksum:       "abc",
+			Manifests:      map[string]string{"Package.swift": "// swift-tools-version:5.0\n"},
+			Metadata:       json.RawMessage(`{"repositoryURLs":["https://github.com/mona/LinkedList"]}`),
+			RepositoryURLs: urls,
+			PublishedAt:    "2026-01-01T00:00:00Z",
+		}
+		restored, err := SwiftReleaseFromProperties(release.Properties())
+		assert.NoError(t, err)
+		assert.Equal(t, release, restored)
+		assert.Equal(t, "mona.LinkedList", restored.ID())
+	})
+}
+
+func buildSwiftArchive(t *testing.T, dir string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(dir + name)
+		assert.NoError(t, err)
+		_, _ = w.Write([]byte(content))
+	}
+	assert.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestConanArtifact(t *testing.T) {
+	conanArtifact := &ConanArtifact{}
+
+	t.Run("References", func(t *testing.T) {
+		ref, err := ParseConanReference("zlib/1.3.1@acme/stable")
+		assert.NoError(t, err)
+		assert.Equal(t, "zlib/1.3.1/acme/stable", ref.Path())
+		assert.Equal(t, "zlib/1.3.1@acme/stable", ref.String())
+
+		ref = NewConanReference("zlib", "1.3.1", "_", "_")
+		assert.Equal(t, "zlib/1.3.1", ref.String())
+		assert.Equal(t, "zlib/1.3.1/_/_", ref.Path())
+
+		_, err = ParseConanReference("zlib@acme/stable")
+		assert.Error(t, err)
+		_, err = ParseConanReference("zlib/1.3.1@acme")
+		assert.Error(t, err)
+	})
+
+	t.Run("Paths", func(t *testing.T) {
+		info, err := conanArtifact.ParsePath("zlib/1.3.1/_/_/f1a2/package/9e18/b3c4/conan_package.tgz")
+		assert.NoError(t, err)
+		assert.Equal(t, "zlib", info.Name)
+		assert.Equal(t, "zlib/1.3.1", info.Metadata["reference"])
+		assert.Equal(t, "9e18", info.Metadata["package_id"])
+		assert.Equal(t, "b3c4", info.Metadata["package_revision"])
+		assert.Equal(t, info.Path, conanArtifact.GeneratePath(info))
+
+		info, err = conanArtifact.ParsePath("zlib/1.3.1/acme/stable/f1a2/export/conanfile.py")
+		assert.NoError(t, err)
+		assert.Equal(t, "zlib/1.3.1@acme/stable", info.Metadata["reference"])
+		assert.Equal(t, info.Path, conanArtifact.GeneratePath(info))
+
+		assert.Error(t, conanArtifact.ValidatePath("zlib/1.3.1/_/_/f1a2/conanfile.py"))
+		assert.Error(t, conanArtifact.ValidatePath("zlib/1.3.1/_/_/f1-a2/export/conanfile.py"))
+	})
+
+	t.Run("ParseConanInfo", func(t *testing.T) {
+		info, err := ParseConanInfo([]byte(`[settings]
+arch=x86_64
+build_type=Release
+os=Linux
+
+[options]
+shared=False
+
+[requires]
+bzip2/1.0.Z
+`))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"arch": "x86_64", "build_type": "Release", "os": "Linux"}, info.Settings)
+		assert.Equal(t, map[string]string{"shared": "False"}, info.Options)
+		assert.Equal(t, []string{"bzip2/1.0.Z"}, info.Requires)
+	})
+
+	t.Run("MatchConanPattern", func(t *testing.T) {
+		assert.True(t, MatchConanPattern("zlib*", "zlib/1.3.1", false))
+		assert.True(t, MatchConanPattern("ZLIB/*", "zlib/1.3.1@acme/stable", true))
+		assert.False(t, MatchConanPattern("ZLIB/*", "zlib/1.3.1", false))
+		assert.False(t, MatchConanPattern("zlib", "zlib/1.3.1", true))
+		assert.True(t, MatchConanPattern("zlib/1.?.1", "zlib/1.3.1", false))
+	})
+}
+
+func TestLFSArtifact(t *testing.T) {
+	content := []byte("large binary asset")
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	lfsArtifact := &LFSArtifact{metadata: &artifact.Metadata{Name: oid}}
+
+	assert.Equal(t, oid[:2]+"/"+oid[2:4]+"/"+oid, lfsArtifact.GetPath())
+	info, err := lfsArtifact.ParsePath(lfsArtifact.GetPath())
+	assert.NoError(t, err)
+	assert.Equal(t, oid, info.Name)
+	assert.Error(t, lfsArtifact.ValidatePath("00/00/"+oid), "shards must match the OID")
+
+	assert.True(t, ValidLFSOID(oid))
+	assert.False(t, ValidLFSOID(strings.ToUpper(oid)))
+	assert.NoError(t, lfsArtifact.ValidateArtifact(bytes.NewReader(content)))
+	assert.Error(t, lfsArtifact.ValidateArtifact(strings.NewReader("tampered")))
+}
+
+func buildPubArchive(t *testing.T, pubspec string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range map[string]string{"pubspec.yaml": pubspec, "lib/hello.dart": "void main() {}\n"} {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}))
+		_, err := tw.Write([]byte(body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestPubArtifact(t *testing.T) {
+	pubArtifact := &PubArtifact{metadata: &artifact.Metadata{Name: "hello", Version: "1.2.0"}}
+	assert.Equal(t, "packages/hello/versions/1.2.0.tar.gz", pubArtifact.GetPath())
+	info, err := pubArtifact.ParsePath("packages/hello/versions/2.0.0-dev.1.tar.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "2.0.0-dev.1", info.Version)
+	assert.Error(t, pubArtifact.ValidatePath("packages/Hello/versions/1.0.0.tar.gz"))
+
+	pkg, err := ReadPubArchive(bytes.NewReader(buildPubArchive(t, "name: hello\nversion: 1.2.0\ndescription: Says hello\nenvironment:\n  sdk: '>=3.0.0 <4.0.0'\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", pkg.Name)
+	assert.JSONEq(t, `{"name":"hello","version":"1.2.0","description":"Says hello","environment":{"sdk":">=3.0.0 <4.0.0"}}`, string(pkg.Pubspec))
+	_, err = ReadPubArchive(bytes.NewReader(buildPubArchive(t, "name: hello\n")))
+	assert.Error(t, err, "a version is required")
+	assert.Error(t, pubArtifact.ValidateArtifact(strings.NewReader("not gzip")))
+
+	restored, err := PubPackageFromProperties(pkg.Properties())
+	assert.NoError(t, err)
+	assert.Equal(t, pkg.Pubspec, restored.Pubspec)
+
+	versions := []*PubPackage{
+		{Name: "hello", Version: "2.0.0-dev.1", Pubspec: json.RawMessage(`{}`), SHA256: "b"},
+		{Name: "hello", Version: "1.2.0", Pubspec: json.RawMessage(`{}`), SHA256: "a"},
+		{Name: "hello", Version: "1.10.0", Pubspec: json.RawMessage(`{}`), SHA256: "c"},
+	}
+	listing, err := GeneratePubListing("hello", versions, func(p *PubPackage) string { return "https://pub.example/" + p.Version })
+	assert.NoError(t, err)
+	var resp struct {
+		Latest struct {
+			Version    string
+			ArchiveURL string `json:"archive_url"`
+		}
+		Versions []struct{ Version string }
+	}
+	assert.NoError(t, json.Unmarshal(listing, &resp))
+	assert.Equal(t, "1.10.0", resp.Latest.Version, "pre-releases are not latest while a stable version exists")
+	assert.Equal(t, "https://pub.example/1.10.0", resp.Latest.ArchiveURL)
+	if assert.Len(t, resp.Versions, 3) {
+		assert.Equal(t, []string{"1.2.0", "1.10.0", "2.0.0-dev.1"}, []string{resp.Versions[0].Version, resp.Versions[1].Version, resp.Versions[2].Version})
+	}
+}
+
+func buildVagrantBox(t *testing.T, metadata string, compress bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	gz := gzip.NewWriter(&buf)
+	if compress {
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, file := range []struct{ name, body string }{{"box.ovf", "<ovf/>"}, {"metadata.json", metadata}} {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "./" + file.name, Mode: 0644, Size: int64(len(file.body))}))
+		_, _ = tw.Write([]byte(file.body))
+	}
+	assert.NoError(t, tw.Close())
+	if compress {
+		assert.NoError(t, gz.Close())
+	}
+	return buf.Bytes()
+}
+
+func TestVagrantArtifact(t *testing.T) {
+	vagrantArtifact := &VagrantArtifact{metadata: &artifact.Metadata{Name: "infra/ubuntu-24.04", Version: "1.2.0", Properties: map[string]string{"provider": "virtualbox"}}}
+	assert.Equal(t, "infra/ubuntu-24.04/1.2.0/virtualbox.box", vagrantArtifact.GetPath())
+	info, err := vagrantArtifact.ParsePath("infra/ubuntu-24.04/1.2/libvirt.box")
+	assert.NoError(t, err)
+	assert.Equal(t, "infra/ubuntu-24.04", info.Name)
+	assert.Equal(t, "libvirt", info.Metadata["provider"])
+	assert.Error(t, vagrantArtifact.ValidatePath("infra/ubuntu/1.2.0-beta/virtualbox.box"))
+
+	for _, compress := range []bool{false, true} {
+		assert.NoError(t, vagrantArtifact.ValidateArtifact(bytes.NewReader(buildVagrantBox(t, `{"provider":"virtualbox"}`, compress))))
+	}
+	assert.Error(t, vagrantArtifact.ValidateArtifact(bytes.NewReader(buildVagrantBox(t, `{"provider":"libvirt"}`, true))))
+	assert.Error(t, vagrantArtifact.ValidateArtifact(strings.NewReader("not a box")))
+
+	boxes := []*VagrantBox{
+		{Name: "infra/ubuntu", Version: "1.2.0", Provider: "virtualbox", SHA256: "aa", Description: "Old"},
+		{Name: "infra/ubuntu", Version: "1.10.0", Provider: "virtualbox", SHA256: "bb", Description: "Ubuntu base box"},
+		{Name: "infra/ubuntu", Version: "1.10.0", Provider: "libvirt", SHA256: "cc"},
+	}
+	metadata, err := GenerateVagrantMetadata("infra/ubuntu", boxes, func(b *VagrantBox) string {
+		return "https://boxes.example/" + VagrantBoxPath(b.Name, b.Version, b.Provider)
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"name": "infra/ubuntu",
+		"description": "Ubuntu base box",
+		"versions": [
+			{"version": "1.10.0", "status": "active", "providers": [
+				{"name": "libvirt", "url": "https://boxes.example/infra/ubuntu/1.10.0/libvirt.box", "checksum_type": "sha256", "checksum": "cc"},
+				{"name": "virtualbox", "url": "https://boxes.example/infra/ubuntu/1.10.0/virtualbox.box", "checksum_type": "sha256", "checksum": "bb"}
+			]},
+			{"version": "1.2.0", "status": "active", "providers": [
+				{"name": "virtualbox", "url": "https://boxes.example/infra/ubuntu/1.2.0/virtualbox.box", "checksum_type": "sha256", "checksum": "aa"}
+			]}
+		]
+	}`, string(metadata))
+}
+
+func TestCocoaPodsArtifact(t *testing.T) {
+	assert.Equal(t, "d_a_2", CocoaPodsShard("Alamofire"))
+	assert.Equal(t, "Specs/d/a/2/Alamofire/5.9.1/Alamofire.podspec.json", CocoaPodsSpecPath("Alamofire", "5.9.1"))
+	podsArtifact := &CocoaPodsArtifact{metadata: &artifact.Metadata{Name: "Alamofire", Version: "5.9.1"}}
+	assert.Equal(t, "all_pods_versions_d_a_2.txt", podsArtifact.GetIndexPath())
+	info, err := podsArtifact.ParsePath(podsArtifact.GetPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "Alamofire", info.Name)
+	assert.Error(t, podsArtifact.ValidatePath("Specs/0/0/0/Alamofire/5.9.1/Alamofire.podspec.json"), "the shard must match the name")
+
+	shard, ok := CocoaPodsShardFromFile("all_pods_versions_d_a_2.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "d_a_2", shard)
+	assert.True(t, IsCocoaPodsIndexFile(CocoaPodsDeprecatedFile))
+	assert.False(t, IsCocoaPodsIndexFile(CocoaPodsVersionFile))
+
+	spec, err := ParsePodspec([]byte(`{"name":"Legacy","version":"1.0.0","deprecated_in_favor_of":"Modern"}`))
+	assert.NoError(t, err)
+	assert.True(t, spec.Deprecated)
+	_, err = ParsePodspec([]byte(`{"name":"Legacy"}`))
+	assert.Error(t, err)
+
+	rewritten, err := SetPodspecSource([]byte(`{"name":"Legacy","version":"1.0.0","swift_versions":5.0,"source":{"git":"https://example.com/legacy.git"}}`), "https://pods.example/legacy.zip", "abc")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"Legacy","version":"1.0.0","swift_versions":5.0,"source":{"http":"https://pods.example/legacy.zip","sha256":"abc"}}`, string(rewritten))
+
+	specs := []*CocoaPodsSpec{
+		{Name: "Zeta", Version: "1.10.0"},
+		{Name: "Alpha", Version: "2.0.0", Deprecated: true},
+		{Name: "Zeta", Version: "1.2.0"},
+	}
+	assert.Equal(t, "Alpha/2.0.0\nZeta/1.2.0/1.10.0\n", string(BuildCocoaPodsShard(specs)))
+	assert.Equal(t, "Alpha\nZeta\n", string(BuildCocoaPodsAllPods(specs)))
+	assert.Equal(t, CocoaPodsSpecPath("Alpha", "2.0.0")+"\n", string(BuildCocoaPodsDeprecated(specs)))
+}
+
+func TestHuggingFaceArtifact(t *testing.T) {
+	hfArtifact := &HuggingFaceArtifact{metadata: &artifact.Metadata{Name: "acme/bert", Version: "main", Properties: map[string]string{"file": "onnx/model.onnx"}}}
+	assert.Equal(t, "acme/bert/resolve/main/onnx/model.onnx", hfArtifact.GetPath())
+	assert.Equal(t, "api/models/acme/bert/revision/main", hfArtifact.GetIndexPath())
+	info, err := hfArtifact.ParsePath(hfArtifact.GetPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/bert", info.Name)
+	assert.Equal(t, "onnx/model.onnx", info.Metadata["file"])
+	assert.Error(t, hfArtifact.ValidatePath("acme/bert/resolve/main/../secret"))
+	info, err = hfArtifact.ParsePath("gpt2/resolve/main/config.json")
+	assert.NoError(t, err, "repository ids may have no namespace")
+	assert.Equal(t, "gpt2", info.Name)
+	assert.Equal(t, "config.json", info.Metadata["file"])
+	assert.Error(t, hfArtifact.ValidatePath("acme/nlp/bert/resolve/main/config.json"))
+	assert.True(t, IsHuggingFaceMutablePath("api/models/gpt2/revision/main"))
+
+	assert.True(t, IsHuggingFaceMutablePath("api/models/acme/bert/revision/main"))
+	assert.False(t, IsHuggingFaceMutablePath("api/models/acme/bert/revision/"+strings.Repeat("a", 40)))
+	assert.False(t, IsHuggingFaceMutablePath("acme/bert/resolve/main/config.json"))
+	assert.True(t, IsHuggingFaceLFSFile("model.safetensors", 10))
+	assert.True(t, IsHuggingFaceLFSFile("vocab.txt", HuggingFaceLFSThreshold))
+	assert.False(t, IsHuggingFaceLFSFile("config.json", 100))
+
+	blobID, err := GitBlobID(strings.NewReader("hello\n"), 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "ce013625030ba8dba906f756967f9e9ca394464a", blobID)
+	_, err = GitBlobID(strings.NewReader("hello\n"), 7)
+	assert.Error(t, err)
+
+	weights := &HuggingFaceFile{RepoID: "acme/bert", Revision: "main", Path: "model.safetensors", Size: 42, SHA256: strings.Repeat("b", 64), BlobID: strings.Repeat("c", 40), LFS: true}
+	restored, err := HuggingFaceFileFromProperties(weights.Properties())
+	assert.NoError(t, err)
+	assert.Equal(t, weights, restored)
+	assert.Equal(t, weights.SHA256, weights.ETag())
+
+	config := &HuggingFaceFile{RepoID: "acme/bert", Revision: "main", Path: "config.json", Size: 6, BlobID: blobID}
+	commit := HuggingFaceCommit([]*HuggingFaceFile{weights, config})
+	assert.True(t, IsHuggingFaceCommit(commit))
+	assert.Equal(t, commit, HuggingFaceCommit([]*HuggingFaceFile{config, weights}), "the commit does not depend on file order")
+	assert.NotEqual(t, commit, HuggingFaceCommit([]*HuggingFaceFile{config}))
+
+	data, err := GenerateHuggingFaceRevisionInfo("acme/bert", []*HuggingFaceFile{weights, config}, true)
+	assert.NoError(t, err)
+	var doc struct {
+		ID       string `json:"id"`
+		SHA      string `json:"sha"`
+		Siblings []struct {
+			RFilename string `json:"rfilename"`
+			BlobID    string `json:"blobId"`
+			LFS       *struct {
+				SHA256      string `json:"sha256"`
+				PointerSize int    `json:"pointerSize"`
+			} `json:"lfs"`
+		} `json:"siblings"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "acme/bert", doc.ID)
+	assert.Equal(t, commit, doc.SHA)
+	assert.Len(t, doc.Siblings, 2)
+	assert.Equal(t, "config.json", doc.Siblings[0].RFilename)
+	assert.Nil(t, doc.Siblings[0].LFS)
+	assert.Equal(t, weights.SHA256, doc.Siblings[1].LFS.SHA256)
+	assert.Equal(t, len(HuggingFaceLFSPointer(weights.SHA256, 42)), doc.Siblings[1].LFS.PointerSize)
+
+	data, err = GenerateHuggingFaceRevisionInfo("acme/bert", []*HuggingFaceFile{weights}, false)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "blobId")
 }
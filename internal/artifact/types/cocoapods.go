@@ -0,0 +1,312 @@
+package types
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+)
+
+// CocoaPods CDN sources shard the spec repository by the MD5 of the pod name, with a prefix
+// of one hex digit per level. Clients read the prefix lengths from CocoaPods-version.yml.
+const (
+	// CocoaPodsVersionFile describes the spec repository layout to clients
+	CocoaPodsVersionFile = "CocoaPods-version.yml"
+	// CocoaPodsAllPodsFile lists every pod name
+	CocoaPodsAllPodsFile = "all_pods.txt"
+	// CocoaPodsDeprecatedFile lists the spec paths of deprecated podspecs
+	CocoaPodsDeprecatedFile = "deprecated_podspecs.txt"
+)
+
+// cocoapodsVersionYAML is the content of CocoaPods-version.yml
+const cocoapodsVersionYAML = "---\nmin: 1.0.0\nlast: 1.16.2\nprefix_lengths:\n- 1\n- 1\n- 1\n"
+
+var (
+	cocoapodsNamePattern    = regexp.MustCompile(`^[A-Za-z0-9_+-][A-Za-z0-9_.+-]*$`)
+	cocoapodsVersionPattern = regexp.MustCompile(`^[0-9][0-9A-Za-z.+-]*$`)
+	cocoapodsShardPattern   = regexp.MustCompile(`^all_pods_versions_([0-9a-f])_([0-9a-f])_([0-9a-f])\.txt$`)
+	cocoapodsSpecPattern    = regexp.MustCompile(`^Specs/([0-9a-f])/([0-9a-f])/([0-9a-f])/([^/]+)/([^/]+)/([^/]+)\.podspec\.json$`)
+	cocoapodsSourcePattern  = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+-]*\.(zip|tar\.gz|tgz|tar\.bz2|tbz|tar\.xz|txz)$`)
+)
+
+// CocoaPodsArtifact implements CocoaPods podspec handling
+type CocoaPodsArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewCocoaPodsArtifact creates a new CocoaPods podspec artifact
+func NewCocoaPodsArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &CocoaPodsArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (c *CocoaPodsArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeCocoaPods
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (c *CocoaPodsArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return c.metadata
+}
+
+// GetPath returns the sharded storage path of the podspec
+func (c *CocoaPodsArtifact) GetPath() string {
+	return CocoaPodsSpecPath(c.metadata.Name, c.metadata.Version)
+}
+
+// GetIndexPath returns the shard file listing the pod's versions
+func (c *CocoaPodsArtifact) GetIndexPath() string {
+	return CocoaPodsShardFile(CocoaPodsShard(c.metadata.Name))
+}
+
+// ValidatePath validates a podspec path
+func (c *CocoaPodsArtifact) ValidatePath(p string) error {
+	_, err := c.ParsePath(p)
+	return err
+}
+
+// ParsePath parses a Specs/<a>/<b>/<c>/<pod>/<version>/<pod>.podspec.json path
+func (c *CocoaPodsArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := cocoapodsSpecPattern.FindStringSubmatch(p)
+	if m == nil || m[4] != m[6] || !ValidCocoaPodsName(m[4]) || !ValidCocoaPodsVersion(m[5]) || CocoaPodsSpecPath(m[4], m[5]) != p {
+		return nil, fmt.Errorf("invalid podspec path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:    m[4],
+		Version: m[5],
+		Type:    artifact.ArtifactTypeCocoaPods,
+		Path:    p,
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (c *CocoaPodsArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	return CocoaPodsSpecPath(info.Name, info.Version)
+}
+
+// ValidateArtifact validates that the content is a podspec with a name and version
+func (c *CocoaPodsArtifact) ValidateArtifact(content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	_, err = ParsePodspec(data)
+	return err
+}
+
+// GetMetadata extracts the name, version and deprecation of a podspec
+func (c *CocoaPodsArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := ParsePodspec(data)
+	if err != nil {
+		return nil, err
+	}
+	return spec.Properties(), nil
+}
+
+// GenerateIndex generates the all_pods_versions lines of the given podspecs
+func (c *CocoaPodsArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	var specs []*CocoaPodsSpec
+	for _, info := range artifacts {
+		specs = append(specs, &CocoaPodsSpec{Name: info.Name, Version: info.Version})
+	}
+	return BuildCocoaPodsShard(specs), nil
+}
+
+// GetEndpoints returns CocoaPods CDN source endpoints
+func (c *CocoaPodsArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /CocoaPods-version.yml",
+		"GET /all_pods_versions_{a}_{b}_{c}.txt",
+		"GET /Specs/{a}/{b}/{c}/{pod}/{version}/{pod}.podspec.json",
+		"GET /sources/{pod}/{version}/{file}",
+		"POST /api/pods",
+		"DELETE /api/pods/{pod}/{version}",
+	}
+}
+
+// CocoaPodsVersionYAML returns the content of CocoaPods-version.yml
+func CocoaPodsVersionYAML() []byte {
+	return []byte(cocoapodsVersionYAML)
+}
+
+// CocoaPodsShard returns the shard of a pod, the first three hex digits of the MD5 of its name
+// joined by "_"
+func CocoaPodsShard(name string) string {
+	sum := md5.Sum([]byte(name))
+	digest := hex.EncodeToString(sum[:])
+	return digest[0:1] + "_" + digest[1:2] + "_" + digest[2:3]
+}
+
+// CocoaPodsShardFile returns the path of the file listing the pods of a shard and their versions
+func CocoaPodsShardFile(shard string) string {
+	return "all_pods_versions_" + shard + ".txt"
+}
+
+// CocoaPodsShardFromFile returns the shard listed by an all_pods_versions file
+func CocoaPodsShardFromFile(p string) (string, bool) {
+	m := cocoapodsShardPattern.FindStringSubmatch(p)
+	if m == nil {
+		return "", false
+	}
+	return m[1] + "_" + m[2] + "_" + m[3], true
+}
+
+// IsCocoaPodsIndexFile reports whether p is one of the index files regenerated from the podspecs
+func IsCocoaPodsIndexFile(p string) bool {
+	_, shard := CocoaPodsShardFromFile(p)
+	return shard || p == CocoaPodsAllPodsFile || p == CocoaPodsDeprecatedFile
+}
+
+// CocoaPodsSpecPath returns the sharded path of a podspec
+func CocoaPodsSpecPath(name, version string) string {
+	return fmt.Sprintf("Specs/%s/%s/%s/%s.podspec.json", strings.ReplaceAll(CocoaPodsShard(name), "_", "/"), name, version, name)
+}
+
+// CocoaPodsSourcePath returns the storage path of a source archive hosted next to the podspecs
+func CocoaPodsSourcePath(name, version, file string) string {
+	return fmt.Sprintf("sources/%s/%s/%s", name, version, file)
+}
+
+// ValidCocoaPodsName reports whether name is a valid pod name
+func ValidCocoaPodsName(name string) bool {
+	return cocoapodsNamePattern.MatchString(name)
+}
+
+// ValidCocoaPodsVersion reports whether version is usable as a pod version
+func ValidCocoaPodsVersion(version string) bool {
+	return cocoapodsVersionPattern.MatchString(version)
+}
+
+// ValidCocoaPodsSourceFile reports whether file is a plain archive file name
+func ValidCocoaPodsSourceFile(file string) bool {
+	return cocoapodsSourcePattern.MatchString(file)
+}
+
+// CocoaPodsSpec is an uploaded podspec
+type CocoaPodsSpec struct {
+	Name    string
+	Version string
+	// Deprecated is set when the podspec declares "deprecated" or "deprecated_in_favor_of"
+	Deprecated bool
+}
+
+// Properties returns the properties persisted with an uploaded podspec
+func (s *CocoaPodsSpec) Properties() map[string]string {
+	return map[string]string{
+		"type":       "cocoapods-podspec",
+		"name":       s.Name,
+		"version":    s.Version,
+		"deprecated": fmt.Sprint(s.Deprecated),
+	}
+}
+
+// CocoaPodsSpecFromProperties restores a podspec from the properties returned by Properties.
+// Source archives are stored with other properties and are rejected.
+func CocoaPodsSpecFromProperties(props map[string]string) (*CocoaPodsSpec, error) {
+	if props["type"] != "cocoapods-podspec" || !ValidCocoaPodsName(props["name"]) || !ValidCocoaPodsVersion(props["version"]) {
+		return nil, fmt.Errorf("invalid podspec %s %s", props["name"], props["version"])
+	}
+	return &CocoaPodsSpec{Name: props["name"], Version: props["version"], Deprecated: props["deprecated"] == "true"}, nil
+}
+
+// ParsePodspec validates the name and version of a .podspec.json
+func ParsePodspec(data []byte) (*CocoaPodsSpec, error) {
+	var doc struct {
+		Name                string `json:"name"`
+		Version             string `json:"version"`
+		Deprecated          bool   `json:"deprecated"`
+		DeprecatedInFavorOf string `json:"deprecated_in_favor_of"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid podspec: %w", err)
+	}
+	if !ValidCocoaPodsName(doc.Name) {
+		return nil, fmt.Errorf("invalid pod name %q", doc.Name)
+	}
+	if !ValidCocoaPodsVersion(doc.Version) {
+		return nil, fmt.Errorf("invalid pod version %q", doc.Version)
+	}
+	return &CocoaPodsSpec{Name: doc.Name, Version: doc.Version, Deprecated: doc.Deprecated || doc.DeprecatedInFavorOf != ""}, nil
+}
+
+// SetPodspecSource replaces the source of a podspec with an HTTP archive and its SHA-256.
+// The other attributes are kept, numbers included, though keys are written in sorted order.
+func SetPodspecSource(data []byte, url, sha256 string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid podspec: %w", err)
+	}
+	doc["source"] = map[string]string{"http": url, "sha256": sha256}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// BuildCocoaPodsShard builds an all_pods_versions file: one "<pod>/<version>/<version>..." line per
+// pod, pods sorted by name and versions in ascending order
+func BuildCocoaPodsShard(specs []*CocoaPodsSpec) []byte {
+	versions := map[string][]string{}
+	for _, s := range specs {
+		versions[s.Name] = append(versions[s.Name], s.Version)
+	}
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		vs := versions[name]
+		sort.Slice(vs, func(i, j int) bool { return CompareVersions(vs[i], vs[j]) < 0 })
+		buf.WriteString(name + "/" + strings.Join(vs, "/") + "\n")
+	}
+	return buf.Bytes()
+}
+
+// BuildCocoaPodsAllPods builds all_pods.txt, the sorted pod names
+func BuildCocoaPodsAllPods(specs []*CocoaPodsSpec) []byte {
+	seen := map[string]bool{}
+	var names []string
+	for _, s := range specs {
+		if !seen[s.Name] {
+			seen[s.Name] = true
+			names = append(names, s.Name)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString(name + "\n")
+	}
+	return buf.Bytes()
+}
+
+// BuildCocoaPodsDeprecated builds deprecated_podspecs.txt, the sorted spec paths of deprecated podspecs
+func BuildCocoaPodsDeprecated(specs []*CocoaPodsSpec) []byte {
+	var paths []string
+	for _, s := range specs {
+		if s.Deprecated {
+			paths = append(paths, CocoaPodsSpecPath(s.Name, s.Version))
+		}
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	for _, p := range paths {
+		buf.WriteString(p + "\n")
+	}
+	return buf.Bytes()
+}
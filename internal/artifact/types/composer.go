@@ -0,0 +1,366 @@
+package types
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+)
+
+var (
+	composerNamePattern    = regexp.MustCompile(`^[a-z0-9]([_.-]?[a-z0-9]+)*/[a-z0-9](([_.]|-{1,2})?[a-z0-9]+)*$`)
+	composerVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+	composerPathPattern    = regexp.MustCompile(`^dists/([^/]+)/([^/]+)/([^/]+)/[^/]+\.zip$`)
+
+	// Based on Composer's VersionParser: numeric version, optional stability modifier and dev suffix
+	composerClassicPattern = regexp.MustCompile(`(?i)^v?(\d{1,5})(\.\d+)?(\.\d+)?(\.\d+)?[._-]?(?:(stable|beta|b|rc|alpha|a|patch|pl|p)((?:[.-]?\d+)*)?)?([.-]?dev)?$`)
+	composerBranchPattern  = regexp.MustCompile(`(?i)^v?(\d+)(\.(?:\d+|[x*]))?(\.(?:\d+|[x*]))?(\.(?:\d+|[x*]))?-dev$`)
+)
+
+// ComposerArtifact implements Composer (PHP) package handling
+type ComposerArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewComposerArtifact creates a new Composer artifact
+func NewComposerArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &ComposerArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (c *ComposerArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeComposer
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (c *ComposerArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return c.metadata
+}
+
+// GetPath returns the storage path of the dist archive
+func (c *ComposerArtifact) GetPath() string {
+	return ComposerDistPath(c.metadata.Name, c.metadata.Version)
+}
+
+// GetIndexPath returns the metadata file of the package (/p2/<vendor>/<package>.json)
+func (c *ComposerArtifact) GetIndexPath() string {
+	return "p2/" + c.metadata.Name + ".json"
+}
+
+// ValidatePath validates a dist archive path
+func (c *ComposerArtifact) ValidatePath(p string) error {
+	if !composerPathPattern.MatchString(p) {
+		return fmt.Errorf("invalid Composer dist path: %s", p)
+	}
+	return nil
+}
+
+// ParsePath parses package information from a dists/<vendor>/<package>/<version>/<file>.zip path
+func (c *ComposerArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := composerPathPattern.FindStringSubmatch(p)
+	if m == nil {
+		return nil, fmt.Errorf("invalid Composer dist path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:     m[1] + "/" + m[2],
+		Version:  m[3],
+		Type:     artifact.ArtifactTypeComposer,
+		Path:     p,
+		Metadata: map[string]string{"vendor": m[1]},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (c *ComposerArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	return ComposerDistPath(info.Name, info.Version)
+}
+
+// ValidateArtifact validates that the content is a zip archive with a valid composer.json
+func (c *ComposerArtifact) ValidateArtifact(content io.Reader) error {
+	_, err := c.GetMetadata(content)
+	return err
+}
+
+// GetMetadata extracts metadata from composer.json
+func (c *ComposerArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := ReadComposerPackage(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return pkg.Metadata(), nil
+}
+
+// GenerateIndex generates the /p2 metadata of the given versions, which must share a package name
+func (c *ComposerArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	var pkgs []*ComposerPackage
+	name := ""
+	for _, info := range artifacts {
+		pkg, err := ComposerPackageFromMetadata(info.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", info.Name, err)
+		}
+		name = pkg.Name
+		pkgs = append(pkgs, pkg)
+	}
+	return GenerateComposerMetadata(name, pkgs, func(p *ComposerPackage) string { return ComposerDistPath(p.Name, p.Version) })
+}
+
+// GetEndpoints returns Composer repository endpoints
+func (c *ComposerArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /packages.json",
+		"GET /p2/{vendor}/{package}.json",
+		"GET /p2/{vendor}/{package}~dev.json",
+		"GET /dists/{vendor}/{package}/{version}/{file}.zip",
+		"POST /api/packages",
+	}
+}
+
+// ComposerDistPath returns the storage path of the dist archive of a package version
+func ComposerDistPath(name, version string) string {
+	return fmt.Sprintf("dists/%s/%s/%s.zip", name, version, strings.ReplaceAll(name, "/", "-")+"-"+version)
+}
+
+// ValidComposerName reports whether name is a valid <vendor>/<package> name
+func ValidComposerName(name string) bool {
+	return composerNamePattern.MatchString(name)
+}
+
+// IsComposerDevVersion reports whether version is a branch version, listed in the ~dev metadata file
+func IsComposerDevVersion(version string) bool {
+	return strings.HasPrefix(version, "dev-") || strings.HasSuffix(strings.ToLower(version), "-dev")
+}
+
+// NormalizeComposerVersion returns the version_normalized Composer expects for a version,
+// e.g. "v1.2" becomes "1.2.0.0", "2.0.0-rc1" becomes "2.0.0.0-RC1" and "1.x-dev" becomes
+// "1.9999999.9999999.9999999-dev"
+func NormalizeComposerVersion(version string) (string, error) {
+	v := strings.TrimSpace(version)
+	if strings.HasPrefix(strings.ToLower(v), "dev-") {
+		return "dev-" + v[4:], nil
+	}
+
+	if m := composerClassicPattern.FindStringSubmatch(v); m != nil {
+		parts := []string{m[1]}
+		for _, p := range m[2:5] {
+			if p == "" {
+				p = ".0"
+			}
+			parts = append(parts, strings.TrimPrefix(p, "."))
+		}
+		normalized := strings.Join(parts, ".")
+		if stability := strings.ToLower(m[5]); stability != "" && stability != "stable" {
+			switch stability {
+			case "a":
+				stability = "alpha"
+			case "b":
+				stability = "beta"
+			case "rc":
+				stability = "RC"
+			case "p", "pl":
+				stability = "patch"
+			}
+			normalized += "-" + stability + strings.TrimLeft(m[6], ".-")
+		}
+		if m[7] != "" {
+			normalized += "-dev"
+		}
+		return normalized, nil
+	}
+
+	if m := composerBranchPattern.FindStringSubmatch(v); m != nil {
+		parts := []string{m[1]}
+		for _, p := range m[2:5] {
+			p = strings.TrimPrefix(p, ".")
+			if p == "" || p == "x" || p == "X" || p == "*" {
+				p = "9999999"
+			}
+			parts = append(parts, p)
+		}
+		return strings.Join(parts, ".") + "-dev", nil
+	}
+
+	return "", fmt.Errorf("invalid version string %q", version)
+}
+
+// ComposerPackage is a published version: its composer.json and the dist checksum
+type ComposerPackage struct {
+	Name              string
+	Version           string
+	VersionNormalized string
+	Description       string
+
+	// Manifest is composer.json as found in the archive; metadata entries are built from
+	// it so fields this type does not model (require, autoload, ...) are kept verbatim
+	Manifest json.RawMessage
+
+	// Shasum is the SHA-1 of the dist archive
+	Shasum string
+	// Time is the release time in RFC 3339 format
+	Time string
+}
+
+// Metadata returns the properties persisted with an uploaded version
+func (p *ComposerPackage) Metadata() map[string]string {
+	return map[string]string{
+		"type":               "composer-package",
+		"name":               p.Name,
+		"version":            p.Version,
+		"version_normalized": p.VersionNormalized,
+		"description":        p.Description,
+		"composer_json":      string(p.Manifest),
+		"shasum":             p.Shasum,
+		"time":               p.Time,
+	}
+}
+
+// ComposerPackageFromMetadata restores a version from the properties returned by Metadata
+func ComposerPackageFromMetadata(props map[string]string) (*ComposerPackage, error) {
+	if props["composer_json"] == "" {
+		return nil, fmt.Errorf("missing composer.json")
+	}
+	pkg, err := parseComposerJSON([]byte(props["composer_json"]))
+	if err != nil {
+		return nil, err
+	}
+	if err := pkg.SetVersion(props["version"]); err != nil {
+		return nil, err
+	}
+	pkg.Shasum = props["shasum"]
+	pkg.Time = props["time"]
+	return pkg, nil
+}
+
+// SetVersion sets the version and its normalized form
+func (p *ComposerPackage) SetVersion(version string) error {
+	if !composerVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid version %q", version)
+	}
+	normalized, err := NormalizeComposerVersion(version)
+	if err != nil {
+		return err
+	}
+	p.Version = version
+	p.VersionNormalized = normalized
+	return nil
+}
+
+// ReadComposerPackage reads composer.json from a dist archive. The file may be at the root of
+// the archive or inside a single top-level directory, as in zipballs exported from Git hosts.
+// The version is taken from composer.json when it declares one.
+func ReadComposerPackage(r io.ReaderAt, size int64) (*ComposerPackage, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	var manifest *zip.File
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, "./")
+		if path.Base(name) != "composer.json" || strings.Count(name, "/") > 1 {
+			continue
+		}
+		if manifest == nil || strings.Count(name, "/") < strings.Count(manifest.Name, "/") {
+			manifest = f
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("composer.json not found in archive")
+	}
+
+	rc, err := manifest.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read composer.json: %w", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read composer.json: %w", err)
+	}
+
+	pkg, err := parseComposerJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var declared struct {
+		Version string `json:"version"`
+	}
+	_ = json.Unmarshal(data, &declared)
+	if declared.Version != "" {
+		if err := pkg.SetVersion(declared.Version); err != nil {
+			return nil, err
+		}
+	}
+	return pkg, nil
+}
+
+// parseComposerJSON validates the fields of a composer.json that paths and metadata rely on
+func parseComposerJSON(data []byte) (*ComposerPackage, error) {
+	var manifest struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid composer.json: %w", err)
+	}
+	if !ValidComposerName(manifest.Name) {
+		return nil, fmt.Errorf("invalid package name %q in composer.json", manifest.Name)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, fmt.Errorf("invalid composer.json: %w", err)
+	}
+	return &ComposerPackage{
+		Name:        manifest.Name,
+		Description: manifest.Description,
+		Manifest:    compact.Bytes(),
+	}, nil
+}
+
+// GenerateComposerMetadata renders a /p2/<vendor>/<package>.json file listing the given
+// versions, newest first. distURL returns the download URL of a version.
+func GenerateComposerMetadata(name string, pkgs []*ComposerPackage, distURL func(*ComposerPackage) string) ([]byte, error) {
+	sorted := append([]*ComposerPackage(nil), pkgs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return CompareVersions(sorted[i].VersionNormalized, sorted[j].VersionNormalized) > 0
+	})
+
+	versions := []map[string]interface{}{}
+	for _, p := range sorted {
+		if p.Name != name {
+			continue
+		}
+		entry := map[string]interface{}{}
+		dec := json.NewDecoder(bytes.NewReader(p.Manifest))
+		dec.UseNumber()
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("%s %s: invalid composer.json: %w", p.Name, p.Version, err)
+		}
+		entry["name"] = p.Name
+		entry["version"] = p.Version
+		entry["version_normalized"] = p.VersionNormalized
+		entry["dist"] = map[string]string{
+			"type":   "zip",
+			"url":    distURL(p),
+			"shasum": p.Shasum,
+		}
+		if p.Time != "" {
+			entry["time"] = p.Time
+		}
+		versions = append(versions, entry)
+	}
+	return json.Marshal(map[string]interface{}{
+		"packages": map[string]interface{}{name: versions},
+	})
+}
@@ -0,0 +1,316 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+)
+
+// ConanInfoFile is the package file holding the settings, options and requirements a binary was built with
+const ConanInfoFile = "conaninfo.txt"
+
+var (
+	conanNamePattern     = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_+.-]{0,100}$`)
+	conanRevisionPattern = regexp.MustCompile(`^[a-zA-Z0-9]{1,64}$`)
+	conanFilePattern     = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+-]*$`)
+	conanPathPattern     = regexp.MustCompile(`^([^/]+)/([^/]+)/([^/]+)/([^/]+)/([^/]+)/(export|package/([^/]+)/([^/]+))/([^/]+)$`)
+)
+
+// ConanArtifact implements Conan v2 recipe and package handling
+type ConanArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewConanArtifact creates a new Conan artifact
+func NewConanArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &ConanArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (c *ConanArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeConan
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (c *ConanArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return c.metadata
+}
+
+// GetPath returns the storage path of the artifact; the path is carried in the metadata
+// properties since a Conan file is addressed by revision rather than name and version
+func (c *ConanArtifact) GetPath() string {
+	return c.metadata.Properties["path"]
+}
+
+// GetIndexPath returns the storage directory of the recipe
+func (c *ConanArtifact) GetIndexPath() string {
+	ref, err := ParseConanReference(c.metadata.Properties["reference"])
+	if err != nil {
+		return ""
+	}
+	return ref.Path()
+}
+
+// ValidatePath validates a recipe or package file path
+func (c *ConanArtifact) ValidatePath(p string) error {
+	if _, err := c.ParsePath(p); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParsePath parses a <name>/<version>/<user>/<channel>/<rrev>/export/<file> or
+// <name>/<version>/<user>/<channel>/<rrev>/package/<package_id>/<prev>/<file> path
+func (c *ConanArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := conanPathPattern.FindStringSubmatch(p)
+	if m == nil {
+		return nil, fmt.Errorf("invalid Conan path: %s", p)
+	}
+	ref := NewConanReference(m[1], m[2], m[3], m[4])
+	if !ref.Valid() || !ValidConanRevision(m[5]) || !ValidConanFileName(m[9]) {
+		return nil, fmt.Errorf("invalid Conan path: %s", p)
+	}
+	meta := map[string]string{
+		"reference":       ref.String(),
+		"recipe_revision": m[5],
+		"file":            m[9],
+	}
+	if m[7] != "" {
+		if !ValidConanRevision(m[7]) || !ValidConanRevision(m[8]) {
+			return nil, fmt.Errorf("invalid Conan path: %s", p)
+		}
+		meta["package_id"] = m[7]
+		meta["package_revision"] = m[8]
+	}
+	return &artifact.ArtifactInfo{
+		Name:     ref.Name,
+		Version:  ref.Version,
+		Type:     artifact.ArtifactTypeConan,
+		Path:     p,
+		Metadata: meta,
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact from its parsed metadata
+func (c *ConanArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	ref, err := ParseConanReference(info.Metadata["reference"])
+	if err != nil {
+		return ""
+	}
+	if info.Metadata["package_id"] != "" {
+		return ConanPackageRevisionPath(ref, info.Metadata["recipe_revision"], info.Metadata["package_id"], info.Metadata["package_revision"]) + "/" + info.Metadata["file"]
+	}
+	return ConanRecipeRevisionPath(ref, info.Metadata["recipe_revision"]) + "/" + info.Metadata["file"]
+}
+
+// ValidateArtifact accepts any content; Conan files are opaque to the server
+func (c *ConanArtifact) ValidateArtifact(content io.Reader) error {
+	return nil
+}
+
+// GetMetadata extracts the build configuration of a conaninfo.txt
+func (c *ConanArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParseConanInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	encoded, _ := json.Marshal(info)
+	return map[string]string{"conaninfo": string(encoded)}, nil
+}
+
+// GenerateIndex generates a /search result listing the references of the given artifacts
+func (c *ConanArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	seen := map[string]bool{}
+	results := []string{}
+	for _, info := range artifacts {
+		ref := info.Metadata["reference"]
+		if ref != "" && !seen[ref] {
+			seen[ref] = true
+			results = append(results, ref)
+		}
+	}
+	sort.Strings(results)
+	return json.Marshal(map[string]interface{}{"results": results})
+}
+
+// GetEndpoints returns Conan v2 API endpoints
+func (c *ConanArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /v1/ping",
+		"GET /v2/users/authenticate",
+		"GET /v2/conans/search",
+		"GET /v2/conans/{name}/{version}/{user}/{channel}/latest",
+		"GET /v2/conans/{name}/{version}/{user}/{channel}/revisions",
+		"GET /v2/conans/{name}/{version}/{user}/{channel}/revisions/{rrev}/files",
+		"PUT /v2/conans/{name}/{version}/{user}/{channel}/revisions/{rrev}/files/{file}",
+		"GET /v2/conans/{name}/{version}/{user}/{channel}/revisions/{rrev}/search",
+		"GET /v2/conans/{name}/{version}/{user}/{channel}/revisions/{rrev}/packages/{package_id}/latest",
+		"GET /v2/conans/{name}/{version}/{user}/{channel}/revisions/{rrev}/packages/{package_id}/revisions/{prev}/files",
+		"PUT /v2/conans/{name}/{version}/{user}/{channel}/revisions/{rrev}/packages/{package_id}/revisions/{prev}/files/{file}",
+	}
+}
+
+// ConanReference identifies a recipe: name/version, optionally with @user/channel
+type ConanReference struct {
+	Name    string
+	Version string
+	User    string
+	Channel string
+}
+
+// NewConanReference builds a reference from URL segments, where "_" stands for no user or channel
+func NewConanReference(name, version, user, channel string) ConanReference {
+	if user == "_" {
+		user = ""
+	}
+	if channel == "_" {
+		channel = ""
+	}
+	return ConanReference{Name: name, Version: version, User: user, Channel: channel}
+}
+
+// ParseConanReference parses "name/version" or "name/version@user/channel"
+func ParseConanReference(s string) (ConanReference, error) {
+	main, userChannel, hasUser := strings.Cut(s, "@")
+	name, version, ok := strings.Cut(main, "/")
+	if !ok {
+		return ConanReference{}, fmt.Errorf("invalid Conan reference: %s", s)
+	}
+	ref := ConanReference{Name: name, Version: version}
+	if hasUser {
+		user, channel, ok := strings.Cut(userChannel, "/")
+		if !ok {
+			return ConanReference{}, fmt.Errorf("invalid Conan reference: %s", s)
+		}
+		ref = NewConanReference(name, version, user, channel)
+	}
+	if !ref.Valid() {
+		return ConanReference{}, fmt.Errorf("invalid Conan reference: %s", s)
+	}
+	return ref, nil
+}
+
+// Valid reports whether every part of the reference is well-formed; user and channel
+// are either both set or both empty
+func (r ConanReference) Valid() bool {
+	if !conanNamePattern.MatchString(r.Name) || !conanNamePattern.MatchString(r.Version) {
+		return false
+	}
+	if r.User == "" && r.Channel == "" {
+		return true
+	}
+	return conanNamePattern.MatchString(r.User) && conanNamePattern.MatchString(r.Channel)
+}
+
+// String returns the reference as Conan prints it
+func (r ConanReference) String() string {
+	if r.User == "" && r.Channel == "" {
+		return r.Name + "/" + r.Version
+	}
+	return r.Name + "/" + r.Version + "@" + r.User + "/" + r.Channel
+}
+
+// Path returns the storage directory of the recipe, <name>/<version>/<user>/<channel> with "_" for empty parts
+func (r ConanReference) Path() string {
+	user, channel := r.User, r.Channel
+	if user == "" {
+		user = "_"
+	}
+	if channel == "" {
+		channel = "_"
+	}
+	return r.Name + "/" + r.Version + "/" + user + "/" + channel
+}
+
+// ConanRecipeRevisionPath returns the storage directory of a recipe revision's files
+func ConanRecipeRevisionPath(ref ConanReference, recipeRevision string) string {
+	return ref.Path() + "/" + recipeRevision + "/export"
+}
+
+// ConanPackageRevisionPath returns the storage directory of a package revision's files
+func ConanPackageRevisionPath(ref ConanReference, recipeRevision, packageID, packageRevision string) string {
+	return ref.Path() + "/" + recipeRevision + "/package/" + packageID + "/" + packageRevision
+}
+
+// ValidConanRevision reports whether s is usable as a revision or package ID
+func ValidConanRevision(s string) bool {
+	return conanRevisionPattern.MatchString(s)
+}
+
+// ValidConanFileName reports whether name is a plain file name
+func ValidConanFileName(name string) bool {
+	return conanFilePattern.MatchString(name)
+}
+
+// ConanPackageInfo is the build configuration of a package binary, as returned by package search
+type ConanPackageInfo struct {
+	Settings map[string]string `json:"settings"`
+	Options  map[string]string `json:"options"`
+	Requires []string          `json:"requires"`
+}
+
+// ParseConanInfo parses the [settings], [options] and [requires] sections of a conaninfo.txt
+func ParseConanInfo(data []byte) (*ConanPackageInfo, error) {
+	info := &ConanPackageInfo{Settings: map[string]string{}, Options: map[string]string{}, Requires: []string{}}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		switch section {
+		case "settings", "options":
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid %s entry: %s", section, line)
+			}
+			if section == "settings" {
+				info.Settings[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			} else {
+				info.Options[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		case "requires":
+			info.Requires = append(info.Requires, line)
+		}
+	}
+	return info, scanner.Err()
+}
+
+// MatchConanPattern reports whether a reference matches a /search pattern. As with fnmatch,
+// "*" and "?" also match the "/" and "@" separators.
+func MatchConanPattern(pattern, ref string, ignoreCase bool) bool {
+	var expr strings.Builder
+	if ignoreCase {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	return err == nil && re.MatchString(ref)
+}
@@ -0,0 +1,420 @@
+package types
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Conda package formats, named after their file extensions
+const (
+	CondaFormatConda  = "conda"
+	CondaFormatTarBz2 = "tar.bz2"
+)
+
+// Channel index files generated for every subdir
+const (
+	CondaRepodataFile        = "repodata.json"
+	CondaCurrentRepodataFile = "current_repodata.json"
+)
+
+var (
+	condaNamePattern   = regexp.MustCompile(`^[a-z0-9_][a-z0-9_.-]*$`)
+	condaFieldPattern  = regexp.MustCompile(`^[a-zA-Z0-9_.+!*]+$`)
+	condaSubdirPattern = regexp.MustCompile(`^(noarch|[a-z0-9]+-[a-z0-9_]+)$`)
+	condaPathPattern   = regexp.MustCompile(`^([^/]+)/([^/]+)-([^/-]+)-([^/-]+)\.(conda|tar\.bz2)$`)
+)
+
+// CondaArtifact implements conda package (.conda and .tar.bz2) handling
+type CondaArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewCondaArtifact creates a new conda artifact
+func NewCondaArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &CondaArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (c *CondaArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeConda
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (c *CondaArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return c.metadata
+}
+
+// GetPath returns the storage path for the package
+func (c *CondaArtifact) GetPath() string {
+	props := c.metadata.Properties
+	if props == nil {
+		props = map[string]string{}
+	}
+	format := props["format"]
+	if format == "" {
+		format = CondaFormatConda
+	}
+	return CondaPackagePath(props["subdir"], c.metadata.Name+"-"+c.metadata.Version+"-"+props["build"]+"."+format)
+}
+
+// GetIndexPath returns the repodata.json path of the package's subdir
+func (c *CondaArtifact) GetIndexPath() string {
+	return path.Dir(c.GetPath()) + "/" + CondaRepodataFile
+}
+
+// ValidatePath validates a conda package path
+func (c *CondaArtifact) ValidatePath(p string) error {
+	m := condaPathPattern.FindStringSubmatch(p)
+	if m == nil || !ValidCondaSubdir(m[1]) {
+		return fmt.Errorf("invalid conda package path: %s", p)
+	}
+	return nil
+}
+
+// ParsePath parses package information from a <subdir>/<name>-<version>-<build>.<ext> path
+func (c *CondaArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	if err := c.ValidatePath(p); err != nil {
+		return nil, err
+	}
+	m := condaPathPattern.FindStringSubmatch(p)
+	return &artifact.ArtifactInfo{
+		Name:    m[2],
+		Version: m[3],
+		Type:    artifact.ArtifactTypeConda,
+		Path:    p,
+		Metadata: map[string]string{
+			"subdir": m[1],
+			"build":  m[4],
+			"format": m[5],
+		},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (c *CondaArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	format := info.Metadata["format"]
+	if format == "" {
+		format = CondaFormatConda
+	}
+	return CondaPackagePath(info.Metadata["subdir"], info.Name+"-"+info.Version+"-"+info.Metadata["build"]+"."+format)
+}
+
+// ValidateArtifact validates that the content is a conda package with a readable info/index.json
+func (c *CondaArtifact) ValidateArtifact(content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	_, err = ReadCondaPackage(bytes.NewReader(data), int64(len(data)))
+	return err
+}
+
+// GetMetadata extracts metadata from info/index.json
+func (c *CondaArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := ReadCondaPackage(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return pkg.Metadata(), nil
+}
+
+// GenerateIndex generates the repodata.json of the subdir the given packages belong to
+func (c *CondaArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	var pkgs []*CondaPackage
+	subdir := ""
+	for _, info := range artifacts {
+		pkg, err := CondaPackageFromMetadata(info.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", info.Name, err)
+		}
+		subdir = pkg.Subdir
+		pkgs = append(pkgs, pkg)
+	}
+	return GenerateCondaRepodata(subdir, pkgs, false)
+}
+
+// GetEndpoints returns conda channel endpoints
+func (c *CondaArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /{subdir}/repodata.json",
+		"GET /{subdir}/current_repodata.json",
+		"GET /{subdir}/{name}-{version}-{build}.conda",
+		"GET /{subdir}/{name}-{version}-{build}.tar.bz2",
+		"POST /api/packages",
+	}
+}
+
+// CondaPackagePath returns the storage path of a package within a subdir
+func CondaPackagePath(subdir, filename string) string {
+	return subdir + "/" + filename
+}
+
+// ValidCondaSubdir reports whether s is a platform subdir such as "linux-64" or "noarch"
+func ValidCondaSubdir(s string) bool {
+	return condaSubdirPattern.MatchString(s)
+}
+
+// IsCondaIndexFile reports whether name is a channel index that changes as packages are published
+func IsCondaIndexFile(name string) bool {
+	switch name {
+	case CondaRepodataFile, CondaCurrentRepodataFile, "channeldata.json":
+		return true
+	}
+	return strings.HasPrefix(name, CondaRepodataFile+".") || strings.HasPrefix(name, CondaCurrentRepodataFile+".")
+}
+
+// CondaPackage holds the info/index.json of a package and the digests listed in repodata
+type CondaPackage struct {
+	Name        string
+	Version     string
+	Build       string
+	BuildNumber int64
+	Subdir      string
+	Format      string
+
+	// Index is info/index.json as found in the package; repodata entries are built from it
+	// so fields this type does not model (depends, constrains, noarch, ...) are kept verbatim
+	Index json.RawMessage
+
+	MD5    string
+	SHA256 string
+	Size   int64
+}
+
+// Filename returns the canonical <name>-<version>-<build>.<ext> file name
+func (p *CondaPackage) Filename() string {
+	return p.Name + "-" + p.Version + "-" + p.Build + "." + p.Format
+}
+
+// Metadata returns the properties persisted with an uploaded package
+func (p *CondaPackage) Metadata() map[string]string {
+	return map[string]string{
+		"type":         "conda-package",
+		"name":         p.Name,
+		"version":      p.Version,
+		"build":        p.Build,
+		"build_number": strconv.FormatInt(p.BuildNumber, 10),
+		"subdir":       p.Subdir,
+		"format":       p.Format,
+		"filename":     p.Filename(),
+		"index_json":   string(p.Index),
+		"md5":          p.MD5,
+		"sha256":       p.SHA256,
+		"size":         strconv.FormatInt(p.Size, 10),
+	}
+}
+
+// CondaPackageFromMetadata restores a package from the properties returned by Metadata
+func CondaPackageFromMetadata(props map[string]string) (*CondaPackage, error) {
+	if props["index_json"] == "" {
+		return nil, fmt.Errorf("missing index.json")
+	}
+	pkg, err := parseCondaIndex([]byte(props["index_json"]))
+	if err != nil {
+		return nil, err
+	}
+	pkg.Format = props["format"]
+	pkg.MD5 = props["md5"]
+	pkg.SHA256 = props["sha256"]
+	pkg.Size, _ = strconv.ParseInt(props["size"], 10, 64)
+	if pkg.Format != CondaFormatConda && pkg.Format != CondaFormatTarBz2 {
+		return nil, fmt.Errorf("unknown conda package format %q", pkg.Format)
+	}
+	return pkg, nil
+}
+
+// ReadCondaPackage reads info/index.json from a .conda or .tar.bz2 package; the format is
+// detected from the content. Digests and size are left for the caller to fill in.
+func ReadCondaPackage(r io.ReaderAt, size int64) (*CondaPackage, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, fmt.Errorf("not a conda package: %w", err)
+	}
+
+	var index []byte
+	var format string
+	var err error
+	switch {
+	case bytes.Equal(magic, []byte("PK\x03\x04")):
+		format = CondaFormatConda
+		index, err = readCondaV2Index(r, size)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		format = CondaFormatTarBz2
+		index, err = readCondaTarIndex(bzip2.NewReader(io.NewSectionReader(r, 0, size)))
+	default:
+		return nil, fmt.Errorf("not a conda package: expected a .conda or .tar.bz2 archive")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := parseCondaIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	pkg.Format = format
+	return pkg, nil
+}
+
+// readCondaV2Index reads info/index.json from the info-*.tar.zst member of a .conda archive
+func readCondaV2Index(r io.ReaderAt, size int64) ([]byte, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .conda archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if !strings.HasPrefix(f.Name, "info-") || !strings.HasSuffix(f.Name, ".tar.zst") {
+			continue
+		}
+		member, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid .conda archive: %w", err)
+		}
+		defer member.Close()
+		dec, err := zstd.NewReader(member)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", f.Name, err)
+		}
+		defer dec.Close()
+		return readCondaTarIndex(dec)
+	}
+	return nil, fmt.Errorf("invalid .conda archive: info-*.tar.zst not found")
+}
+
+// readCondaTarIndex returns info/index.json from a tar stream
+func readCondaTarIndex(r io.Reader) ([]byte, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("info/index.json not found in package")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid package archive: %w", err)
+		}
+		if strings.TrimPrefix(hdr.Name, "./") == "info/index.json" {
+			return io.ReadAll(io.LimitReader(tr, 1<<20))
+		}
+	}
+}
+
+// parseCondaIndex validates the fields of an index.json that repodata and storage paths rely on
+func parseCondaIndex(data []byte) (*CondaPackage, error) {
+	var index struct {
+		Name        string `json:"name"`
+		Version     string `json:"version"`
+		Build       string `json:"build"`
+		BuildNumber int64  `json:"build_number"`
+		Subdir      string `json:"subdir"`
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid info/index.json: %w", err)
+	}
+	if !condaNamePattern.MatchString(index.Name) {
+		return nil, fmt.Errorf("invalid package name %q", index.Name)
+	}
+	if !condaFieldPattern.MatchString(index.Version) {
+		return nil, fmt.Errorf("invalid package version %q", index.Version)
+	}
+	if !condaFieldPattern.MatchString(index.Build) {
+		return nil, fmt.Errorf("invalid build string %q", index.Build)
+	}
+	if !ValidCondaSubdir(index.Subdir) {
+		return nil, fmt.Errorf("invalid subdir %q", index.Subdir)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, fmt.Errorf("invalid info/index.json: %w", err)
+	}
+	return &CondaPackage{
+		Name:        index.Name,
+		Version:     index.Version,
+		Build:       index.Build,
+		BuildNumber: index.BuildNumber,
+		Subdir:      index.Subdir,
+		Index:       compact.Bytes(),
+	}, nil
+}
+
+// repodataEntry returns the index.json fields extended with the package digests
+func (p *CondaPackage) repodataEntry() (map[string]interface{}, error) {
+	entry := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(p.Index))
+	dec.UseNumber()
+	if err := dec.Decode(&entry); err != nil {
+		return nil, fmt.Errorf("%s: invalid index.json: %w", p.Filename(), err)
+	}
+	entry["md5"] = p.MD5
+	entry["sha256"] = p.SHA256
+	entry["size"] = p.Size
+	return entry, nil
+}
+
+// GenerateCondaRepodata renders the repodata.json of a subdir. With current set only the
+// latest version of each package name is listed, as in current_repodata.json.
+func GenerateCondaRepodata(subdir string, pkgs []*CondaPackage, current bool) ([]byte, error) {
+	if current {
+		latest := map[string]string{}
+		for _, p := range pkgs {
+			if v, ok := latest[p.Name]; !ok || CompareVersions(p.Version, v) > 0 {
+				latest[p.Name] = p.Version
+			}
+		}
+		var kept []*CondaPackage
+		for _, p := range pkgs {
+			if latest[p.Name] == p.Version {
+				kept = append(kept, p)
+			}
+		}
+		pkgs = kept
+	}
+
+	repodata := struct {
+		Info            map[string]string      `json:"info"`
+		Packages        map[string]interface{} `json:"packages"`
+		PackagesConda   map[string]interface{} `json:"packages.conda"`
+		Removed         []string               `json:"removed"`
+		RepodataVersion int                    `json:"repodata_version"`
+	}{
+		Info:            map[string]string{"subdir": subdir},
+		Packages:        map[string]interface{}{},
+		PackagesConda:   map[string]interface{}{},
+		Removed:         []string{},
+		RepodataVersion: 1,
+	}
+
+	sorted := append([]*CondaPackage(nil), pkgs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Filename() < sorted[j].Filename() })
+	for _, p := range sorted {
+		if p.Subdir != subdir {
+			continue
+		}
+		entry, err := p.repodataEntry()
+		if err != nil {
+			return nil, err
+		}
+		if p.Format == CondaFormatConda {
+			repodata.PackagesConda[p.Filename()] = entry
+		} else {
+			repodata.Packages[p.Filename()] = entry
+		}
+	}
+	return json.MarshalIndent(repodata, "", "  ")
+}
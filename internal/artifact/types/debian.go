@@ -0,0 +1,464 @@
+package types
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	debianPackagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+	debianPoolPattern    = regexp.MustCompile(`^pool/([^/]+)/[^/]+/[^/]+/([^/_]+)_([^/_]+)_([^/_]+)\.deb$`)
+)
+
+// debianIndexFields are appended by the repository and never copied from an uploaded control file
+var debianIndexFields = map[string]bool{
+	"filename": true, "size": true, "md5sum": true, "sha1": true, "sha256": true,
+}
+
+// DebianArtifact implements Debian package (.deb) handling for APT repositories
+type DebianArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewDebianArtifact creates a new Debian artifact
+func NewDebianArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &DebianArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (d *DebianArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeDebian
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (d *DebianArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return d.metadata
+}
+
+// GetPath returns the pool path for the package
+func (d *DebianArtifact) GetPath() string {
+	component := "main"
+	arch := "all"
+	if d.metadata.Properties != nil {
+		if c := d.metadata.Properties["component"]; c != "" {
+			component = c
+		}
+		if a := d.metadata.Properties["architecture"]; a != "" {
+			arch = a
+		}
+	}
+	// Names that cannot form a pool path give no path
+	p, _ := DebianPoolPath(component, d.metadata.Name, d.metadata.Name, d.metadata.Version, arch)
+	return p
+}
+
+// GetIndexPath returns the index path for the Debian repository
+func (d *DebianArtifact) GetIndexPath() string {
+	return "dists"
+}
+
+// ValidatePath validates a Debian pool path
+func (d *DebianArtifact) ValidatePath(p string) error {
+	if !debianPoolPattern.MatchString(p) {
+		return fmt.Errorf("invalid Debian package path: %s", p)
+	}
+	return nil
+}
+
+// ParsePath parses package information from a pool path
+func (d *DebianArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := debianPoolPattern.FindStringSubmatch(p)
+	if m == nil {
+		return nil, fmt.Errorf("invalid Debian package path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:    m[2],
+		Version: m[3],
+		Type:    artifact.ArtifactTypeDebian,
+		Path:    p,
+		Metadata: map[string]string{
+			"component":    m[1],
+			"architecture": m[4],
+			"filename":     p,
+		},
+	}, nil
+}
+
+// GeneratePath creates a pool path for the artifact
+func (d *DebianArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	component, arch := "main", "all"
+	if c := info.Metadata["component"]; c != "" {
+		component = c
+	}
+	if a := info.Metadata["architecture"]; a != "" {
+		arch = a
+	}
+	p, _ := DebianPoolPath(component, info.Name, info.Name, info.Version, arch)
+	return p
+}
+
+// ValidateArtifact validates that the content is a .deb with a usable control file
+func (d *DebianArtifact) ValidateArtifact(content io.Reader) error {
+	_, err := ReadDebControl(content)
+	return err
+}
+
+// GetMetadata extracts metadata from the package control file
+func (d *DebianArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	control, err := ReadDebControl(content)
+	if err != nil {
+		return nil, err
+	}
+	return control.Metadata(), nil
+}
+
+// GenerateIndex generates a Packages file for the given packages.
+// Each artifact's metadata must carry the control paragraph and the pool filename, size and digests.
+func (d *DebianArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	sorted := make([]*artifact.ArtifactInfo, len(artifacts))
+	copy(sorted, artifacts)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		if c := CompareVersions(sorted[i].Version, sorted[j].Version); c != 0 {
+			return c < 0
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+
+	var buf bytes.Buffer
+	for _, art := range sorted {
+		control, err := ParseDebControl(art.Metadata["control"])
+		if err != nil {
+			return nil, fmt.Errorf("package %s %s: %w", art.Name, art.Version, err)
+		}
+		var description *DebField
+		for i, f := range control.Fields {
+			if strings.EqualFold(f.Name, "Description") {
+				description = &control.Fields[i]
+				continue
+			}
+			if debianIndexFields[strings.ToLower(f.Name)] {
+				continue
+			}
+			fmt.Fprintf(&buf, "%s: %s\n", f.Name, f.Value)
+		}
+		filename := art.Metadata["filename"]
+		if filename == "" {
+			filename = art.Path
+		}
+		fmt.Fprintf(&buf, "Filename: %s\n", filename)
+		fmt.Fprintf(&buf, "Size: %s\n", art.Metadata["size"])
+		if v := art.Metadata["md5"]; v != "" {
+			fmt.Fprintf(&buf, "MD5sum: %s\n", v)
+		}
+		if v := art.Metadata["sha1"]; v != "" {
+			fmt.Fprintf(&buf, "SHA1: %s\n", v)
+		}
+		fmt.Fprintf(&buf, "SHA256: %s\n", art.Metadata["sha256"])
+		if description != nil {
+			fmt.Fprintf(&buf, "%s: %s\n", description.Name, description.Value)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// GetEndpoints returns APT repository endpoints
+func (d *DebianArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /dists/{distribution}/Release",
+		"GET /dists/{distribution}/InRelease",
+		"GET /dists/{distribution}/Release.gpg",
+		"GET /dists/{distribution}/{component}/binary-{arch}/Packages",
+		"GET /dists/{distribution}/{component}/binary-{arch}/Packages.gz",
+		"GET /pool/{component}/{prefix}/{source}/{package}_{version}_{arch}.deb",
+		"GET /public.key",
+		"POST /api/packages/{distribution}/{component}",
+	}
+}
+
+// DebField is a single field of a Debian control paragraph; multi-line values keep their continuation lines
+type DebField struct {
+	Name  string
+	Value string
+}
+
+// DebControl is the parsed control file of a binary package
+type DebControl struct {
+	Package      string
+	Version      string
+	Architecture string
+	Fields       []DebField
+}
+
+// Get returns the value of a control field, matched case-insensitively
+func (c *DebControl) Get(name string) string {
+	for _, f := range c.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// String renders the control paragraph
+func (c *DebControl) String() string {
+	var b strings.Builder
+	for _, f := range c.Fields {
+		fmt.Fprintf(&b, "%s: %s\n", f.Name, f.Value)
+	}
+	return b.String()
+}
+
+// Source returns the source package name, which defaults to the binary package name
+func (c *DebControl) Source() string {
+	if src := strings.Fields(c.Get("Source")); len(src) > 0 {
+		return src[0]
+	}
+	return c.Package
+}
+
+// Filename returns the conventional .deb filename; the epoch is not part of file names
+func (c *DebControl) Filename() string {
+	version := c.Version
+	if i := strings.Index(version, ":"); i >= 0 {
+		version = version[i+1:]
+	}
+	return fmt.Sprintf("%s_%s_%s.deb", c.Package, version, c.Architecture)
+}
+
+// PoolPath returns the pool path of the package within a component
+func (c *DebControl) PoolPath(component string) (string, error) {
+	return DebianPoolPath(component, c.Source(), c.Package, c.Version, c.Architecture)
+}
+
+// Metadata returns the properties persisted with an uploaded package
+func (c *DebControl) Metadata() map[string]string {
+	return map[string]string{
+		"type":         "debian-package",
+		"format":       "deb",
+		"package":      c.Package,
+		"version":      c.Version,
+		"architecture": c.Architecture,
+		"description":  strings.SplitN(c.Get("Description"), "\n", 2)[0],
+		"control":      c.String(),
+	}
+}
+
+// DebianPoolPath returns pool/<component>/<prefix>/<source>/<package>_<version>_<arch>.deb, and
+// an error when the names would place the package anywhere else
+func DebianPoolPath(component, source, pkg, version, arch string) (string, error) {
+	if !debianPackagePattern.MatchString(source) {
+		return "", fmt.Errorf("invalid source package name %q", source)
+	}
+	prefix := source[:1]
+	if strings.HasPrefix(source, "lib") && len(source) > 3 {
+		prefix = source[:4]
+	}
+	if i := strings.Index(version, ":"); i >= 0 {
+		version = version[i+1:]
+	}
+	p := path.Join("pool", component, prefix, source, fmt.Sprintf("%s_%s_%s.deb", pkg, version, arch))
+	if !strings.HasPrefix(p, path.Join("pool", component)+"/") || !debianPoolPattern.MatchString(p) {
+		return "", fmt.Errorf("invalid Debian pool path: %s", p)
+	}
+	return p, nil
+}
+
+// ParseDebControl parses a single control paragraph
+func ParseDebControl(text string) (*DebControl, error) {
+	control := &DebControl{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(control.Fields) > 0 {
+				break
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(control.Fields) == 0 {
+				return nil, fmt.Errorf("control file starts with a continuation line")
+			}
+			control.Fields[len(control.Fields)-1].Value += "\n" + line
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed control line %q", line)
+		}
+		control.Fields = append(control.Fields, DebField{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	control.Package = control.Get("Package")
+	control.Version = control.Get("Version")
+	control.Architecture = control.Get("Architecture")
+	if !debianPackagePattern.MatchString(control.Package) {
+		return nil, fmt.Errorf("invalid package name %q", control.Package)
+	}
+	if src := strings.Fields(control.Get("Source")); len(src) > 0 && !debianPackagePattern.MatchString(src[0]) {
+		return nil, fmt.Errorf("invalid source package name %q", src[0])
+	}
+	if control.Version == "" || strings.ContainsAny(control.Version, " /_") {
+		return nil, fmt.Errorf("invalid version %q", control.Version)
+	}
+	if control.Architecture == "" || strings.ContainsAny(control.Architecture, " /_") {
+		return nil, fmt.Errorf("invalid architecture %q", control.Architecture)
+	}
+	return control, nil
+}
+
+// ReadDebControl reads the control file from a .deb (an ar archive holding control.tar[.gz|.xz|.zst])
+func ReadDebControl(content io.Reader) (*DebControl, error) {
+	r := bufio.NewReader(content)
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "!<arch>\n" {
+		return nil, fmt.Errorf("not a Debian package: missing ar header")
+	}
+
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("not a Debian package: control archive not found")
+		}
+		name := strings.TrimRight(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("not a Debian package: malformed ar member header")
+		}
+		member := io.LimitReader(r, size)
+
+		if strings.HasPrefix(name, "control.tar") {
+			return readDebControlTar(name, member)
+		}
+		if _, err := io.Copy(io.Discard, member); err != nil {
+			return nil, err
+		}
+		if size%2 == 1 {
+			if _, err := r.Discard(1); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// readDebControlTar decompresses a control archive and parses its control file
+func readDebControlTar(name string, member io.Reader) (*DebControl, error) {
+	var tarStream io.Reader
+	switch path.Ext(name) {
+	case ".tar":
+		tarStream = member
+	case ".gz":
+		gz, err := gzip.NewReader(member)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		defer gz.Close()
+		tarStream = gz
+	case ".xz":
+		xzr, err := xz.NewReader(member)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		tarStream = xzr
+	case ".zst":
+		zr, err := zstd.NewReader(member)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		defer zr.Close()
+		tarStream = zr
+	default:
+		return nil, fmt.Errorf("unsupported control archive %s", name)
+	}
+
+	tr := tar.NewReader(tarStream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("control file not found in %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		if path.Clean(hdr.Name) != "control" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+		return ParseDebControl(string(data))
+	}
+}
+
+// DebianIndexFile is an index file listed in a Release file, relative to dists/<distribution>
+type DebianIndexFile struct {
+	Path    string
+	Content []byte
+}
+
+// DebianRelease describes the Release file of a distribution
+type DebianRelease struct {
+	Origin        string
+	Label         string
+	Suite         string
+	Codename      string
+	Description   string
+	Date          time.Time
+	Architectures []string
+	Components    []string
+	Files         []DebianIndexFile
+}
+
+// Bytes renders the Release file
+func (r *DebianRelease) Bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Origin: %s\n", r.Origin)
+	fmt.Fprintf(&buf, "Label: %s\n", r.Label)
+	fmt.Fprintf(&buf, "Suite: %s\n", r.Suite)
+	fmt.Fprintf(&buf, "Codename: %s\n", r.Codename)
+	fmt.Fprintf(&buf, "Date: %s\n", r.Date.UTC().Format("Mon, 02 Jan 2006 15:04:05 UTC"))
+	fmt.Fprintf(&buf, "Architectures: %s\n", strings.Join(r.Architectures, " "))
+	fmt.Fprintf(&buf, "Components: %s\n", strings.Join(r.Components, " "))
+	if r.Description != "" {
+		fmt.Fprintf(&buf, "Description: %s\n", r.Description)
+	}
+
+	sums := []struct {
+		field string
+		sum   func([]byte) string
+	}{
+		{"MD5Sum", md5Hex},
+		{"SHA1", sha1Hex},
+		{"SHA256", sha256Hex},
+	}
+	for _, s := range sums {
+		fmt.Fprintf(&buf, "%s:\n", s.field)
+		for _, f := range r.Files {
+			fmt.Fprintf(&buf, " %s %d %s\n", s.sum(f.Content), len(f.Content), f.Path)
+		}
+	}
+	return buf.Bytes()
+}
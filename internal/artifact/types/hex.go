@@ -0,0 +1,691 @@
+package types
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	hexNamePattern    = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	hexVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+	hexPathPattern    = regexp.MustCompile(`^tarballs/([a-z][a-z0-9_]*)-(\d+\.\d+\.\d+[0-9A-Za-z.+-]*)\.tar$`)
+)
+
+// HexArtifact implements Hex (Elixir/Erlang) package handling
+type HexArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewHexArtifact creates a new Hex artifact
+func NewHexArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &HexArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (h *HexArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeHex
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (h *HexArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return h.metadata
+}
+
+// GetPath returns the storage path of the release tarball
+func (h *HexArtifact) GetPath() string {
+	return HexTarballPath(h.metadata.Name, h.metadata.Version)
+}
+
+// GetIndexPath returns the registry resource listing the package's releases
+func (h *HexArtifact) GetIndexPath() string {
+	return "packages/" + h.metadata.Name
+}
+
+// ValidatePath validates a tarball path
+func (h *HexArtifact) ValidatePath(p string) error {
+	if !hexPathPattern.MatchString(p) {
+		return fmt.Errorf("invalid Hex tarball path: %s", p)
+	}
+	return nil
+}
+
+// ParsePath parses package information from a tarballs/<name>-<version>.tar path
+func (h *HexArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := hexPathPattern.FindStringSubmatch(p)
+	if m == nil {
+		return nil, fmt.Errorf("invalid Hex tarball path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:     m[1],
+		Version:  m[2],
+		Type:     artifact.ArtifactTypeHex,
+		Path:     p,
+		Metadata: map[string]string{},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (h *HexArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	return HexTarballPath(info.Name, info.Version)
+}
+
+// ValidateArtifact validates that the content is a version 3 Hex tarball
+func (h *HexArtifact) ValidateArtifact(content io.Reader) error {
+	_, err := ReadHexTarball(content)
+	return err
+}
+
+// GetMetadata extracts metadata from metadata.config
+func (h *HexArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	release, err := ReadHexTarball(content)
+	if err != nil {
+		return nil, err
+	}
+	return release.Metadata(), nil
+}
+
+// GenerateIndex generates the unsigned /packages/<name> payload of the given releases
+func (h *HexArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	var releases []*HexRelease
+	name := ""
+	for _, info := range artifacts {
+		release, err := HexReleaseFromMetadata(info.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", info.Name, err)
+		}
+		name = release.Name
+		releases = append(releases, release)
+	}
+	return HexPackagePayload("", name, releases), nil
+}
+
+// GetEndpoints returns Hex repository endpoints
+func (h *HexArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /names",
+		"GET /versions",
+		"GET /packages/{name}",
+		"GET /tarballs/{name}-{version}.tar",
+		"GET /public_key",
+		"POST /api/publish",
+		"DELETE /api/packages/{name}/releases/{version}",
+	}
+}
+
+// HexTarballPath returns the storage path of a release tarball
+func HexTarballPath(name, version string) string {
+	return fmt.Sprintf("tarballs/%s-%s.tar", name, version)
+}
+
+// ValidHexName reports whether name is a valid package name
+func ValidHexName(name string) bool {
+	return hexNamePattern.MatchString(name)
+}
+
+// HexRequirement is a dependency declared in metadata.config
+type HexRequirement struct {
+	Name        string `json:"name"`
+	App         string `json:"app,omitempty"`
+	Requirement string `json:"requirement"`
+	Optional    bool   `json:"optional,omitempty"`
+	Repository  string `json:"repository,omitempty"`
+}
+
+// HexRelease is a published package version
+type HexRelease struct {
+	Name         string
+	Version      string
+	App          string
+	Description  string
+	Licenses     []string
+	BuildTools   []string
+	Requirements []HexRequirement
+
+	// InnerChecksum is the SHA-256 of the tarball's VERSION, metadata.config and contents.tar.gz
+	InnerChecksum []byte
+	// OuterChecksum is the SHA-256 of the whole tarball
+	OuterChecksum []byte
+}
+
+// Metadata returns the properties persisted with a published release
+func (r *HexRelease) Metadata() map[string]string {
+	requirements, _ := json.Marshal(r.Requirements)
+	licenses, _ := json.Marshal(r.Licenses)
+	buildTools, _ := json.Marshal(r.BuildTools)
+	return map[string]string{
+		"type":           "hex-release",
+		"name":           r.Name,
+		"version":        r.Version,
+		"app":            r.App,
+		"description":    r.Description,
+		"licenses":       string(licenses),
+		"build_tools":    string(buildTools),
+		"requirements":   string(requirements),
+		"inner_checksum": hex.EncodeToString(r.InnerChecksum),
+		"outer_checksum": hex.EncodeToString(r.OuterChecksum),
+	}
+}
+
+// HexReleaseFromMetadata restores a release from the properties returned by Metadata
+func HexReleaseFromMetadata(props map[string]string) (*HexRelease, error) {
+	r := &HexRelease{
+		Name:        props["name"],
+		Version:     props["version"],
+		App:         props["app"],
+		Description: props["description"],
+	}
+	if !ValidHexName(r.Name) || !hexVersionPattern.MatchString(r.Version) {
+		return nil, fmt.Errorf("invalid Hex release %q %q", r.Name, r.Version)
+	}
+	for key, target := range map[string]interface{}{
+		"requirements": &r.Requirements,
+		"licenses":     &r.Licenses,
+		"build_tools":  &r.BuildTools,
+	} {
+		if props[key] == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(props[key]), target); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	var err error
+	if r.InnerChecksum, err = hex.DecodeString(props["inner_checksum"]); err != nil {
+		return nil, fmt.Errorf("invalid inner checksum: %w", err)
+	}
+	if r.OuterChecksum, err = hex.DecodeString(props["outer_checksum"]); err != nil {
+		return nil, fmt.Errorf("invalid outer checksum: %w", err)
+	}
+	return r, nil
+}
+
+// ReadHexTarball reads a version 3 package tarball: it parses metadata.config and verifies the
+// CHECKSUM file against the inner checksum it computes
+func ReadHexTarball(content io.Reader) (*HexRelease, error) {
+	outer := sha256.New()
+	tr := tar.NewReader(io.TeeReader(content, outer))
+
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Hex tarball: %w", err)
+		}
+		switch hdr.Name {
+		case "VERSION", "CHECKSUM", "metadata.config", "contents.tar.gz":
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Hex tarball: %w", err)
+			}
+			files[hdr.Name] = data
+		}
+	}
+	// Hash any trailing padding so the outer checksum covers the whole file
+	if _, err := io.Copy(io.Discard, io.TeeReader(content, outer)); err != nil {
+		return nil, fmt.Errorf("invalid Hex tarball: %w", err)
+	}
+
+	for _, name := range []string{"VERSION", "metadata.config", "contents.tar.gz"} {
+		if _, ok := files[name]; !ok {
+			return nil, fmt.Errorf("invalid Hex tarball: %s not found", name)
+		}
+	}
+	if v := strings.TrimSpace(string(files["VERSION"])); v != "3" {
+		return nil, fmt.Errorf("unsupported Hex tarball version %q", v)
+	}
+
+	inner := sha256.New()
+	inner.Write(files["VERSION"])
+	inner.Write(files["metadata.config"])
+	inner.Write(files["contents.tar.gz"])
+	innerChecksum := inner.Sum(nil)
+	if declared, ok := files["CHECKSUM"]; ok {
+		if !strings.EqualFold(strings.TrimSpace(string(declared)), hex.EncodeToString(innerChecksum)) {
+			return nil, fmt.Errorf("Hex tarball checksum mismatch")
+		}
+	}
+
+	release, err := ParseHexMetadata(files["metadata.config"])
+	if err != nil {
+		return nil, err
+	}
+	release.InnerChecksum = innerChecksum
+	release.OuterChecksum = outer.Sum(nil)
+	return release, nil
+}
+
+// ParseHexMetadata parses metadata.config, a file of Erlang terms such as
+// {<<"name">>,<<"decimal">>}. Requirements are accepted in both the current
+// [{Name, Properties}] form and the legacy [[{<<"name">>, Name}, ...]] form.
+func ParseHexMetadata(data []byte) (*HexRelease, error) {
+	terms, err := parseErlangTerms(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata.config: %w", err)
+	}
+
+	fields := map[string]interface{}{}
+	for _, term := range terms {
+		if t, ok := term.(erlTuple); ok && len(t) == 2 {
+			if key, ok := t[0].(string); ok {
+				fields[key] = t[1]
+			}
+		}
+	}
+
+	r := &HexRelease{
+		Name:        erlString(fields["name"]),
+		Version:     erlString(fields["version"]),
+		App:         erlString(fields["app"]),
+		Description: erlString(fields["description"]),
+		Licenses:    erlStrings(fields["licenses"]),
+		BuildTools:  erlStrings(fields["build_tools"]),
+	}
+	if !ValidHexName(r.Name) {
+		return nil, fmt.Errorf("invalid package name %q in metadata.config", r.Name)
+	}
+	if !hexVersionPattern.MatchString(r.Version) {
+		return nil, fmt.Errorf("invalid version %q in metadata.config", r.Version)
+	}
+	if r.App == "" {
+		r.App = r.Name
+	}
+
+	requirements, _ := fields["requirements"].(erlList)
+	for _, item := range requirements {
+		var req HexRequirement
+		var props erlList
+		switch v := item.(type) {
+		case erlTuple:
+			if len(v) != 2 {
+				return nil, fmt.Errorf("invalid requirement in metadata.config")
+			}
+			req.Name = erlString(v[0])
+			props, _ = v[1].(erlList)
+		case erlList:
+			props = v
+		default:
+			return nil, fmt.Errorf("invalid requirement in metadata.config")
+		}
+		for _, p := range props {
+			prop, ok := p.(erlTuple)
+			if !ok || len(prop) != 2 {
+				continue
+			}
+			switch erlString(prop[0]) {
+			case "name":
+				req.Name = erlString(prop[1])
+			case "app":
+				req.App = erlString(prop[1])
+			case "requirement":
+				req.Requirement = erlString(prop[1])
+			case "optional":
+				req.Optional = prop[1] == erlAtom("true")
+			case "repository":
+				req.Repository = erlString(prop[1])
+			}
+		}
+		if !ValidHexName(req.Name) || req.Requirement == "" {
+			return nil, fmt.Errorf("invalid requirement %q in metadata.config", req.Name)
+		}
+		r.Requirements = append(r.Requirements, req)
+	}
+	sort.Slice(r.Requirements, func(i, j int) bool { return r.Requirements[i].Name < r.Requirements[j].Name })
+	return r, nil
+}
+
+// Erlang terms as read from metadata.config: binaries and strings become Go strings
+type (
+	erlAtom  string
+	erlTuple []interface{}
+	erlList  []interface{}
+)
+
+func erlString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case erlAtom:
+		return string(s)
+	}
+	return ""
+}
+
+func erlStrings(v interface{}) []string {
+	list, _ := v.(erlList)
+	var out []string
+	for _, item := range list {
+		if s := erlString(item); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// parseErlangTerms parses a sequence of "Term." expressions in the subset of the Erlang
+// term syntax used by metadata.config: tuples, lists, binaries, strings, atoms and numbers
+func parseErlangTerms(src string) ([]interface{}, error) {
+	p := &erlParser{src: src}
+	var terms []interface{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return terms, nil
+		}
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(".") {
+			return nil, p.errorf("expected '.'")
+		}
+		terms = append(terms, term)
+	}
+}
+
+type erlParser struct {
+	src string
+	pos int
+}
+
+func (p *erlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *erlParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '%':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *erlParser) consume(token string) bool {
+	if strings.HasPrefix(p.src[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *erlParser) term() (interface{}, error) {
+	p.skipSpace()
+	switch {
+	case p.pos >= len(p.src):
+		return nil, p.errorf("unexpected end of input")
+	case p.consume("<<"):
+		p.skipSpace()
+		if p.consume(">>") {
+			return "", nil
+		}
+		s, err := p.quoted('"')
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		p.consume("/utf8")
+		p.skipSpace()
+		if !p.consume(">>") {
+			return nil, p.errorf("expected '>>'")
+		}
+		return s, nil
+	case p.consume("{"):
+		items, err := p.sequence("}")
+		return erlTuple(items), err
+	case p.consume("["):
+		items, err := p.sequence("]")
+		return erlList(items), err
+	case p.src[p.pos] == '"':
+		return p.quoted('"')
+	case p.src[p.pos] == '\'':
+		s, err := p.quoted('\'')
+		return erlAtom(s), err
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := rune(p.src[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' && c != '@' && c != '-' && c != '.' {
+			break
+		}
+		// A '.' only continues a float such as 1.5, otherwise it ends the term
+		if c == '.' && (p.pos+1 >= len(p.src) || !unicode.IsDigit(rune(p.src[p.pos+1]))) {
+			break
+		}
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+	if word == "" {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	return erlAtom(word), nil
+}
+
+func (p *erlParser) sequence(end string) ([]interface{}, error) {
+	items := []interface{}{}
+	p.skipSpace()
+	if p.consume(end) {
+		return items, nil
+	}
+	for {
+		item, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		p.skipSpace()
+		if p.consume(end) {
+			return items, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected ',' or '%s'", end)
+		}
+	}
+}
+
+func (p *erlParser) quoted(quote byte) (string, error) {
+	p.pos++ // opening quote
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return sb.String(), nil
+		case '\\':
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unterminated escape")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// Registry resources are protobuf messages wrapped in a Signed message and gzipped; see
+// https://github.com/hexpm/specifications/blob/main/registry-v2.md
+
+// HexNamesPayload encodes the Names message listing every package of a repository
+func HexNamesPayload(repository string, names []string) []byte {
+	var b []byte
+	for _, name := range names {
+		var pkg []byte
+		pkg = protowire.AppendTag(pkg, 1, protowire.BytesType)
+		pkg = protowire.AppendString(pkg, name)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, pkg)
+	}
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendString(b, repository)
+}
+
+// HexVersionsPayload encodes the Versions message listing the versions of every package
+func HexVersionsPayload(repository string, versions map[string][]string) []byte {
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b []byte
+	for _, name := range names {
+		var pkg []byte
+		pkg = protowire.AppendTag(pkg, 1, protowire.BytesType)
+		pkg = protowire.AppendString(pkg, name)
+		for _, v := range SortHexVersions(versions[name]) {
+			pkg = protowire.AppendTag(pkg, 2, protowire.BytesType)
+			pkg = protowire.AppendString(pkg, v)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, pkg)
+	}
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendString(b, repository)
+}
+
+// HexPackagePayload encodes the Package message describing the releases of a package
+func HexPackagePayload(repository, name string, releases []*HexRelease) []byte {
+	sorted := append([]*HexRelease(nil), releases...)
+	sort.SliceStable(sorted, func(i, j int) bool { return CompareVersions(sorted[i].Version, sorted[j].Version) < 0 })
+
+	var b []byte
+	for _, r := range sorted {
+		var rel []byte
+		rel = protowire.AppendTag(rel, 1, protowire.BytesType)
+		rel = protowire.AppendString(rel, r.Version)
+		rel = protowire.AppendTag(rel, 2, protowire.BytesType)
+		rel = protowire.AppendBytes(rel, r.InnerChecksum)
+		for _, req := range r.Requirements {
+			var dep []byte
+			dep = protowire.AppendTag(dep, 1, protowire.BytesType)
+			dep = protowire.AppendString(dep, req.Name)
+			dep = protowire.AppendTag(dep, 2, protowire.BytesType)
+			dep = protowire.AppendString(dep, req.Requirement)
+			if req.Optional {
+				dep = protowire.AppendTag(dep, 3, protowire.VarintType)
+				dep = protowire.AppendVarint(dep, 1)
+			}
+			if req.App != "" && req.App != req.Name {
+				dep = protowire.AppendTag(dep, 4, protowire.BytesType)
+				dep = protowire.AppendString(dep, req.App)
+			}
+			if req.Repository != "" {
+				dep = protowire.AppendTag(dep, 5, protowire.BytesType)
+				dep = protowire.AppendString(dep, req.Repository)
+			}
+			rel = protowire.AppendTag(rel, 3, protowire.BytesType)
+			rel = protowire.AppendBytes(rel, dep)
+		}
+		if len(r.OuterChecksum) > 0 {
+			rel = protowire.AppendTag(rel, 5, protowire.BytesType)
+			rel = protowire.AppendBytes(rel, r.OuterChecksum)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, rel)
+	}
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, name)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	return protowire.AppendString(b, repository)
+}
+
+// SignHexResource wraps a registry payload in a Signed message and gzips it. The signature is
+// RSA PKCS #1 v1.5 over the SHA-512 of the payload; without a key the resource is unsigned.
+func SignHexResource(payload []byte, key *rsa.PrivateKey) ([]byte, error) {
+	var signed []byte
+	signed = protowire.AppendTag(signed, 1, protowire.BytesType)
+	signed = protowire.AppendBytes(signed, payload)
+	if key != nil {
+		digest := sha512.Sum512(payload)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA512, digest[:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign registry resource: %w", err)
+		}
+		signed = protowire.AppendTag(signed, 2, protowire.BytesType)
+		signed = protowire.AppendBytes(signed, signature)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(signed); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseHexSigningKey parses the PEM encoded RSA private key registry resources are signed with
+func ParseHexSigningKey(pemData []byte) (*rsa.PrivateKey, error) {
+	key, err := parseRSAPrivateKey(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Hex signing key: %w", err)
+	}
+	return key, nil
+}
+
+// HexPublicKeyPEM returns the public key clients pass to "mix hex.repo add --public-key"
+func HexPublicKeyPEM(key *rsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// SortHexVersions returns versions in ascending order, as the registry lists them
+func SortHexVersions(versions []string) []string {
+	sorted := append([]string(nil), versions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return CompareVersions(sorted[i], sorted[j]) < 0 })
+	return sorted
+}
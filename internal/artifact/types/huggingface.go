@@ -0,0 +1,344 @@
+package types
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+)
+
+// HuggingFaceLFSThreshold is the size from which a file is stored as an LFS object regardless
+// of its extension
+const HuggingFaceLFSThreshold = 10 << 20
+
+var (
+	huggingFaceNamePattern     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,95}$`)
+	huggingFaceRevisionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+	huggingFaceCommitPattern   = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	huggingFaceFilePattern     = regexp.MustCompile(`^((?:[^/]+/)?[^/]+)/resolve/([^/]+)/(.+)$`)
+	huggingFaceInfoPattern     = regexp.MustCompile(`^api/models/((?:[^/]+/)?[^/]+)/revision/([^/]+)$`)
+)
+
+// huggingFaceLFSExtensions are the extensions the Hub's default .gitattributes tracks with LFS
+var huggingFaceLFSExtensions = map[string]bool{
+	".bin": true, ".safetensors": true, ".gguf": true, ".ggml": true, ".onnx": true, ".pt": true,
+	".pth": true, ".ckpt": true, ".h5": true, ".msgpack": true, ".tflite": true, ".pb": true,
+	".ot": true, ".npy": true, ".npz": true, ".pkl": true, ".pickle": true, ".joblib": true,
+	".model": true, ".arrow": true, ".parquet": true, ".zip": true, ".gz": true, ".tar": true,
+}
+
+// HuggingFaceArtifact implements Hugging Face model repository handling; each file is stored
+// per model and branch
+type HuggingFaceArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewHuggingFaceArtifact creates a new Hugging Face model file artifact
+func NewHuggingFaceArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &HuggingFaceArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (h *HuggingFaceArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeHuggingFace
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (h *HuggingFaceArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return h.metadata
+}
+
+// GetPath returns the storage path of the file; the name is the [<org>/]<model> repository id,
+// the version its branch and the file path is carried in the metadata properties
+func (h *HuggingFaceArtifact) GetPath() string {
+	return HuggingFaceFilePath(h.metadata.Name, h.metadata.Version, h.metadata.Properties["file"])
+}
+
+// GetIndexPath returns the revision info path of the model's branch
+func (h *HuggingFaceArtifact) GetIndexPath() string {
+	return HuggingFaceRevisionPath(h.metadata.Name, h.metadata.Version)
+}
+
+// ValidatePath validates a model file path
+func (h *HuggingFaceArtifact) ValidatePath(p string) error {
+	_, err := h.ParsePath(p)
+	return err
+}
+
+// ParsePath parses an [<org>/]<model>/resolve/<revision>/<file> path
+func (h *HuggingFaceArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := huggingFaceFilePattern.FindStringSubmatch(p)
+	if m == nil || !ValidHuggingFaceRepoID(m[1]) || !ValidHuggingFaceRevision(m[2]) || !ValidHuggingFaceFile(m[3]) {
+		return nil, fmt.Errorf("invalid Hugging Face file path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:     m[1],
+		Version:  m[2],
+		Type:     artifact.ArtifactTypeHuggingFace,
+		Path:     p,
+		Metadata: map[string]string{"file": m[3]},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (h *HuggingFaceArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	return HuggingFaceFilePath(info.Name, info.Version, info.Metadata["file"])
+}
+
+// ValidateArtifact accepts any content; model files are opaque
+func (h *HuggingFaceArtifact) ValidateArtifact(content io.Reader) error {
+	return nil
+}
+
+// GetMetadata returns no metadata; model files are opaque
+func (h *HuggingFaceArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// GenerateIndex generates the revision info of the given files, which must belong to one branch
+func (h *HuggingFaceArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	var files []*HuggingFaceFile
+	id := ""
+	for _, info := range artifacts {
+		id = info.Name
+		files = append(files, &HuggingFaceFile{
+			RepoID:   info.Name,
+			Revision: info.Version,
+			Path:     info.Metadata["file"],
+			Size:     info.Size,
+			SHA256:   info.Checksum,
+			BlobID:   info.Metadata["blob_id"],
+			LFS:      info.Metadata["lfs"] == "true",
+		})
+	}
+	return GenerateHuggingFaceRevisionInfo(id, files, false)
+}
+
+// GetEndpoints returns Hugging Face Hub endpoints
+func (h *HuggingFaceArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /api/models/[{org}/]{model}",
+		"GET /api/models/[{org}/]{model}/revision/{revision}",
+		"GET /[{org}/]{model}/resolve/{revision}/{file}",
+		"HEAD /[{org}/]{model}/resolve/{revision}/{file}",
+		"PUT /[{org}/]{model}/resolve/{revision}/{file}",
+		"DELETE /[{org}/]{model}/resolve/{revision}/{file}",
+	}
+}
+
+// HuggingFaceFilePath returns the storage path of a file at a revision; id is [<org>/]<model>
+func HuggingFaceFilePath(id, revision, file string) string {
+	return id + "/resolve/" + revision + "/" + file
+}
+
+// HuggingFaceRevisionPath returns the Hub API path of a revision's info; remote repositories
+// cache it at this path
+func HuggingFaceRevisionPath(id, revision string) string {
+	return "api/models/" + id + "/revision/" + revision
+}
+
+// IsHuggingFaceMutablePath reports whether p is the revision info of a branch or tag, which
+// moves as commits are pushed; files and the info of commits never change
+func IsHuggingFaceMutablePath(p string) bool {
+	m := huggingFaceInfoPattern.FindStringSubmatch(p)
+	return m != nil && !IsHuggingFaceCommit(m[2])
+}
+
+// ValidHuggingFaceRepoID reports whether id is a namespaced <org>/<model> repository id, or the
+// <model> id of a model without a namespace such as gpt2
+func ValidHuggingFaceRepoID(id string) bool {
+	org, model, ok := strings.Cut(id, "/")
+	if !ok {
+		org, model = "", id
+	}
+	return (!ok || huggingFaceNamePattern.MatchString(org)) && huggingFaceNamePattern.MatchString(model) &&
+		!strings.Contains(id, "..") && !strings.HasSuffix(model, ".git")
+}
+
+// ValidHuggingFaceRevision reports whether revision is a branch name or commit id; revisions
+// containing "/", such as refs/pr/1, are not supported
+func ValidHuggingFaceRevision(revision string) bool {
+	return huggingFaceRevisionPattern.MatchString(revision) && !strings.Contains(revision, "..")
+}
+
+// IsHuggingFaceCommit reports whether revision is a full commit id rather than a branch name
+func IsHuggingFaceCommit(revision string) bool {
+	return huggingFaceCommitPattern.MatchString(revision)
+}
+
+// ValidHuggingFaceFile reports whether file is a relative path inside a model repository
+func ValidHuggingFaceFile(file string) bool {
+	if file == "" || len(file) > 1024 || path.Clean(file) != file || strings.HasPrefix(file, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(file, "/") {
+		if segment == "." || segment == ".." || segment == ".git" {
+			return false
+		}
+	}
+	return true
+}
+
+// IsHuggingFaceLFSFile reports whether a file is stored as an LFS object, as the Hub does for
+// weights and other binary formats and for any file of HuggingFaceLFSThreshold or more
+func IsHuggingFaceLFSFile(file string, size int64) bool {
+	return size >= HuggingFaceLFSThreshold || huggingFaceLFSExtensions[strings.ToLower(path.Ext(file))]
+}
+
+// HuggingFaceLFSPointer returns the Git LFS pointer committed in place of an LFS object
+func HuggingFaceLFSPointer(sha256 string, size int64) []byte {
+	return []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", sha256, size))
+}
+
+// GitBlobID returns the Git object id of a blob of the given size read from r, the ETag the
+// Hub serves for files not stored with LFS
+func GitBlobID(r io.Reader, size int64) (string, error) {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	if n != size {
+		return "", fmt.Errorf("blob is %d bytes, expected %d", n, size)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HuggingFaceFile is a file uploaded to a branch of a model repository
+type HuggingFaceFile struct {
+	// RepoID is [<org>/]<model>
+	RepoID   string
+	Revision string
+	Path     string
+	Size     int64
+	// SHA256 is the hex encoded digest of the content
+	SHA256 string
+	// BlobID is the Git object id of the committed blob: the content, or its LFS pointer
+	BlobID string
+	LFS    bool
+	// LastModified is when the file was uploaded; it is not part of the properties
+	LastModified time.Time
+}
+
+// ETag returns the entity tag the Hub serves for the file: the SHA-256 of an LFS object and
+// the blob id otherwise
+func (f *HuggingFaceFile) ETag() string {
+	if f.LFS {
+		return f.SHA256
+	}
+	return f.BlobID
+}
+
+// Properties returns the properties persisted with an uploaded file
+func (f *HuggingFaceFile) Properties() map[string]string {
+	return map[string]string{
+		"type":     "huggingface-file",
+		"repo_id":  f.RepoID,
+		"revision": f.Revision,
+		"file":     f.Path,
+		"size":     strconv.FormatInt(f.Size, 10),
+		"sha256":   f.SHA256,
+		"blob_id":  f.BlobID,
+		"lfs":      strconv.FormatBool(f.LFS),
+	}
+}
+
+// HuggingFaceFileFromProperties restores a file from the properties returned by Properties
+func HuggingFaceFileFromProperties(props map[string]string) (*HuggingFaceFile, error) {
+	if props["type"] != "huggingface-file" || !ValidHuggingFaceRepoID(props["repo_id"]) ||
+		!ValidHuggingFaceRevision(props["revision"]) || !ValidHuggingFaceFile(props["file"]) {
+		return nil, fmt.Errorf("invalid Hugging Face file %s %s %s", props["repo_id"], props["revision"], props["file"])
+	}
+	size, err := strconv.ParseInt(props["size"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Hugging Face file size %q", props["size"])
+	}
+	return &HuggingFaceFile{
+		RepoID:   props["repo_id"],
+		Revision: props["revision"],
+		Path:     props["file"],
+		Size:     size,
+		SHA256:   props["sha256"],
+		BlobID:   props["blob_id"],
+		LFS:      props["lfs"] == "true",
+	}, nil
+}
+
+// HuggingFaceCommit returns the commit id of a branch holding files. Branches are not backed by
+// Git history, so the id is derived from the paths and blob ids of the files: it changes
+// whenever a file is added, replaced or removed.
+func HuggingFaceCommit(files []*HuggingFaceFile) string {
+	entries := make([]string, 0, len(files))
+	for _, f := range files {
+		entries = append(entries, f.Path+"\x00"+f.BlobID+"\n")
+	}
+	sort.Strings(entries)
+	h := sha1.New()
+	for _, entry := range entries {
+		io.WriteString(h, entry)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GenerateHuggingFaceRevisionInfo builds the model info huggingface_hub reads from
+// /api/models/<id>/revision/<revision>: the commit id and the files ("siblings") of the
+// revision. With blobs set, each sibling also carries its blob id, size and LFS pointer.
+func GenerateHuggingFaceRevisionInfo(id string, files []*HuggingFaceFile, blobs bool) ([]byte, error) {
+	type lfs struct {
+		SHA256      string `json:"sha256"`
+		Size        int64  `json:"size"`
+		PointerSize int    `json:"pointerSize"`
+	}
+	type sibling struct {
+		RFilename string `json:"rfilename"`
+		BlobID    string `json:"blobId,omitempty"`
+		Size      *int64 `json:"size,omitempty"`
+		LFS       *lfs   `json:"lfs,omitempty"`
+	}
+
+	sorted := append([]*HuggingFaceFile(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	siblings := make([]sibling, 0, len(sorted))
+	var lastModified time.Time
+	for _, f := range sorted {
+		if f.LastModified.After(lastModified) {
+			lastModified = f.LastModified
+		}
+		s := sibling{RFilename: f.Path}
+		if blobs {
+			size := f.Size
+			s.BlobID, s.Size = f.BlobID, &size
+			if f.LFS {
+				s.LFS = &lfs{SHA256: f.SHA256, Size: f.Size, PointerSize: len(HuggingFaceLFSPointer(f.SHA256, f.Size))}
+			}
+		}
+		siblings = append(siblings, s)
+	}
+
+	author, _, _ := strings.Cut(id, "/")
+	doc := map[string]interface{}{
+		"id":       id,
+		"modelId":  id,
+		"author":   author,
+		"sha":      HuggingFaceCommit(files),
+		"private":  false,
+		"disabled": false,
+		"gated":    false,
+		"tags":     []string{},
+		"siblings": siblings,
+	}
+	if !lastModified.IsZero() {
+		doc["lastModified"] = lastModified.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,177 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+var (
+	lfsOIDPattern  = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	lfsPathPattern = regexp.MustCompile(`^([0-9a-f]{2})/([0-9a-f]{2})/([0-9a-f]{64})$`)
+)
+
+// LFSArtifact implements Git LFS object handling; objects are addressed by the SHA-256 of their content
+type LFSArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewLFSArtifact creates a new Git LFS object artifact
+func NewLFSArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &LFSArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (l *LFSArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeLFS
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (l *LFSArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return l.metadata
+}
+
+// GetPath returns the storage path of the object; the name is its OID
+func (l *LFSArtifact) GetPath() string {
+	return LFSObjectPath(l.metadata.Name)
+}
+
+// GetIndexPath returns the batch endpoint objects are negotiated through
+func (l *LFSArtifact) GetIndexPath() string {
+	return "objects/batch"
+}
+
+// ValidatePath validates an object path
+func (l *LFSArtifact) ValidatePath(p string) error {
+	_, err := l.ParsePath(p)
+	return err
+}
+
+// ParsePath parses the OID of an <oid[0:2]>/<oid[2:4]>/<oid> object path
+func (l *LFSArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := lfsPathPattern.FindStringSubmatch(p)
+	if m == nil || m[3][:2] != m[1] || m[3][2:4] != m[2] {
+		return nil, fmt.Errorf("invalid LFS object path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:     m[3],
+		Type:     artifact.ArtifactTypeLFS,
+		Path:     p,
+		Metadata: map[string]string{"oid": m[3]},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (l *LFSArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	return LFSObjectPath(info.Name)
+}
+
+// ValidateArtifact validates that the content hashes to the object's OID
+func (l *LFSArtifact) ValidateArtifact(content io.Reader) error {
+	sum := sha256.New()
+	if _, err := io.Copy(sum, content); err != nil {
+		return err
+	}
+	if l.metadata != nil && l.metadata.Name != "" && hex.EncodeToString(sum.Sum(nil)) != l.metadata.Name {
+		return fmt.Errorf("content does not match OID %s", l.metadata.Name)
+	}
+	return nil
+}
+
+// GetMetadata returns the OID and size of the content
+func (l *LFSArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	sum := sha256.New()
+	size, err := io.Copy(sum, content)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"oid": hex.EncodeToString(sum.Sum(nil)), "size": fmt.Sprint(size)}, nil
+}
+
+// GenerateIndex lists the given objects as LFS pointers
+func (l *LFSArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	objects := []LFSPointer{}
+	for _, info := range artifacts {
+		objects = append(objects, LFSPointer{OID: info.Name, Size: info.Size})
+	}
+	return json.Marshal(map[string]interface{}{"objects": objects})
+}
+
+// GetEndpoints returns Git LFS API endpoints
+func (l *LFSArtifact) GetEndpoints() []string {
+	return []string{
+		"POST /objects/batch",
+		"GET /objects/{oid}",
+		"PUT /objects/{oid}",
+		"POST /objects/verify",
+		"GET /locks",
+		"POST /locks",
+		"POST /locks/verify",
+		"POST /locks/{id}/unlock",
+	}
+}
+
+// LFSObjectPath returns the sharded storage path of an object
+func LFSObjectPath(oid string) string {
+	return storage.ShardedPath(oid)
+}
+
+// ValidLFSOID reports whether oid is a lowercase hex SHA-256
+func ValidLFSOID(oid string) bool {
+	return lfsOIDPattern.MatchString(oid)
+}
+
+// LFSPointer identifies an object by OID and size
+type LFSPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// LFSRef is the Git ref a request is made for
+type LFSRef struct {
+	Name string `json:"name"`
+}
+
+// LFSBatchRequest is the body of POST /objects/batch
+type LFSBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers,omitempty"`
+	Ref       *LFSRef      `json:"ref,omitempty"`
+	Objects   []LFSPointer `json:"objects"`
+	HashAlgo  string       `json:"hash_algo,omitempty"`
+}
+
+// LFSAction tells the client where and how to transfer an object
+type LFSAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+// LFSObjectError reports why a single object of a batch cannot be transferred
+type LFSObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// LFSObjectResult is the batch response for one object. Actions is empty when there is
+// nothing to transfer, such as an upload of an object the server already has.
+type LFSObjectResult struct {
+	OID           string                `json:"oid"`
+	Size          int64                 `json:"size"`
+	Authenticated bool                  `json:"authenticated,omitempty"`
+	Actions       map[string]*LFSAction `json:"actions,omitempty"`
+	Error         *LFSObjectError       `json:"error,omitempty"`
+}
+
+// LFSBatchResponse is the body answering POST /objects/batch
+type LFSBatchResponse struct {
+	Transfer string            `json:"transfer"`
+	Objects  []LFSObjectResult `json:"objects"`
+	HashAlgo string            `json:"hash_algo"`
+}
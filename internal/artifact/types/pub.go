@@ -0,0 +1,288 @@
+package types
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	pubNamePattern    = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	pubVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+	pubPathPattern    = regexp.MustCompile(`^packages/([^/]+)/versions/([^/]+)\.tar\.gz$`)
+)
+
+// PubArtifact implements Dart pub package handling
+type PubArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewPubArtifact creates a new pub package artifact
+func NewPubArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &PubArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (p *PubArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypePub
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (p *PubArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return p.metadata
+}
+
+// GetPath returns the storage path of the package archive
+func (p *PubArtifact) GetPath() string {
+	return PubArchivePath(p.metadata.Name, p.metadata.Version)
+}
+
+// GetIndexPath returns the version listing of the package
+func (p *PubArtifact) GetIndexPath() string {
+	return "api/packages/" + p.metadata.Name
+}
+
+// ValidatePath validates a package archive path
+func (p *PubArtifact) ValidatePath(pth string) error {
+	_, err := p.ParsePath(pth)
+	return err
+}
+
+// ParsePath parses a packages/<name>/versions/<version>.tar.gz path
+func (p *PubArtifact) ParsePath(pth string) (*artifact.ArtifactInfo, error) {
+	m := pubPathPattern.FindStringSubmatch(pth)
+	if m == nil || !ValidPubName(m[1]) || !ValidPubVersion(m[2]) {
+		return nil, fmt.Errorf("invalid pub archive path: %s", pth)
+	}
+	return &artifact.ArtifactInfo{
+		Name:    m[1],
+		Version: m[2],
+		Type:    artifact.ArtifactTypePub,
+		Path:    pth,
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (p *PubArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	return PubArchivePath(info.Name, info.Version)
+}
+
+// ValidateArtifact validates that the content is a package archive with a valid pubspec.yaml
+func (p *PubArtifact) ValidateArtifact(content io.Reader) error {
+	_, err := ReadPubArchive(content)
+	return err
+}
+
+// GetMetadata extracts the pubspec of a package archive
+func (p *PubArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	pkg, err := ReadPubArchive(content)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.Properties(), nil
+}
+
+// GenerateIndex generates a version listing of the given archives
+func (p *PubArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	versions := []map[string]string{}
+	for _, info := range artifacts {
+		versions = append(versions, map[string]string{"version": info.Version, "archive_url": info.Path})
+	}
+	return json.Marshal(map[string]interface{}{"versions": versions})
+}
+
+// GetEndpoints returns hosted pub repository endpoints
+func (p *PubArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /api/packages/{name}",
+		"GET /api/packages/versions/new",
+		"POST /api/packages/versions/newUpload",
+		"GET /api/packages/versions/newUploadFinish",
+		"GET /packages/{name}/versions/{version}.tar.gz",
+	}
+}
+
+// PubArchivePath returns the storage path of a package version's archive
+func PubArchivePath(name, version string) string {
+	return fmt.Sprintf("packages/%s/versions/%s.tar.gz", name, version)
+}
+
+// ValidPubName reports whether name is a valid package name
+func ValidPubName(name string) bool {
+	return len(name) <= 64 && pubNamePattern.MatchString(name)
+}
+
+// ValidPubVersion reports whether version is a semantic version
+func ValidPubVersion(version string) bool {
+	return pubVersionPattern.MatchString(version)
+}
+
+// PubPackage is an uploaded package version
+type PubPackage struct {
+	Name    string
+	Version string
+	// Pubspec is pubspec.yaml converted to JSON, as version listings embed it
+	Pubspec json.RawMessage
+	// SHA256 is the hex encoded digest of the archive
+	SHA256 string
+	// Published is the upload time in RFC 3339 format
+	Published string
+}
+
+// Properties returns the properties persisted with an uploaded version
+func (p *PubPackage) Properties() map[string]string {
+	return map[string]string{
+		"type":      "pub-package",
+		"name":      p.Name,
+		"version":   p.Version,
+		"pubspec":   string(p.Pubspec),
+		"sha256":    p.SHA256,
+		"published": p.Published,
+	}
+}
+
+// PubPackageFromProperties restores a version from the properties returned by Properties
+func PubPackageFromProperties(props map[string]string) (*PubPackage, error) {
+	if !ValidPubName(props["name"]) || !ValidPubVersion(props["version"]) || props["pubspec"] == "" {
+		return nil, fmt.Errorf("invalid pub package %s %s", props["name"], props["version"])
+	}
+	return &PubPackage{
+		Name:      props["name"],
+		Version:   props["version"],
+		Pubspec:   json.RawMessage(props["pubspec"]),
+		SHA256:    props["sha256"],
+		Published: props["published"],
+	}, nil
+}
+
+// ReadPubArchive reads pubspec.yaml from the root of a gzipped package tarball
+func ReadPubArchive(content io.Reader) (*PubPackage, error) {
+	gz, err := gzip.NewReader(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid package archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("pubspec.yaml not found in package archive")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid package archive: %w", err)
+		}
+		if path.Clean(strings.TrimPrefix(hdr.Name, "./")) != "pubspec.yaml" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, 1<<20))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pubspec.yaml: %w", err)
+		}
+		return ParsePubspec(data)
+	}
+}
+
+// ParsePubspec validates the name and version of a pubspec.yaml and converts it to JSON
+func ParsePubspec(data []byte) (*PubPackage, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid pubspec.yaml: %w", err)
+	}
+	spec, ok := pubJSONValue(doc).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid pubspec.yaml: not a mapping")
+	}
+	name, _ := spec["name"].(string)
+	version, _ := spec["version"].(string)
+	if !ValidPubName(name) {
+		return nil, fmt.Errorf("invalid package name %q", name)
+	}
+	if !ValidPubVersion(version) {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubspec.yaml: %w", err)
+	}
+	return &PubPackage{Name: name, Version: version, Pubspec: encoded}, nil
+}
+
+// pubJSONValue converts decoded YAML into values encoding/json accepts: mappings with
+// non-string keys become maps keyed by the keys' string form
+func pubJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = pubJSONValue(e)
+		}
+		return t
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = pubJSONValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range t {
+			t[i] = pubJSONValue(e)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// GeneratePubListing builds the /api/packages/<name> response. Versions are listed oldest first;
+// the latest is the newest stable version, or the newest pre-release when there is no stable one.
+func GeneratePubListing(name string, pkgs []*PubPackage, archiveURL func(*PubPackage) string) ([]byte, error) {
+	sorted := append([]*PubPackage(nil), pkgs...)
+	sort.Slice(sorted, func(i, j int) bool { return CompareVersions(sorted[i].Version, sorted[j].Version) < 0 })
+
+	type version struct {
+		Version       string          `json:"version"`
+		Retracted     bool            `json:"retracted"`
+		ArchiveURL    string          `json:"archive_url"`
+		ArchiveSHA256 string          `json:"archive_sha256"`
+		Pubspec       json.RawMessage `json:"pubspec"`
+		Published     string          `json:"published,omitempty"`
+	}
+	versions := make([]version, 0, len(sorted))
+	var latest *version
+	for _, p := range sorted {
+		versions = append(versions, version{
+			Version:       p.Version,
+			ArchiveURL:    archiveURL(p),
+			ArchiveSHA256: p.SHA256,
+			Pubspec:       p.Pubspec,
+			Published:     p.Published,
+		})
+	}
+	for i := range versions {
+		if latest == nil || !isPubPrerelease(versions[i].Version) || isPubPrerelease(latest.Version) {
+			latest = &versions[i]
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"name":           name,
+		"isDiscontinued": false,
+		"latest":         latest,
+		"versions":       versions,
+	})
+}
+
+// isPubPrerelease reports whether a version carries a pre-release suffix; build metadata does not count
+func isPubPrerelease(version string) bool {
+	main, _, _ := strings.Cut(version, "+")
+	return strings.Contains(main, "-")
+}
@@ -0,0 +1,806 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+)
+
+// RPM header tags read from uploaded packages
+const (
+	rpmTagName          = 1000
+	rpmTagVersion       = 1001
+	rpmTagRelease       = 1002
+	rpmTagEpoch         = 1003
+	rpmTagSummary       = 1004
+	rpmTagDescription   = 1005
+	rpmTagBuildTime     = 1006
+	rpmTagBuildHost     = 1007
+	rpmTagSize          = 1009
+	rpmTagVendor        = 1011
+	rpmTagLicense       = 1014
+	rpmTagPackager      = 1015
+	rpmTagGroup         = 1016
+	rpmTagURL           = 1020
+	rpmTagArch          = 1022
+	rpmTagOldFilenames  = 1027
+	rpmTagFileModes     = 1030
+	rpmTagFileFlags     = 1037
+	rpmTagSourceRPM     = 1044
+	rpmTagArchiveSize   = 1046
+	rpmTagProvideName   = 1047
+	rpmTagRequireFlags  = 1048
+	rpmTagRequireName   = 1049
+	rpmTagRequireVer    = 1050
+	rpmTagChangelogTime = 1080
+	rpmTagChangelogName = 1081
+	rpmTagChangelogText = 1082
+	rpmTagProvideFlags  = 1112
+	rpmTagProvideVer    = 1113
+	rpmTagDirIndexes    = 1116
+	rpmTagBaseNames     = 1117
+	rpmTagDirNames      = 1118
+
+	// rpmSigTagPayloadSize is the uncompressed payload size recorded in the signature header
+	rpmSigTagPayloadSize = 1007
+)
+
+const (
+	rpmSenseLess    = 0x02
+	rpmSenseGreater = 0x04
+	rpmSenseEqual   = 0x08
+	rpmSensePrereq  = 0x40 | 0x200 | 0x400
+	rpmFileGhost    = 0x40
+	rpmMaxHeader    = 64 << 20
+)
+
+var (
+	rpmHeaderMagic  = []byte{0x8e, 0xad, 0xe8, 0x01}
+	rpmLeadMagic    = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmPathPattern  = regexp.MustCompile(`^Packages/([^/]+)-([^/-]+)-([^/-]+)\.([^/.]+)\.rpm$`)
+	rpmNamePattern  = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._+-]*$`)
+	rpmPrimaryFiles = regexp.MustCompile(`^(/etc/|/usr/lib/sendmail$|.*bin/)`)
+)
+
+// RPMArtifact implements RPM package handling for YUM/DNF repositories
+type RPMArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewRPMArtifact creates a new RPM artifact
+func NewRPMArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &RPMArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (r *RPMArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeRPM
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (r *RPMArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return r.metadata
+}
+
+// GetPath returns the storage path for the package
+func (r *RPMArtifact) GetPath() string {
+	arch := "noarch"
+	if r.metadata.Properties != nil && r.metadata.Properties["arch"] != "" {
+		arch = r.metadata.Properties["arch"]
+	}
+	return fmt.Sprintf("Packages/%s-%s.%s.rpm", r.metadata.Name, r.metadata.Version, arch)
+}
+
+// GetIndexPath returns the repository metadata index path
+func (r *RPMArtifact) GetIndexPath() string {
+	return "repodata/repomd.xml"
+}
+
+// ValidatePath validates an RPM package path
+func (r *RPMArtifact) ValidatePath(p string) error {
+	if !rpmPathPattern.MatchString(p) {
+		return fmt.Errorf("invalid RPM package path: %s", p)
+	}
+	return nil
+}
+
+// ParsePath parses package information from a Packages/<name>-<version>-<release>.<arch>.rpm path
+func (r *RPMArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := rpmPathPattern.FindStringSubmatch(p)
+	if m == nil {
+		return nil, fmt.Errorf("invalid RPM package path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:    m[1],
+		Version: m[2] + "-" + m[3],
+		Type:    artifact.ArtifactTypeRPM,
+		Path:    p,
+		Metadata: map[string]string{
+			"version":  m[2],
+			"release":  m[3],
+			"arch":     m[4],
+			"filename": path.Base(p),
+		},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (r *RPMArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	arch := info.Metadata["arch"]
+	if arch == "" {
+		arch = "noarch"
+	}
+	return fmt.Sprintf("Packages/%s-%s.%s.rpm", info.Name, info.Version, arch)
+}
+
+// ValidateArtifact validates that the content is an RPM with a readable header
+func (r *RPMArtifact) ValidateArtifact(content io.Reader) error {
+	_, err := ReadRPMHeader(content)
+	return err
+}
+
+// GetMetadata extracts metadata from the RPM header
+func (r *RPMArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	pkg, err := ReadRPMHeader(content)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.Metadata(), nil
+}
+
+// GenerateIndex generates primary.xml for the given packages
+func (r *RPMArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	var pkgs []*RPMPackage
+	for _, a := range artifacts {
+		pkg, err := RPMPackageFromMetadata(a.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", a.Name, err)
+		}
+		if pkg.Location == "" {
+			pkg.Location = a.Path
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	sortRPMPackages(pkgs)
+	return rpmPrimaryXML(pkgs), nil
+}
+
+// GetEndpoints returns YUM/DNF repository endpoints
+func (r *RPMArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /repodata/repomd.xml",
+		"GET /repodata/repomd.xml.asc",
+		"GET /repodata/{checksum}-{primary|filelists|other}.xml.gz",
+		"GET /Packages/{name}-{version}-{release}.{arch}.rpm",
+		"GET /public.key",
+		"POST /api/packages",
+	}
+}
+
+// RPMDependency is a provides/requires entry
+type RPMDependency struct {
+	Name    string `json:"name"`
+	Flags   string `json:"flags,omitempty"`
+	Epoch   string `json:"epoch,omitempty"`
+	Version string `json:"ver,omitempty"`
+	Release string `json:"rel,omitempty"`
+	Pre     bool   `json:"pre,omitempty"`
+}
+
+// RPMFile is a file owned by a package
+type RPMFile struct {
+	Path string `json:"path"`
+	Type string `json:"type,omitempty"` // "", "dir" or "ghost"
+}
+
+// RPMChangelog is a changelog entry
+type RPMChangelog struct {
+	Author string `json:"author"`
+	Date   int64  `json:"date"`
+	Text   string `json:"text"`
+}
+
+// RPMPackage holds the header fields needed to build repodata, plus where the repository stores the package
+type RPMPackage struct {
+	Name          string
+	Epoch         string
+	Version       string
+	Release       string
+	Arch          string
+	Summary       string
+	Description   string
+	URL           string
+	License       string
+	Vendor        string
+	Group         string
+	BuildHost     string
+	SourceRPM     string
+	Packager      string
+	BuildTime     int64
+	InstalledSize int64
+	ArchiveSize   int64
+	HeaderStart   int64
+	HeaderEnd     int64
+	Requires      []RPMDependency
+	Provides      []RPMDependency
+	Files         []RPMFile
+	Changelogs    []RPMChangelog
+
+	// Set by the repository
+	Location    string
+	Checksum    string
+	PackageSize int64
+	FileTime    int64
+}
+
+// Filename returns the canonical <name>-<version>-<release>.<arch>.rpm file name
+func (p *RPMPackage) Filename() string {
+	return fmt.Sprintf("%s-%s-%s.%s.rpm", p.Name, p.Version, p.Release, p.Arch)
+}
+
+// Metadata returns the properties persisted with an uploaded package
+func (p *RPMPackage) Metadata() map[string]string {
+	requires, _ := json.Marshal(p.Requires)
+	provides, _ := json.Marshal(p.Provides)
+	files, _ := json.Marshal(p.Files)
+	changelogs, _ := json.Marshal(p.Changelogs)
+	return map[string]string{
+		"type":           "rpm-package",
+		"format":         "rpm",
+		"name":           p.Name,
+		"epoch":          p.Epoch,
+		"version":        p.Version,
+		"release":        p.Release,
+		"arch":           p.Arch,
+		"summary":        p.Summary,
+		"description":    p.Description,
+		"url":            p.URL,
+		"license":        p.License,
+		"vendor":         p.Vendor,
+		"group":          p.Group,
+		"buildhost":      p.BuildHost,
+		"sourcerpm":      p.SourceRPM,
+		"packager":       p.Packager,
+		"buildtime":      strconv.FormatInt(p.BuildTime, 10),
+		"installed_size": strconv.FormatInt(p.InstalledSize, 10),
+		"archive_size":   strconv.FormatInt(p.ArchiveSize, 10),
+		"header_start":   strconv.FormatInt(p.HeaderStart, 10),
+		"header_end":     strconv.FormatInt(p.HeaderEnd, 10),
+		"requires":       string(requires),
+		"provides":       string(provides),
+		"files":          string(files),
+		"changelogs":     string(changelogs),
+		"filename":       p.Filename(),
+	}
+}
+
+// RPMPackageFromMetadata restores a package from the properties produced by Metadata
+func RPMPackageFromMetadata(props map[string]string) (*RPMPackage, error) {
+	p := &RPMPackage{
+		Name:        props["name"],
+		Epoch:       props["epoch"],
+		Version:     props["version"],
+		Release:     props["release"],
+		Arch:        props["arch"],
+		Summary:     props["summary"],
+		Description: props["description"],
+		URL:         props["url"],
+		License:     props["license"],
+		Vendor:      props["vendor"],
+		Group:       props["group"],
+		BuildHost:   props["buildhost"],
+		SourceRPM:   props["sourcerpm"],
+		Packager:    props["packager"],
+		Location:    props["location"],
+		Checksum:    props["sha256"],
+	}
+	if p.Name == "" || p.Version == "" || p.Arch == "" {
+		return nil, fmt.Errorf("missing RPM header properties")
+	}
+	p.BuildTime, _ = strconv.ParseInt(props["buildtime"], 10, 64)
+	p.InstalledSize, _ = strconv.ParseInt(props["installed_size"], 10, 64)
+	p.ArchiveSize, _ = strconv.ParseInt(props["archive_size"], 10, 64)
+	p.HeaderStart, _ = strconv.ParseInt(props["header_start"], 10, 64)
+	p.HeaderEnd, _ = strconv.ParseInt(props["header_end"], 10, 64)
+	p.PackageSize, _ = strconv.ParseInt(props["size"], 10, 64)
+
+	for key, target := range map[string]interface{}{
+		"requires":   &p.Requires,
+		"provides":   &p.Provides,
+		"files":      &p.Files,
+		"changelogs": &p.Changelogs,
+	} {
+		if props[key] == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(props[key]), target); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return p, nil
+}
+
+// rpmHeader is a parsed header structure (signature or main header)
+type rpmHeader struct {
+	entries map[int32]rpmHeaderEntry
+	store   []byte
+}
+
+type rpmHeaderEntry struct {
+	typ    uint32
+	offset uint32
+	count  uint32
+}
+
+// readRPMHeaderStructure reads one header structure and returns it with its on-disk length
+func readRPMHeaderStructure(r io.Reader) (*rpmHeader, int64, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, 0, fmt.Errorf("truncated RPM header")
+	}
+	if !bytes.Equal(intro[:4], rpmHeaderMagic) {
+		return nil, 0, fmt.Errorf("bad RPM header magic")
+	}
+	nindex := binary.BigEndian.Uint32(intro[8:12])
+	hsize := binary.BigEndian.Uint32(intro[12:16])
+	if int64(nindex)*16+int64(hsize) > rpmMaxHeader {
+		return nil, 0, fmt.Errorf("RPM header too large")
+	}
+
+	index := make([]byte, int(nindex)*16)
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, 0, fmt.Errorf("truncated RPM header index")
+	}
+	h := &rpmHeader{entries: make(map[int32]rpmHeaderEntry, nindex), store: make([]byte, hsize)}
+	if _, err := io.ReadFull(r, h.store); err != nil {
+		return nil, 0, fmt.Errorf("truncated RPM header store")
+	}
+	for i := 0; i < int(nindex); i++ {
+		e := index[i*16 : i*16+16]
+		h.entries[int32(binary.BigEndian.Uint32(e[0:4]))] = rpmHeaderEntry{
+			typ:    binary.BigEndian.Uint32(e[4:8]),
+			offset: binary.BigEndian.Uint32(e[8:12]),
+			count:  binary.BigEndian.Uint32(e[12:16]),
+		}
+	}
+	return h, 16 + int64(nindex)*16 + int64(hsize), nil
+}
+
+// strings returns a STRING, STRING_ARRAY or I18NSTRING tag as a slice
+func (h *rpmHeader) strings(tag int32) []string {
+	e, ok := h.entries[tag]
+	if !ok || (e.typ != 6 && e.typ != 8 && e.typ != 9) || int(e.offset) >= len(h.store) {
+		return nil
+	}
+	count := int(e.count)
+	if e.typ == 6 {
+		count = 1
+	}
+	var out []string
+	data := h.store[e.offset:]
+	for i := 0; i < count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			break
+		}
+		out = append(out, string(data[:end]))
+		data = data[end+1:]
+	}
+	return out
+}
+
+// string returns the first value of a string tag
+func (h *rpmHeader) string(tag int32) string {
+	if values := h.strings(tag); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ints returns an INT16, INT32 or INT64 tag as a slice
+func (h *rpmHeader) ints(tag int32) []int64 {
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	size := map[uint32]int{3: 2, 4: 4, 5: 8}[e.typ]
+	if size == 0 || int(e.offset)+int(e.count)*size > len(h.store) {
+		return nil
+	}
+	out := make([]int64, e.count)
+	for i := range out {
+		b := h.store[int(e.offset)+i*size:]
+		switch size {
+		case 2:
+			out[i] = int64(binary.BigEndian.Uint16(b))
+		case 4:
+			out[i] = int64(binary.BigEndian.Uint32(b))
+		case 8:
+			out[i] = int64(binary.BigEndian.Uint64(b))
+		}
+	}
+	return out
+}
+
+// int returns the first value of an integer tag
+func (h *rpmHeader) int(tag int32) (int64, bool) {
+	if values := h.ints(tag); len(values) > 0 {
+		return values[0], true
+	}
+	return 0, false
+}
+
+// ReadRPMHeader reads the lead, signature header and main header of an RPM package
+func ReadRPMHeader(content io.Reader) (*RPMPackage, error) {
+	r := bufio.NewReader(content)
+	lead := make([]byte, 96)
+	if _, err := io.ReadFull(r, lead); err != nil || !bytes.Equal(lead[:4], rpmLeadMagic) {
+		return nil, fmt.Errorf("not an RPM package: missing lead")
+	}
+
+	sig, sigLen, err := readRPMHeaderStructure(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature header: %w", err)
+	}
+	// The signature header is padded to an 8 byte boundary
+	pad := (8 - sigLen%8) % 8
+	if _, err := r.Discard(int(pad)); err != nil {
+		return nil, fmt.Errorf("truncated RPM signature header")
+	}
+
+	h, headerLen, err := readRPMHeaderStructure(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RPM header: %w", err)
+	}
+
+	p := &RPMPackage{
+		Name:        h.string(rpmTagName),
+		Epoch:       "0",
+		Version:     h.string(rpmTagVersion),
+		Release:     h.string(rpmTagRelease),
+		Arch:        h.string(rpmTagArch),
+		Summary:     h.string(rpmTagSummary),
+		Description: h.string(rpmTagDescription),
+		URL:         h.string(rpmTagURL),
+		License:     h.string(rpmTagLicense),
+		Vendor:      h.string(rpmTagVendor),
+		Group:       h.string(rpmTagGroup),
+		BuildHost:   h.string(rpmTagBuildHost),
+		SourceRPM:   h.string(rpmTagSourceRPM),
+		Packager:    h.string(rpmTagPackager),
+		HeaderStart: 96 + sigLen + pad,
+	}
+	p.HeaderEnd = p.HeaderStart + headerLen
+	if epoch, ok := h.int(rpmTagEpoch); ok {
+		p.Epoch = strconv.FormatInt(epoch, 10)
+	}
+	if p.SourceRPM == "" {
+		// Source packages carry no SOURCERPM tag and are published with the "src" arch
+		p.Arch = "src"
+	}
+	p.BuildTime, _ = h.int(rpmTagBuildTime)
+	p.InstalledSize, _ = h.int(rpmTagSize)
+	if size, ok := sig.int(rpmSigTagPayloadSize); ok {
+		p.ArchiveSize = size
+	} else {
+		p.ArchiveSize, _ = h.int(rpmTagArchiveSize)
+	}
+
+	if !rpmNamePattern.MatchString(p.Name) {
+		return nil, fmt.Errorf("invalid RPM name %q", p.Name)
+	}
+	for field, value := range map[string]string{"version": p.Version, "release": p.Release, "arch": p.Arch} {
+		if value == "" || strings.ContainsAny(value, "/- ") {
+			return nil, fmt.Errorf("invalid RPM %s %q", field, value)
+		}
+	}
+
+	p.Provides = rpmDependencies(h.strings(rpmTagProvideName), h.ints(rpmTagProvideFlags), h.strings(rpmTagProvideVer))
+	for _, d := range rpmDependencies(h.strings(rpmTagRequireName), h.ints(rpmTagRequireFlags), h.strings(rpmTagRequireVer)) {
+		// rpmlib() capabilities are satisfied by rpm itself and are not listed in repodata
+		if !strings.HasPrefix(d.Name, "rpmlib(") {
+			p.Requires = append(p.Requires, d)
+		}
+	}
+	p.Files = rpmFiles(h)
+
+	times := h.ints(rpmTagChangelogTime)
+	names := h.strings(rpmTagChangelogName)
+	texts := h.strings(rpmTagChangelogText)
+	for i := 0; i < len(times) && i < len(names) && i < len(texts); i++ {
+		p.Changelogs = append(p.Changelogs, RPMChangelog{Author: names[i], Date: times[i], Text: texts[i]})
+	}
+	return p, nil
+}
+
+// rpmDependencies zips the name/flags/version arrays of a dependency tag set
+func rpmDependencies(names []string, flags []int64, versions []string) []RPMDependency {
+	deps := make([]RPMDependency, 0, len(names))
+	for i, name := range names {
+		d := RPMDependency{Name: name}
+		var f int64
+		if i < len(flags) {
+			f = flags[i]
+		}
+		d.Pre = f&rpmSensePrereq != 0
+		switch f & (rpmSenseLess | rpmSenseGreater | rpmSenseEqual) {
+		case rpmSenseEqual:
+			d.Flags = "EQ"
+		case rpmSenseLess:
+			d.Flags = "LT"
+		case rpmSenseGreater:
+			d.Flags = "GT"
+		case rpmSenseLess | rpmSenseEqual:
+			d.Flags = "LE"
+		case rpmSenseGreater | rpmSenseEqual:
+			d.Flags = "GE"
+		}
+		if d.Flags != "" && i < len(versions) && versions[i] != "" {
+			d.Epoch, d.Version, d.Release = splitEVR(versions[i])
+		}
+		deps = append(deps, d)
+	}
+	return deps
+}
+
+// splitEVR splits [epoch:]version[-release]; the epoch defaults to 0
+func splitEVR(evr string) (epoch, version, release string) {
+	epoch = "0"
+	if i := strings.Index(evr, ":"); i >= 0 {
+		epoch, evr = evr[:i], evr[i+1:]
+	}
+	version = evr
+	if i := strings.LastIndex(evr, "-"); i >= 0 {
+		version, release = evr[:i], evr[i+1:]
+	}
+	return epoch, version, release
+}
+
+// rpmFiles lists package files from the compressed (dirnames/basenames) or legacy file list
+func rpmFiles(h *rpmHeader) []RPMFile {
+	var paths []string
+	if basenames := h.strings(rpmTagBaseNames); len(basenames) > 0 {
+		dirnames := h.strings(rpmTagDirNames)
+		indexes := h.ints(rpmTagDirIndexes)
+		for i, base := range basenames {
+			dir := ""
+			if i < len(indexes) && int(indexes[i]) < len(dirnames) {
+				dir = dirnames[indexes[i]]
+			}
+			paths = append(paths, dir+base)
+		}
+	} else {
+		paths = h.strings(rpmTagOldFilenames)
+	}
+
+	modes := h.ints(rpmTagFileModes)
+	flags := h.ints(rpmTagFileFlags)
+	files := make([]RPMFile, 0, len(paths))
+	for i, p := range paths {
+		f := RPMFile{Path: p}
+		if i < len(flags) && flags[i]&rpmFileGhost != 0 {
+			f.Type = "ghost"
+		} else if i < len(modes) && modes[i]&0170000 == 0040000 {
+			f.Type = "dir"
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// RPMRepodataFile is a compressed metadata file referenced from repomd.xml
+type RPMRepodataFile struct {
+	Name    string
+	Content []byte
+}
+
+// RPMRepodata is a complete set of repository metadata
+type RPMRepodata struct {
+	RepoMD []byte
+	Files  []RPMRepodataFile
+}
+
+// File returns the metadata file with the given name under repodata/
+func (r *RPMRepodata) File(name string) ([]byte, bool) {
+	for _, f := range r.Files {
+		if f.Name == name {
+			return f.Content, true
+		}
+	}
+	return nil, false
+}
+
+// GenerateRPMRepodata builds repomd.xml with primary, filelists and other metadata for the packages
+func GenerateRPMRepodata(pkgs []*RPMPackage, timestamp int64) *RPMRepodata {
+	sorted := make([]*RPMPackage, len(pkgs))
+	copy(sorted, pkgs)
+	sortRPMPackages(sorted)
+
+	data := []struct {
+		typ     string
+		content []byte
+	}{
+		{"primary", rpmPrimaryXML(sorted)},
+		{"filelists", rpmFilelistsXML(sorted)},
+		{"other", rpmOtherXML(sorted)},
+	}
+
+	repodata := &RPMRepodata{}
+	var repomd bytes.Buffer
+	repomd.WriteString(xml.Header)
+	repomd.WriteString(`<repomd xmlns="http://linux.duke.edu/metadata/repo" xmlns:rpm="http://linux.duke.edu/metadata/rpm">` + "\n")
+	fmt.Fprintf(&repomd, "  <revision>%d</revision>\n", timestamp)
+	for _, d := range data {
+		compressed := rpmGzip(d.content)
+		checksum := sha256Hex(compressed)
+		name := fmt.Sprintf("%s-%s.xml.gz", checksum, d.typ)
+		repodata.Files = append(repodata.Files, RPMRepodataFile{Name: name, Content: compressed})
+
+		fmt.Fprintf(&repomd, "  <data type=\"%s\">\n", d.typ)
+		fmt.Fprintf(&repomd, "    <checksum type=\"sha256\">%s</checksum>\n", checksum)
+		fmt.Fprintf(&repomd, "    <open-checksum type=\"sha256\">%s</open-checksum>\n", sha256Hex(d.content))
+		fmt.Fprintf(&repomd, "    <location href=\"repodata/%s\"/>\n", name)
+		fmt.Fprintf(&repomd, "    <timestamp>%d</timestamp>\n", timestamp)
+		fmt.Fprintf(&repomd, "    <size>%d</size>\n", len(compressed))
+		fmt.Fprintf(&repomd, "    <open-size>%d</open-size>\n", len(d.content))
+		repomd.WriteString("  </data>\n")
+	}
+	repomd.WriteString("</repomd>\n")
+	repodata.RepoMD = repomd.Bytes()
+	return repodata
+}
+
+// sortRPMPackages orders packages by name, arch, version and release so generated metadata is deterministic
+func sortRPMPackages(pkgs []*RPMPackage) {
+	sort.Slice(pkgs, func(i, j int) bool {
+		a, b := pkgs[i], pkgs[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Arch != b.Arch {
+			return a.Arch < b.Arch
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		if a.Release != b.Release {
+			return a.Release < b.Release
+		}
+		return a.Location < b.Location
+	})
+}
+
+// rpmGzip compresses metadata deterministically
+func rpmGzip(data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(data)
+	_ = gz.Close()
+	return buf.Bytes()
+}
+
+// xmlEscape escapes text for element content and attribute values
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func rpmVersionXML(p *RPMPackage) string {
+	return fmt.Sprintf(`<version epoch="%s" ver="%s" rel="%s"/>`, xmlEscape(p.Epoch), xmlEscape(p.Version), xmlEscape(p.Release))
+}
+
+func rpmEntriesXML(buf *bytes.Buffer, element string, deps []RPMDependency) {
+	if len(deps) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "    <rpm:%s>\n", element)
+	for _, d := range deps {
+		fmt.Fprintf(buf, `      <rpm:entry name="%s"`, xmlEscape(d.Name))
+		if d.Flags != "" {
+			fmt.Fprintf(buf, ` flags="%s" epoch="%s" ver="%s"`, d.Flags, xmlEscape(d.Epoch), xmlEscape(d.Version))
+			if d.Release != "" {
+				fmt.Fprintf(buf, ` rel="%s"`, xmlEscape(d.Release))
+			}
+		}
+		if d.Pre {
+			buf.WriteString(` pre="1"`)
+		}
+		buf.WriteString("/>\n")
+	}
+	fmt.Fprintf(buf, "    </rpm:%s>\n", element)
+}
+
+func rpmFileXML(buf *bytes.Buffer, indent string, f RPMFile) {
+	if f.Type != "" {
+		fmt.Fprintf(buf, "%s<file type=\"%s\">%s</file>\n", indent, f.Type, xmlEscape(f.Path))
+		return
+	}
+	fmt.Fprintf(buf, "%s<file>%s</file>\n", indent, xmlEscape(f.Path))
+}
+
+// rpmPrimaryXML renders primary.xml
+func rpmPrimaryXML(pkgs []*RPMPackage) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="%d">`+"\n", len(pkgs))
+	for _, p := range pkgs {
+		buf.WriteString("<package type=\"rpm\">\n")
+		fmt.Fprintf(&buf, "  <name>%s</name>\n", xmlEscape(p.Name))
+		fmt.Fprintf(&buf, "  <arch>%s</arch>\n", xmlEscape(p.Arch))
+		fmt.Fprintf(&buf, "  %s\n", rpmVersionXML(p))
+		fmt.Fprintf(&buf, "  <checksum type=\"sha256\" pkgid=\"YES\">%s</checksum>\n", p.Checksum)
+		fmt.Fprintf(&buf, "  <summary>%s</summary>\n", xmlEscape(p.Summary))
+		fmt.Fprintf(&buf, "  <description>%s</description>\n", xmlEscape(p.Description))
+		fmt.Fprintf(&buf, "  <packager>%s</packager>\n", xmlEscape(p.Packager))
+		fmt.Fprintf(&buf, "  <url>%s</url>\n", xmlEscape(p.URL))
+		fmt.Fprintf(&buf, "  <time file=\"%d\" build=\"%d\"/>\n", p.FileTime, p.BuildTime)
+		fmt.Fprintf(&buf, "  <size package=\"%d\" installed=\"%d\" archive=\"%d\"/>\n", p.PackageSize, p.InstalledSize, p.ArchiveSize)
+		fmt.Fprintf(&buf, "  <location href=\"%s\"/>\n", xmlEscape(p.Location))
+		buf.WriteString("  <format>\n")
+		fmt.Fprintf(&buf, "    <rpm:license>%s</rpm:license>\n", xmlEscape(p.License))
+		fmt.Fprintf(&buf, "    <rpm:vendor>%s</rpm:vendor>\n", xmlEscape(p.Vendor))
+		fmt.Fprintf(&buf, "    <rpm:group>%s</rpm:group>\n", xmlEscape(p.Group))
+		fmt.Fprintf(&buf, "    <rpm:buildhost>%s</rpm:buildhost>\n", xmlEscape(p.BuildHost))
+		fmt.Fprintf(&buf, "    <rpm:sourcerpm>%s</rpm:sourcerpm>\n", xmlEscape(p.SourceRPM))
+		fmt.Fprintf(&buf, "    <rpm:header-range start=\"%d\" end=\"%d\"/>\n", p.HeaderStart, p.HeaderEnd)
+		rpmEntriesXML(&buf, "provides", p.Provides)
+		rpmEntriesXML(&buf, "requires", p.Requires)
+		// primary.xml only carries the files dependency solvers commonly need
+		for _, f := range p.Files {
+			if f.Type != "ghost" && rpmPrimaryFiles.MatchString(f.Path) {
+				rpmFileXML(&buf, "    ", f)
+			}
+		}
+		buf.WriteString("  </format>\n")
+		buf.WriteString("</package>\n")
+	}
+	buf.WriteString("</metadata>\n")
+	return buf.Bytes()
+}
+
+// rpmFilelistsXML renders filelists.xml
+func rpmFilelistsXML(pkgs []*RPMPackage) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<filelists xmlns="http://linux.duke.edu/metadata/filelists" packages="%d">`+"\n", len(pkgs))
+	for _, p := range pkgs {
+		fmt.Fprintf(&buf, "<package pkgid=\"%s\" name=\"%s\" arch=\"%s\">\n", p.Checksum, xmlEscape(p.Name), xmlEscape(p.Arch))
+		fmt.Fprintf(&buf, "  %s\n", rpmVersionXML(p))
+		for _, f := range p.Files {
+			rpmFileXML(&buf, "  ", f)
+		}
+		buf.WriteString("</package>\n")
+	}
+	buf.WriteString("</filelists>\n")
+	return buf.Bytes()
+}
+
+// rpmOtherXML renders other.xml
+func rpmOtherXML(pkgs []*RPMPackage) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<otherdata xmlns="http://linux.duke.edu/metadata/other" packages="%d">`+"\n", len(pkgs))
+	for _, p := range pkgs {
+		fmt.Fprintf(&buf, "<package pkgid=\"%s\" name=\"%s\" arch=\"%s\">\n", p.Checksum, xmlEscape(p.Name), xmlEscape(p.Arch))
+		fmt.Fprintf(&buf, "  %s\n", rpmVersionXML(p))
+		for _, c := range p.Changelogs {
+			fmt.Fprintf(&buf, "  <changelog author=\"%s\" date=\"%d\">%s</changelog>\n", xmlEscape(c.Author), c.Date, xmlEscape(c.Text))
+		}
+		buf.WriteString("</package>\n")
+	}
+	buf.WriteString("</otherdata>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,312 @@
+package types
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+)
+
+// SwiftManifestFile is the unqualified package manifest
+const SwiftManifestFile = "Package.swift"
+
+var (
+	swiftScopePattern    = regexp.MustCompile(`^[A-Za-z0-9](-?[A-Za-z0-9])*$`)
+	swiftNamePattern     = regexp.MustCompile(`^[A-Za-z0-9]([-_]?[A-Za-z0-9])*$`)
+	swiftVersionPattern  = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+	swiftManifestPattern = regexp.MustCompile(`^Package(@swift-(\d+(\.\d+){0,2}))?\.swift$`)
+	swiftPathPattern     = regexp.MustCompile(`^([a-z0-9-]+)/([a-z0-9_-]+)/([^/]+)\.zip$`)
+)
+
+// SwiftArtifact implements Swift Package Registry (SE-0292) package handling
+type SwiftArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewSwiftArtifact creates a new Swift package artifact
+func NewSwiftArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &SwiftArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (s *SwiftArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeSwift
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (s *SwiftArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return s.metadata
+}
+
+// GetPath returns the storage path of the source archive; the name is "<scope>.<name>"
+func (s *SwiftArtifact) GetPath() string {
+	scope, name, _ := strings.Cut(s.metadata.Name, ".")
+	return SwiftArchivePath(scope, name, s.metadata.Version)
+}
+
+// GetIndexPath returns the release listing of the package
+func (s *SwiftArtifact) GetIndexPath() string {
+	scope, name, _ := strings.Cut(s.metadata.Name, ".")
+	return strings.ToLower(scope + "/" + name)
+}
+
+// ValidatePath validates a source archive path
+func (s *SwiftArtifact) ValidatePath(p string) error {
+	if !swiftPathPattern.MatchString(p) {
+		return fmt.Errorf("invalid Swift source archive path: %s", p)
+	}
+	return nil
+}
+
+// ParsePath parses package information from a <scope>/<name>/<version>.zip path
+func (s *SwiftArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := swiftPathPattern.FindStringSubmatch(p)
+	if m == nil || !swiftVersionPattern.MatchString(m[3]) {
+		return nil, fmt.Errorf("invalid Swift source archive path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:     m[1] + "." + m[2],
+		Version:  m[3],
+		Type:     artifact.ArtifactTypeSwift,
+		Path:     p,
+		Metadata: map[string]string{"scope": m[1], "package": m[2]},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (s *SwiftArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	scope, name, _ := strings.Cut(info.Name, ".")
+	return SwiftArchivePath(scope, name, info.Version)
+}
+
+// ValidateArtifact validates that the content is a zip source archive with a Package.swift
+func (s *SwiftArtifact) ValidateArtifact(content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	_, err = ReadSwiftSourceArchive(bytes.NewReader(data), int64(len(data)))
+	return err
+}
+
+// GetMetadata extracts the package manifests of a source archive
+func (s *SwiftArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := ReadSwiftSourceArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	encoded, _ := json.Marshal(manifests)
+	return map[string]string{"manifests": string(encoded)}, nil
+}
+
+// GenerateIndex generates the release listing of the given versions
+func (s *SwiftArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	releases := map[string]interface{}{}
+	for _, info := range artifacts {
+		releases[info.Version] = map[string]string{"url": info.Path}
+	}
+	return json.Marshal(map[string]interface{}{"releases": releases})
+}
+
+// GetEndpoints returns Swift Package Registry endpoints
+func (s *SwiftArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /{scope}/{name}",
+		"GET /{scope}/{name}/{version}",
+		"GET /{scope}/{name}/{version}/Package.swift",
+		"GET /{scope}/{name}/{version}.zip",
+		"GET /identifiers?url={url}",
+		"PUT /{scope}/{name}/{version}",
+	}
+}
+
+// SwiftArchivePath returns the storage path of a release's source archive. Package
+// identifiers are case-insensitive, so scope and name are stored lowercased.
+func SwiftArchivePath(scope, name, version string) string {
+	return strings.ToLower(scope+"/"+name) + "/" + version + ".zip"
+}
+
+// ValidSwiftScope reports whether scope is a valid package scope
+func ValidSwiftScope(scope string) bool {
+	return len(scope) <= 39 && swiftScopePattern.MatchString(scope)
+}
+
+// ValidSwiftName reports whether name is a valid package name
+func ValidSwiftName(name string) bool {
+	return len(name) <= 100 && swiftNamePattern.MatchString(name)
+}
+
+// ValidSwiftVersion reports whether version is a semantic version
+func ValidSwiftVersion(version string) bool {
+	return swiftVersionPattern.MatchString(version)
+}
+
+// ReadSwiftSourceArchive returns the package manifests (Package.swift and any
+// Package@swift-<version>.swift) of a source archive. Manifests are looked up at the
+// root of the archive or in a single top-level directory, as "swift package archive-source" creates.
+func ReadSwiftSourceArchive(r io.ReaderAt, size int64) (map[string]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source archive: %w", err)
+	}
+
+	// Manifests of the shallowest directory holding a Package.swift win
+	root, depth := "", -1
+	for _, f := range zr.File {
+		d := strings.Count(f.Name, "/")
+		if path.Base(f.Name) != SwiftManifestFile || d > 1 {
+			continue
+		}
+		if depth < 0 || d < depth {
+			root, depth = path.Dir(f.Name), d
+		}
+	}
+	if depth < 0 {
+		return nil, fmt.Errorf("source archive has no %s", SwiftManifestFile)
+	}
+
+	manifests := map[string]string{}
+	for _, f := range zr.File {
+		if path.Dir(f.Name) != root || !swiftManifestPattern.MatchString(path.Base(f.Name)) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, 1<<20))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		manifests[path.Base(f.Name)] = string(data)
+	}
+	return manifests, nil
+}
+
+// SwiftManifestFor returns the manifest file to serve for a swift-version query: the most
+// specific Package@swift-<version>.swift available, or "" when only Package.swift applies
+func SwiftManifestFor(manifests map[string]string, swiftVersion string) string {
+	parts := strings.Split(swiftVersion, ".")
+	for n := len(parts); n > 0; n-- {
+		name := "Package@swift-" + strings.Join(parts[:n], ".") + ".swift"
+		if _, ok := manifests[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// NormalizeSwiftRepositoryURL reduces the forms a repository URL can take (https, ssh,
+// scp-like, with or without .git) to host/path for identifier lookups
+func NormalizeSwiftRepositoryURL(u string) string {
+	u = strings.ToLower(strings.TrimSpace(u))
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	} else if at := strings.Index(u, "@"); at >= 0 {
+		// scp-like syntax: git@github.com:owner/repo.git
+		u = strings.Replace(u[at+1:], ":", "/", 1)
+	}
+	if at := strings.Index(u, "@"); at >= 0 && at < strings.Index(u+"/", "/") {
+		u = u[at+1:]
+	}
+	u = strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	return u
+}
+
+// SwiftRelease is a published package version
+type SwiftRelease struct {
+	Scope   string
+	Name    string
+	Version string
+
+	// Checksum is the hex encoded SHA-256 of the source archive
+	Checksum  string
+	Manifests map[string]string
+	// Metadata is the release metadata document supplied at publish time
+	Metadata       json.RawMessage
+	RepositoryURLs []string
+
+	Signature       string
+	SignatureFormat string
+	PublishedAt     string
+}
+
+// ID returns the package identifier "<scope>.<name>"
+func (r *SwiftRelease) ID() string {
+	return r.Scope + "." + r.Name
+}
+
+// Properties returns the properties persisted with a published release
+func (r *SwiftRelease) Properties() map[string]string {
+	manifests, _ := json.Marshal(r.Manifests)
+	urls, _ := json.Marshal(r.RepositoryURLs)
+	props := map[string]string{
+		"type":            "swift-release",
+		"scope":           r.Scope,
+		"name":            r.Name,
+		"version":         r.Version,
+		"checksum":        r.Checksum,
+		"manifests":       string(manifests),
+		"repository_urls": string(urls),
+		"published_at":    r.PublishedAt,
+	}
+	if len(r.Metadata) > 0 {
+		props["metadata"] = string(r.Metadata)
+	}
+	if r.Signature != "" {
+		props["signature"] = r.Signature
+		props["signature_format"] = r.SignatureFormat
+	}
+	return props
+}
+
+// SwiftReleaseFromProperties restores a release from the properties returned by Properties
+func SwiftReleaseFromProperties(props map[string]string) (*SwiftRelease, error) {
+	r := &SwiftRelease{
+		Scope:           props["scope"],
+		Name:            props["name"],
+		Version:         props["version"],
+		Checksum:        props["checksum"],
+		Signature:       props["signature"],
+		SignatureFormat: props["signature_format"],
+		PublishedAt:     props["published_at"],
+	}
+	if !ValidSwiftScope(r.Scope) || !ValidSwiftName(r.Name) || !ValidSwiftVersion(r.Version) {
+		return nil, fmt.Errorf("invalid Swift release %s.%s %s", r.Scope, r.Name, r.Version)
+	}
+	if err := json.Unmarshal([]byte(props["manifests"]), &r.Manifests); err != nil {
+		return nil, fmt.Errorf("invalid manifests: %w", err)
+	}
+	if props["repository_urls"] != "" {
+		if err := json.Unmarshal([]byte(props["repository_urls"]), &r.RepositoryURLs); err != nil {
+			return nil, fmt.Errorf("invalid repository URLs: %w", err)
+		}
+	}
+	if props["metadata"] != "" {
+		r.Metadata = json.RawMessage(props["metadata"])
+	}
+	return r, nil
+}
+
+// ParseSwiftReleaseMetadata validates the metadata document of a publish request and returns
+// the repository URLs it declares (SE-0391 "repositoryURLs")
+func ParseSwiftReleaseMetadata(data []byte) ([]string, error) {
+	var metadata struct {
+		RepositoryURLs []string `json:"repositoryURLs"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid release metadata: %w", err)
+	}
+	return metadata.RepositoryURLs, nil
+}
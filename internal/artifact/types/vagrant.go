@@ -0,0 +1,267 @@
+package types
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+)
+
+var (
+	vagrantNamePattern     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	vagrantVersionPattern  = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+	vagrantProviderPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	vagrantPathPattern     = regexp.MustCompile(`^([^/]+)/([^/]+)/([^/]+)/([^/]+)\.box$`)
+)
+
+// VagrantArtifact implements Vagrant box handling; a box file is stored per name, version and provider
+type VagrantArtifact struct {
+	metadata *artifact.Metadata
+}
+
+// NewVagrantArtifact creates a new Vagrant box artifact
+func NewVagrantArtifact(metadata *artifact.Metadata) artifact.Artifact {
+	return &VagrantArtifact{metadata: metadata}
+}
+
+// GetType returns the artifact type
+func (v *VagrantArtifact) GetType() artifact.ArtifactType {
+	return artifact.ArtifactTypeVagrant
+}
+
+// GetArtifactMetadata returns artifact metadata
+func (v *VagrantArtifact) GetArtifactMetadata() *artifact.Metadata {
+	return v.metadata
+}
+
+// GetPath returns the storage path of the box file; the name is <org>/<box> and the provider
+// is carried in the metadata properties
+func (v *VagrantArtifact) GetPath() string {
+	return VagrantBoxPath(v.metadata.Name, v.metadata.Version, v.metadata.Properties["provider"])
+}
+
+// GetIndexPath returns the box metadata path
+func (v *VagrantArtifact) GetIndexPath() string {
+	return v.metadata.Name
+}
+
+// ValidatePath validates a box file path
+func (v *VagrantArtifact) ValidatePath(p string) error {
+	_, err := v.ParsePath(p)
+	return err
+}
+
+// ParsePath parses an <org>/<box>/<version>/<provider>.box path
+func (v *VagrantArtifact) ParsePath(p string) (*artifact.ArtifactInfo, error) {
+	m := vagrantPathPattern.FindStringSubmatch(p)
+	if m == nil || !ValidVagrantName(m[1]) || !ValidVagrantName(m[2]) || !ValidVagrantVersion(m[3]) || !ValidVagrantProvider(m[4]) {
+		return nil, fmt.Errorf("invalid Vagrant box path: %s", p)
+	}
+	return &artifact.ArtifactInfo{
+		Name:     m[1] + "/" + m[2],
+		Version:  m[3],
+		Type:     artifact.ArtifactTypeVagrant,
+		Path:     p,
+		Metadata: map[string]string{"provider": m[4]},
+	}, nil
+}
+
+// GeneratePath creates a storage path for the artifact
+func (v *VagrantArtifact) GeneratePath(info *artifact.ArtifactInfo) string {
+	return VagrantBoxPath(info.Name, info.Version, info.Metadata["provider"])
+}
+
+// ValidateArtifact validates that the content is a box archive whose metadata.json, when it
+// names a provider, agrees with the artifact's provider
+func (v *VagrantArtifact) ValidateArtifact(content io.Reader) error {
+	meta, err := ReadVagrantBoxMetadata(content)
+	if err != nil {
+		return err
+	}
+	if v.metadata != nil && meta["provider"] != "" && v.metadata.Properties["provider"] != "" && meta["provider"] != v.metadata.Properties["provider"] {
+		return fmt.Errorf("box is for provider %s, not %s", meta["provider"], v.metadata.Properties["provider"])
+	}
+	return nil
+}
+
+// GetMetadata returns the string fields of the box's metadata.json
+func (v *VagrantArtifact) GetMetadata(content io.Reader) (map[string]string, error) {
+	return ReadVagrantBoxMetadata(content)
+}
+
+// GenerateIndex generates box metadata for the given box files, which must belong to one box
+func (v *VagrantArtifact) GenerateIndex(artifacts []*artifact.ArtifactInfo) ([]byte, error) {
+	var boxes []*VagrantBox
+	name := ""
+	for _, info := range artifacts {
+		name = info.Name
+		boxes = append(boxes, &VagrantBox{Name: info.Name, Version: info.Version, Provider: info.Metadata["provider"], SHA256: info.Checksum})
+	}
+	return GenerateVagrantMetadata(name, boxes, func(b *VagrantBox) string {
+		return VagrantBoxPath(b.Name, b.Version, b.Provider)
+	})
+}
+
+// GetEndpoints returns Vagrant box endpoints
+func (v *VagrantArtifact) GetEndpoints() []string {
+	return []string{
+		"GET /{org}/{box}",
+		"GET /{org}/{box}/{version}/{provider}.box",
+		"PUT /{org}/{box}/{version}/{provider}.box",
+		"DELETE /{org}/{box}/{version}/{provider}.box",
+	}
+}
+
+// VagrantBoxPath returns the storage path of a box file; name is <org>/<box>
+func VagrantBoxPath(name, version, provider string) string {
+	return fmt.Sprintf("%s/%s/%s.box", name, version, provider)
+}
+
+// ValidVagrantName reports whether s is a valid organization or box name
+func ValidVagrantName(s string) bool {
+	return vagrantNamePattern.MatchString(s)
+}
+
+// ValidVagrantVersion reports whether version has the X, X.Y or X.Y.Z form Vagrant requires
+func ValidVagrantVersion(version string) bool {
+	return vagrantVersionPattern.MatchString(version)
+}
+
+// ValidVagrantProvider reports whether provider is a valid provider name such as "virtualbox"
+func ValidVagrantProvider(provider string) bool {
+	return vagrantProviderPattern.MatchString(provider)
+}
+
+// ReadVagrantBoxMetadata reads metadata.json from a box, a tar archive that may be gzipped
+func ReadVagrantBoxMetadata(content io.Reader) (map[string]string, error) {
+	br := bufio.NewReader(content)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid box archive: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("metadata.json not found in box archive")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid box archive: %w", err)
+		}
+		if path.Clean(strings.TrimPrefix(hdr.Name, "./")) != "metadata.json" {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid metadata.json: %w", err)
+		}
+		meta := map[string]string{}
+		for k, v := range doc {
+			if s, ok := v.(string); ok {
+				meta[k] = s
+			}
+		}
+		return meta, nil
+	}
+}
+
+// VagrantBox is an uploaded box file
+type VagrantBox struct {
+	// Name is <org>/<box>
+	Name     string
+	Version  string
+	Provider string
+	// SHA256 is the hex encoded digest of the box file
+	SHA256 string
+	// Description is the box description given with the upload, if any
+	Description string
+}
+
+// Properties returns the properties persisted with an uploaded box file
+func (b *VagrantBox) Properties() map[string]string {
+	return map[string]string{
+		"type":        "vagrant-box",
+		"name":        b.Name,
+		"version":     b.Version,
+		"provider":    b.Provider,
+		"sha256":      b.SHA256,
+		"description": b.Description,
+	}
+}
+
+// VagrantBoxFromProperties restores a box file from the properties returned by Properties
+func VagrantBoxFromProperties(props map[string]string) (*VagrantBox, error) {
+	org, box, ok := strings.Cut(props["name"], "/")
+	if !ok || !ValidVagrantName(org) || !ValidVagrantName(box) || !ValidVagrantVersion(props["version"]) || !ValidVagrantProvider(props["provider"]) {
+		return nil, fmt.Errorf("invalid Vagrant box %s %s %s", props["name"], props["version"], props["provider"])
+	}
+	return &VagrantBox{
+		Name:        props["name"],
+		Version:     props["version"],
+		Provider:    props["provider"],
+		SHA256:      props["sha256"],
+		Description: props["description"],
+	}, nil
+}
+
+// GenerateVagrantMetadata builds the box metadata "vagrant box add" and "vagrant box outdated"
+// read: versions, newest first, each listing the URL and checksum of its providers. The box
+// description is the one uploaded with the newest version that has one.
+func GenerateVagrantMetadata(name string, boxes []*VagrantBox, boxURL func(*VagrantBox) string) ([]byte, error) {
+	type provider struct {
+		Name         string `json:"name"`
+		URL          string `json:"url"`
+		ChecksumType string `json:"checksum_type,omitempty"`
+		Checksum     string `json:"checksum,omitempty"`
+	}
+	type version struct {
+		Version   string     `json:"version"`
+		Status    string     `json:"status"`
+		Providers []provider `json:"providers"`
+	}
+
+	byVersion := map[string]*version{}
+	versions := []*version{}
+	description, describedVersion := "", ""
+	for _, b := range boxes {
+		if b.Description != "" && (describedVersion == "" || CompareVersions(b.Version, describedVersion) > 0) {
+			description, describedVersion = b.Description, b.Version
+		}
+		v, ok := byVersion[b.Version]
+		if !ok {
+			v = &version{Version: b.Version, Status: "active"}
+			byVersion[b.Version] = v
+			versions = append(versions, v)
+		}
+		p := provider{Name: b.Provider, URL: boxURL(b)}
+		if b.SHA256 != "" {
+			p.ChecksumType, p.Checksum = "sha256", b.SHA256
+		}
+		v.Providers = append(v.Providers, p)
+	}
+	sort.Slice(versions, func(i, j int) bool { return CompareVersions(versions[i].Version, versions[j].Version) > 0 })
+	for _, v := range versions {
+		sort.Slice(v.Providers, func(i, j int) bool { return v.Providers[i].Name < v.Providers[j].Name })
+	}
+
+	doc := map[string]interface{}{"name": name, "versions": versions}
+	if description != "" {
+		doc["description"] = description
+	}
+	return json.Marshal(doc)
+}
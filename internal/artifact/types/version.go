@@ -0,0 +1,57 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two dotted version strings segment by segment.
+// Numeric segments are compared numerically, others lexicographically, and a
+// pre-release suffix (after '-') sorts before the release it belongs to.
+// It returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	aMain, aPre, aHasPre := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	bMain, bPre, bHasPre := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	if c := compareSegments(strings.Split(aMain, "."), strings.Split(bMain, ".")); c != 0 {
+		return c
+	}
+	switch {
+	case aHasPre && !bHasPre:
+		return -1
+	case !aHasPre && bHasPre:
+		return 1
+	case aHasPre && bHasPre:
+		return compareSegments(strings.Split(aPre, "."), strings.Split(bPre, "."))
+	}
+	return 0
+}
+
+func compareSegments(a, b []string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y string
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		xn, xErr := strconv.ParseInt(x, 10, 64)
+		yn, yErr := strconv.ParseInt(y, 10, 64)
+		switch {
+		case xErr == nil && yErr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
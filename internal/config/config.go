@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -24,6 +25,9 @@ type Config struct {
 type ServerConfig struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
+
+	// GRPCPort enables the Bazel remote cache (REAPI) gRPC listener when non-zero
+	GRPCPort int `yaml:"grpc_port,omitempty"`
 }
 
 // DatabaseConfig contains database connection configuration
@@ -42,6 +46,106 @@ type StorageConfig struct {
 	Type      string            `yaml:"type"`
 	LocalPath string            `yaml:"local_path,omitempty"`
 	Options   map[string]string `yaml:"options,omitempty"`
+	// Deduplicate stores identical content once, with references kept in the database
+	Deduplicate bool             `yaml:"deduplicate,omitempty"`
+	Encryption  EncryptionConfig `yaml:"encryption,omitempty"`
+	Tiering     TieringConfig    `yaml:"tiering,omitempty"`
+	// Pools are named storage pools repositories can select with their storage_pool option;
+	// repositories without one use the storage above, which is the "default" pool
+	Pools map[string]StoragePoolConfig `yaml:"pools,omitempty"`
+	Scrub ScrubConfig                  `yaml:"scrub,omitempty"`
+	// Quota limits the artifacts of all repositories together; repositories set their own
+	// quotas with the quota_max_bytes, quota_max_artifacts and quota_soft_percent options
+	Quota QuotaConfig `yaml:"quota,omitempty"`
+}
+
+// StoragePoolConfig describes a storage pool: a backend, configured like StorageConfig, and a
+// path prefix within it. A pool without a type shares the backend of the default pool, so it
+// needs a prefix. Deduplication, encryption and tiering apply to every pool.
+type StoragePoolConfig struct {
+	Type      string            `yaml:"type,omitempty"`
+	LocalPath string            `yaml:"local_path,omitempty"`
+	Options   map[string]string `yaml:"options,omitempty"`
+	Prefix    string            `yaml:"prefix,omitempty"`
+}
+
+// TieringConfig moves content that was not pulled for ColdAfterDays from the storage above to
+// a cold storage, checking every MigrationIntervalMinutes. Pulling cold content moves it back.
+type TieringConfig struct {
+	Enabled                  bool              `yaml:"enabled"`
+	Cold                     ColdStorageConfig `yaml:"cold"`
+	ColdAfterDays            int               `yaml:"cold_after_days,omitempty"`
+	MigrationIntervalMinutes int               `yaml:"migration_interval_minutes,omitempty"`
+}
+
+// ColdStorageConfig describes the cold storage, with the same settings as StorageConfig
+type ColdStorageConfig struct {
+	Type      string            `yaml:"type"`
+	LocalPath string            `yaml:"local_path,omitempty"`
+	Options   map[string]string `yaml:"options,omitempty"`
+}
+
+// ColdAfter returns how long content stays hot after its last pull, 30 days by default
+func (t *TieringConfig) ColdAfter() time.Duration {
+	if t.ColdAfterDays <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(t.ColdAfterDays) * 24 * time.Hour
+}
+
+// MigrationInterval returns how often cold content is looked for, hourly by default
+func (t *TieringConfig) MigrationInterval() time.Duration {
+	if t.MigrationIntervalMinutes <= 0 {
+		return time.Hour
+	}
+	return time.Duration(t.MigrationIntervalMinutes) * time.Minute
+}
+
+// QuotaConfig limits the total size, such as "500GB", and number of artifacts; pushes past a
+// limit are rejected, and pushes past SoftPercent of it (90 by default) publish a warning
+type QuotaConfig struct {
+	MaxBytes     string `yaml:"max_bytes,omitempty"`
+	MaxArtifacts int64  `yaml:"max_artifacts,omitempty"`
+	SoftPercent  int    `yaml:"soft_percent,omitempty"`
+}
+
+// ScrubConfig re-hashes stored content every IntervalHours, at up to RateMBPerSec, to find
+// content that does not match its checksum, records without content and content without
+// records. OnMismatch and OnOrphan are report, quarantine or repair; Ignore lists path patterns
+// of content that has no record by design.
+type ScrubConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	IntervalHours int      `yaml:"interval_hours,omitempty"`
+	RateMBPerSec  int      `yaml:"rate_mb_per_sec,omitempty"`
+	OnMismatch    string   `yaml:"on_mismatch,omitempty"`
+	OnOrphan      string   `yaml:"on_orphan,omitempty"`
+	Ignore        []string `yaml:"ignore,omitempty"`
+}
+
+// Interval returns how often content is scrubbed, daily by default
+func (s *ScrubConfig) Interval() time.Duration {
+	if s.IntervalHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(s.IntervalHours) * time.Hour
+}
+
+// BytesPerSecond returns how fast content is re-hashed, 10 MB per second by default
+func (s *ScrubConfig) BytesPerSecond() int64 {
+	if s.RateMBPerSec <= 0 {
+		return 10 << 20
+	}
+	return int64(s.RateMBPerSec) << 20
+}
+
+// EncryptionConfig contains storage encryption at rest configuration. Master keys are base64
+// encoded 256-bit keys; the first one configured wraps new data keys, in the order Key,
+// the lines of KeyFile, PreviousKeys.
+type EncryptionConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Key          string   `yaml:"key,omitempty"`
+	KeyFile      string   `yaml:"key_file,omitempty"`
+	PreviousKeys []string `yaml:"previous_keys,omitempty"`
 }
 
 // AuthConfig contains authentication configuration
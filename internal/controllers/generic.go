@@ -1,18 +1,28 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
 	"github.com/hbahadorzadeh/ganje/internal/database"
-	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
 	"github.com/hbahadorzadeh/ganje/internal/storage"
 )
 
+// genericPath returns the path of an artifact below its repository, as the stored content and
+// its record are keyed by repoName + "/" + path
+func genericPath(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("path"), "/")
+}
+
 // GenericGet handles generic artifact retrieval
 func GenericGet(db database.DatabaseInterface, storageService storage.Storage, repoName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		path := c.Param("path")
+		path := genericPath(c)
 		
 		// Get artifact from storage
 		reader, err := storageService.Retrieve(c.Request.Context(), repoName+"/"+path)
@@ -22,19 +32,36 @@ func GenericGet(db database.DatabaseInterface, storageService storage.Storage, r
 		}
 		defer reader.Close()
 
-		// Stream the content
-		c.DataFromReader(http.StatusOK, -1, "application/octet-stream", reader, nil)
+		// The size lets streams that cannot seek serve ranges; the checksum is the ETag
+		size, err := storageService.GetSize(c.Request.Context(), repoName+"/"+path)
+		if err != nil {
+			size = -1
+		}
+		checksum, _ := storageService.GetChecksum(c.Request.Context(), repoName+"/"+path)
+
+		// Stream the content, honouring ranges and conditional requests
+		c.Header("Content-Type", "application/octet-stream")
+		storage.ServeContent(c.Writer, c.Request, reader, size, checksum, time.Time{})
 	}
 }
 
-// GenericPut handles generic artifact upload
-func GenericPut(db database.DatabaseInterface, storageService storage.Storage, messagingService messaging.Publisher, repoName string) gin.HandlerFunc {
+// GenericPut handles generic artifact upload through repo, which records the artifact and
+// enforces the quotas of the repository
+func GenericPut(repo repository.Repository, repoName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		path := c.Param("path")
+		path := genericPath(c)
 		
-		// Store artifact in storage
-		err := storageService.Store(c.Request.Context(), repoName+"/"+path, c.Request.Body)
+		// Store and record the artifact; the record is keyed like the stored content
+		err := repo.Push(c.Request.Context(), repoName+"/"+path, c.Request.Body, &artifact.Metadata{
+			Name: path,
+			Size: c.Request.ContentLength,
+		})
 		if err != nil {
+			var quotaErr *repository.QuotaError
+			if errors.As(err, &quotaErr) {
+				c.JSON(quotaErr.Status(), gin.H{"error": quotaErr.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store artifact"})
 			return
 		}
@@ -46,10 +73,10 @@ func GenericPut(db database.DatabaseInterface, storageService storage.Storage, m
 // GenericHead checks generic artifact existence
 func GenericHead(db database.DatabaseInterface, repoName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		path := c.Param("path")
+		path := genericPath(c)
 		
 		// Check if artifact exists in database
-		_, err := db.GetArtifactByPath(c.Request.Context(), repoName, path)
+		_, err := db.GetArtifactByPath(c.Request.Context(), repoName, repoName+"/"+path)
 		if err != nil {
 			c.Status(http.StatusNotFound)
 			return
@@ -62,7 +89,7 @@ func GenericHead(db database.DatabaseInterface, repoName string) gin.HandlerFunc
 // GenericDelete deletes generic artifact
 func GenericDelete(db database.DatabaseInterface, storageService storage.Storage, repoName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		path := c.Param("path")
+		path := genericPath(c)
 		
 		// Delete from storage
 		err := storageService.Delete(c.Request.Context(), repoName+"/"+path)
@@ -72,7 +99,7 @@ func GenericDelete(db database.DatabaseInterface, storageService storage.Storage
 		}
 
 		// Delete from database
-		err = db.DeleteArtifactByPath(c.Request.Context(), repoName, path)
+		err = db.DeleteArtifactByPath(c.Request.Context(), repoName, repoName+"/"+path)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete artifact metadata"})
 			return
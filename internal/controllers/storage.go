@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/config"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// GetDedupSavings reports the storage saved by deduplication, per repository and in total
+func GetDedupSavings(db database.DatabaseInterface, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		savings, err := db.GetDedupSavings(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		total := database.DedupSavings{}
+		for _, repo := range savings {
+			total.Paths += repo.Paths
+			total.LogicalSize += repo.LogicalSize
+			total.StoredSize += repo.StoredSize
+			total.SavedSize += repo.SavedSize
+		}
+		if savings == nil {
+			savings = []*database.DedupSavings{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":      cfg.Storage.Deduplicate,
+			"repositories": savings,
+			"total": gin.H{
+				"paths":        total.Paths,
+				"logical_size": total.LogicalSize,
+				"stored_size":  total.StoredSize,
+				"saved_size":   total.SavedSize,
+			},
+		})
+	}
+}
+
+// KeyRotator rewraps data keys with the primary master key
+type KeyRotator interface {
+	Rotate(ctx context.Context) (int, error)
+}
+
+// RotateEncryptionKeys rewraps every data key of encrypted storage with the primary master key;
+// rotator is nil when encryption is disabled
+func RotateEncryptionKeys(rotator KeyRotator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rotator == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Storage encryption is not enabled"})
+			return
+		}
+		rewrapped, err := rotator.Rotate(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "rewrapped": rewrapped})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rewrapped": rewrapped})
+	}
+}
+
+// StorageScrubber verifies stored content against the database
+type StorageScrubber interface {
+	Start(ctx context.Context) error
+	LastReport() *storage.ScrubReport
+	Running() bool
+}
+
+// GetStorageScrub returns the report of the last storage scrub and whether one is running
+func GetStorageScrub(scrubber StorageScrubber, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scrubber == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Storage scrubbing is not available"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"enabled": cfg.Storage.Scrub.Enabled,
+			"running": scrubber.Running(),
+			"report":  scrubber.LastReport(),
+		})
+	}
+}
+
+// StartStorageScrub starts verifying stored content against the database in the background
+func StartStorageScrub(scrubber StorageScrubber) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scrubber == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Storage scrubbing is not available"})
+			return
+		}
+		if err := scrubber.Start(context.Background()); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "started"})
+	}
+}
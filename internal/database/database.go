@@ -2,12 +2,17 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"time"
 
+	"github.com/hbahadorzadeh/ganje/internal/storage"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // DB wraps GORM database connection
@@ -43,9 +48,44 @@ func New(driver, connectionString string) (*DB, error) {
 	return &DB{conn: db}, nil
 }
 
-// SaveArtifact saves artifact information to database
+// SaveArtifact saves artifact information to database. An artifact already stored at the path
+// in the repository is updated in place, so it keeps its creation time and pull statistics and
+// adds the push count of artifact to its own.
 func (db *DB) SaveArtifact(ctx context.Context, artifact *ArtifactInfo) error {
-	return db.conn.WithContext(ctx).Create(artifact).Error
+	return db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing ArtifactInfo
+		err := tx.Where("repository_id = ? AND path = ?", artifact.RepositoryID, artifact.Path).First(&existing).Error
+		switch {
+		case err == nil:
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return tx.Create(artifact).Error
+		default:
+			return err
+		}
+
+		// New content is written to hot storage and is not yanked
+		err = tx.Model(&existing).Updates(map[string]interface{}{
+			"type":       artifact.Type,
+			"name":       artifact.Name,
+			"version":    artifact.Version,
+			"group":      artifact.Group,
+			"size":       artifact.Size,
+			"checksum":   artifact.Checksum,
+			"metadata":   artifact.Metadata,
+			"yanked":     false,
+			"cold_since": nil,
+			"push_count": gorm.Expr("push_count + ?", artifact.PushCount),
+		}).Error
+		if err != nil {
+			return err
+		}
+		artifact.ID = existing.ID
+		artifact.CreatedAt = existing.CreatedAt
+		artifact.PullCount = existing.PullCount
+		artifact.PushCount += existing.PushCount
+		artifact.LastPulledAt = existing.LastPulledAt
+		return nil
+	})
 }
 
 // GetArtifactByPath retrieves artifact by path
@@ -63,6 +103,24 @@ func (db *DB) GetArtifactByPath(ctx context.Context, repoName, path string) (*Ar
 	return &artifactInfo, nil
 }
 
+// GetArtifactsByPaths retrieves the artifacts of a repository stored at any of the given paths
+func (db *DB) GetArtifactsByPaths(ctx context.Context, repoName string, paths []string) ([]*ArtifactInfo, error) {
+	var artifacts []*ArtifactInfo
+	if len(paths) == 0 {
+		return artifacts, nil
+	}
+	err := db.conn.WithContext(ctx).
+		Joins("JOIN repositories ON repositories.id = artifact_infos.repository_id").
+		Where("repositories.name = ? AND artifact_infos.path IN ?", repoName, paths).
+		Find(&artifacts).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return artifacts, nil
+}
+
 // GetArtifactsByRepository retrieves all artifacts for a repository
 func (db *DB) GetArtifactsByRepository(ctx context.Context, repoName string) ([]*ArtifactInfo, error) {
 	var artifacts []*ArtifactInfo
@@ -80,18 +138,58 @@ func (db *DB) GetArtifactsByRepository(ctx context.Context, repoName string) ([]
 
 // DeleteArtifactByPath deletes artifact by path
 func (db *DB) DeleteArtifactByPath(ctx context.Context, repoName, path string) error {
+	// A subquery rather than a join, as DELETE does not take joins
+	repositoryID := db.conn.Model(&Repository{}).Select("id").Where("name = ?", repoName)
 	return db.conn.WithContext(ctx).
-		Joins("JOIN repositories ON repositories.id = artifact_infos.repository_id").
-		Where("repositories.name = ? AND artifact_infos.path = ?", repoName, path).
+		Where("repository_id IN (?) AND path = ?", repositoryID, path).
 		Delete(&ArtifactInfo{}).Error
 }
 
-// IncrementPullCount increments pull count for an artifact
+// IncrementPullCount increments pull count for an artifact and records when it was pulled
 func (db *DB) IncrementPullCount(ctx context.Context, artifactID uint) error {
 	return db.conn.WithContext(ctx).
 		Model(&ArtifactInfo{}).
 		Where("id = ?", artifactID).
-		UpdateColumn("pull_count", gorm.Expr("pull_count + ?", 1)).Error
+		UpdateColumns(map[string]interface{}{
+			"pull_count":     gorm.Expr("pull_count + ?", 1),
+			"last_pulled_at": time.Now(),
+		}).Error
+}
+
+// ListColdArtifacts returns up to limit artifacts neither pulled nor updated since cutoff and
+// not moved to cold storage yet. Artifacts sharing deduplicated content with an artifact used
+// since cutoff are left out, as moving the content would move the other one too.
+func (db *DB) ListColdArtifacts(ctx context.Context, cutoff time.Time, limit int) ([]storage.ColdArtifact, error) {
+	active := db.conn.
+		Table("blob_references AS r1").
+		Select("1").
+		Joins("JOIN blob_references AS r2 ON r2.pool = r1.pool AND r2.hash = r1.hash").
+		Joins("JOIN repositories AS rb ON rb.name = r2.repository").
+		Joins("JOIN artifact_infos AS b ON b.repository_id = rb.id AND b.path = r2.path").
+		Where("r1.repository = repositories.name AND r1.path = artifact_infos.path").
+		Where("b.last_pulled_at >= ? OR b.updated_at >= ?", cutoff, cutoff)
+
+	var artifacts []storage.ColdArtifact
+	err := db.conn.WithContext(ctx).
+		Model(&ArtifactInfo{}).
+		Select("artifact_infos.id AS id, repositories.name AS repository, artifact_infos.path AS path").
+		Joins("JOIN repositories ON repositories.id = artifact_infos.repository_id").
+		Where("(artifact_infos.last_pulled_at IS NULL OR artifact_infos.last_pulled_at < ?) AND artifact_infos.updated_at < ?", cutoff, cutoff).
+		Where("artifact_infos.cold_since IS NULL OR artifact_infos.cold_since < artifact_infos.last_pulled_at OR "+
+			"artifact_infos.cold_since < artifact_infos.updated_at").
+		Where("NOT EXISTS (?)", active).
+		Order("artifact_infos.id").
+		Limit(limit).
+		Scan(&artifacts).Error
+	return artifacts, err
+}
+
+// MarkArtifactCold records that the content of an artifact moved to cold storage
+func (db *DB) MarkArtifactCold(ctx context.Context, id uint) error {
+	return db.conn.WithContext(ctx).
+		Model(&ArtifactInfo{}).
+		Where("id = ?", id).
+		UpdateColumn("cold_since", time.Now()).Error
 }
 
 // IncrementPushCount increments push count for an artifact
@@ -116,7 +214,8 @@ func (db *DB) GetRepositoryStatistics(ctx context.Context, repoName string) (*St
 
 	err := db.conn.WithContext(ctx).
 		Model(&ArtifactInfo{}).
-		Select("COUNT(*) as total_artifacts, SUM(size) as total_size, SUM(pull_count) as pull_count, SUM(push_count) as push_count").
+		Select("COUNT(*) as total_artifacts, COALESCE(SUM(artifact_infos.size), 0) as total_size, "+
+			"COALESCE(SUM(artifact_infos.pull_count), 0) as pull_count, COALESCE(SUM(artifact_infos.push_count), 0) as push_count").
 		Joins("JOIN repositories ON repositories.id = artifact_infos.repository_id").
 		Where("repositories.name = ?", repoName).
 		Scan(&stats).Error
@@ -124,6 +223,18 @@ func (db *DB) GetRepositoryStatistics(ctx context.Context, repoName string) (*St
 	return &stats, err
 }
 
+// GetStorageStatistics returns the statistics of the artifacts of every repository
+func (db *DB) GetStorageStatistics(ctx context.Context) (*Statistics, error) {
+	var stats Statistics
+
+	err := db.conn.WithContext(ctx).
+		Model(&ArtifactInfo{}).
+		Select("COUNT(*) as total_artifacts, COALESCE(SUM(size), 0) as total_size, COALESCE(SUM(pull_count), 0) as pull_count, COALESCE(SUM(push_count), 0) as push_count").
+		Scan(&stats).Error
+
+	return &stats, err
+}
+
 // SaveRepository saves repository information
 func (db *DB) SaveRepository(ctx context.Context, repo *Repository) error {
 	return db.conn.WithContext(ctx).Create(repo).Error
@@ -229,6 +340,11 @@ func (db *DB) UpdateArtifactYanked(ctx context.Context, repositoryName, name, ve
 		Update("yanked", yanked).Error
 }
 
+// UpdateArtifactMetadata replaces the type specific properties of an artifact by ID
+func (db *DB) UpdateArtifactMetadata(ctx context.Context, id uint, metadata string) error {
+	return db.conn.WithContext(ctx).Model(&ArtifactInfo{}).Where("id = ?", id).Update("metadata", metadata).Error
+}
+
 // CreateWebhook creates a webhook for a repository name
 func (db *DB) CreateWebhook(ctx context.Context, repoName string, hook *Webhook) error {
 	var repo Repository
@@ -276,6 +392,356 @@ func (db *DB) RecordWebhookDelivery(ctx context.Context, delivery *WebhookDelive
 	return db.conn.WithContext(ctx).Create(delivery).Error
 }
 
+// conanRevisionScope narrows a query to the revisions sharing a latest pointer: the recipe
+// revisions of a reference when packageID is empty, otherwise the revisions of that package
+func conanRevisionScope(tx *gorm.DB, repoID uint, reference, recipeRevision, packageID string) *gorm.DB {
+	tx = tx.Where("repository_id = ? AND reference = ?", repoID, reference)
+	if packageID == "" {
+		return tx.Where("package_id = ''")
+	}
+	return tx.Where("recipe_revision = ? AND package_id = ?", recipeRevision, packageID)
+}
+
+// SaveConanRevision records a revision, or refreshes the time of an existing one, and makes it the latest
+func (db *DB) SaveConanRevision(ctx context.Context, repoName string, rev *ConanRevision) error {
+	var repo Repository
+	if err := db.conn.WithContext(ctx).Where("name = ?", repoName).First(&repo).Error; err != nil {
+		return err
+	}
+	rev.RepositoryID = repo.ID
+	rev.Latest = true
+
+	return db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := conanRevisionScope(tx.Model(&ConanRevision{}), repo.ID, rev.Reference, rev.RecipeRevision, rev.PackageID).
+			Update("latest", false).Error; err != nil {
+			return err
+		}
+
+		var existing ConanRevision
+		err := conanRevisionScope(tx, repo.ID, rev.Reference, rev.RecipeRevision, rev.PackageID).
+			Where("recipe_revision = ? AND package_revision = ?", rev.RecipeRevision, rev.PackageRevision).
+			First(&existing).Error
+		switch {
+		case err == nil:
+			rev.ID, rev.CreatedAt = existing.ID, existing.CreatedAt
+			return tx.Save(rev).Error
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return tx.Create(rev).Error
+		default:
+			return err
+		}
+	})
+}
+
+// ListConanRevisions lists revisions newest first: the recipe revisions of a reference (of every
+// reference when it is empty) when recipeRevision is empty, otherwise the package revisions built
+// from that recipe revision, optionally of a single package
+func (db *DB) ListConanRevisions(ctx context.Context, repoName, reference, recipeRevision, packageID string) ([]*ConanRevision, error) {
+	query := db.conn.WithContext(ctx).
+		Joins("JOIN repositories ON repositories.id = conan_revisions.repository_id").
+		Where("repositories.name = ?", repoName)
+	if reference != "" {
+		query = query.Where("conan_revisions.reference = ?", reference)
+	}
+	if recipeRevision == "" {
+		query = query.Where("conan_revisions.package_id = ''")
+	} else {
+		query = query.Where("conan_revisions.recipe_revision = ? AND conan_revisions.package_id <> ''", recipeRevision)
+		if packageID != "" {
+			query = query.Where("conan_revisions.package_id = ?", packageID)
+		}
+	}
+
+	var revs []*ConanRevision
+	err := query.Order("conan_revisions.updated_at DESC, conan_revisions.id DESC").Find(&revs).Error
+	if err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+// GetLatestConanRevision returns the latest recipe revision of a reference, or with packageID
+// set, the latest revision of that package
+func (db *DB) GetLatestConanRevision(ctx context.Context, repoName, reference, recipeRevision, packageID string) (*ConanRevision, error) {
+	var repo Repository
+	if err := db.conn.WithContext(ctx).Where("name = ?", repoName).First(&repo).Error; err != nil {
+		return nil, err
+	}
+	var rev ConanRevision
+	err := conanRevisionScope(db.conn.WithContext(ctx), repo.ID, reference, recipeRevision, packageID).
+		Where("latest = ?", true).
+		First(&rev).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// DeleteConanRevisions removes a package revision, every revision of a package, a recipe revision
+// with its packages, or with only reference set the whole recipe. Where the latest revision was
+// removed, the newest remaining one becomes the latest.
+func (db *DB) DeleteConanRevisions(ctx context.Context, repoName, reference, recipeRevision, packageID, packageRevision string) error {
+	var repo Repository
+	if err := db.conn.WithContext(ctx).Where("name = ?", repoName).First(&repo).Error; err != nil {
+		return err
+	}
+
+	return db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("repository_id = ? AND reference = ?", repo.ID, reference)
+		if recipeRevision != "" {
+			query = query.Where("recipe_revision = ?", recipeRevision)
+		}
+		if packageID != "" {
+			query = query.Where("package_id = ?", packageID)
+		}
+		if packageRevision != "" {
+			query = query.Where("package_revision = ?", packageRevision)
+		}
+		if err := query.Delete(&ConanRevision{}).Error; err != nil {
+			return err
+		}
+
+		var latest ConanRevision
+		err := conanRevisionScope(tx, repo.ID, reference, recipeRevision, packageID).Where("latest = ?", true).First(&latest).Error
+		if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		err = conanRevisionScope(tx, repo.ID, reference, recipeRevision, packageID).Order("updated_at DESC, id DESC").First(&latest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return tx.Model(&latest).Update("latest", true).Error
+	})
+}
+
+// CreateLFSLock creates a lock; it fails when the path is already locked in the repository
+func (db *DB) CreateLFSLock(ctx context.Context, repoName string, lock *LFSLock) error {
+	var repo Repository
+	if err := db.conn.WithContext(ctx).Where("name = ?", repoName).First(&repo).Error; err != nil {
+		return err
+	}
+	lock.RepositoryID = repo.ID
+	return db.conn.WithContext(ctx).Create(lock).Error
+}
+
+// ListLFSLocks lists the locks of a repository in creation order
+func (db *DB) ListLFSLocks(ctx context.Context, repoName string) ([]*LFSLock, error) {
+	var locks []*LFSLock
+	err := db.conn.WithContext(ctx).
+		Joins("JOIN repositories ON repositories.id = lfs_locks.repository_id").
+		Where("repositories.name = ?", repoName).
+		Order("lfs_locks.id").
+		Find(&locks).Error
+	if err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// DeleteLFSLock removes a lock of a repository
+func (db *DB) DeleteLFSLock(ctx context.Context, repoName string, id uint) error {
+	var repo Repository
+	if err := db.conn.WithContext(ctx).Where("name = ?", repoName).First(&repo).Error; err != nil {
+		return err
+	}
+	return db.conn.WithContext(ctx).Where("repository_id = ? AND id = ?", repo.ID, id).Delete(&LFSLock{}).Error
+}
+
+// DB keeps the references of a deduplicating storage, the access times of a tiered one and the
+// checksums a scrub verifies
+var (
+	_ storage.RefStore    = (*DB)(nil)
+	_ storage.AccessIndex = (*DB)(nil)
+	_ storage.ScrubIndex  = (*DB)(nil)
+)
+
+// GetBlobRef returns the blob reference of a storage path of a repository in a pool, or nil when
+// it has none
+func (db *DB) GetBlobRef(ctx context.Context, pool, repository, path string) (*storage.BlobRef, error) {
+	// Find rather than First: paths without a reference are expected and not worth logging
+	var refs []BlobReference
+	if err := db.conn.WithContext(ctx).Where("pool = ? AND repository = ? AND path = ?", pool, repository, path).Limit(1).Find(&refs).Error; err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	ref := refs[0]
+	return &storage.BlobRef{Path: ref.Path, Hash: ref.Hash, Size: ref.Size, Repository: ref.Repository, Pool: ref.Pool}, nil
+}
+
+// SaveBlobRef creates the blob reference of a storage path of a repository in a pool or replaces
+// the existing one
+func (db *DB) SaveBlobRef(ctx context.Context, ref *storage.BlobRef) error {
+	return db.conn.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pool"}, {Name: "repository"}, {Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hash", "size", "updated_at"}),
+	}).Create(&BlobReference{Path: ref.Path, Hash: ref.Hash, Size: ref.Size, Repository: ref.Repository, Pool: ref.Pool}).Error
+}
+
+// DeleteBlobRef removes the blob reference of a storage path of a repository in a pool
+func (db *DB) DeleteBlobRef(ctx context.Context, pool, repository, path string) error {
+	return db.conn.WithContext(ctx).Where("pool = ? AND repository = ? AND path = ?", pool, repository, path).Delete(&BlobReference{}).Error
+}
+
+// CountBlobRefs returns the number of storage paths referencing a blob of a storage pool
+func (db *DB) CountBlobRefs(ctx context.Context, pool, hash string) (int64, error) {
+	var count int64
+	err := db.conn.WithContext(ctx).Model(&BlobReference{}).Where("pool = ? AND hash = ?", pool, hash).Count(&count).Error
+	return count, err
+}
+
+// ListBlobRefs lists the blob references of the storage paths of every repository of a pool
+// starting with prefix
+func (db *DB) ListBlobRefs(ctx context.Context, pool, prefix string) ([]*storage.BlobRef, error) {
+	var refs []*BlobReference
+	query := db.conn.WithContext(ctx).Where("pool = ?", pool).Order("path, repository")
+	if prefix != "" {
+		// Compared by substring rather than LIKE, so "_" and "%" in paths match literally
+		query = query.Where("SUBSTR(path, 1, ?) = ?", len(prefix), prefix)
+	}
+	if err := query.Find(&refs).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*storage.BlobRef, len(refs))
+	for i, ref := range refs {
+		result[i] = &storage.BlobRef{Path: ref.Path, Hash: ref.Hash, Size: ref.Size, Repository: ref.Repository, Pool: ref.Pool}
+	}
+	return result, nil
+}
+
+// DedupSavings reports how much storage deduplication saves for a repository. A blob shared by
+// several paths is attributed to each of them in equal parts, so the stored sizes of all
+// repositories add up to the size of the blob store.
+type DedupSavings struct {
+	Repository  string `json:"repository"`
+	Paths       int64  `json:"paths"`
+	Blobs       int64  `json:"blobs"`
+	LogicalSize int64  `json:"logical_size"`
+	StoredSize  int64  `json:"stored_size"`
+	SavedSize   int64  `json:"saved_size"`
+}
+
+// GetDedupSavings returns the deduplication savings of each repository with blob references
+func (db *DB) GetDedupSavings(ctx context.Context) ([]*DedupSavings, error) {
+	var rows []struct {
+		Repository  string
+		Paths       int64
+		Blobs       int64
+		LogicalSize int64
+		StoredSize  float64
+	}
+	shares := db.conn.Model(&BlobReference{}).Select("pool, hash, COUNT(*) AS refs").Group("pool, hash")
+	err := db.conn.WithContext(ctx).
+		Table("blob_references AS r").
+		Select("r.repository AS repository, COUNT(*) AS paths, COUNT(DISTINCT r.hash) AS blobs, "+
+			"SUM(r.size) AS logical_size, SUM(r.size * 1.0 / h.refs) AS stored_size").
+		Joins("JOIN (?) AS h ON h.pool = r.pool AND h.hash = r.hash", shares).
+		Group("r.repository").
+		Order("r.repository").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	savings := make([]*DedupSavings, len(rows))
+	for i, row := range rows {
+		stored := int64(math.Round(row.StoredSize))
+		savings[i] = &DedupSavings{
+			Repository:  row.Repository,
+			Paths:       row.Paths,
+			Blobs:       row.Blobs,
+			LogicalSize: row.LogicalSize,
+			StoredSize:  stored,
+			SavedSize:   row.LogicalSize - stored,
+		}
+	}
+	return savings, nil
+}
+
+// ListScrubRecords returns up to limit artifacts, or cache entries when cached is set, with an ID
+// above after, ordered by ID
+func (db *DB) ListScrubRecords(ctx context.Context, cached bool, after uint, limit int) ([]storage.ScrubRecord, error) {
+	query := db.conn.WithContext(ctx).Preload("Repository").Where("id > ?", after).Order("id").Limit(limit)
+	if cached {
+		var entries []CacheEntry
+		if err := query.Find(&entries).Error; err != nil {
+			return nil, err
+		}
+		records := make([]storage.ScrubRecord, len(entries))
+		for i, entry := range entries {
+			records[i] = cacheScrubRecord(&entry)
+		}
+		return records, nil
+	}
+
+	var artifacts []ArtifactInfo
+	if err := query.Find(&artifacts).Error; err != nil {
+		return nil, err
+	}
+	records := make([]storage.ScrubRecord, len(artifacts))
+	for i, art := range artifacts {
+		records[i] = artifactScrubRecord(&art)
+	}
+	return records, nil
+}
+
+// GetScrubRecord returns an artifact, or a cache entry when cached is set, by ID, or nil when it
+// was deleted
+func (db *DB) GetScrubRecord(ctx context.Context, cached bool, id uint) (*storage.ScrubRecord, error) {
+	query := db.conn.WithContext(ctx).Preload("Repository").Where("id = ?", id).Limit(1)
+	if cached {
+		var entries []CacheEntry
+		if err := query.Find(&entries).Error; err != nil || len(entries) == 0 {
+			return nil, err
+		}
+		record := cacheScrubRecord(&entries[0])
+		return &record, nil
+	}
+
+	var artifacts []ArtifactInfo
+	if err := query.Find(&artifacts).Error; err != nil || len(artifacts) == 0 {
+		return nil, err
+	}
+	record := artifactScrubRecord(&artifacts[0])
+	return &record, nil
+}
+
+func artifactScrubRecord(art *ArtifactInfo) storage.ScrubRecord {
+	return storage.ScrubRecord{ID: art.ID, Repository: art.Repository.Name, Path: art.Path, Size: art.Size, Checksum: art.Checksum}
+}
+
+func cacheScrubRecord(entry *CacheEntry) storage.ScrubRecord {
+	return storage.ScrubRecord{ID: entry.ID, Repository: entry.Repository.Name, Path: entry.LocalPath, Size: entry.Size, Checksum: entry.Checksum, Cached: true}
+}
+
+// KnownPaths returns the storage paths among paths that an artifact or a cache entry points at
+func (db *DB) KnownPaths(ctx context.Context, paths []string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	if len(paths) == 0 {
+		return known, nil
+	}
+	var found []string
+	if err := db.conn.WithContext(ctx).Model(&ArtifactInfo{}).Where("path IN ?", paths).Pluck("path", &found).Error; err != nil {
+		return nil, err
+	}
+	var cached []string
+	if err := db.conn.WithContext(ctx).Model(&CacheEntry{}).Where("local_path IN ?", paths).Pluck("local_path", &cached).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range append(found, cached...) {
+		known[p] = true
+	}
+	return known, nil
+}
+
+// DropCacheRecord deletes a cache entry by ID
+func (db *DB) DropCacheRecord(ctx context.Context, id uint) error {
+	return db.conn.WithContext(ctx).Delete(&CacheEntry{}, id).Error
+}
+
 // Close closes database connection
 func (db *DB) Close() error {
 	sqlDB, err := db.conn.DB()
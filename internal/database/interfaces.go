@@ -13,11 +13,14 @@ type DatabaseInterface interface {
 	SaveArtifact(ctx context.Context, artifact *ArtifactInfo) error
 	GetArtifact(ctx context.Context, repositoryName, name, version string) (*ArtifactInfo, error)
 	GetArtifactByPath(ctx context.Context, repositoryName, path string) (*ArtifactInfo, error)
+	GetArtifactsByPaths(ctx context.Context, repositoryName string, paths []string) ([]*ArtifactInfo, error)
 	DeleteArtifactByPath(ctx context.Context, repositoryName, path string) error
 	IncrementPullCount(ctx context.Context, artifactID uint) error
 	GetRepositoryStatistics(ctx context.Context, repositoryName string) (*Statistics, error)
+	GetStorageStatistics(ctx context.Context) (*Statistics, error)
 	LogAccess(ctx context.Context, log *AccessLog) error
 	UpdateArtifactYanked(ctx context.Context, repositoryName, name, version string, yanked bool) error
+	UpdateArtifactMetadata(ctx context.Context, id uint, metadata string) error
 
 	// Webhooks
 	CreateWebhook(ctx context.Context, repoName string, hook *Webhook) error
@@ -26,6 +29,20 @@ type DatabaseInterface interface {
 	GetWebhook(ctx context.Context, id uint) (*Webhook, error)
 	ListWebhooksByRepository(ctx context.Context, repoName string) ([]*Webhook, error)
 	RecordWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+
+	// Conan revisions
+	SaveConanRevision(ctx context.Context, repoName string, rev *ConanRevision) error
+	ListConanRevisions(ctx context.Context, repoName, reference, recipeRevision, packageID string) ([]*ConanRevision, error)
+	GetLatestConanRevision(ctx context.Context, repoName, reference, recipeRevision, packageID string) (*ConanRevision, error)
+	DeleteConanRevisions(ctx context.Context, repoName, reference, recipeRevision, packageID, packageRevision string) error
+
+	// Git LFS locks
+	CreateLFSLock(ctx context.Context, repoName string, lock *LFSLock) error
+	ListLFSLocks(ctx context.Context, repoName string) ([]*LFSLock, error)
+	DeleteLFSLock(ctx context.Context, repoName string, id uint) error
+
+	// Storage deduplication
+	GetDedupSavings(ctx context.Context) ([]*DedupSavings, error)
 }
 
 
@@ -39,12 +39,17 @@ type ArtifactInfo struct {
 	Size         int64     `gorm:"not null"`
 	Checksum     string    `gorm:"not null"`
 	Yanked       bool      `gorm:"not null;default:false"`
+	Metadata     string    `gorm:"type:text"` // JSON of artifact-type specific properties
 	CreatedAt    time.Time `gorm:"autoCreateTime"`
 	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
 	
 	// Statistics
-	PullCount int64 `gorm:"default:0"`
-	PushCount int64 `gorm:"default:0"`
+	PullCount    int64      `gorm:"default:0"`
+	PushCount    int64      `gorm:"default:0"`
+	LastPulledAt *time.Time `gorm:"index"`
+	
+	// ColdSince is when the content moved to cold storage, if it did
+	ColdSince *time.Time
 	
 	// Relationships
 	Repository Repository `gorm:"foreignKey:RepositoryID"`
@@ -143,6 +148,44 @@ type WebhookDelivery struct {
 	CreatedAt   time.Time `gorm:"autoCreateTime"`
 }
 
+// ConanRevision records a Conan recipe revision or, when PackageID is set, a revision of
+// that package built from RecipeRevision. Latest marks the revision clients resolve to
+// among those of the same recipe, or of the same package.
+type ConanRevision struct {
+	ID              uint      `gorm:"primaryKey"`
+	RepositoryID    uint      `gorm:"not null;uniqueIndex:idx_conan_revision"`
+	Reference       string    `gorm:"not null;uniqueIndex:idx_conan_revision"` // name/version[@user/channel]
+	RecipeRevision  string    `gorm:"not null;uniqueIndex:idx_conan_revision"`
+	PackageID       string    `gorm:"not null;default:'';uniqueIndex:idx_conan_revision"`
+	PackageRevision string    `gorm:"not null;default:'';uniqueIndex:idx_conan_revision"`
+	Latest          bool      `gorm:"not null;default:false;index"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime"`
+}
+
+// LFSLock is a Git LFS file lock a user holds on a path of a repository
+type LFSLock struct {
+	ID           uint      `gorm:"primaryKey"`
+	RepositoryID uint      `gorm:"not null;uniqueIndex:idx_lfs_lock_path"`
+	Path         string    `gorm:"not null;uniqueIndex:idx_lfs_lock_path"`
+	Owner        string    `gorm:"not null"`
+	Ref          string    `gorm:""` // ref the lock was taken on, if the client sent one
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+// BlobReference maps a logical storage path of a repository to the content-addressed blob of its
+// pool holding its content
+type BlobReference struct {
+	ID         uint      `gorm:"primaryKey"`
+	Pool       string    `gorm:"not null;uniqueIndex:idx_blob_ref_path,priority:1"` // storage pool holding the blob, empty for the default pool
+	Path       string    `gorm:"not null;uniqueIndex:idx_blob_ref_path,priority:3"`
+	Hash       string    `gorm:"not null;index"` // SHA-256 of the content
+	Size       int64     `gorm:"not null"`
+	Repository string    `gorm:"uniqueIndex:idx_blob_ref_path,priority:2;index"` // name of the repository that stored the path
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
 // AutoMigrate runs database migrations
 func AutoMigrate(db *gorm.DB) error {
 	return db.AutoMigrate(
@@ -154,5 +197,8 @@ func AutoMigrate(db *gorm.DB) error {
 		&VirtualRepositoryMapping{},
 		&Webhook{},
 		&WebhookDelivery{},
+		&ConanRevision{},
+		&LFSLock{},
+		&BlobReference{},
 	)
 }
@@ -7,6 +7,9 @@ const (
 	EventAdd    = "artifact.add"
 	EventRemove = "artifact.remove"
 	EventChange = "artifact.change"
+
+	// EventQuotaWarning is published when a push takes usage past the soft limit of a quota
+	EventQuotaWarning = "quota.warning"
 )
 
 // Event describes an artifact lifecycle event to publish
@@ -18,6 +21,17 @@ type Event struct {
 	Version    string    `json:"version,omitempty"`
 	Group      string    `json:"group,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
+
+	// Quota is the usage of the quota an EventQuotaWarning is about
+	Quota *QuotaUsage `json:"quota,omitempty"`
+}
+
+// QuotaUsage describes the usage of a repository or global quota
+type QuotaUsage struct {
+	Scope    string `json:"scope"`
+	Resource string `json:"resource"`
+	Used     int64  `json:"used"`
+	Limit    int64  `json:"limit"`
 }
 
 // Publisher defines a minimal interface for event publishing
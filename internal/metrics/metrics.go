@@ -32,6 +32,14 @@ type MetricsService struct {
 	databaseQueriesTotal      *prometheus.CounterVec
 	databaseQueryDuration     *prometheus.HistogramVec
 	
+	// Storage scrub metrics
+	scrubRunsTotal      *prometheus.CounterVec
+	scrubObjectsTotal   prometheus.Counter
+	scrubBytesTotal     prometheus.Counter
+	scrubFindings       *prometheus.GaugeVec
+	scrubLastRun        prometheus.Gauge
+	scrubDuration       prometheus.Gauge
+	
 	// System metrics
 	systemInfo                *prometheus.GaugeVec
 	uptime                   *prometheus.CounterVec
@@ -134,6 +142,51 @@ func NewMetricsService() *MetricsService {
 		[]string{"operation"},
 	)
 	
+	// Storage scrub metrics
+	scrubRunsTotal := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ganje_storage_scrub_runs_total",
+			Help: "Total number of storage scrubs",
+		},
+		[]string{"status"},
+	)
+	
+	scrubObjectsTotal := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ganje_storage_scrub_objects_total",
+			Help: "Total number of stored objects re-hashed by storage scrubs",
+		},
+	)
+	
+	scrubBytesTotal := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ganje_storage_scrub_bytes_total",
+			Help: "Total number of bytes re-hashed by storage scrubs",
+		},
+	)
+	
+	scrubFindings := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ganje_storage_scrub_findings",
+			Help: "Problems found by the last storage scrub",
+		},
+		[]string{"kind"},
+	)
+	
+	scrubLastRun := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ganje_storage_scrub_last_run_timestamp_seconds",
+			Help: "Time the last storage scrub finished",
+		},
+	)
+	
+	scrubDuration := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ganje_storage_scrub_duration_seconds",
+			Help: "Duration of the last storage scrub in seconds",
+		},
+	)
+	
 	// System metrics
 	systemInfo := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -164,6 +217,12 @@ func NewMetricsService() *MetricsService {
 		databaseConnectionsActive,
 		databaseQueriesTotal,
 		databaseQueryDuration,
+		scrubRunsTotal,
+		scrubObjectsTotal,
+		scrubBytesTotal,
+		scrubFindings,
+		scrubLastRun,
+		scrubDuration,
 		systemInfo,
 		uptime,
 	)
@@ -185,6 +244,12 @@ func NewMetricsService() *MetricsService {
 		databaseConnectionsActive:   databaseConnectionsActive,
 		databaseQueriesTotal:        databaseQueriesTotal,
 		databaseQueryDuration:       databaseQueryDuration,
+		scrubRunsTotal:              scrubRunsTotal,
+		scrubObjectsTotal:           scrubObjectsTotal,
+		scrubBytesTotal:             scrubBytesTotal,
+		scrubFindings:               scrubFindings,
+		scrubLastRun:                scrubLastRun,
+		scrubDuration:               scrubDuration,
 		systemInfo:                  systemInfo,
 		uptime:                      uptime,
 	}
@@ -257,6 +322,18 @@ func (m *MetricsService) SetDatabaseConnections(count float64) {
 	m.databaseConnectionsActive.Set(count)
 }
 
+// RecordScrub records a storage scrub; findings are the problems found by kind
+func (m *MetricsService) RecordScrub(status string, objects int, bytes int64, findings map[string]int, finished time.Time, duration time.Duration) {
+	m.scrubRunsTotal.WithLabelValues(status).Inc()
+	m.scrubObjectsTotal.Add(float64(objects))
+	m.scrubBytesTotal.Add(float64(bytes))
+	for kind, count := range findings {
+		m.scrubFindings.WithLabelValues(kind).Set(float64(count))
+	}
+	m.scrubLastRun.Set(float64(finished.Unix()))
+	m.scrubDuration.Set(duration.Seconds())
+}
+
 // SetSystemInfo sets system information metrics
 func (m *MetricsService) SetSystemInfo(version, goVersion string) {
 	m.systemInfo.WithLabelValues(version, goVersion).Set(1)
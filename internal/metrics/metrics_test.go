@@ -33,6 +33,9 @@ func TestMetricsService(t *testing.T) {
 
 	// Test recording database operation
 	service.RecordDatabaseQuery("SELECT", "success", time.Millisecond*10)
+
+	// Test recording a storage scrub
+	service.RecordScrub("success", 10, 4096, map[string]int{"mismatch": 1, "missing": 0, "orphan": 2}, time.Now(), time.Second)
 }
 
 func TestMetricsMiddleware(t *testing.T) {
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+)
+
+// APK repositories keep a signed APKINDEX.tar.gz per <branch>/<repo>/<arch> directory in
+// storage. Push and Delete mark the directory of the changed package and RebuildIndex
+// regenerates only the marked indexes; with nothing marked it regenerates all of them.
+
+// indexState tracks stored indexes awaiting regeneration, keyed by a directory or shard;
+// the zero value is ready to use
+type indexState struct {
+	mu    sync.Mutex
+	dirty map[string]bool
+
+	// build serializes rebuilds so an older package set never overwrites a newer index
+	build sync.Mutex
+}
+
+func (st *indexState) mark(dir string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.dirty == nil {
+		st.dirty = make(map[string]bool)
+	}
+	st.dirty[dir] = true
+}
+
+func (st *indexState) pending() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.dirty) > 0
+}
+
+func (st *indexState) take() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	dirs := make([]string, 0, len(st.dirty))
+	for dir := range st.dirty {
+		dirs = append(dirs, dir)
+	}
+	st.dirty = nil
+	sort.Strings(dirs)
+	return dirs
+}
+
+// repositoryOptions returns the options stored with a repository's configuration
+func repositoryOptions(ctx context.Context, db database.DatabaseInterface, name string) (map[string]string, error) {
+	repo, err := db.GetRepository(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	opts := map[string]string{}
+	if strings.TrimSpace(repo.Config) != "" {
+		if err := json.Unmarshal([]byte(repo.Config), &opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// LoadAPKSigningKey loads the key used to sign APKINDEX files. It returns nil when the
+// repository has no key configured. Recognized option keys:
+// - apk_signing_key (PEM encoded RSA private key)
+// - apk_signing_key_file (path to a PEM encoded RSA private key)
+// - apk_key_name (public key file name clients install, defaults to "<repository>.rsa.pub")
+func LoadAPKSigningKey(ctx context.Context, db database.DatabaseInterface, repositoryName string) (*types.APKSigningKey, error) {
+	opts, err := repositoryOptions(ctx, db, repositoryName)
+	if err != nil {
+		return nil, nil
+	}
+	keyPEM := opts["apk_signing_key"]
+	if keyPEM == "" && opts["apk_signing_key_file"] != "" {
+		data, err := os.ReadFile(opts["apk_signing_key_file"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read APK signing key: %w", err)
+		}
+		keyPEM = string(data)
+	}
+	if strings.TrimSpace(keyPEM) == "" {
+		return nil, nil
+	}
+	name := opts["apk_key_name"]
+	if name == "" {
+		name = repositoryName + ".rsa.pub"
+	}
+	return types.ParseAPKSigningKey([]byte(keyPEM), name)
+}
+
+// markAPKIndex records that the index listing the package at p must be regenerated
+func (l *LocalRepository) markAPKIndex(p string) {
+	if l.artifactType == artifact.ArtifactTypeAPK && strings.HasSuffix(p, ".apk") {
+		l.apkIndexes.mark(path.Dir(p))
+	}
+}
+
+// rebuildAPKIndexes regenerates the marked APKINDEX files, or every index when full is set.
+// Packages built for "noarch" are listed in the index of each architecture of their branch/repo.
+func (l *LocalRepository) rebuildAPKIndexes(ctx context.Context, full bool) error {
+	l.apkIndexes.build.Lock()
+	defer l.apkIndexes.build.Unlock()
+
+	marked := l.apkIndexes.take()
+	artifacts, err := l.db.GetArtifactsByRepository(ctx, l.name)
+	if err != nil {
+		for _, dir := range marked {
+			l.apkIndexes.mark(dir)
+		}
+		return fmt.Errorf("failed to get artifacts: %w", err)
+	}
+
+	packages := map[string][]*types.APKPackage{}
+	archs := map[string]map[string]bool{}
+	addArch := func(branchRepo, arch string) {
+		if archs[branchRepo] == nil {
+			archs[branchRepo] = map[string]bool{}
+		}
+		if arch != "noarch" {
+			archs[branchRepo][arch] = true
+		}
+	}
+	for _, a := range artifacts {
+		if a.Type != string(artifact.ArtifactTypeAPK) || a.Metadata == "" {
+			continue
+		}
+		props := map[string]string{}
+		if err := json.Unmarshal([]byte(a.Metadata), &props); err != nil {
+			continue
+		}
+		pkg, err := types.APKPackageFromMetadata(props)
+		if err != nil {
+			continue
+		}
+		if pkg.Size == 0 {
+			pkg.Size = a.Size
+		}
+		dir := path.Dir(a.Path)
+		packages[dir] = append(packages[dir], pkg)
+		addArch(path.Dir(dir), path.Base(dir))
+	}
+	// Let repositories announce architectures they only serve noarch packages for
+	opts, _ := repositoryOptions(ctx, l.db, l.name)
+	for branchRepo := range archs {
+		for _, arch := range strings.Split(opts["apk_architectures"], ",") {
+			if arch = strings.TrimSpace(arch); arch != "" {
+				addArch(branchRepo, arch)
+			}
+		}
+	}
+
+	targets := map[string]bool{}
+	for _, dir := range marked {
+		if path.Base(dir) != "noarch" {
+			targets[dir] = true
+			continue
+		}
+		for arch := range archs[path.Dir(dir)] {
+			targets[path.Dir(dir)+"/"+arch] = true
+		}
+	}
+	if full {
+		for branchRepo, set := range archs {
+			for arch := range set {
+				targets[branchRepo+"/"+arch] = true
+			}
+		}
+	}
+
+	key, err := LoadAPKSigningKey(ctx, l.db, l.name)
+	if err != nil {
+		for _, dir := range marked {
+			l.apkIndexes.mark(dir)
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	var failed []string
+	var firstErr error
+	for dir := range targets {
+		branchRepo := path.Dir(dir)
+		pkgs := append(append([]*types.APKPackage(nil), packages[dir]...), packages[branchRepo+"/noarch"]...)
+		index, err := types.BuildAPKIndex(pkgs, l.name+" "+branchRepo, key, now)
+		if err == nil {
+			_, err = l.storage.Store(ctx, types.APKIndexPath(dir), bytes.NewReader(index))
+		}
+		if err != nil {
+			failed = append(failed, dir)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to rebuild %s: %w", types.APKIndexPath(dir), err)
+			}
+		}
+	}
+	for _, dir := range failed {
+		l.apkIndexes.mark(dir)
+	}
+	return firstErr
+}
+
+// apkIndex returns a stored APKINDEX.tar.gz, building the repository's indexes when it is missing
+func (l *LocalRepository) apkIndex(ctx context.Context, indexPath string) (io.ReadCloser, error) {
+	exists, err := l.storage.Exists(ctx, indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check index existence: %w", err)
+	}
+	if !exists {
+		if err := l.rebuildAPKIndexes(ctx, true); err != nil {
+			return nil, err
+		}
+		if exists, err = l.storage.Exists(ctx, indexPath); err != nil || !exists {
+			return nil, fmt.Errorf("index not found: %s", indexPath)
+		}
+	}
+	return l.storage.Retrieve(ctx, indexPath)
+}
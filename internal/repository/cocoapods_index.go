@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+)
+
+// CocoaPods repositories keep an all_pods_versions_<shard>.txt per shard in storage, along with
+// all_pods.txt and deprecated_podspecs.txt. Push and Delete mark the shard of the changed podspec
+// and RebuildIndex regenerates only the marked shards; with nothing marked it regenerates all of
+// them. The repository-wide files are regenerated with every rebuild.
+
+// markCocoaPodsShard records that the shard listing the podspec at p must be regenerated
+func (l *LocalRepository) markCocoaPodsShard(p string) {
+	if l.artifactType != artifact.ArtifactTypeCocoaPods {
+		return
+	}
+	if info, err := types.NewCocoaPodsArtifact(nil).ParsePath(p); err == nil {
+		l.cocoapodsShards.mark(types.CocoaPodsShard(info.Name))
+	}
+}
+
+// rebuildCocoaPodsShards regenerates the marked shard files, or every shard holding a pod when
+// full is set. A marked shard whose last pod was deleted is rewritten empty.
+func (l *LocalRepository) rebuildCocoaPodsShards(ctx context.Context, full bool) error {
+	l.cocoapodsShards.build.Lock()
+	defer l.cocoapodsShards.build.Unlock()
+
+	marked := l.cocoapodsShards.take()
+	artifacts, err := l.db.GetArtifactsByRepository(ctx, l.name)
+	if err != nil {
+		for _, shard := range marked {
+			l.cocoapodsShards.mark(shard)
+		}
+		return fmt.Errorf("failed to get artifacts: %w", err)
+	}
+
+	var all []*types.CocoaPodsSpec
+	shards := map[string][]*types.CocoaPodsSpec{}
+	for _, a := range artifacts {
+		if a.Type != string(artifact.ArtifactTypeCocoaPods) || a.Metadata == "" {
+			continue
+		}
+		props := map[string]string{}
+		if err := json.Unmarshal([]byte(a.Metadata), &props); err != nil {
+			continue
+		}
+		spec, err := types.CocoaPodsSpecFromProperties(props)
+		if err != nil {
+			continue
+		}
+		all = append(all, spec)
+		shard := types.CocoaPodsShard(spec.Name)
+		shards[shard] = append(shards[shard], spec)
+	}
+
+	targets := map[string]bool{}
+	for _, shard := range marked {
+		targets[shard] = true
+	}
+	if full {
+		for shard := range shards {
+			targets[shard] = true
+		}
+	}
+
+	var failed []string
+	var firstErr error
+	for shard := range targets {
+		file := types.CocoaPodsShardFile(shard)
+		if _, err := l.storage.Store(ctx, file, bytes.NewReader(types.BuildCocoaPodsShard(shards[shard]))); err != nil {
+			failed = append(failed, shard)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to rebuild %s: %w", file, err)
+			}
+		}
+	}
+	for _, shard := range failed {
+		l.cocoapodsShards.mark(shard)
+	}
+
+	for file, content := range map[string][]byte{
+		types.CocoaPodsAllPodsFile:    types.BuildCocoaPodsAllPods(all),
+		types.CocoaPodsDeprecatedFile: types.BuildCocoaPodsDeprecated(all),
+	} {
+		if _, err := l.storage.Store(ctx, file, bytes.NewReader(content)); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to rebuild %s: %w", file, err)
+		}
+	}
+	return firstErr
+}
+
+// cocoapodsIndex returns a stored index file, building the repository's indexes when it is
+// missing. Shards no pod hashes to are served empty, as clients fetch shards before knowing
+// whether a pod exists.
+func (l *LocalRepository) cocoapodsIndex(ctx context.Context, indexPath string) (io.ReadCloser, error) {
+	exists, err := l.storage.Exists(ctx, indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check index existence: %w", err)
+	}
+	if !exists {
+		if err := l.rebuildCocoaPodsShards(ctx, true); err != nil {
+			return nil, err
+		}
+		if exists, err = l.storage.Exists(ctx, indexPath); err != nil {
+			return nil, fmt.Errorf("failed to check index existence: %w", err)
+		}
+		if !exists {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+	}
+	return l.storage.Retrieve(ctx, indexPath)
+}
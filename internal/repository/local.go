@@ -2,12 +2,14 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
 	"time"
 
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
 	"github.com/hbahadorzadeh/ganje/internal/database"
 	"github.com/hbahadorzadeh/ganje/internal/storage"
 )
@@ -19,6 +21,12 @@ type LocalRepository struct {
 	storage      storage.Storage
 	factory      artifact.Factory
 	db           database.DatabaseInterface
+
+	// apkIndexes tracks APKINDEX files that need regenerating after pushes and deletes
+	apkIndexes indexState
+
+	// cocoapodsShards tracks all_pods_versions shard files that need regenerating after pushes and deletes
+	cocoapodsShards indexState
 }
 
 // NewLocalRepository creates a new local repository
@@ -81,8 +89,10 @@ func (l *LocalRepository) Pull(ctx context.Context, path string) (io.ReadCloser,
 		Name:     artifactInfo.Name,
 		Version:  artifactInfo.Version,
 		Group:    artifactInfo.Group,
-		Size:     artifactInfo.Size,
-		Checksum: artifactInfo.Checksum,
+		Size:      artifactInfo.Size,
+		Checksum:  artifactInfo.Checksum,
+		CreatedAt: artifactInfo.CreatedAt,
+		UpdatedAt: artifactInfo.UpdatedAt,
 	}
 
 	return content, metadata, nil
@@ -90,40 +100,49 @@ func (l *LocalRepository) Pull(ctx context.Context, path string) (io.ReadCloser,
 
 // Push stores an artifact to local storage
 func (l *LocalRepository) Push(ctx context.Context, path string, content io.Reader, metadata *artifact.Metadata) error {
-	// Store artifact in storage
-	if err := l.storage.Store(ctx, path, content); err != nil {
-		return fmt.Errorf("failed to store artifact: %w", err)
-	}
-
-	// Get size and checksum from storage
-	size, err := l.storage.GetSize(ctx, path)
+	// Store artifact in storage; size and checksum are computed while it is written
+	digests, err := l.storage.Store(ctx, path, content)
 	if err != nil {
-		return fmt.Errorf("failed to get artifact size: %w", err)
+		return fmt.Errorf("failed to store artifact: %w", err)
 	}
 
-	checksum, err := l.storage.GetChecksum(ctx, path)
-	if err != nil {
-		return fmt.Errorf("failed to get artifact checksum: %w", err)
+	var properties string
+	if len(metadata.Properties) > 0 {
+		if b, err := json.Marshal(metadata.Properties); err == nil {
+			properties = string(b)
+		}
 	}
 
-	// Save metadata to database
+	// Save metadata to database; content stored at a path again updates the artifact there
 	if err := l.db.SaveArtifact(ctx, &database.ArtifactInfo{
-		RepositoryID: 1, // TODO: Get actual repository ID
+		RepositoryID: l.repositoryID(ctx),
 		Type:         string(l.artifactType),
 		Name:         metadata.Name,
 		Version:      metadata.Version,
+		Group:        metadata.Group,
 		Path:         path,
-		Size:         size,
-		Checksum:     checksum,
+		Size:         digests.Size,
+		Checksum:     digests.SHA256,
+		Metadata:     properties,
 		CreatedAt:    time.Now(),
 		PushCount:    1,
 	}); err != nil {
 		return fmt.Errorf("failed to save artifact metadata: %w", err)
 	}
+	l.markAPKIndex(path)
+	l.markCocoaPodsShard(path)
 
 	return nil
 }
 
+// repositoryID resolves the database ID of this repository, falling back to 1 when unknown
+func (l *LocalRepository) repositoryID(ctx context.Context) uint {
+	if repo, err := l.db.GetRepository(ctx, l.name); err == nil && repo != nil {
+		return repo.ID
+	}
+	return 1
+}
+
 // Delete removes an artifact from local storage
 func (l *LocalRepository) Delete(ctx context.Context, path string) error {
 	// Delete from storage
@@ -135,6 +154,8 @@ func (l *LocalRepository) Delete(ctx context.Context, path string) error {
 	if err := l.db.DeleteArtifactByPath(ctx, l.name, path); err != nil {
 		return fmt.Errorf("failed to delete artifact metadata: %w", err)
 	}
+	l.markAPKIndex(path)
+	l.markCocoaPodsShard(path)
 
 	return nil
 }
@@ -146,6 +167,15 @@ func (l *LocalRepository) List(ctx context.Context, prefix string) ([]string, er
 
 // GetIndex returns index for the repository
 func (l *LocalRepository) GetIndex(ctx context.Context, indexType string) (io.ReadCloser, error) {
+	// APK indexes are stored per branch/repo/arch and requested by their path
+	if l.artifactType == artifact.ArtifactTypeAPK && strings.HasSuffix(indexType, "/"+types.APKIndexFile) {
+		return l.apkIndex(ctx, indexType)
+	}
+	// CocoaPods shards and pod lists are stored at the repository root
+	if l.artifactType == artifact.ArtifactTypeCocoaPods && types.IsCocoaPodsIndexFile(indexType) {
+		return l.cocoapodsIndex(ctx, indexType)
+	}
+
 	// Get all artifacts for this repository
 	artifacts, err := l.db.GetArtifactsByRepository(ctx, l.name)
 	if err != nil {
@@ -193,6 +223,15 @@ func (l *LocalRepository) InvalidateCache(ctx context.Context, path string) erro
 
 // RebuildIndex rebuilds the repository index
 func (l *LocalRepository) RebuildIndex(ctx context.Context) error {
+	// APK indexes are regenerated from the database: only those marked by Push and
+	// Delete, or all of them when nothing is pending
+	if l.artifactType == artifact.ArtifactTypeAPK {
+		return l.rebuildAPKIndexes(ctx, !l.apkIndexes.pending())
+	}
+	if l.artifactType == artifact.ArtifactTypeCocoaPods {
+		return l.rebuildCocoaPodsShards(ctx, !l.cocoapodsShards.pending())
+	}
+
 	// For local repositories, we can rebuild index by scanning storage
 	// and updating database records
 	paths, err := l.storage.List(ctx, "")
@@ -225,7 +264,7 @@ func (l *LocalRepository) RebuildIndex(ctx context.Context) error {
 
 		// Update database
 		if err := l.db.SaveArtifact(ctx, &database.ArtifactInfo{
-			RepositoryID: 1, // TODO: Get actual repository ID
+			RepositoryID: l.repositoryID(ctx),
 			Type:         string(l.artifactType),
 			Name:         metadata.Name,
 			Version:      metadata.Version,
@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+)
+
+// Options configuring the quota of a repository
+const (
+	QuotaMaxBytesOption     = "quota_max_bytes"
+	QuotaMaxArtifactsOption = "quota_max_artifacts"
+	QuotaSoftPercentOption  = "quota_soft_percent"
+)
+
+// Quota scopes and resources
+const (
+	QuotaScopeRepository = "repository"
+	QuotaScopeGlobal     = "global"
+
+	QuotaBytes     = "bytes"
+	QuotaArtifacts = "artifacts"
+)
+
+// defaultQuotaSoftPercent is the share of a limit at which a warning is published by default
+const defaultQuotaSoftPercent = 90
+
+// Quota limits the content of a repository, or of all repositories; zero means no limit
+type Quota struct {
+	MaxBytes     int64
+	MaxArtifacts int64
+	// SoftPercent is the share of a limit, in percent, at which a warning is published
+	SoftPercent int
+}
+
+// Limited reports whether the quota sets a limit
+func (q Quota) Limited() bool {
+	return q.MaxBytes > 0 || q.MaxArtifacts > 0
+}
+
+// NewQuota parses a quota: maxBytes is a size such as "500MB", and softPercent defaults to 90
+func NewQuota(maxBytes string, maxArtifacts int64, softPercent int) (Quota, error) {
+	q := Quota{MaxArtifacts: maxArtifacts, SoftPercent: softPercent}
+	if maxBytes != "" {
+		size, err := ParseByteSize(maxBytes)
+		if err != nil {
+			return Quota{}, err
+		}
+		q.MaxBytes = size
+	}
+	if q.MaxArtifacts < 0 {
+		return Quota{}, fmt.Errorf("invalid artifact quota: %d", maxArtifacts)
+	}
+	if q.SoftPercent == 0 {
+		q.SoftPercent = defaultQuotaSoftPercent
+	}
+	if q.SoftPercent < 0 || q.SoftPercent > 100 {
+		return Quota{}, fmt.Errorf("invalid soft quota percentage: %d", softPercent)
+	}
+	return q, nil
+}
+
+// QuotaFromOptions returns the quota set by the options of a repository
+func QuotaFromOptions(options map[string]string) (Quota, error) {
+	var maxArtifacts int64
+	var softPercent int
+	var err error
+	if v := options[QuotaMaxArtifactsOption]; v != "" {
+		if maxArtifacts, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return Quota{}, fmt.Errorf("invalid %s: %s", QuotaMaxArtifactsOption, v)
+		}
+	}
+	if v := options[QuotaSoftPercentOption]; v != "" {
+		if softPercent, err = strconv.Atoi(v); err != nil {
+			return Quota{}, fmt.Errorf("invalid %s: %s", QuotaSoftPercentOption, v)
+		}
+	}
+	return NewQuota(options[QuotaMaxBytesOption], maxArtifacts, softPercent)
+}
+
+// ParseByteSize parses a size in bytes, optionally with a K, M, G or T suffix for powers of
+// 1024, which may be followed by B or iB: "512", "10MB" and "1GiB" are valid sizes
+func ParseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		if i := strings.IndexByte("KMGT", value[n-1]); i >= 0 {
+			multiplier = 1 << (10 * (i + 1))
+			value = strings.TrimSpace(value[:n-1])
+		}
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 || size > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return size * multiplier, nil
+}
+
+// QuotaError is returned by pushes that would exceed a quota
+type QuotaError struct {
+	Repository string
+	Scope      string
+	Resource   string
+	Limit      int64
+	Used       int64
+}
+
+func (e *QuotaError) Error() string {
+	if e.Scope == QuotaScopeGlobal {
+		return fmt.Sprintf("global quota of %d %s exceeded", e.Limit, e.Resource)
+	}
+	return fmt.Sprintf("quota of %d %s exceeded for repository %s", e.Limit, e.Resource, e.Repository)
+}
+
+// Status returns the HTTP status of the rejected push: 413 when it exceeds the quota of the
+// repository, 507 when it exceeds the global quota
+func (e *QuotaError) Status() int {
+	if e.Scope == QuotaScopeGlobal {
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusRequestEntityTooLarge
+}
+
+// QuotaStatistics reports the usage of the quotas applying to a repository
+type QuotaStatistics struct {
+	Repository QuotaScopeUsage  `json:"repository"`
+	Global     *QuotaScopeUsage `json:"global,omitempty"`
+}
+
+// QuotaScopeUsage is the usage and limits of a quota; a zero limit is no limit
+type QuotaScopeUsage struct {
+	Bytes        int64 `json:"bytes"`
+	Artifacts    int64 `json:"artifacts"`
+	MaxBytes     int64 `json:"max_bytes,omitempty"`
+	MaxArtifacts int64 `json:"max_artifacts,omitempty"`
+}
+
+// QuotaWrapper enforces the quota set by the options of a repository, and a global quota over
+// all repositories, on pushes to a repository. Usage is the size and number of the artifacts
+// recorded in the database, so it matches the repository statistics.
+type QuotaWrapper struct {
+	Repository
+	db        database.DatabaseInterface
+	global    Quota
+	publisher messaging.Publisher
+}
+
+// NewQuotaWrapper creates a quota wrapper for a repository; publisher receives soft limit
+// warnings and may be nil
+func NewQuotaWrapper(repo Repository, db database.DatabaseInterface, global Quota, publisher messaging.Publisher) Repository {
+	return &QuotaWrapper{Repository: repo, db: db, global: global, publisher: publisher}
+}
+
+// quotaScope is a quota with its current usage
+type quotaScope struct {
+	name  string
+	quota Quota
+	usage *database.Statistics
+}
+
+// scopes returns the quotas applying to the repository, with their usage
+func (q *QuotaWrapper) scopes(ctx context.Context) ([]quotaScope, error) {
+	options, err := repositoryOptions(ctx, q.db, q.GetName())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository options: %w", err)
+	}
+	quota, err := QuotaFromOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var scopes []quotaScope
+	if quota.Limited() {
+		usage, err := q.db.GetRepositoryStatistics(ctx, q.GetName())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get repository usage: %w", err)
+		}
+		scopes = append(scopes, quotaScope{name: QuotaScopeRepository, quota: quota, usage: usage})
+	}
+	if q.global.Limited() {
+		usage, err := q.db.GetStorageStatistics(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get storage usage: %w", err)
+		}
+		scopes = append(scopes, quotaScope{name: QuotaScopeGlobal, quota: q.global, usage: usage})
+	}
+	return scopes, nil
+}
+
+// Push stores an artifact when it fits in the quotas, and warns when it takes usage past a
+// soft limit. Content is counted while it is stored, so pushes of unknown size are stopped
+// once they exceed the remaining space. A push replacing the artifact at path frees its space.
+func (q *QuotaWrapper) Push(ctx context.Context, path string, content io.Reader, metadata *artifact.Metadata) error {
+	scopes, err := q.scopes(ctx)
+	if err != nil {
+		return err
+	}
+	if len(scopes) == 0 {
+		return q.Repository.Push(ctx, path, content, metadata)
+	}
+	if existing, err := q.db.GetArtifactByPath(ctx, q.GetName(), path); err == nil && existing != nil {
+		for i, scope := range scopes {
+			usage := *scope.usage
+			usage.TotalArtifacts--
+			usage.TotalSize -= existing.Size
+			scopes[i].usage = &usage
+		}
+	}
+
+	// The push may read as many bytes as the quota with the least space left allows
+	var exceeded *QuotaError
+	remaining := int64(-1)
+	for _, scope := range scopes {
+		if limit := scope.quota.MaxArtifacts; limit > 0 && scope.usage.TotalArtifacts >= limit {
+			return q.quotaError(scope, QuotaArtifacts)
+		}
+		if limit := scope.quota.MaxBytes; limit > 0 {
+			left := limit - scope.usage.TotalSize
+			if metadata != nil && metadata.Size > left {
+				return q.quotaError(scope, QuotaBytes)
+			}
+			if remaining < 0 || left < remaining {
+				remaining, exceeded = max(left, 0), q.quotaError(scope, QuotaBytes)
+			}
+		}
+	}
+
+	counter := &quotaReader{r: content, remaining: remaining, limit: exceeded}
+	if err := q.Repository.Push(ctx, path, counter, metadata); err != nil {
+		if counter.exceeded {
+			return exceeded
+		}
+		return err
+	}
+
+	for _, scope := range scopes {
+		q.warn(scope, QuotaBytes, scope.usage.TotalSize, scope.usage.TotalSize+counter.read, scope.quota.MaxBytes)
+		q.warn(scope, QuotaArtifacts, scope.usage.TotalArtifacts, scope.usage.TotalArtifacts+1, scope.quota.MaxArtifacts)
+	}
+	return nil
+}
+
+func (q *QuotaWrapper) quotaError(scope quotaScope, resource string) *QuotaError {
+	err := &QuotaError{Repository: q.GetName(), Scope: scope.name, Resource: resource}
+	if resource == QuotaBytes {
+		err.Limit, err.Used = scope.quota.MaxBytes, scope.usage.TotalSize
+	} else {
+		err.Limit, err.Used = scope.quota.MaxArtifacts, scope.usage.TotalArtifacts
+	}
+	return err
+}
+
+// warn publishes a warning when usage went past the soft limit of a quota
+func (q *QuotaWrapper) warn(scope quotaScope, resource string, before, after, limit int64) {
+	if limit <= 0 || q.publisher == nil {
+		return
+	}
+	soft := float64(limit) * float64(scope.quota.SoftPercent) / 100
+	if float64(before) >= soft || float64(after) < soft {
+		return
+	}
+	_ = q.publisher.Publish(messaging.Event{
+		Type:       messaging.EventQuotaWarning,
+		Repository: q.GetName(),
+		Timestamp:  time.Now(),
+		Quota:      &messaging.QuotaUsage{Scope: scope.name, Resource: resource, Used: after, Limit: limit},
+	})
+}
+
+// GetStatistics returns the repository statistics with the usage of its quotas
+func (q *QuotaWrapper) GetStatistics(ctx context.Context) (*Statistics, error) {
+	stats, err := q.Repository.GetStatistics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Quota = &QuotaStatistics{Repository: QuotaScopeUsage{Bytes: stats.TotalSize, Artifacts: stats.TotalArtifacts}}
+	if options, err := repositoryOptions(ctx, q.db, q.GetName()); err == nil {
+		if quota, err := QuotaFromOptions(options); err == nil {
+			stats.Quota.Repository.MaxBytes, stats.Quota.Repository.MaxArtifacts = quota.MaxBytes, quota.MaxArtifacts
+		}
+	}
+	if q.global.Limited() {
+		usage, err := q.db.GetStorageStatistics(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stats.Quota.Global = &QuotaScopeUsage{
+			Bytes:        usage.TotalSize,
+			Artifacts:    usage.TotalArtifacts,
+			MaxBytes:     q.global.MaxBytes,
+			MaxArtifacts: q.global.MaxArtifacts,
+		}
+	}
+	return stats, nil
+}
+
+// quotaReader counts the bytes read, failing once more than remaining are read; a negative
+// remaining is no limit
+type quotaReader struct {
+	r         io.Reader
+	read      int64
+	remaining int64
+	limit     *QuotaError
+	exceeded  bool
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.read += int64(n)
+	if q.remaining >= 0 && q.read > q.remaining {
+		q.exceeded = true
+		return n, q.limit
+	}
+	return n, err
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepository records the content pushed to it
+type countingRepository struct {
+	Repository
+	pushed map[string]string
+}
+
+func (c *countingRepository) GetName() string { return "builds" }
+
+func (c *countingRepository) Push(ctx context.Context, path string, content io.Reader, metadata *artifact.Metadata) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	c.pushed[path] = string(data)
+	return nil
+}
+
+func (c *countingRepository) GetStatistics(ctx context.Context) (*Statistics, error) {
+	return &Statistics{TotalArtifacts: 3, TotalSize: 90}, nil
+}
+
+// recordingPublisher keeps the events published to it
+type recordingPublisher struct {
+	events []messaging.Event
+}
+
+func (r *recordingPublisher) Publish(e messaging.Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recordingPublisher) Close() error { return nil }
+
+func TestParseByteSize(t *testing.T) {
+	for input, expected := range map[string]int64{
+		"512":   512,
+		"10K":   10 << 10,
+		"10MB":  10 << 20,
+		"1GiB":  1 << 30,
+		" 2 tb": 2 << 40,
+	} {
+		size, err := ParseByteSize(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, size, input)
+	}
+	for _, input := range []string{"", "MB", "-1", "1.5G", "10X"} {
+		_, err := ParseByteSize(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestQuotaWrapper(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDB)
+	mockDB.On("GetRepository", mock.Anything, "builds").Return(&database.Repository{
+		Name:   "builds",
+		Config: `{"quota_max_bytes":"100","quota_max_artifacts":"4","quota_soft_percent":"80"}`,
+	}, nil)
+	mockDB.On("GetRepositoryStatistics", mock.Anything, "builds").Return(&database.Statistics{TotalArtifacts: 3, TotalSize: 70}, nil)
+	mockDB.On("GetStorageStatistics", mock.Anything).Return(&database.Statistics{TotalArtifacts: 10, TotalSize: 500}, nil)
+	mockDB.On("GetArtifactByPath", mock.Anything, "builds", "old.bin").Return(&database.ArtifactInfo{Path: "old.bin", Size: 40}, nil)
+	mockDB.On("GetArtifactByPath", mock.Anything, "builds", mock.Anything).Return((*database.ArtifactInfo)(nil), errors.New("record not found"))
+
+	inner := &countingRepository{pushed: map[string]string{}}
+	publisher := &recordingPublisher{}
+	repo := NewQuotaWrapper(inner, mockDB, Quota{MaxBytes: 1000, SoftPercent: 90}, publisher)
+
+	t.Run("Pushes within the quota warn past the soft limit", func(t *testing.T) {
+		require.NoError(t, repo.Push(ctx, "a.bin", strings.NewReader(strings.Repeat("a", 20)), &artifact.Metadata{}))
+		assert.Len(t, inner.pushed["a.bin"], 20)
+		require.Len(t, publisher.events, 2)
+		assert.Equal(t, messaging.EventQuotaWarning, publisher.events[0].Type)
+		assert.Equal(t, &messaging.QuotaUsage{Scope: QuotaScopeRepository, Resource: QuotaBytes, Used: 90, Limit: 100}, publisher.events[0].Quota)
+		assert.Equal(t, &messaging.QuotaUsage{Scope: QuotaScopeRepository, Resource: QuotaArtifacts, Used: 4, Limit: 4}, publisher.events[1].Quota)
+	})
+
+	t.Run("Pushes of known size past the quota are rejected", func(t *testing.T) {
+		err := repo.Push(ctx, "b.bin", strings.NewReader("b"), &artifact.Metadata{Size: 31})
+		var quotaErr *QuotaError
+		require.True(t, errors.As(err, &quotaErr))
+		assert.Equal(t, QuotaScopeRepository, quotaErr.Scope)
+		assert.Equal(t, QuotaBytes, quotaErr.Resource)
+		assert.NotContains(t, inner.pushed, "b.bin")
+	})
+
+	t.Run("Pushes of unknown size are stopped past the quota", func(t *testing.T) {
+		err := repo.Push(ctx, "c.bin", strings.NewReader(strings.Repeat("c", 31)), &artifact.Metadata{})
+		var quotaErr *QuotaError
+		require.True(t, errors.As(err, &quotaErr))
+		assert.Equal(t, QuotaBytes, quotaErr.Resource)
+	})
+
+	t.Run("Pushes replacing an artifact reuse its space", func(t *testing.T) {
+		require.NoError(t, repo.Push(ctx, "old.bin", strings.NewReader(strings.Repeat("o", 60)), &artifact.Metadata{}))
+		assert.Len(t, inner.pushed["old.bin"], 60)
+	})
+
+	t.Run("Statistics report usage and limits", func(t *testing.T) {
+		stats, err := repo.GetStatistics(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &QuotaStatistics{
+			Repository: QuotaScopeUsage{Bytes: 90, Artifacts: 3, MaxBytes: 100, MaxArtifacts: 4},
+			Global:     &QuotaScopeUsage{Bytes: 500, Artifacts: 10, MaxBytes: 1000},
+		}, stats.Quota)
+	})
+}
+
+func TestQuotaWrapperLimits(t *testing.T) {
+	ctx := context.Background()
+	newRepo := func(usage *database.Statistics, global Quota) Repository {
+		mockDB := new(MockDB)
+		mockDB.On("GetRepository", mock.Anything, "builds").Return(&database.Repository{Name: "builds", Config: `{"quota_max_artifacts":"5"}`}, nil)
+		mockDB.On("GetRepositoryStatistics", mock.Anything, "builds").Return(usage, nil)
+		mockDB.On("GetStorageStatistics", mock.Anything).Return(usage, nil)
+		mockDB.On("GetArtifactByPath", mock.Anything, "builds", mock.Anything).Return((*database.ArtifactInfo)(nil), errors.New("record not found"))
+		return NewQuotaWrapper(&countingRepository{pushed: map[string]string{}}, mockDB, global, nil)
+	}
+
+	err := newRepo(&database.Statistics{TotalArtifacts: 5}, Quota{}).Push(ctx, "a", strings.NewReader("a"), &artifact.Metadata{})
+	var quotaErr *QuotaError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, QuotaArtifacts, quotaErr.Resource)
+
+	err = newRepo(&database.Statistics{TotalArtifacts: 1, TotalSize: 10}, Quota{MaxBytes: 10}).Push(ctx, "a", strings.NewReader("a"), &artifact.Metadata{})
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, QuotaScopeGlobal, quotaErr.Scope)
+
+	assert.NoError(t, newRepo(&database.Statistics{TotalArtifacts: 1}, Quota{}).Push(ctx, "a", strings.NewReader("a"), &artifact.Metadata{}))
+
+	_, err = QuotaFromOptions(map[string]string{QuotaSoftPercentOption: "120"})
+	assert.Error(t, err)
+}
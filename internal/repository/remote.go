@@ -5,13 +5,23 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	pathpkg "path"
 	"time"
 
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
 	"github.com/hbahadorzadeh/ganje/internal/database"
 	"github.com/hbahadorzadeh/ganje/internal/storage"
 )
 
+// Cached upstream content is considered fresh for remoteCacheTTL; indexes that change whenever
+// upstream publishes (such as conda repodata.json or the revision info of a Hugging Face
+// branch) are revalidated after remoteIndexCacheTTL.
+const (
+	remoteCacheTTL      = 24 * time.Hour
+	remoteIndexCacheTTL = 10 * time.Minute
+)
+
 // RemoteRepository implements remote repository functionality with caching
 type RemoteRepository struct {
 	name         string
@@ -65,8 +75,9 @@ func (r *RemoteRepository) Pull(ctx context.Context, path string) (io.ReadCloser
 		content, err := r.storage.Retrieve(ctx, cacheEntry.LocalPath)
 		if err == nil {
 			metadata := &artifact.Metadata{
-				Size:     cacheEntry.Size,
-				Checksum: cacheEntry.Checksum,
+				Size:      cacheEntry.Size,
+				Checksum:  cacheEntry.Checksum,
+				UpdatedAt: cacheEntry.UpdatedAt,
 			}
 			return content, metadata, nil
 		}
@@ -86,20 +97,11 @@ func (r *RemoteRepository) Pull(ctx context.Context, path string) (io.ReadCloser
 
 	// Store in cache
 	cachePath := fmt.Sprintf("cache/%s/%s", r.name, path)
-	if err := r.storage.Store(ctx, cachePath, resp.Body); err != nil {
-		return nil, nil, fmt.Errorf("failed to cache artifact: %w", err)
-	}
-
-	// Get size and checksum
-	size, err := r.storage.GetSize(ctx, cachePath)
+	digests, err := r.storage.Store(ctx, cachePath, resp.Body)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get cached artifact size: %w", err)
-	}
-
-	checksum, err := r.storage.GetChecksum(ctx, cachePath)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get cached artifact checksum: %w", err)
+		return nil, nil, fmt.Errorf("failed to cache artifact: %w", err)
 	}
+	size, checksum := digests.Size, digests.SHA256
 
 	// Save cache entry
 	cacheEntry = &database.CacheEntry{
@@ -108,7 +110,7 @@ func (r *RemoteRepository) Pull(ctx context.Context, path string) (io.ReadCloser
 		LocalPath:    cachePath,
 		Size:         size,
 		Checksum:     checksum,
-		ExpiresAt:    time.Now().Add(24 * time.Hour), // Cache for 24 hours
+		ExpiresAt:    time.Now().Add(r.cacheTTL(path)),
 	}
 	r.db.SaveCacheEntry(ctx, cacheEntry)
 
@@ -119,13 +121,25 @@ func (r *RemoteRepository) Pull(ctx context.Context, path string) (io.ReadCloser
 	}
 
 	metadata := &artifact.Metadata{
-		Size:     size,
-		Checksum: checksum,
+		Size:      size,
+		Checksum:  checksum,
+		UpdatedAt: cacheEntry.UpdatedAt,
 	}
 
 	return content, metadata, nil
 }
 
+// cacheTTL returns how long a cached copy of path is served without asking upstream
+func (r *RemoteRepository) cacheTTL(path string) time.Duration {
+	if r.artifactType == artifact.ArtifactTypeConda && types.IsCondaIndexFile(pathpkg.Base(path)) {
+		return remoteIndexCacheTTL
+	}
+	if r.artifactType == artifact.ArtifactTypeHuggingFace && types.IsHuggingFaceMutablePath(path) {
+		return remoteIndexCacheTTL
+	}
+	return remoteCacheTTL
+}
+
 // Push is not supported for remote repositories
 func (r *RemoteRepository) Push(ctx context.Context, path string, content io.Reader, metadata *artifact.Metadata) error {
 	return fmt.Errorf("push operation not supported for remote repository")
@@ -59,6 +59,9 @@ type Statistics struct {
 	TotalSize      int64 `json:"total_size"`
 	PullCount      int64 `json:"pull_count"`
 	PushCount      int64 `json:"push_count"`
+
+	// Quota is the usage of the quotas applying to the repository, when it enforces them
+	Quota *QuotaStatistics `json:"quota,omitempty"`
 }
 
 // Config represents repository configuration
@@ -71,6 +74,9 @@ type Config struct {
 	Options      map[string]string `yaml:"options,omitempty"`
 }
 
+// StoragePoolOption is the option naming the storage pool of a repository
+const StoragePoolOption = "storage_pool"
+
 // Manager manages repositories
 type Manager interface {
 	// GetRepository returns a repository by name
@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"io"
 	"strings"
 	"testing"
@@ -9,7 +13,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
 	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
 )
 
 // MockStorage for testing
@@ -17,9 +23,12 @@ type MockStorage struct {
 	mock.Mock
 }
 
-func (m *MockStorage) Store(ctx context.Context, path string, content io.Reader) error {
+func (m *MockStorage) Store(ctx context.Context, path string, content io.Reader) (*storage.Digests, error) {
 	args := m.Called(ctx, path, content)
-	return args.Error(0)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Digests), args.Error(1)
 }
 
 func (m *MockStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
@@ -27,6 +36,11 @@ func (m *MockStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser,
 	return args.Get(0).(io.ReadCloser), args.Error(1)
 }
 
+func (m *MockStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	args := m.Called(ctx, path, offset, length)
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
 func (m *MockStorage) Delete(ctx context.Context, path string) error {
 	args := m.Called(ctx, path)
 	return args.Error(0)
@@ -117,6 +131,11 @@ func (m *MockDB) GetArtifactByPath(ctx context.Context, repositoryName, path str
 	return args.Get(0).(*database.ArtifactInfo), args.Error(1)
 }
 
+func (m *MockDB) GetArtifactsByPaths(ctx context.Context, repositoryName string, paths []string) ([]*database.ArtifactInfo, error) {
+	args := m.Called(ctx, repositoryName, paths)
+	return args.Get(0).([]*database.ArtifactInfo), args.Error(1)
+}
+
 func (m *MockDB) DeleteArtifactByPath(ctx context.Context, repositoryName, path string) error {
 	args := m.Called(ctx, repositoryName, path)
 	return args.Error(0)
@@ -132,6 +151,11 @@ func (m *MockDB) GetRepositoryStatistics(ctx context.Context, repositoryName str
 	return args.Get(0).(*database.Statistics), args.Error(1)
 }
 
+func (m *MockDB) GetStorageStatistics(ctx context.Context) (*database.Statistics, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*database.Statistics), args.Error(1)
+}
+
 func (m *MockDB) LogAccess(ctx context.Context, log *database.AccessLog) error {
 	args := m.Called(ctx, log)
 	return args.Error(0)
@@ -142,6 +166,11 @@ func (m *MockDB) UpdateArtifactYanked(ctx context.Context, repositoryName, name,
 	return args.Error(0)
 }
 
+func (m *MockDB) UpdateArtifactMetadata(ctx context.Context, id uint, metadata string) error {
+	args := m.Called(ctx, id, metadata)
+	return args.Error(0)
+}
+
 func (m *MockDB) CreateWebhook(ctx context.Context, repoName string, hook *database.Webhook) error {
 	args := m.Called(ctx, repoName, hook)
 	return args.Error(0)
@@ -178,6 +207,60 @@ func (m *MockDB) RecordWebhookDelivery(ctx context.Context, delivery *database.W
 	return args.Error(0)
 }
 
+// Conan revision methods to satisfy DatabaseInterface
+func (m *MockDB) SaveConanRevision(ctx context.Context, repoName string, rev *database.ConanRevision) error {
+	args := m.Called(ctx, repoName, rev)
+	return args.Error(0)
+}
+
+func (m *MockDB) ListConanRevisions(ctx context.Context, repoName, reference, recipeRevision, packageID string) ([]*database.ConanRevision, error) {
+	args := m.Called(ctx, repoName, reference, recipeRevision, packageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*database.ConanRevision), args.Error(1)
+}
+
+func (m *MockDB) GetLatestConanRevision(ctx context.Context, repoName, reference, recipeRevision, packageID string) (*database.ConanRevision, error) {
+	args := m.Called(ctx, repoName, reference, recipeRevision, packageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*database.ConanRevision), args.Error(1)
+}
+
+func (m *MockDB) DeleteConanRevisions(ctx context.Context, repoName, reference, recipeRevision, packageID, packageRevision string) error {
+	args := m.Called(ctx, repoName, reference, recipeRevision, packageID, packageRevision)
+	return args.Error(0)
+}
+
+// Git LFS lock methods to satisfy DatabaseInterface
+func (m *MockDB) CreateLFSLock(ctx context.Context, repoName string, lock *database.LFSLock) error {
+	args := m.Called(ctx, repoName, lock)
+	return args.Error(0)
+}
+
+func (m *MockDB) ListLFSLocks(ctx context.Context, repoName string) ([]*database.LFSLock, error) {
+	args := m.Called(ctx, repoName)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*database.LFSLock), args.Error(1)
+}
+
+func (m *MockDB) DeleteLFSLock(ctx context.Context, repoName string, id uint) error {
+	args := m.Called(ctx, repoName, id)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetDedupSavings(ctx context.Context) ([]*database.DedupSavings, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*database.DedupSavings), args.Error(1)
+}
+
 // MockArtifact for testing
 type MockArtifact struct {
 	mock.Mock
@@ -259,10 +342,11 @@ func TestLocalRepository(t *testing.T) {
 		}
 		
 		mockArtifact.On("ValidateArtifact", mock.Anything).Return(nil)
-		mockStorage.On("Store", ctx, path, mock.Anything).Return(nil)
-		mockStorage.On("GetSize", ctx, path).Return(int64(100), nil)
-		mockStorage.On("GetChecksum", ctx, path).Return("sha256:abc123", nil)
-		mockDB.On("SaveArtifact", ctx, mock.AnythingOfType("*database.ArtifactInfo")).Return(nil)
+		mockStorage.On("Store", ctx, path, mock.Anything).Return(&storage.Digests{Size: 100, SHA256: "abc123"}, nil)
+		mockDB.On("GetRepository", ctx, "local-maven-repo").Return(&database.Repository{ID: 7, Name: "local-maven-repo"}, nil)
+		mockDB.On("SaveArtifact", ctx, mock.MatchedBy(func(info *database.ArtifactInfo) bool {
+			return info.Size == 100 && info.Checksum == "abc123"
+		})).Return(nil)
 		
 		err := repo.Push(ctx, path, content, metadata)
 		assert.NoError(t, err)
@@ -362,7 +446,7 @@ func TestRemoteRepository(t *testing.T) {
 		mockStorage.On("Exists", ctx, path).Return(false, nil).Once()
 		
 		// Cache the artifact after fetching from remote
-		mockStorage.On("Store", ctx, path, mock.Anything).Return(nil).Once()
+		mockStorage.On("Store", ctx, path, mock.Anything).Return(&storage.Digests{Size: 11, SHA256: "abc"}, nil).Once()
 		
 		// Return cached content
 		expectedContent := io.NopCloser(strings.NewReader("tgz content"))
@@ -570,7 +654,7 @@ func TestRepositoryIndexing(t *testing.T) {
 		mockArtifact.On("GenerateIndex", mock.AnythingOfType("[]*artifact.ArtifactInfo")).Return(indexData, nil)
 		
 		// Mock storing the generated index
-		mockStorage.On("Store", ctx, ".index/maven-metadata.xml", mock.Anything).Return(nil)
+		mockStorage.On("Store", ctx, ".index/maven-metadata.xml", mock.Anything).Return(&storage.Digests{}, nil)
 		
 		err := repo.RebuildIndex(ctx)
 		assert.NoError(t, err)
@@ -672,3 +756,167 @@ func TestRepositoryValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestLocalRepositoryAPKIndexes(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := &MockStorage{}
+	mockDB := &MockDB{}
+	repo := NewLocalRepository("alpine", artifact.ArtifactTypeAPK, mockStorage, &MockArtifactFactory{}, mockDB)
+
+	apkRecord := func(path, name string) *database.ArtifactInfo {
+		parts := strings.Split(path, "/")
+		return &database.ArtifactInfo{
+			Type: "apk", Name: name, Version: "1.0-r0", Path: path, Size: 10,
+			Metadata: `{"name":"` + name + `","version":"1.0-r0","arch":"` + parts[2] + `","apk_checksum":"Q1abc="}`,
+		}
+	}
+	mockDB.On("GetRepository", ctx, "alpine").Return(&database.Repository{ID: 3, Name: "alpine", Config: `{"apk_key_name":"unused.rsa.pub"}`}, nil)
+	mockDB.On("SaveArtifact", ctx, mock.AnythingOfType("*database.ArtifactInfo")).Return(nil)
+	mockDB.On("DeleteArtifactByPath", ctx, "alpine", mock.Anything).Return(nil)
+	mockDB.On("GetArtifactsByRepository", ctx, "alpine").Return([]*database.ArtifactInfo{
+		apkRecord("v3.19/main/x86_64/hello-1.0-r0.apk", "hello"),
+		apkRecord("v3.19/main/aarch64/hello-1.0-r0.apk", "hello"),
+		apkRecord("v3.19/main/noarch/hello-doc-1.0-r0.apk", "hello-doc"),
+		apkRecord("edge/testing/x86_64/tool-1.0-r0.apk", "tool"),
+	}, nil)
+
+	var stored []string
+	indexes := map[string][]byte{}
+	mockStorage.On("Store", ctx, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		path := args.String(1)
+		if strings.HasSuffix(path, "/APKINDEX.tar.gz") {
+			stored = append(stored, path)
+			indexes[path], _ = io.ReadAll(args.Get(2).(io.Reader))
+		}
+	}).Return(&storage.Digests{Size: 10, SHA256: "abc"}, nil)
+	mockStorage.On("Delete", ctx, mock.Anything).Return(nil)
+
+	t.Run("Push rebuilds only the affected index", func(t *testing.T) {
+		stored = nil
+		assert.NoError(t, repo.Push(ctx, "v3.19/main/x86_64/hello-1.0-r0.apk", strings.NewReader("apk"), &artifact.Metadata{Name: "hello"}))
+		assert.NoError(t, repo.RebuildIndex(ctx))
+		assert.Equal(t, []string{"v3.19/main/x86_64/APKINDEX.tar.gz"}, stored)
+
+		text := apkIndexText(t, indexes["v3.19/main/x86_64/APKINDEX.tar.gz"])
+		assert.Contains(t, text, "P:hello\n")
+		assert.Contains(t, text, "P:hello-doc\n", "noarch packages are listed for every architecture")
+		assert.NotContains(t, text, "P:tool\n")
+	})
+
+	t.Run("noarch changes rebuild every architecture of the branch", func(t *testing.T) {
+		stored = nil
+		assert.NoError(t, repo.Delete(ctx, "v3.19/main/noarch/hello-doc-1.0-r0.apk"))
+		assert.NoError(t, repo.RebuildIndex(ctx))
+		assert.ElementsMatch(t, []string{"v3.19/main/x86_64/APKINDEX.tar.gz", "v3.19/main/aarch64/APKINDEX.tar.gz"}, stored)
+	})
+
+	t.Run("Nothing pending rebuilds all indexes", func(t *testing.T) {
+		stored = nil
+		assert.NoError(t, repo.RebuildIndex(ctx))
+		assert.ElementsMatch(t, []string{
+			"v3.19/main/x86_64/APKINDEX.tar.gz",
+			"v3.19/main/aarch64/APKINDEX.tar.gz",
+			"edge/testing/x86_64/APKINDEX.tar.gz",
+		}, stored)
+	})
+
+	t.Run("GetIndex returns the stored index", func(t *testing.T) {
+		mockStorage.On("Exists", ctx, "edge/testing/x86_64/APKINDEX.tar.gz").Return(true, nil)
+		mockStorage.On("Retrieve", ctx, "edge/testing/x86_64/APKINDEX.tar.gz").
+			Return(io.NopCloser(strings.NewReader("index")), nil)
+		index, err := repo.GetIndex(ctx, "edge/testing/x86_64/APKINDEX.tar.gz")
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(index)
+		assert.Equal(t, "index", string(data))
+
+		mockStorage.On("Exists", ctx, "edge/main/x86_64/APKINDEX.tar.gz").Return(false, nil)
+		_, err = repo.GetIndex(ctx, "edge/main/x86_64/APKINDEX.tar.gz")
+		assert.Error(t, err)
+	})
+}
+
+// apkIndexText extracts the APKINDEX file from an unsigned APKINDEX.tar.gz
+func apkIndexText(t *testing.T, index []byte) string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("APKINDEX not found: %v", err)
+		}
+		if hdr.Name == "APKINDEX" {
+			data, _ := io.ReadAll(tr)
+			return string(data)
+		}
+	}
+}
+
+func TestLocalRepositoryCocoaPodsShards(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := &MockStorage{}
+	mockDB := &MockDB{}
+	repo := NewLocalRepository("pods", artifact.ArtifactTypeCocoaPods, mockStorage, &MockArtifactFactory{}, mockDB)
+
+	podRecord := func(name, version string, deprecated bool) *database.ArtifactInfo {
+		spec := &types.CocoaPodsSpec{Name: name, Version: version, Deprecated: deprecated}
+		props, _ := json.Marshal(spec.Properties())
+		return &database.ArtifactInfo{Type: "cocoapods", Name: name, Version: version, Path: types.CocoaPodsSpecPath(name, version), Metadata: string(props)}
+	}
+	mockDB.On("GetRepository", ctx, "pods").Return(&database.Repository{ID: 4, Name: "pods"}, nil)
+	mockDB.On("SaveArtifact", ctx, mock.AnythingOfType("*database.ArtifactInfo")).Return(nil)
+	mockDB.On("DeleteArtifactByPath", ctx, "pods", mock.Anything).Return(nil)
+	mockDB.On("GetArtifactsByRepository", ctx, "pods").Return([]*database.ArtifactInfo{
+		podRecord("Alamofire", "5.9.1", false),
+		podRecord("Alamofire", "5.10.0", false),
+		podRecord("Legacy", "1.0.0", true),
+		{Type: "cocoapods", Name: "Alamofire", Version: "5.9.1", Path: "sources/Alamofire/5.9.1/Alamofire.zip", Metadata: `{"type":"cocoapods-source"}`},
+	}, nil)
+
+	files := map[string]string{}
+	mockStorage.On("Store", ctx, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := io.ReadAll(args.Get(2).(io.Reader))
+		files[args.String(1)] = string(data)
+	}).Return(&storage.Digests{Size: 10, SHA256: "abc"}, nil)
+	mockStorage.On("Delete", ctx, mock.Anything).Return(nil)
+
+	alamofireShard := types.CocoaPodsShardFile(types.CocoaPodsShard("Alamofire"))
+	legacyShard := types.CocoaPodsShardFile(types.CocoaPodsShard("Legacy"))
+
+	t.Run("Push rebuilds only the affected shard", func(t *testing.T) {
+		files = map[string]string{}
+		path := types.CocoaPodsSpecPath("Alamofire", "5.10.0")
+		assert.NoError(t, repo.Push(ctx, path, strings.NewReader("{}"), &artifact.Metadata{Name: "Alamofire"}))
+		assert.NoError(t, repo.RebuildIndex(ctx))
+		assert.Equal(t, "Alamofire/5.9.1/5.10.0\n", files[alamofireShard])
+		assert.NotContains(t, files, legacyShard)
+		assert.Equal(t, "Alamofire\nLegacy\n", files[types.CocoaPodsAllPodsFile])
+		assert.Equal(t, types.CocoaPodsSpecPath("Legacy", "1.0.0")+"\n", files[types.CocoaPodsDeprecatedFile])
+	})
+
+	t.Run("Source archives do not mark shards", func(t *testing.T) {
+		assert.NoError(t, repo.Push(ctx, "sources/Alamofire/5.9.1/Alamofire.zip", strings.NewReader("zip"), &artifact.Metadata{Name: "Alamofire"}))
+		files = map[string]string{}
+		assert.NoError(t, repo.RebuildIndex(ctx))
+		assert.Contains(t, files, alamofireShard, "nothing pending rebuilds every shard")
+		assert.Contains(t, files, legacyShard)
+	})
+
+	t.Run("GetIndex serves unknown shards empty", func(t *testing.T) {
+		mockStorage.On("Exists", ctx, alamofireShard).Return(true, nil)
+		mockStorage.On("Retrieve", ctx, alamofireShard).Return(io.NopCloser(strings.NewReader("Alamofire/5.9.1\n")), nil)
+		index, err := repo.GetIndex(ctx, alamofireShard)
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(index)
+		assert.Equal(t, "Alamofire/5.9.1\n", string(data))
+
+		mockStorage.On("Exists", ctx, "all_pods_versions_0_0_0.txt").Return(false, nil)
+		index, err = repo.GetIndex(ctx, "all_pods_versions_0_0_0.txt")
+		assert.NoError(t, err)
+		data, _ = io.ReadAll(index)
+		assert.Empty(t, data)
+	})
+}
@@ -16,6 +16,8 @@ func RegisterAPIRoutes(
 	r *gin.Engine,
 	db database.DatabaseInterface,
 	storageService storage.Storage,
+	keyRotator controllers.KeyRotator,
+	scrubber controllers.StorageScrubber,
 	authService auth.AuthInterface,
 	oidcService *auth.OIDCService,
 	messagingService messaging.Publisher,
@@ -51,6 +53,10 @@ func RegisterAPIRoutes(
 
 	// Statistics
 	api.GET("/repositories/:name/stats", authMiddleware, controllers.GetRepositoryStats(db))
+	api.GET("/storage/dedup", authMiddleware, requireAdmin, controllers.GetDedupSavings(db, cfg))
+	api.POST("/storage/encryption/rotate", authMiddleware, requireAdmin, controllers.RotateEncryptionKeys(keyRotator))
+	api.GET("/storage/scrub", authMiddleware, requireAdmin, controllers.GetStorageScrub(scrubber, cfg))
+	api.POST("/storage/scrub", authMiddleware, requireAdmin, controllers.StartStorageScrub(scrubber))
 
 	// Artifacts (admin portal)
 	api.GET("/repositories/:name/artifacts", authMiddleware, requireRead, controllers.ListArtifacts(db))
@@ -2,14 +2,19 @@ package routes
 
 import (
 	"context"
+	"encoding/json"
+	"log"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
 	"github.com/hbahadorzadeh/ganje/internal/auth"
 	"github.com/hbahadorzadeh/ganje/internal/config"
 	"github.com/hbahadorzadeh/ganje/internal/controllers"
 	"github.com/hbahadorzadeh/ganje/internal/database"
 	"github.com/hbahadorzadeh/ganje/internal/messaging"
 	"github.com/hbahadorzadeh/ganje/internal/metrics"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
 	"github.com/hbahadorzadeh/ganje/internal/storage"
 )
 
@@ -17,7 +22,8 @@ import (
 func RegisterDynamicRoutes(
 	r *gin.Engine,
 	db database.DatabaseInterface,
-	storageService storage.Storage,
+	pools storage.Pools,
+	quota repository.Quota,
 	authService auth.AuthInterface,
 	messagingService messaging.Publisher,
 	metricsService *metrics.MetricsService,
@@ -37,7 +43,18 @@ func RegisterDynamicRoutes(
 	}
 
 	for _, repo := range repos {
-		registerRepositoryRoutes(r, repo, db, storageService, authService, messagingService, metricsService, cfg, authMiddleware, requireRead, requireWrite)
+		// Bind the repository to its storage pool
+		opts := map[string]string{}
+		if strings.TrimSpace(repo.Config) != "" {
+			_ = json.Unmarshal([]byte(repo.Config), &opts)
+		}
+		pool, err := pools.Get(opts[repository.StoragePoolOption])
+		if err != nil {
+			log.Printf("Skipping routes of repository %s: %v", repo.Name, err)
+			continue
+		}
+		storageService := pool.ForRepository(repo.Name)
+		registerRepositoryRoutes(r, repo, db, storageService, quota, authService, messagingService, metricsService, cfg, authMiddleware, requireRead, requireWrite)
 	}
 }
 
@@ -47,6 +64,7 @@ func registerRepositoryRoutes(
 	repo *database.Repository,
 	db database.DatabaseInterface,
 	storageService storage.Storage,
+	quota repository.Quota,
 	authService auth.AuthInterface,
 	messagingService messaging.Publisher,
 	metricsService *metrics.MetricsService,
@@ -70,7 +88,7 @@ func registerRepositoryRoutes(
 	case "helm":
 		registerHelmRoutes(r, repo, db, storageService, authService, messagingService, metricsService, authMiddleware, requireRead, requireWrite)
 	case "generic":
-		registerGenericRoutes(r, repo, db, storageService, authService, messagingService, metricsService, authMiddleware, requireRead, requireWrite)
+		registerGenericRoutes(r, repo, db, storageService, quota, authService, messagingService, metricsService, authMiddleware, requireRead, requireWrite)
 	}
 }
 
@@ -217,6 +235,7 @@ func registerGenericRoutes(
 	repo *database.Repository,
 	db database.DatabaseInterface,
 	storageService storage.Storage,
+	quota repository.Quota,
 	authService auth.AuthInterface,
 	messagingService messaging.Publisher,
 	metricsService *metrics.MetricsService,
@@ -228,7 +247,9 @@ func registerGenericRoutes(
 	repoGroup.Use(authMiddleware)
 	
 	repoGroup.GET("/*path", requireRead, controllers.GenericGet(db, storageService, repo.Name))
-	repoGroup.PUT("/*path", requireWrite, controllers.GenericPut(db, storageService, messagingService, repo.Name))
+	// Uploads are recorded and held to the quotas through the repository
+	local := repository.NewLocalRepository(repo.Name, artifact.ArtifactTypeGeneric, storageService, artifact.NewFactory(), db)
+	repoGroup.PUT("/*path", requireWrite, controllers.GenericPut(repository.NewQuotaWrapper(local, db, quota, messagingService), repo.Name))
 	repoGroup.HEAD("/*path", requireRead, controllers.GenericHead(db, repo.Name))
 	repoGroup.DELETE("/*path", requireWrite, controllers.GenericDelete(db, storageService, repo.Name))
 }
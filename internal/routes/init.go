@@ -4,9 +4,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/hbahadorzadeh/ganje/internal/auth"
 	"github.com/hbahadorzadeh/ganje/internal/config"
+	"github.com/hbahadorzadeh/ganje/internal/controllers"
 	"github.com/hbahadorzadeh/ganje/internal/database"
 	"github.com/hbahadorzadeh/ganje/internal/messaging"
 	"github.com/hbahadorzadeh/ganje/internal/metrics"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
 	"github.com/hbahadorzadeh/ganje/internal/storage"
 )
 
@@ -14,7 +16,9 @@ import (
 func SetupRoutes(
 	r *gin.Engine,
 	db database.DatabaseInterface,
-	storageService storage.Storage,
+	pools storage.Pools,
+	quota repository.Quota,
+	scrubber controllers.StorageScrubber,
 	authService auth.AuthInterface,
 	oidcService *auth.OIDCService,
 	messagingService messaging.Publisher,
@@ -44,8 +48,13 @@ func SetupRoutes(
 	requireAdmin := createPermissionMiddleware(authService, auth.PermissionAdmin)
 
 	// Setup API routes
-	RegisterAPIRoutes(r, db, storageService, authService, oidcService, messagingService, metricsService, cfg, authMiddleware, requireRead, requireWrite, requireAdmin)
+	storageService := pools[storage.DefaultPool].Storage
+	var keyRotator controllers.KeyRotator
+	if cfg.Storage.Encryption.Enabled {
+		keyRotator = pools
+	}
+	RegisterAPIRoutes(r, db, storageService, keyRotator, scrubber, authService, oidcService, messagingService, metricsService, cfg, authMiddleware, requireRead, requireWrite, requireAdmin)
 
 	// Setup dynamic artifact routes
-	RegisterDynamicRoutes(r, db, storageService, authService, messagingService, metricsService, cfg, authMiddleware, requireRead, requireWrite)
+	RegisterDynamicRoutes(r, db, pools, quota, authService, messagingService, metricsService, cfg, authMiddleware, requireRead, requireWrite)
 }
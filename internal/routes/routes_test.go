@@ -0,0 +1,229 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/auth"
+	"github.com/hbahadorzadeh/ganje/internal/config"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allowAll accepts every token and grants every permission
+type allowAll struct{}
+
+func (allowAll) ValidateToken(token string) (*auth.Claims, error) {
+	return &auth.Claims{Username: "ci"}, nil
+}
+
+func (allowAll) CheckPermission(claims *auth.Claims, repository string, permission auth.Permission) bool {
+	return true
+}
+
+// recordingPublisher keeps the events published to it
+type recordingPublisher struct {
+	events []messaging.Event
+}
+
+func (r *recordingPublisher) Publish(e messaging.Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recordingPublisher) Close() error { return nil }
+
+func TestGenericUploadQuotas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db, err := database.New("sqlite", ":memory:")
+	require.NoError(t, err)
+	require.NoError(t, db.SaveRepository(ctx, &database.Repository{
+		Name: "builds", Type: "local", ArtifactType: "generic",
+		Config: `{"quota_max_bytes":"10","quota_max_artifacts":"2"}`,
+	}))
+	require.NoError(t, db.SaveRepository(ctx, &database.Repository{Name: "scratch", Type: "local", ArtifactType: "generic"}))
+
+	pools := storage.Pools{
+		storage.DefaultPool: storage.NewPool(storage.DefaultPool, storage.NewLocalStorage(t.TempDir()), "", storage.PoolLayers{}),
+	}
+	publisher := &recordingPublisher{}
+	r := gin.New()
+	SetupRoutes(r, db, pools, repository.Quota{MaxBytes: 20, SoftPercent: 90}, nil, allowAll{}, nil, publisher, nil, &config.Config{})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, do("PUT", "/builds/a.txt", "12345").Code)
+	original, err := db.GetArtifactByPath(ctx, "builds", "builds/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, do("PUT", "/builds/a.txt", "123456").Code, "replacing an upload frees its space")
+	replaced, err := db.GetArtifactByPath(ctx, "builds", "builds/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, original.ID, replaced.ID, "the record is updated in place")
+	assert.Equal(t, int64(6), replaced.Size)
+	assert.Equal(t, int64(2), replaced.PushCount)
+	assert.Equal(t, http.StatusCreated, do("PUT", "/builds/b.txt", "1234").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, do("PUT", "/builds/c.txt", "1").Code)
+
+	assert.Equal(t, http.StatusOK, do("HEAD", "/builds/a.txt", "").Code)
+	w := do("GET", "/builds/a.txt", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "123456", w.Body.String())
+
+	stats, err := db.GetRepositoryStatistics(ctx, "builds")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.TotalArtifacts)
+	assert.Equal(t, int64(10), stats.TotalSize)
+
+	assert.Equal(t, http.StatusInsufficientStorage, do("PUT", "/scratch/big.bin", strings.Repeat("x", 11)).Code)
+	assert.Equal(t, http.StatusNotFound, do("HEAD", "/scratch/big.bin", "").Code)
+
+	var warnings []messaging.QuotaUsage
+	for _, e := range publisher.events {
+		if e.Type == messaging.EventQuotaWarning {
+			warnings = append(warnings, *e.Quota)
+		}
+	}
+	assert.Contains(t, warnings, messaging.QuotaUsage{Scope: repository.QuotaScopeRepository, Resource: repository.QuotaBytes, Used: 10, Limit: 10})
+}
+
+func TestGenericUploadsScrubClean(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db, err := database.New("sqlite", ":memory:")
+	require.NoError(t, err)
+	require.NoError(t, db.SaveRepository(ctx, &database.Repository{Name: "builds", Type: "local", ArtifactType: "generic"}))
+	require.NoError(t, db.SaveRepository(ctx, &database.Repository{Name: "mirror", Type: "local", ArtifactType: "generic"}))
+
+	pools := storage.Pools{
+		storage.DefaultPool: storage.NewPool(storage.DefaultPool, storage.NewLocalStorage(t.TempDir()), "", storage.PoolLayers{}),
+	}
+	r := gin.New()
+	SetupRoutes(r, db, pools, repository.Quota{}, nil, allowAll{}, nil, &recordingPublisher{}, nil, &config.Config{})
+
+	for _, path := range []string{"/builds/a.txt", "/builds/nested/b.txt"} {
+		req := httptest.NewRequest("PUT", path, strings.NewReader("content of "+path))
+		req.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	// Records are keyed like the stored content, so live uploads are neither missing nor orphans
+	report, err := storage.NewScrubber(pools, db, storage.ScrubOptions{OnOrphan: storage.ScrubPolicyQuarantine}).Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Checked)
+	assert.Empty(t, report.Findings)
+}
+
+func TestStorageAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	db, err := database.New("sqlite", ":memory:")
+	require.NoError(t, err)
+	require.NoError(t, db.SaveRepository(ctx, &database.Repository{Name: "builds", Type: "local", ArtifactType: "generic"}))
+	require.NoError(t, db.SaveRepository(ctx, &database.Repository{Name: "mirror", Type: "local", ArtifactType: "generic"}))
+
+	cfg := &config.Config{}
+	cfg.Storage.Deduplicate = true
+	cfg.Storage.Encryption.Enabled = true
+	backend := storage.NewLocalStorage(t.TempDir())
+	oldKey, newKey := make([]byte, 32), make([]byte, 32)
+	newKey[0] = 1
+	router := func(keys ...[]byte) *gin.Engine {
+		keyring, err := storage.NewKeyring(keys...)
+		require.NoError(t, err)
+		pools := storage.Pools{
+			storage.DefaultPool: storage.NewPool(storage.DefaultPool, backend, "", storage.PoolLayers{Refs: db, Keys: keyring}),
+		}
+		scrubber := storage.NewScrubber(pools, db, storage.ScrubOptions{})
+		r := gin.New()
+		SetupRoutes(r, db, pools, repository.Quota{}, scrubber, allowAll{}, nil, &recordingPublisher{}, nil, cfg)
+		return r
+	}
+	r := router(oldKey)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	require.Equal(t, http.StatusCreated, do("PUT", "/builds/a.txt", "shared").Code)
+	require.Equal(t, http.StatusCreated, do("PUT", "/builds/b.txt", "shared").Code)
+	require.Equal(t, http.StatusCreated, do("PUT", "/mirror/a.txt", "shared").Code)
+
+	t.Run("Deduplication savings", func(t *testing.T) {
+		w := do("GET", "/api/v1/storage/dedup", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Enabled      bool                     `json:"enabled"`
+			Repositories []*database.DedupSavings `json:"repositories"`
+			Total        struct {
+				Paths     int64 `json:"paths"`
+				SavedSize int64 `json:"saved_size"`
+			} `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(t, response.Enabled)
+		assert.Equal(t, int64(3), response.Total.Paths)
+		assert.Equal(t, int64(2*len("shared")), response.Total.SavedSize)
+		require.Len(t, response.Repositories, 2)
+		assert.Equal(t, "builds", response.Repositories[0].Repository)
+		assert.Equal(t, int64(2), response.Repositories[0].Paths)
+		assert.Equal(t, "mirror", response.Repositories[1].Repository)
+		assert.Equal(t, int64(1), response.Repositories[1].Paths)
+	})
+
+	t.Run("Deleting keeps content other repositories share", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, do("DELETE", "/mirror/a.txt", "").Code)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/mirror/a.txt", "").Code)
+		assert.Equal(t, "shared", do("GET", "/builds/a.txt", "").Body.String())
+	})
+
+	t.Run("Encryption key rotation", func(t *testing.T) {
+		// Serve the same content with a new primary master key
+		r = router(newKey, oldKey)
+		w := do("POST", "/api/v1/storage/encryption/rotate", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"rewrapped":1}`, w.Body.String(), "both paths share one encrypted blob")
+
+		w = do("POST", "/api/v1/storage/encryption/rotate", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"rewrapped":0}`, w.Body.String())
+		assert.Equal(t, "shared", do("GET", "/builds/a.txt", "").Body.String())
+	})
+
+	t.Run("Storage scrub", func(t *testing.T) {
+		require.Equal(t, http.StatusAccepted, do("POST", "/api/v1/storage/scrub", "").Code)
+		var response struct {
+			Running bool                 `json:"running"`
+			Report  *storage.ScrubReport `json:"report"`
+		}
+		require.Eventually(t, func() bool {
+			w := do("GET", "/api/v1/storage/scrub", "")
+			require.Equal(t, http.StatusOK, w.Code)
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			return !response.Running && response.Report != nil
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 2, response.Report.Checked)
+		assert.Empty(t, response.Report.Findings)
+	})
+}
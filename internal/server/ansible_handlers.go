@@ -0,0 +1,488 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+)
+
+// Galaxy import task states
+const (
+	ansibleTaskWaiting   = "waiting"
+	ansibleTaskRunning   = "running"
+	ansibleTaskCompleted = "completed"
+	ansibleTaskFailed    = "failed"
+)
+
+// ansibleImportTTL bounds how long a finished import task can still be polled
+const ansibleImportTTL = time.Hour
+
+// ansibleImportMessage is a single log line of an import task
+type ansibleImportMessage struct {
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// ansibleImportError describes why an import task failed
+type ansibleImportError struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// ansibleImportTask tracks an asynchronous collection import per Galaxy v3
+type ansibleImportTask struct {
+	ID         string                 `json:"id"`
+	Repository string                 `json:"-"`
+	State      string                 `json:"state"`
+	CreatedAt  time.Time              `json:"created_at"`
+	StartedAt  *time.Time             `json:"started_at,omitempty"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+	Messages   []ansibleImportMessage `json:"messages"`
+	Error      *ansibleImportError    `json:"error,omitempty"`
+}
+
+// ansibleImportStore keeps import tasks in memory; the zero value is ready to use
+type ansibleImportStore struct {
+	mu    sync.RWMutex
+	tasks map[string]*ansibleImportTask
+}
+
+// create starts a task for a repository, dropping finished tasks that have expired
+func (st *ansibleImportStore) create(repository string) *ansibleImportTask {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	task := &ansibleImportTask{
+		ID:         hex.EncodeToString(buf),
+		Repository: repository,
+		State:      ansibleTaskWaiting,
+		CreatedAt:  time.Now().UTC(),
+		Messages:   []ansibleImportMessage{},
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.tasks == nil {
+		st.tasks = make(map[string]*ansibleImportTask)
+	}
+	for id, t := range st.tasks {
+		if t.expired() {
+			delete(st.tasks, id)
+		}
+	}
+	st.tasks[task.ID] = task
+	return task
+}
+
+// get returns a snapshot of an unexpired task of the repository
+func (st *ansibleImportStore) get(id, repository string) (ansibleImportTask, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	task, ok := st.tasks[id]
+	if !ok || task.Repository != repository || task.expired() {
+		return ansibleImportTask{}, false
+	}
+	snapshot := *task
+	snapshot.Messages = append([]ansibleImportMessage(nil), task.Messages...)
+	return snapshot, true
+}
+
+// expired reports whether the task finished longer than ansibleImportTTL ago
+func (t *ansibleImportTask) expired() bool {
+	return t.FinishedAt != nil && time.Since(*t.FinishedAt) > ansibleImportTTL
+}
+
+func (st *ansibleImportStore) update(id string, fn func(task *ansibleImportTask)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if task, ok := st.tasks[id]; ok {
+		fn(task)
+	}
+}
+
+func (st *ansibleImportStore) log(id, level, message string) {
+	st.update(id, func(task *ansibleImportTask) {
+		task.Messages = append(task.Messages, ansibleImportMessage{Level: level, Message: message, Time: time.Now().UTC()})
+	})
+}
+
+// ansibleCollectionVersion is a stored collection version resolved from the database
+type ansibleCollectionVersion struct {
+	record *database.ArtifactInfo
+	props  map[string]string
+}
+
+// ansibleAPIRoot serves Galaxy API discovery (GET /api/)
+func (s *Server) ansibleAPIRoot(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"description":     "GALAXY REST API",
+		"current_version": "v3",
+		"available_versions": gin.H{
+			"v3": "v3/",
+		},
+	})
+}
+
+// ansibleCollectionVersions returns stored versions of a collection, highest version first
+func (s *Server) ansibleCollectionVersions(ctx context.Context, repositoryName, namespace, name string) ([]ansibleCollectionVersion, error) {
+	records, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	var versions []ansibleCollectionVersion
+	for _, rec := range records {
+		if rec.Type != string(artifact.ArtifactTypeAnsible) || rec.Name != name {
+			continue
+		}
+		props := artifactProperties(rec)
+		if props["namespace"] != namespace {
+			continue
+		}
+		versions = append(versions, ansibleCollectionVersion{record: rec, props: props})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return types.CompareVersions(versions[i].record.Version, versions[j].record.Version) > 0
+	})
+	return versions, nil
+}
+
+// ansibleCollectionHref returns the repository-relative v3 href of a collection
+func ansibleCollectionHref(repositoryName, namespace, name string) string {
+	return fmt.Sprintf("/%s/api/v3/collections/%s/%s/", repositoryName, namespace, name)
+}
+
+// ansibleGetCollection serves GET /api/v3/collections/:namespace/:name/
+func (s *Server) ansibleGetCollection(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	namespace, name := c.Param("namespace"), c.Param("name")
+
+	versions, err := s.ansibleCollectionVersions(c.Request.Context(), repositoryName, namespace, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"errors": []gin.H{{"status": "404", "code": "not_found", "title": "Collection not found"}}})
+		return
+	}
+
+	href := ansibleCollectionHref(repositoryName, namespace, name)
+	highest := versions[0].record
+	created, updated := highest.CreatedAt, highest.UpdatedAt
+	for _, v := range versions {
+		if v.record.CreatedAt.Before(created) {
+			created = v.record.CreatedAt
+		}
+		if v.record.UpdatedAt.After(updated) {
+			updated = v.record.UpdatedAt
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"href":         href,
+		"namespace":    namespace,
+		"name":         name,
+		"deprecated":   false,
+		"versions_url": href + "versions/",
+		"highest_version": gin.H{
+			"href":    href + "versions/" + highest.Version + "/",
+			"version": highest.Version,
+		},
+		"created_at": created,
+		"updated_at": updated,
+	})
+}
+
+// ansibleListVersions serves the paginated GET /api/v3/collections/:namespace/:name/versions/
+func (s *Server) ansibleListVersions(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	namespace, name := c.Param("namespace"), c.Param("name")
+
+	versions, err := s.ansibleCollectionVersions(c.Request.Context(), repositoryName, namespace, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"errors": []gin.H{{"status": "404", "code": "not_found", "title": "Collection not found"}}})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 || offset > len(versions) {
+		offset = 0
+	}
+	end := offset + limit
+	if end > len(versions) {
+		end = len(versions)
+	}
+
+	href := ansibleCollectionHref(repositoryName, namespace, name)
+	pageLink := func(off int) string {
+		return fmt.Sprintf("%sversions/?limit=%d&offset=%d", href, limit, off)
+	}
+	links := gin.H{
+		"first":    pageLink(0),
+		"previous": nil,
+		"next":     nil,
+		"last":     pageLink(((len(versions) - 1) / limit) * limit),
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links["previous"] = pageLink(prev)
+	}
+	if end < len(versions) {
+		links["next"] = pageLink(end)
+	}
+
+	data := make([]gin.H, 0, end-offset)
+	for _, v := range versions[offset:end] {
+		data = append(data, gin.H{
+			"version":    v.record.Version,
+			"href":       href + "versions/" + v.record.Version + "/",
+			"created_at": v.record.CreatedAt,
+			"updated_at": v.record.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"meta":  gin.H{"count": len(versions)},
+		"links": links,
+		"data":  data,
+	})
+}
+
+// ansibleGetVersion serves GET /api/v3/collections/:namespace/:name/versions/:version/
+func (s *Server) ansibleGetVersion(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	namespace, name, version := c.Param("namespace"), c.Param("name"), c.Param("version")
+
+	versions, err := s.ansibleCollectionVersions(c.Request.Context(), repositoryName, namespace, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var found *ansibleCollectionVersion
+	for i := range versions {
+		if versions[i].record.Version == version {
+			found = &versions[i]
+			break
+		}
+	}
+	if found == nil {
+		c.JSON(http.StatusNotFound, gin.H{"errors": []gin.H{{"status": "404", "code": "not_found", "title": "Collection version not found"}}})
+		return
+	}
+
+	dependencies := map[string]string{}
+	if raw := found.props["dependencies"]; raw != "" {
+		_ = json.Unmarshal([]byte(raw), &dependencies)
+	}
+	signatures := []gin.H{}
+	if sig := found.props["signature"]; sig != "" {
+		signatures = append(signatures, gin.H{
+			"signature":          sig,
+			"pubkey_fingerprint": found.props["signature_fingerprint"],
+			"signing_service":    nil,
+		})
+	}
+
+	filename := found.props["filename"]
+	if filename == "" {
+		filename = fmt.Sprintf("%s-%s-%s.tar.gz", namespace, name, version)
+	}
+	href := ansibleCollectionHref(repositoryName, namespace, name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"href":         href + "versions/" + version + "/",
+		"namespace":    gin.H{"name": namespace},
+		"collection":   gin.H{"name": name, "href": href},
+		"version":      version,
+		"download_url": fmt.Sprintf("%s/%s/download/%s", requestBaseURL(c), repositoryName, filename),
+		"artifact": gin.H{
+			"filename": filename,
+			"sha256":   found.record.Checksum,
+			"size":     found.record.Size,
+		},
+		"metadata": gin.H{
+			"dependencies": dependencies,
+			"description":  found.props["description"],
+		},
+		"signatures": signatures,
+		"created_at": found.record.CreatedAt,
+		"updated_at": found.record.UpdatedAt,
+	})
+}
+
+// ansiblePublishCollection accepts POST /api/v3/artifacts/collections/ and schedules an import task
+func (s *Server) ansiblePublishCollection(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"status": "400", "code": "invalid", "title": "file is required"}}})
+		return
+	}
+	defer file.Close()
+
+	// Spool the upload to disk so the import can run after the request returns
+	tmp, err := os.CreateTemp("", "ganje-ansible-*.tar.gz")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), file); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tmp.Close()
+
+	digest := hex.EncodeToString(hasher.Sum(nil))
+	if expected := strings.TrimSpace(c.PostForm("sha256")); expected != "" && !strings.EqualFold(expected, digest) {
+		os.Remove(tmp.Name())
+		c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"status": "400", "code": "invalid", "title": "sha256 checksum mismatch"}}})
+		return
+	}
+
+	task := s.ansibleImports.create(repositoryName)
+	signature := c.PostForm("signature")
+
+	go s.runAnsibleImport(task.ID, repo.GetName(), tmp.Name(), signature)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"task": fmt.Sprintf("%s/%s/api/v3/imports/collections/%s/", requestBaseURL(c), repositoryName, task.ID),
+	})
+}
+
+// runAnsibleImport validates the spooled tarball and stores it in the repository
+func (s *Server) runAnsibleImport(taskID, repositoryName, tmpPath, signature string) {
+	defer os.Remove(tmpPath)
+	ctx := context.Background()
+
+	started := time.Now().UTC()
+	s.ansibleImports.update(taskID, func(task *ansibleImportTask) {
+		task.State = ansibleTaskRunning
+		task.StartedAt = &started
+	})
+
+	fail := func(code string, err error) {
+		finished := time.Now().UTC()
+		s.ansibleImports.log(taskID, "ERROR", err.Error())
+		s.ansibleImports.update(taskID, func(task *ansibleImportTask) {
+			task.State = ansibleTaskFailed
+			task.FinishedAt = &finished
+			task.Error = &ansibleImportError{Code: code, Description: err.Error()}
+		})
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		fail("internal_error", err)
+		return
+	}
+	defer f.Close()
+
+	manifest, err := types.ReadCollectionManifest(f)
+	if err != nil {
+		fail("invalid_collection", err)
+		return
+	}
+	info := manifest.CollectionInfo
+	s.ansibleImports.log(taskID, "INFO", fmt.Sprintf("Importing collection %s.%s %s", info.Namespace, info.Name, info.Version))
+
+	existing, err := s.ansibleCollectionVersions(ctx, repositoryName, info.Namespace, info.Name)
+	if err == nil {
+		for _, v := range existing {
+			if v.record.Version == info.Version {
+				fail("conflict", fmt.Errorf("collection %s.%s version %s already exists", info.Namespace, info.Name, info.Version))
+				return
+			}
+		}
+	}
+
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		fail("not_found", err)
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		fail("internal_error", err)
+		return
+	}
+
+	props := manifest.Metadata()
+	if signature != "" {
+		props["signature"] = signature
+	}
+	storagePath := "download/" + manifest.Filename()
+	if err := repo.Push(ctx, storagePath, f, &artifact.Metadata{
+		Name:       info.Name,
+		Version:    info.Version,
+		Group:      info.Namespace,
+		Properties: props,
+	}); err != nil {
+		fail("push_failed", err)
+		return
+	}
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       info.Name,
+			Version:    info.Version,
+			Group:      info.Namespace,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	finished := time.Now().UTC()
+	s.ansibleImports.log(taskID, "INFO", "Collection imported successfully")
+	s.ansibleImports.update(taskID, func(task *ansibleImportTask) {
+		task.State = ansibleTaskCompleted
+		task.FinishedAt = &finished
+	})
+}
+
+// ansibleGetImportTask serves GET /api/v3/imports/collections/:id/
+func (s *Server) ansibleGetImportTask(c *gin.Context) {
+	task, ok := s.ansibleImports.get(c.Param("id"), repositoryNameFromPath(c))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"errors": []gin.H{{"status": "404", "code": "not_found", "title": "Import task not found"}}})
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
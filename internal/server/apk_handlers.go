@@ -0,0 +1,210 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// apkFile serves GET /:branch/:repo/:arch/:file: the APKINDEX.tar.gz of the directory or a package.
+// Packages built for noarch are served from every architecture directory.
+func (s *Server) apkFile(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	branch, section, arch, file := c.Param("branch"), c.Param("repo"), c.Param("arch"), c.Param("file")
+	if file == types.APKIndexFile {
+		index, err := repo.GetIndex(c.Request.Context(), types.APKIndexPath(branch+"/"+section+"/"+arch))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		defer index.Close()
+		c.Header("Content-Type", "application/gzip")
+		storage.ServeContent(c.Writer, c.Request, index, 0, "", time.Time{})
+		return
+	}
+
+	storagePath := types.APKPackagePath(branch, section, arch, file)
+	if _, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err != nil {
+		storagePath = types.APKPackagePath(branch, section, "noarch", file)
+	}
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", inferContentType(artifact.ArtifactTypeAPK, storagePath))
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// apkUpload accepts POST /api/packages/:branch/:repo with an .apk as the raw body or a multipart "file"
+func (s *Server) apkUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	branch, section := c.Param("branch"), c.Param("repo")
+	if !types.ValidAPKPathSegment(branch) || !types.ValidAPKPathSegment(section) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch or repo"})
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	tmp, err := os.CreateTemp("", "ganje-apk-*.apk")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	pkg, err := types.ReadAPKPackage(tmp)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	storagePath := types.APKPackagePath(branch, section, pkg.Arch, pkg.Filename())
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is already published", storagePath)})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	props := pkg.Metadata()
+	props["branch"] = branch
+	props["repo"] = section
+	props["size"] = strconv.FormatInt(size, 10)
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+		Description: pkg.Description,
+		Size:        size,
+		Properties:  props,
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	// A failed rebuild stays pending and is retried by the next push, delete or reindex
+	_ = repo.RebuildIndex(c.Request.Context())
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"name":     pkg.Name,
+		"version":  pkg.Version,
+		"arch":     pkg.Arch,
+		"branch":   branch,
+		"repo":     section,
+		"location": storagePath,
+	})
+}
+
+// apkDelete removes a package and regenerates the index that listed it
+func (s *Server) apkDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := types.APKPackagePath(c.Param("branch"), c.Param("repo"), c.Param("arch"), c.Param("file"))
+	if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+	_ = repo.RebuildIndex(c.Request.Context())
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Artifact deleted successfully"})
+}
+
+// apkPublicKey serves GET /keys/:name, the public key to install under /etc/apk/keys
+func (s *Server) apkPublicKey(c *gin.Context) {
+	key, err := repository.LoadAPKSigningKey(c.Request.Context(), s.db, repositoryNameFromPath(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if key == nil || key.Name != c.Param("name") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		return
+	}
+	pub, err := key.PublicKeyPEM()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/x-pem-file", pub)
+}
@@ -1,15 +1,42 @@
 package server
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
 	"github.com/hbahadorzadeh/ganje/internal/auth"
 	"github.com/hbahadorzadeh/ganje/internal/database"
 	"github.com/hbahadorzadeh/ganje/internal/repository"
@@ -90,6 +117,45 @@ func TestMavenArtifactHandlers(t *testing.T) {
 		mockRepo.AssertExpectations(t)
 	})
 	
+	t.Run("Resume Maven download", func(t *testing.T) {
+		path := "/maven-repo/com/example/installer/2.0/installer-2.0.tar.gz"
+		content := "installer image content"
+		updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+		mockRepo.On("Pull", mock.Anything, "com/example/installer/2.0/installer-2.0.tar.gz").Return(
+			io.NopCloser(strings.NewReader(content)),
+			&artifact.Metadata{Name: "installer", Size: int64(len(content)), Checksum: "abc123", UpdatedAt: updated},
+			nil,
+		).Once()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		req.Header.Set("Range", "bytes=10-")
+		req.Header.Set("If-Range", `"abc123"`)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, content[10:], w.Body.String())
+		assert.Equal(t, fmt.Sprintf("bytes 10-%d/%d", len(content)-1, len(content)), w.Header().Get("Content-Range"))
+		assert.Equal(t, `"abc123"`, w.Header().Get("ETag"))
+		assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+		assert.Equal(t, "Wed, 01 May 2024 12:00:00 GMT", w.Header().Get("Last-Modified"))
+
+		mockRepo.On("Pull", mock.Anything, "com/example/installer/2.0/installer-2.0.tar.gz").Return(
+			io.NopCloser(strings.NewReader(content)),
+			&artifact.Metadata{Name: "installer", Size: int64(len(content)), Checksum: "abc123", UpdatedAt: updated},
+			nil,
+		).Once()
+		req = httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		req.Header.Set("If-None-Match", `"abc123"`)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
 	t.Run("Get Maven Metadata", func(t *testing.T) {
 		path := "/maven-repo/com/example/myapp/maven-metadata.xml"
 		metadata := `<?xml version="1.0" encoding="UTF-8"?>
@@ -662,3 +728,1818 @@ func TestArtifactPermissions(t *testing.T) {
 		mockAuthService.AssertExpectations(t)
 	})
 }
+
+func TestAnsibleGalaxyV3Handlers(t *testing.T) {
+	server, mockDB, mockRepoManager, mockAuthService := createTestServer()
+
+	mockAuthService.On("ValidateToken", "Bearer valid-token").Return(&auth.Claims{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Realms:   []string{"admin"},
+	}, nil)
+	mockAuthService.On("CheckPermission", mock.AnythingOfType("*auth.Claims"), "galaxy", mock.Anything).Return(true)
+
+	mockRepo := &MockRepository{name: "galaxy", repoType: "local", artifactType: "ansible"}
+	mockRepo.On("GetName").Return("galaxy")
+	mockRepo.On("GetType").Return(repository.Local)
+	mockRepo.On("GetArtifactType").Return(artifact.ArtifactTypeAnsible)
+	mockRepoManager.On("GetRepository", "galaxy").Return(mockRepo, nil)
+
+	server.RegisterRepositoryRoutes(&database.Repository{Name: "galaxy", Type: "local", ArtifactType: "ansible"})
+
+	t.Run("API discovery", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/galaxy/api/", nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"v3":"v3/"`)
+	})
+
+	t.Run("Publish creates import task", func(t *testing.T) {
+		manifest := `{"collection_info":{"namespace":"acme","name":"tools","version":"1.0.0","dependencies":{}},"format":1}`
+		var archive bytes.Buffer
+		gz := gzip.NewWriter(&archive)
+		tw := tar.NewWriter(gz)
+		_ = tw.WriteHeader(&tar.Header{Name: "MANIFEST.json", Mode: 0644, Size: int64(len(manifest))})
+		_, _ = tw.Write([]byte(manifest))
+		_ = tw.Close()
+		_ = gz.Close()
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "acme-tools-1.0.0.tar.gz")
+		_, _ = fw.Write(archive.Bytes())
+		_ = mw.Close()
+
+		pushed := make(chan struct{})
+		mockDB.On("GetArtifactsByRepository", mock.Anything, "galaxy").Return([]*database.ArtifactInfo{}, nil).Once()
+		mockRepo.On("Push", mock.Anything, "download/acme-tools-1.0.0.tar.gz", mock.Anything, mock.AnythingOfType("*artifact.Metadata")).
+			Run(func(args mock.Arguments) { close(pushed) }).Return(nil)
+
+		req := httptest.NewRequest("POST", "/galaxy/api/v3/artifacts/collections/", &body)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		var resp map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Contains(t, resp["task"], "/galaxy/api/v3/imports/collections/")
+
+		select {
+		case <-pushed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("collection import did not push artifact")
+		}
+		taskURL := strings.TrimPrefix(resp["task"], "http://example.com")
+		assert.Eventually(t, func() bool {
+			req := httptest.NewRequest("GET", taskURL, nil)
+			req.Header.Set("Authorization", "Bearer valid-token")
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+			return w.Code == http.StatusOK && strings.Contains(w.Body.String(), `"state":"completed"`)
+		}, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Version detail", func(t *testing.T) {
+		mockDB.On("GetArtifactsByRepository", mock.Anything, "galaxy").Return([]*database.ArtifactInfo{
+			{Type: "ansible", Name: "tools", Version: "1.0.0", Checksum: "abc", Size: 10,
+				Metadata: `{"namespace":"acme","filename":"acme-tools-1.0.0.tar.gz","dependencies":"{\"community.general\":\">=5.0.0\"}"}`},
+			{Type: "ansible", Name: "tools", Version: "1.10.0", Checksum: "def", Size: 12,
+				Metadata: `{"namespace":"acme","filename":"acme-tools-1.10.0.tar.gz"}`},
+		}, nil)
+
+		req := httptest.NewRequest("GET", "/galaxy/api/v3/collections/acme/tools/versions/1.0.0/", nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"download_url":"http://example.com/galaxy/download/acme-tools-1.0.0.tar.gz"`)
+		assert.Contains(t, w.Body.String(), `"sha256":"abc"`)
+		assert.Contains(t, w.Body.String(), `"dependencies":{"community.general":`)
+		assert.Contains(t, w.Body.String(), `"signatures":[]`)
+
+		req = httptest.NewRequest("GET", "/galaxy/api/v3/collections/acme/tools/versions/", nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"count":2`)
+		assert.Less(t, strings.Index(w.Body.String(), `"version":"1.10.0"`), strings.Index(w.Body.String(), `"version":"1.0.0"`))
+	})
+}
+
+func TestAnsibleImportStore(t *testing.T) {
+	var store ansibleImportStore
+	task := store.create("galaxy")
+
+	_, ok := store.get(task.ID, "galaxy")
+	assert.True(t, ok)
+	_, ok = store.get(task.ID, "other")
+	assert.False(t, ok, "tasks are only visible in their repository")
+
+	store.update(task.ID, func(task *ansibleImportTask) {
+		finished := time.Now().Add(-ansibleImportTTL - time.Minute)
+		task.State = ansibleTaskCompleted
+		task.FinishedAt = &finished
+	})
+	_, ok = store.get(task.ID, "galaxy")
+	assert.False(t, ok, "expired tasks are not returned")
+
+	running := store.create("galaxy")
+	assert.NotContains(t, store.tasks, task.ID, "expired tasks are dropped")
+	assert.Contains(t, store.tasks, running.ID)
+}
+
+func TestBazelCacheHandlers(t *testing.T) {
+	server, mockDB, mockRepoManager, mockAuthService := createTestServer()
+
+	mockAuthService.On("ValidateToken", "Bearer valid-token").Return(&auth.Claims{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Realms:   []string{"admin"},
+	}, nil)
+	mockAuthService.On("CheckPermission", mock.AnythingOfType("*auth.Claims"), "bazel-cache", mock.Anything).Return(true)
+	mockDB.On("LogAccess", mock.Anything, mock.Anything).Return(nil)
+
+	mockRepo := &MockRepository{name: "bazel-cache", repoType: "local", artifactType: "bazel"}
+	mockRepo.On("GetName").Return("bazel-cache")
+	mockRepo.On("GetType").Return(repository.Local)
+	mockRepo.On("GetArtifactType").Return(artifact.ArtifactTypeBazel)
+	mockRepoManager.On("GetRepository", "bazel-cache").Return(mockRepo, nil)
+
+	server.RegisterRepositoryRoutes(&database.Repository{Name: "bazel-cache", Type: "local", ArtifactType: "bazel"})
+
+	blob := []byte("hello bazel")
+	sum := sha256.Sum256(blob)
+	blobHash := hex.EncodeToString(sum[:])
+
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer valid-token")
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("CAS upload with mismatching digest is rejected", func(t *testing.T) {
+		w := do("PUT", "/bazel-cache/cas/"+strings.Repeat("a", 64), blob)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "digest mismatch")
+		mockRepo.AssertNotCalled(t, "Push", mock.Anything, "cas/"+strings.Repeat("a", 64), mock.Anything, mock.Anything)
+	})
+
+	t.Run("CAS upload with matching digest is stored", func(t *testing.T) {
+		mockRepo.On("Push", mock.Anything, "cas/"+blobHash, mock.Anything, mock.AnythingOfType("*artifact.Metadata")).Return(nil).Once()
+		w := do("PUT", "/bazel-cache/cas/"+blobHash, blob)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("AC upload must be an ActionResult", func(t *testing.T) {
+		w := do("PUT", "/bazel-cache/ac/"+strings.Repeat("b", 64), []byte{0xff, 0xff, 0xff})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid ActionResult")
+	})
+
+	t.Run("AC upload referencing missing outputs is refused when required", func(t *testing.T) {
+		result, _ := proto.Marshal(&repb.ActionResult{
+			OutputFiles: []*repb.OutputFile{{Path: "out/lib.a", Digest: &repb.Digest{Hash: blobHash, SizeBytes: int64(len(blob))}}},
+		})
+		mockDB.On("GetRepository", mock.Anything, "bazel-cache").Return(&database.Repository{Name: "bazel-cache", Config: `{"bazel_ac_require_outputs":"true"}`}, nil)
+		mockDB.On("GetArtifactsByPaths", mock.Anything, "bazel-cache", []string{"cas/" + blobHash}).Return([]*database.ArtifactInfo{}, nil).Once()
+
+		w := do("PUT", "/bazel-cache/ac/"+strings.Repeat("c", 64), result)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "missing from the CAS")
+
+		mockDB.On("GetArtifactsByPaths", mock.Anything, "bazel-cache", []string{"cas/" + blobHash}).Return([]*database.ArtifactInfo{{Path: "cas/" + blobHash, Size: int64(len(blob))}}, nil).Once()
+		mockRepo.On("Push", mock.Anything, "ac/"+strings.Repeat("c", 64), mock.Anything, mock.AnythingOfType("*artifact.Metadata")).Return(nil).Once()
+		w = do("PUT", "/bazel-cache/ac/"+strings.Repeat("c", 64), result)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("HEAD reports existence", func(t *testing.T) {
+		mockDB.On("GetArtifactByPath", mock.Anything, "bazel-cache", "cas/"+blobHash).Return(&database.ArtifactInfo{Size: int64(len(blob))}, nil).Once()
+		w := do("HEAD", "/bazel-cache/cas/"+blobHash, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "11", w.Header().Get("Content-Length"))
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "bazel-cache", "ac/"+strings.Repeat("d", 64)).Return(nil, assert.AnError).Once()
+		w = do("HEAD", "/bazel-cache/ac/"+strings.Repeat("d", 64), nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("The empty blob is always present", func(t *testing.T) {
+		w := do("HEAD", "/bazel-cache/cas/"+bazelEmptySHA256, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0", w.Header().Get("Content-Length"))
+
+		w = do("GET", "/bazel-cache/cas/"+bazelEmptySHA256, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Body.Bytes())
+		mockRepo.AssertNotCalled(t, "Pull", mock.Anything, "cas/"+bazelEmptySHA256)
+	})
+}
+
+// typedRepoTestServer is a test server with one local repository of an artifact type, open
+// to the admin that presents "Bearer valid-token"
+type typedRepoTestServer struct {
+	server      *Server
+	db          *MockDB
+	repoManager *MockRepositoryManager
+	authService *MockAuthService
+	repo        *MockRepository
+	claims      *auth.Claims
+}
+
+func newTypedRepoTestServer(t *testing.T, name string, artifactType artifact.ArtifactType) *typedRepoTestServer {
+	t.Helper()
+	server, mockDB, mockRepoManager, mockAuthService := createTestServer()
+
+	claims := &auth.Claims{Username: "testuser", Email: "test@example.com", Realms: []string{"admin"}}
+	mockAuthService.On("ValidateToken", "Bearer valid-token").Return(claims, nil)
+	mockAuthService.On("CheckPermission", claims, mock.Anything, mock.Anything).Return(true)
+	mockDB.On("LogAccess", mock.Anything, mock.Anything).Return(nil)
+
+	mockRepo := &MockRepository{name: name, repoType: "local", artifactType: string(artifactType)}
+	mockRepo.On("GetName").Return(name)
+	mockRepo.On("GetType").Return(repository.Local)
+	mockRepo.On("GetArtifactType").Return(artifactType)
+	mockRepoManager.On("GetRepository", name).Return(mockRepo, nil)
+	server.RegisterRepositoryRoutes(&database.Repository{Name: name, Type: "local", ArtifactType: string(artifactType)})
+
+	return &typedRepoTestServer{
+		server:      server,
+		db:          mockDB,
+		repoManager: mockRepoManager,
+		authService: mockAuthService,
+		repo:        mockRepo,
+		claims:      claims,
+	}
+}
+
+// serve sends a request through the router
+func (s *typedRepoTestServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.server.router.ServeHTTP(w, req)
+	return w
+}
+
+// do sends a request as the admin; headers are name and value pairs that may replace the
+// Authorization header
+func (s *typedRepoTestServer) do(method, target string, body []byte, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer valid-token")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return s.serve(req)
+}
+
+func TestDebianAPTHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "apt", artifact.ArtifactTypeDebian)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.do
+
+	entity, err := openpgp.NewEntity("Ganje APT", "", "apt@example.com", nil)
+	assert.NoError(t, err)
+	var privateKey bytes.Buffer
+	aw, _ := armor.Encode(&privateKey, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, entity.SerializePrivate(aw, nil))
+	_ = aw.Close()
+	repoConfig, _ := json.Marshal(map[string]string{"gpg_signing_key": privateKey.String()})
+	mockDB.On("GetRepository", mock.Anything, "apt").Return(&database.Repository{Name: "apt", Config: string(repoConfig)}, nil)
+
+	control := "Package: hello\nVersion: 2.10-3\nArchitecture: amd64\nMaintainer: Dev <dev@example.com>\nDescription: greeting tool\n"
+	deb := buildDebPackage(t, control)
+
+	t.Run("Upload stores package in the pool", func(t *testing.T) {
+		poolPath := "pool/main/h/hello/hello_2.10-3_amd64.deb"
+		mockDB.On("GetArtifactByPath", mock.Anything, "apt", poolPath).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, poolPath, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "hello" && m.Properties["distribution"] == "stable" && m.Properties["component"] == "main" &&
+				m.Properties["sha256"] != "" && m.Properties["size"] == fmt.Sprint(len(deb))
+		})).Return(nil).Once()
+
+		w := do("POST", "/apt/api/packages/stable/main", deb)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"filename":"`+poolPath+`"`)
+
+		w = do("POST", "/apt/api/packages/stable/main", []byte("not a deb"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Upload rejects source names outside the pool", func(t *testing.T) {
+		hostile := buildDebPackage(t, "Package: foo\nSource: ../../../../tmp/x\nVersion: 1.0\nArchitecture: all\nDescription: x\n")
+		w := do("POST", "/apt/api/packages/stable/main", hostile)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockRepo.AssertNumberOfCalls(t, "Push", 1)
+	})
+
+	sum := sha256.Sum256(deb)
+	t.Run("Upload publishes a pooled file to another distribution", func(t *testing.T) {
+		poolPath := "pool/main/h/hello/hello_2.10-3_amd64.deb"
+		published := &database.ArtifactInfo{ID: 7, Name: "hello", Version: "2.10-3", Path: poolPath, Metadata: mustJSON(t, map[string]string{
+			"distribution": "stable", "distributions": "stable", "component": "main", "architecture": "amd64", "sha256": hex.EncodeToString(sum[:]),
+		})}
+		mockDB.On("GetArtifactByPath", mock.Anything, "apt", poolPath).Return(published, nil).Times(3)
+		mockDB.On("UpdateArtifactMetadata", mock.Anything, uint(7), mock.MatchedBy(func(metadata string) bool {
+			return strings.Contains(metadata, `"distributions":"stable,testing"`)
+		})).Return(nil).Once()
+
+		w := do("POST", "/apt/api/packages/testing/main", deb)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"distribution":"testing"`)
+
+		assert.Equal(t, http.StatusConflict, do("POST", "/apt/api/packages/stable/main", deb).Code, "the package is already in stable")
+		rebuilt := buildDebPackage(t, control+"Homepage: https://example.com\n")
+		assert.Equal(t, http.StatusConflict, do("POST", "/apt/api/packages/unstable/main", rebuilt).Code, "a pool file never changes content")
+		mockRepo.AssertNumberOfCalls(t, "Push", 1)
+	})
+
+	mockDB.On("GetArtifactsByRepository", mock.Anything, "apt").Return([]*database.ArtifactInfo{
+		{Type: "debian", Name: "hello", Version: "2.10-3", Path: "pool/main/h/hello/hello_2.10-3_amd64.deb",
+			CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			Metadata: mustJSON(t, map[string]string{
+				"distribution": "stable", "distributions": "stable,testing", "component": "main", "architecture": "amd64", "control": control,
+				"filename": "pool/main/h/hello/hello_2.10-3_amd64.deb", "size": fmt.Sprint(len(deb)), "sha256": hex.EncodeToString(sum[:]),
+			})},
+		{Type: "debian", Name: "hello-doc", Version: "2.10-3", Path: "pool/main/h/hello/hello-doc_2.10-3_all.deb",
+			Metadata: mustJSON(t, map[string]string{
+				"distribution": "stable", "component": "main", "architecture": "all",
+				"control":  "Package: hello-doc\nVersion: 2.10-3\nArchitecture: all\nDescription: docs\n",
+				"filename": "pool/main/h/hello/hello-doc_2.10-3_all.deb", "size": "10", "sha256": "abc",
+			})},
+	}, nil)
+
+	t.Run("Packages lists architecture and all packages", func(t *testing.T) {
+		w := do("GET", "/apt/dists/stable/main/binary-amd64/Packages", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Package: hello\n")
+		assert.Contains(t, w.Body.String(), "Package: hello-doc\n")
+		assert.Contains(t, w.Body.String(), "Filename: pool/main/h/hello/hello_2.10-3_amd64.deb\n")
+
+		w = do("GET", "/apt/dists/stable/main/binary-amd64/Packages.gz", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		gz, err := gzip.NewReader(w.Body)
+		assert.NoError(t, err)
+		unzipped, _ := io.ReadAll(gz)
+		assert.Contains(t, string(unzipped), "Package: hello\n")
+
+		w = do("GET", "/apt/dists/testing/main/binary-amd64/Packages", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Package: hello\n")
+		assert.NotContains(t, w.Body.String(), "Package: hello-doc\n")
+	})
+
+	t.Run("Release and signed InRelease", func(t *testing.T) {
+		w := do("GET", "/apt/dists/stable/Release", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		release := w.Body.String()
+		assert.Contains(t, release, "Suite: stable\n")
+		assert.Contains(t, release, "Architectures: amd64\n")
+		assert.Contains(t, release, "Components: main\n")
+		assert.Contains(t, release, "Date: Wed, 01 May 2024 12:00:00 UTC\n")
+
+		packages := do("GET", "/apt/dists/stable/main/binary-amd64/Packages", nil).Body.Bytes()
+		packagesSum := sha256.Sum256(packages)
+		assert.Contains(t, release, fmt.Sprintf(" %s %d main/binary-amd64/Packages\n", hex.EncodeToString(packagesSum[:]), len(packages)))
+
+		w = do("GET", "/apt/dists/stable/InRelease", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		block, _ := clearsign.Decode(w.Body.Bytes())
+		if assert.NotNil(t, block) {
+			assert.Equal(t, release, string(block.Plaintext))
+			_, err := block.VerifySignature(openpgp.EntityList{entity}, nil)
+			assert.NoError(t, err)
+		}
+
+		w = do("GET", "/apt/dists/stable/Release.gpg", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, strings.NewReader(release), w.Body, nil)
+		assert.NoError(t, err)
+
+		w = do("GET", "/apt/public.key", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "BEGIN PGP PUBLIC KEY BLOCK")
+
+		w = do("GET", "/apt/dists/unknown/Release", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+// buildDebPackage assembles a minimal .deb around the given control file
+func buildDebPackage(t *testing.T, control string) []byte {
+	t.Helper()
+	tarGz := func(name, content string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		_, _ = tw.Write([]byte(content))
+		_ = tw.Close()
+		_ = gz.Close()
+		return buf.Bytes()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	members := []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", tarGz("./control", control)},
+		{"data.tar.gz", tarGz("./usr/bin/hello", "#!/bin/sh\n")},
+	}
+	for _, m := range members {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", m.name, 0, 0, 0, "100644", len(m.data))
+		buf.Write(m.data)
+		if len(m.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRPMRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "yum", artifact.ArtifactTypeRPM)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.do
+
+	entity, err := openpgp.NewEntity("Ganje YUM", "", "yum@example.com", nil)
+	assert.NoError(t, err)
+	var privateKey bytes.Buffer
+	aw, _ := armor.Encode(&privateKey, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, entity.SerializePrivate(aw, nil))
+	_ = aw.Close()
+	repoConfig, _ := json.Marshal(map[string]string{"gpg_signing_key": privateKey.String()})
+	mockDB.On("GetRepository", mock.Anything, "yum").Return(&database.Repository{Name: "yum", Config: string(repoConfig)}, nil)
+
+	rpm := buildRPMPackage(t, "hello", "2.10", "3", "x86_64")
+
+	var pushed *artifact.Metadata
+	t.Run("Upload reads the RPM header", func(t *testing.T) {
+		location := "Packages/hello-2.10-3.x86_64.rpm"
+		mockDB.On("GetArtifactByPath", mock.Anything, "yum", location).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "hello" && m.Version == "2.10-3" && m.Properties["arch"] == "x86_64"
+		})).Run(func(args mock.Arguments) { pushed = args.Get(3).(*artifact.Metadata) }).Return(nil).Once()
+
+		w := do("POST", "/yum/api/packages", rpm)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"location":"`+location+`"`)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "yum", location).Return(&database.ArtifactInfo{Path: location}, nil).Once()
+		w = do("POST", "/yum/api/packages", rpm)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = do("POST", "/yum/api/packages", []byte("not an rpm"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	if pushed == nil {
+		t.FailNow()
+	}
+
+	mockDB.On("GetArtifactsByRepository", mock.Anything, "yum").Return([]*database.ArtifactInfo{
+		{ID: 1, Type: "rpm", Name: "hello", Version: "2.10-3", Path: "Packages/hello-2.10-3.x86_64.rpm",
+			Size: int64(len(rpm)), Checksum: pushed.Checksum, CreatedAt: time.Unix(1714564800, 0),
+			Metadata: mustJSON(t, pushed.Properties)},
+	}, nil)
+
+	t.Run("repomd.xml lists generated metadata", func(t *testing.T) {
+		w := do("GET", "/yum/repodata/repomd.xml", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		repomd := w.Body.String()
+		assert.Contains(t, repomd, "<revision>1714564800</revision>")
+
+		for _, typ := range []string{"primary", "filelists", "other"} {
+			start := strings.Index(repomd, `<location href="repodata/`)
+			if !assert.GreaterOrEqual(t, start, 0) {
+				return
+			}
+			href := repomd[start+len(`<location href="`):]
+			href = href[:strings.Index(href, `"`)]
+			repomd = repomd[start+1:]
+			assert.True(t, strings.HasSuffix(href, "-"+typ+".xml.gz"), href)
+
+			w := do("GET", "/yum/"+href, nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+			gz, err := gzip.NewReader(w.Body)
+			assert.NoError(t, err)
+			content, _ := io.ReadAll(gz)
+			assert.Contains(t, string(content), `<version epoch="0" ver="2.10" rel="3"/>`)
+			if typ == "primary" {
+				sum := sha256.Sum256(rpm)
+				assert.Contains(t, string(content), `<checksum type="sha256" pkgid="YES">`+hex.EncodeToString(sum[:])+`</checksum>`)
+				assert.Contains(t, string(content), `<location href="Packages/hello-2.10-3.x86_64.rpm"/>`)
+				assert.Contains(t, string(content), `<rpm:entry name="bash"/>`)
+			}
+		}
+
+		assert.Equal(t, http.StatusNotFound, do("GET", "/yum/repodata/deadbeef-primary.xml.gz", nil).Code)
+	})
+
+	t.Run("repomd.xml.asc signs repomd.xml", func(t *testing.T) {
+		repomd := do("GET", "/yum/repodata/repomd.xml", nil).Body.String()
+		w := do("GET", "/yum/repodata/repomd.xml.asc", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, strings.NewReader(repomd), w.Body, nil)
+		assert.NoError(t, err)
+
+		w = do("GET", "/yum/public.key", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "BEGIN PGP PUBLIC KEY BLOCK")
+	})
+}
+
+// buildRPMPackage assembles a minimal binary RPM requiring bash
+func buildRPMPackage(t *testing.T, name, version, release, arch string) []byte {
+	t.Helper()
+	header := func(tags [][2]interface{}) []byte {
+		var index, store bytes.Buffer
+		for _, tag := range tags {
+			values := tag[1].([]string)
+			typ := uint32(8)
+			if len(values) == 1 {
+				typ = 6
+			}
+			_ = binary.Write(&index, binary.BigEndian, []uint32{uint32(tag[0].(int)), typ, uint32(store.Len()), uint32(len(values))})
+			for _, v := range values {
+				store.WriteString(v + "\x00")
+			}
+		}
+		var buf bytes.Buffer
+		buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+		_ = binary.Write(&buf, binary.BigEndian, []uint32{uint32(len(tags)), uint32(store.Len())})
+		buf.Write(index.Bytes())
+		buf.Write(store.Bytes())
+		return buf.Bytes()
+	}
+
+	var buf bytes.Buffer
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	buf.Write(lead)
+	buf.Write(header(nil))
+	buf.Write(header([][2]interface{}{
+		{1000, []string{name}},
+		{1001, []string{version}},
+		{1002, []string{release}},
+		{1004, []string{"test package"}},
+		{1022, []string{arch}},
+		{1044, []string{name + "-" + version + "-" + release + ".src.rpm"}},
+		{1049, []string{"bash", "rpmlib(PayloadIsXz)"}},
+	}))
+	buf.WriteString("payload")
+	return buf.Bytes()
+}
+
+func TestAPKRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "alpine", artifact.ArtifactTypeAPK)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.do
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	repoConfig, _ := json.Marshal(map[string]string{"apk_signing_key": string(keyPEM), "apk_key_name": "ganje-1.rsa.pub"})
+	mockDB.On("GetRepository", mock.Anything, "alpine").Return(&database.Repository{Name: "alpine", Config: string(repoConfig)}, nil)
+
+	t.Run("Upload stores the package and rebuilds the index", func(t *testing.T) {
+		apk := buildAPKPackage(t, "pkgname = hello\npkgver = 2.10-r3\narch = x86_64\n")
+		location := "v3.19/main/x86_64/hello-2.10-r3.apk"
+		mockDB.On("GetArtifactByPath", mock.Anything, "alpine", location).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "hello" && m.Properties["branch"] == "v3.19" && m.Properties["repo"] == "main" &&
+				strings.HasPrefix(m.Properties["apk_checksum"], "Q1") && m.Properties["size"] == fmt.Sprint(len(apk))
+		})).Return(nil).Once()
+		mockRepo.On("RebuildIndex", mock.Anything).Return(nil).Once()
+
+		w := do("POST", "/alpine/api/packages/v3.19/main", apk)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"location":"`+location+`"`)
+
+		w = do("POST", "/alpine/api/packages/v3.19/main", []byte("not an apk"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = do("POST", "/alpine/api/packages/-v3.19/main", apk)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Index and noarch packages are served per architecture", func(t *testing.T) {
+		mockRepo.On("GetIndex", mock.Anything, "v3.19/main/x86_64/APKINDEX.tar.gz").Return(io.NopCloser(strings.NewReader("index")), nil).Once()
+		w := do("GET", "/alpine/v3.19/main/x86_64/APKINDEX.tar.gz", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "index", w.Body.String())
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "alpine", "v3.19/main/x86_64/docs-1.0-r0.apk").Return(nil, assert.AnError).Once()
+		mockRepo.On("Pull", mock.Anything, "v3.19/main/noarch/docs-1.0-r0.apk").
+			Return(io.NopCloser(strings.NewReader("docs")), &artifact.Metadata{Size: 4}, nil).Once()
+		w = do("GET", "/alpine/v3.19/main/x86_64/docs-1.0-r0.apk", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "docs", w.Body.String())
+	})
+
+	t.Run("Delete rebuilds the index", func(t *testing.T) {
+		mockRepo.On("Delete", mock.Anything, "v3.19/main/x86_64/hello-2.10-r3.apk").Return(nil).Once()
+		mockRepo.On("RebuildIndex", mock.Anything).Return(nil).Once()
+		w := do("DELETE", "/alpine/v3.19/main/x86_64/hello-2.10-r3.apk", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockRepo.AssertNumberOfCalls(t, "RebuildIndex", 2)
+	})
+
+	t.Run("Public key", func(t *testing.T) {
+		w := do("GET", "/alpine/keys/ganje-1.rsa.pub", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		block, _ := pem.Decode(w.Body.Bytes())
+		if assert.NotNil(t, block) {
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			assert.NoError(t, err)
+			assert.True(t, rsaKey.PublicKey.Equal(pub))
+		}
+		assert.Equal(t, http.StatusNotFound, do("GET", "/alpine/keys/other.rsa.pub", nil).Code)
+	})
+}
+
+// buildAPKPackage assembles a minimal unsigned .apk: a control segment holding .PKGINFO and a data segment
+func buildAPKPackage(t *testing.T, pkginfo string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for i, file := range []struct{ name, content string }{
+		{".PKGINFO", pkginfo},
+		{"usr/bin/hello", "#!/bin/sh\n"},
+	} {
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		_ = tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content))})
+		_, _ = tw.Write([]byte(file.content))
+		if i == 0 {
+			_ = tw.Flush()
+		} else {
+			_ = tw.Close()
+		}
+		_ = gz.Close()
+	}
+	return buf.Bytes()
+}
+
+func TestCondaRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "conda", artifact.ArtifactTypeConda)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.do
+
+	pkg := buildCondaPackage(t, `{"name":"hello","version":"1.0","build":"h0_0","build_number":0,"subdir":"linux-64","depends":["libc"]}`)
+	location := "linux-64/hello-1.0-h0_0.conda"
+
+	var pushed *artifact.Metadata
+	t.Run("Upload reads info/index.json", func(t *testing.T) {
+		mockDB.On("GetArtifactByPath", mock.Anything, "conda", location).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "hello" && m.Version == "1.0" && m.Properties["subdir"] == "linux-64"
+		})).Run(func(args mock.Arguments) { pushed = args.Get(3).(*artifact.Metadata) }).Return(nil).Once()
+
+		w := do("POST", "/conda/api/packages", pkg)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"location":"`+location+`"`)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "conda", location).Return(&database.ArtifactInfo{Path: location}, nil).Once()
+		assert.Equal(t, http.StatusConflict, do("POST", "/conda/api/packages", pkg).Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/conda/api/packages", []byte("not a package")).Code)
+	})
+	if pushed == nil {
+		t.FailNow()
+	}
+
+	mockDB.On("GetArtifactsByRepository", mock.Anything, "conda").Return([]*database.ArtifactInfo{
+		{ID: 1, Type: "conda", Name: "hello", Version: "1.0", Path: location, Size: int64(len(pkg)),
+			Checksum: pushed.Checksum, Metadata: mustJSON(t, pushed.Properties)},
+	}, nil)
+
+	t.Run("repodata.json lists the package with its digests", func(t *testing.T) {
+		w := do("GET", "/conda/linux-64/repodata.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var repodata struct {
+			Packages      map[string]map[string]interface{} `json:"packages"`
+			PackagesConda map[string]map[string]interface{} `json:"packages.conda"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &repodata))
+		entry := repodata.PackagesConda["hello-1.0-h0_0.conda"]
+		sum := sha256.Sum256(pkg)
+		assert.Equal(t, hex.EncodeToString(sum[:]), entry["sha256"])
+		assert.Equal(t, float64(len(pkg)), entry["size"])
+		assert.Equal(t, []interface{}{"libc"}, entry["depends"])
+
+		w = do("GET", "/conda/linux-64/current_repodata.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "hello-1.0-h0_0.conda")
+
+		w = do("GET", "/conda/noarch/repodata.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code, "subdirs without packages have an empty index")
+		assert.NotContains(t, w.Body.String(), "hello")
+	})
+
+	t.Run("Download and delete", func(t *testing.T) {
+		mockRepo.On("Pull", mock.Anything, location).Return(
+			io.NopCloser(bytes.NewReader(pkg)), &artifact.Metadata{Size: int64(len(pkg))}, nil).Once()
+		w := do("GET", "/conda/"+location, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, pkg, w.Body.Bytes())
+
+		mockRepo.On("Delete", mock.Anything, location).Return(nil).Once()
+		assert.Equal(t, http.StatusOK, do("DELETE", "/conda/"+location, nil).Code)
+	})
+
+	t.Run("Remote repositories proxy repodata", func(t *testing.T) {
+		remote := &MockRepository{name: "conda-forge", repoType: "remote", artifactType: "conda"}
+		remote.On("GetType").Return(repository.Remote)
+		srv.repoManager.On("GetRepository", "conda-forge").Return(remote, nil)
+		srv.server.RegisterRepositoryRoutes(&database.Repository{Name: "conda-forge", Type: "remote", ArtifactType: "conda"})
+
+		upstream := []byte(`{"info":{"subdir":"noarch"},"packages":{},"packages.conda":{}}`)
+		remote.On("Pull", mock.Anything, "noarch/repodata.json").Return(
+			io.NopCloser(bytes.NewReader(upstream)), &artifact.Metadata{Size: int64(len(upstream))}, nil).Once()
+		w := do("GET", "/conda-forge/noarch/repodata.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, upstream, w.Body.Bytes())
+	})
+}
+
+// buildCondaPackage assembles a minimal .conda: a zip whose info-*.tar.zst member holds info/index.json
+func buildCondaPackage(t *testing.T, index string) []byte {
+	t.Helper()
+	var info bytes.Buffer
+	zw, _ := zstd.NewWriter(&info)
+	tw := tar.NewWriter(zw)
+	_ = tw.WriteHeader(&tar.Header{Name: "info/index.json", Mode: 0644, Size: int64(len(index))})
+	_, _ = tw.Write([]byte(index))
+	_ = tw.Close()
+	_ = zw.Close()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: "info-hello.tar.zst", Method: zip.Store})
+	assert.NoError(t, err)
+	_, _ = w.Write(info.Bytes())
+	assert.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestComposerRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "php", artifact.ArtifactTypeComposer)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.do
+
+	dist := buildComposerDist(t, `{"name":"acme/logger","description":"PSR-3 logger","require":{"php":">=8.1"}}`)
+	location := "dists/acme/logger/1.4.0/acme-logger-1.4.0.zip"
+
+	var pushed *artifact.Metadata
+	t.Run("Upload validates composer.json", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/php/api/packages", dist).Code, "version is required")
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/php/api/packages?version=1.4.0", []byte("not a zip")).Code)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "php", location).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "acme/logger" && m.Version == "1.4.0"
+		})).Run(func(args mock.Arguments) { pushed = args.Get(3).(*artifact.Metadata) }).Return(nil).Once()
+
+		w := do("POST", "/php/api/packages?version=1.4.0", dist)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"location":"`+location+`"`)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "php", location).Return(&database.ArtifactInfo{Path: location}, nil).Once()
+		assert.Equal(t, http.StatusConflict, do("POST", "/php/api/packages?version=1.4.0", dist).Code)
+	})
+	if pushed == nil {
+		t.FailNow()
+	}
+
+	dev := &types.ComposerPackage{Name: "acme/logger", Manifest: []byte(`{"name":"acme/logger"}`), Shasum: "0"}
+	assert.NoError(t, dev.SetVersion("dev-main"))
+	mockDB.On("GetArtifactsByRepository", mock.Anything, "php").Return([]*database.ArtifactInfo{
+		{ID: 1, Type: "composer", Name: "acme/logger", Version: "1.4.0", Path: location, Metadata: mustJSON(t, pushed.Properties)},
+		{ID: 2, Type: "composer", Name: "acme/logger", Version: "dev-main", Path: types.ComposerDistPath("acme/logger", "dev-main"), Metadata: mustJSON(t, dev.Metadata())},
+	}, nil)
+
+	t.Run("packages.json advertises metadata-url", func(t *testing.T) {
+		w := do("GET", "/php/packages.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var root map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &root))
+		assert.Equal(t, "/php/p2/%package%.json", root["metadata-url"])
+		assert.Equal(t, []interface{}{"acme/logger"}, root["available-packages"])
+	})
+
+	t.Run("p2 metadata splits tagged and dev versions", func(t *testing.T) {
+		var metadata struct {
+			Packages map[string][]struct {
+				Version string            `json:"version"`
+				Dist    map[string]string `json:"dist"`
+			} `json:"packages"`
+		}
+		w := do("GET", "/php/p2/acme/logger.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &metadata))
+		if versions := metadata.Packages["acme/logger"]; assert.Len(t, versions, 1) {
+			sum := sha1.Sum(dist)
+			assert.Equal(t, "1.4.0", versions[0].Version)
+			assert.Equal(t, hex.EncodeToString(sum[:]), versions[0].Dist["shasum"])
+			assert.Equal(t, "http://example.com/php/"+location, versions[0].Dist["url"])
+		}
+
+		w = do("GET", "/php/p2/acme/logger~dev.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"version":"dev-main"`)
+		assert.NotContains(t, w.Body.String(), `"version":"1.4.0"`)
+
+		assert.Equal(t, http.StatusNotFound, do("GET", "/php/p2/acme/missing.json", nil).Code)
+	})
+
+	t.Run("Download and delete", func(t *testing.T) {
+		mockRepo.On("Pull", mock.Anything, location).Return(
+			io.NopCloser(bytes.NewReader(dist)), &artifact.Metadata{Size: int64(len(dist))}, nil).Once()
+		w := do("GET", "/php/"+location, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, dist, w.Body.Bytes())
+
+		mockRepo.On("Delete", mock.Anything, location).Return(nil).Once()
+		assert.Equal(t, http.StatusOK, do("DELETE", "/php/"+location, nil).Code)
+	})
+}
+
+// buildComposerDist returns a zipball with composer.json inside a top-level directory
+func buildComposerDist(t *testing.T, manifest string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, err := archive.Create("acme-logger-1a2b3c/composer.json")
+	assert.NoError(t, err)
+	_, _ = w.Write([]byte(manifest))
+	assert.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestHexRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "hex", artifact.ArtifactTypeHex)
+	mockDB, mockRepo := srv.db, srv.repo
+
+	srv.authService.On("ValidateToken", "valid-token").Return(srv.claims, nil)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	repoConfig, _ := json.Marshal(map[string]string{"hex_signing_key": string(keyPEM), "hex_repository_name": "acme"})
+	mockDB.On("GetRepository", mock.Anything, "hex").Return(&database.Repository{Name: "hex", Config: string(repoConfig)}, nil)
+
+	// mix sends the API key as the raw Authorization header
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		return srv.do(method, path, body, "Authorization", "valid-token")
+	}
+
+	tarball := buildHexRelease(t, "greeter", "0.3.0")
+	location := "tarballs/greeter-0.3.0.tar"
+
+	var pushed *artifact.Metadata
+	t.Run("Publish parses metadata.config", func(t *testing.T) {
+		mockDB.On("GetArtifactByPath", mock.Anything, "hex", location).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "greeter" && m.Version == "0.3.0" && strings.Contains(m.Properties["requirements"], `"name":"jason"`)
+		})).Run(func(args mock.Arguments) { pushed = args.Get(3).(*artifact.Metadata) }).Return(nil).Once()
+
+		w := do("POST", "/hex/api/publish", tarball)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		sum := sha256.Sum256(tarball)
+		assert.Contains(t, w.Body.String(), `"outer_checksum":"`+hex.EncodeToString(sum[:])+`"`)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "hex", location).Return(&database.ArtifactInfo{Path: location}, nil).Once()
+		assert.Equal(t, http.StatusConflict, do("POST", "/hex/api/publish", tarball).Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, do("POST", "/hex/api/publish", []byte("not a tarball")).Code)
+	})
+	if pushed == nil {
+		t.FailNow()
+	}
+
+	mockDB.On("GetArtifactsByRepository", mock.Anything, "hex").Return([]*database.ArtifactInfo{
+		{ID: 1, Type: "hex", Name: "greeter", Version: "0.3.0", Path: location, Metadata: mustJSON(t, pushed.Properties)},
+	}, nil)
+
+	// payload verifies and unwraps a signed, gzipped registry resource
+	payload := func(resource []byte) []byte {
+		gz, err := gzip.NewReader(bytes.NewReader(resource))
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		signed, _ := io.ReadAll(gz)
+		var body, signature []byte
+		for len(signed) > 0 {
+			num, _, n := protowire.ConsumeTag(signed)
+			signed = signed[n:]
+			v, n := protowire.ConsumeBytes(signed)
+			signed = signed[n:]
+			if num == 1 {
+				body = v
+			} else {
+				signature = v
+			}
+		}
+		digest := sha512.Sum512(body)
+		assert.NoError(t, rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA512, digest[:], signature))
+		return body
+	}
+
+	t.Run("Registry resources are signed", func(t *testing.T) {
+		for _, resource := range []string{"names", "versions", "packages/greeter"} {
+			w := do("GET", "/hex/"+resource, nil)
+			assert.Equal(t, http.StatusOK, w.Code, resource)
+			body := payload(w.Body.Bytes())
+			assert.Contains(t, string(body), "greeter", resource)
+			assert.Contains(t, string(body), "acme", "the configured repository name is embedded")
+		}
+		assert.Contains(t, string(payload(do("GET", "/hex/versions", nil).Body.Bytes())), "0.3.0")
+		assert.Contains(t, string(payload(do("GET", "/hex/packages/greeter", nil).Body.Bytes())), "~> 1.4")
+		assert.Equal(t, http.StatusNotFound, do("GET", "/hex/packages/missing", nil).Code)
+	})
+
+	t.Run("Public key", func(t *testing.T) {
+		w := do("GET", "/hex/public_key", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		block, _ := pem.Decode(w.Body.Bytes())
+		if assert.NotNil(t, block) {
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			assert.NoError(t, err)
+			assert.True(t, rsaKey.PublicKey.Equal(pub))
+		}
+	})
+
+	t.Run("Tarball download and revert", func(t *testing.T) {
+		mockRepo.On("Pull", mock.Anything, location).Return(
+			io.NopCloser(bytes.NewReader(tarball)), &artifact.Metadata{Size: int64(len(tarball))}, nil).Once()
+		w := do("GET", "/hex/"+location, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, tarball, w.Body.Bytes())
+
+		mockRepo.On("Delete", mock.Anything, location).Return(nil).Once()
+		assert.Equal(t, http.StatusNoContent, do("DELETE", "/hex/api/packages/greeter/releases/0.3.0", nil).Code)
+	})
+}
+
+// buildHexRelease assembles a version 3 Hex tarball depending on jason
+func buildHexRelease(t *testing.T, name, version string) []byte {
+	t.Helper()
+	metadata := fmt.Sprintf(`{<<"name">>,<<"%s">>}.
+{<<"version">>,<<"%s">>}.
+{<<"requirements">>,[{<<"jason">>,[{<<"app">>,<<"jason">>},{<<"optional">>,false},{<<"requirement">>,<<"~> 1.4">>},{<<"repository">>,<<"hexpm">>}]}]}.
+`, name, version)
+	var contents bytes.Buffer
+	gz := gzip.NewWriter(&contents)
+	_ = tar.NewWriter(gz).Close()
+	_ = gz.Close()
+
+	inner := sha256.New()
+	inner.Write([]byte("3"))
+	inner.Write([]byte(metadata))
+	inner.Write(contents.Bytes())
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"VERSION", []byte("3")},
+		{"CHECKSUM", []byte(strings.ToUpper(hex.EncodeToString(inner.Sum(nil))))},
+		{"metadata.config", []byte(metadata)},
+		{"contents.tar.gz", contents.Bytes()},
+	} {
+		_ = tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))})
+		_, _ = tw.Write(f.data)
+	}
+	assert.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestSwiftRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "swift", artifact.ArtifactTypeSwift)
+	mockDB, mockRepo := srv.db, srv.repo
+
+	do := func(method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+		headers := []string{"Accept", "application/vnd.swift.registry.v1+json"}
+		if contentType != "" {
+			headers = append(headers, "Content-Type", contentType)
+		}
+		return srv.do(method, path, body, headers...)
+	}
+
+	archive := buildSwiftSourceArchive(t)
+	location := "mona/linkedlist/1.1.1.zip"
+
+	var pushed *artifact.Metadata
+	t.Run("Publish", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("source-archive", "LinkedList-1.1.1.zip")
+		_, _ = part.Write(archive)
+		_ = mw.WriteField("metadata", `{"repositoryURLs":["https://github.com/mona/LinkedList.git"]}`)
+		assert.NoError(t, mw.Close())
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "swift", location).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "mona.LinkedList" && m.Version == "1.1.1" && strings.Contains(m.Properties["manifests"], "Package@swift-5.7.swift")
+		})).Run(func(args mock.Arguments) { pushed = args.Get(3).(*artifact.Metadata) }).Return(nil).Once()
+
+		w := do("PUT", "/swift/mona/LinkedList/1.1.1", mw.FormDataContentType(), body.Bytes())
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, "1", w.Header().Get("Content-Version"))
+		assert.Equal(t, "http://example.com/swift/mona/LinkedList/1.1.1", w.Header().Get("Location"))
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "swift", location).Return(&database.ArtifactInfo{Path: location}, nil).Once()
+		assert.Equal(t, http.StatusConflict, do("PUT", "/swift/mona/LinkedList/1.1.1", mw.FormDataContentType(), body.Bytes()).Code)
+		assert.Equal(t, http.StatusBadRequest, do("PUT", "/swift/mona/LinkedList/1.1", mw.FormDataContentType(), body.Bytes()).Code)
+		assert.Equal(t, http.StatusUnsupportedMediaType, do("PUT", "/swift/mona/LinkedList/1.1.1", "application/zip", archive).Code)
+	})
+	if pushed == nil {
+		t.FailNow()
+	}
+
+	older := &types.SwiftRelease{Scope: "mona", Name: "LinkedList", Version: "1.0.0", Checksum: "00",
+		Manifests: map[string]string{"Package.swift": "// swift-tools-version:5.0\n"}}
+	mockDB.On("GetArtifactsByRepository", mock.Anything, "swift").Return([]*database.ArtifactInfo{
+		{ID: 1, Type: "swift", Name: "mona.LinkedList", Version: "1.1.1", Path: location, Metadata: mustJSON(t, pushed.Properties)},
+		{ID: 2, Type: "swift", Name: "mona.LinkedList", Version: "1.0.0", Path: "mona/linkedlist/1.0.0.zip", Metadata: mustJSON(t, older.Properties())},
+	}, nil)
+
+	t.Run("List releases", func(t *testing.T) {
+		w := do("GET", "/swift/mona/linkedlist", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var listing struct {
+			Releases map[string]struct {
+				URL string `json:"url"`
+			} `json:"releases"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &listing))
+		assert.Len(t, listing.Releases, 2)
+		assert.Contains(t, w.Header().Get("Link"), `/swift/mona/linkedlist/1.1.1>; rel="latest-version"`)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/swift/mona/missing", "", nil).Code)
+	})
+
+	t.Run("Release metadata", func(t *testing.T) {
+		w := do("GET", "/swift/mona/LinkedList/1.0.0", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"id":"mona.LinkedList"`)
+		assert.Contains(t, w.Header().Get("Link"), `rel="successor-version"`)
+
+		w = do("GET", "/swift/mona/LinkedList/1.1.1", "", nil)
+		sum := sha256.Sum256(archive)
+		assert.Contains(t, w.Body.String(), `"checksum":"`+hex.EncodeToString(sum[:])+`"`)
+		assert.Contains(t, w.Body.String(), `"repositoryURLs"`)
+		assert.Contains(t, w.Header().Get("Link"), `rel="predecessor-version"`)
+	})
+
+	t.Run("Manifests", func(t *testing.T) {
+		w := do("GET", "/swift/mona/LinkedList/1.1.1/Package.swift", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "// swift-tools-version:5.0\n", w.Body.String())
+		assert.Contains(t, w.Header().Get("Link"), `filename="Package@swift-5.7.swift"`)
+
+		w = do("GET", "/swift/mona/LinkedList/1.1.1/Package.swift?swift-version=5.7", "", nil)
+		assert.Equal(t, "// swift-tools-version:5.7\n", w.Body.String())
+
+		w = do("GET", "/swift/mona/LinkedList/1.1.1/Package.swift?swift-version=5.9", "", nil)
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Equal(t, "/swift/mona/LinkedList/1.1.1/Package.swift", w.Header().Get("Location"))
+	})
+
+	t.Run("Source archive", func(t *testing.T) {
+		sum := sha256.Sum256(archive)
+		mockRepo.On("Pull", mock.Anything, location).Return(io.NopCloser(bytes.NewReader(archive)),
+			&artifact.Metadata{Size: int64(len(archive)), Checksum: hex.EncodeToString(sum[:])}, nil).Once()
+		w := do("GET", "/swift/mona/LinkedList/1.1.1.zip", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, archive, w.Body.Bytes())
+		assert.Equal(t, "sha-256="+base64.StdEncoding.EncodeToString(sum[:]), w.Header().Get("Digest"))
+	})
+
+	t.Run("Identifier lookup", func(t *testing.T) {
+		w := do("GET", "/swift/identifiers?url=git@github.com:mona/LinkedList.git", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"identifiers":["mona.LinkedList"]}`, w.Body.String())
+		assert.Equal(t, http.StatusNotFound, do("GET", "/swift/identifiers?url=https://github.com/mona/other", "", nil).Code)
+	})
+
+	t.Run("Unsupported API version", func(t *testing.T) {
+		w := srv.do("GET", "/swift/mona/LinkedList", nil, "Accept", "application/vnd.swift.registry.v2+json")
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	})
+}
+
+// buildSwiftSourceArchive assembles a source archive like "swift package archive-source" creates
+func buildSwiftSourceArchive(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"LinkedList/Package.swift":                 "// swift-tools-version:5.0\n",
+		"LinkedList/Package@swift-5.7.swift":       "// swift-tools-version:5.7\n",
+		"LinkedList/Sources/LinkedList/List.swift": "struct LinkedList {}\n",
+	} {
+		w, err := archive.Create(name)
+		assert.NoError(t, err)
+		_, _ = w.Write([]byte(content))
+	}
+	assert.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestConanRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "conan", artifact.ArtifactTypeConan)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.do
+
+	srv.authService.On("ValidateToken", "valid-token").Return(srv.claims, nil)
+	srv.authService.On("ValidateToken", "wrong-token").Return(nil, assert.AnError)
+
+	recipe := "/conan/v2/conans/zlib/1.3.1/_/_"
+	rrev, pkgID, prev := "f1a2b3", "9e186f6d94c008b544af1569d1a6368d8339efc5", "c4d5e6"
+	recipeDir := "zlib/1.3.1/_/_/" + rrev + "/export"
+	packageDir := "zlib/1.3.1/_/_/" + rrev + "/package/" + pkgID + "/" + prev
+	conaninfo := "[settings]\nos=Linux\narch=x86_64\n[options]\nshared=False\n"
+
+	t.Run("Ping and authentication", func(t *testing.T) {
+		w := srv.serve(httptest.NewRequest("GET", "/conan/v1/ping", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "revisions", w.Header().Get("X-Conan-Server-Capabilities"))
+
+		req := httptest.NewRequest("GET", "/conan/v2/users/authenticate", nil)
+		req.SetBasicAuth("testuser", "valid-token")
+		w = srv.serve(req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "valid-token", w.Body.String())
+
+		req = httptest.NewRequest("GET", "/conan/v2/users/authenticate", nil)
+		req.SetBasicAuth("testuser", "wrong-token")
+		w = srv.serve(req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		assert.Equal(t, "testuser", do("GET", "/conan/v2/users/check_credentials", nil).Body.String())
+	})
+
+	var pushed *artifact.Metadata
+	t.Run("Upload", func(t *testing.T) {
+		conanfile := []byte("from conan import ConanFile\n")
+		mockDB.On("GetArtifactByPath", mock.Anything, "conan", recipeDir+"/conanfile.py").Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, recipeDir+"/conanfile.py", mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "zlib" && m.Version == "1.3.1" && m.Properties["recipe_revision"] == rrev
+		})).Return(nil).Once()
+		mockDB.On("SaveConanRevision", mock.Anything, "conan", mock.MatchedBy(func(r *database.ConanRevision) bool {
+			return r.Reference == "zlib/1.3.1" && r.RecipeRevision == rrev && r.PackageID == ""
+		})).Return(nil).Once()
+		sum := sha1.Sum(conanfile)
+		w := do("PUT", recipe+"/revisions/"+rrev+"/files/conanfile.py", conanfile, "X-Checksum-Sha1", hex.EncodeToString(sum[:]))
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		assert.Equal(t, http.StatusBadRequest, do("PUT", recipe+"/revisions/"+rrev+"/files/conanfile.py", conanfile, "X-Checksum-Sha1", "0000").Code)
+		assert.Equal(t, http.StatusNotFound, do("PUT", recipe+"/revisions/"+rrev+"/files/conanfile.py", nil, "X-Checksum-Deploy", "true").Code)
+		assert.Equal(t, http.StatusBadRequest, do("PUT", recipe+"/revisions/not-a-rev/files/conanfile.py", conanfile).Code)
+
+		// Packages need their recipe revision
+		mockDB.On("ListConanRevisions", mock.Anything, "conan", "zlib/1.3.1", "", "").Return([]*database.ConanRevision{}, nil).Once()
+		assert.Equal(t, http.StatusNotFound, do("PUT", recipe+"/revisions/"+rrev+"/packages/"+pkgID+"/revisions/"+prev+"/files/conaninfo.txt", []byte(conaninfo)).Code)
+
+		mockDB.On("ListConanRevisions", mock.Anything, "conan", "zlib/1.3.1", "", "").Return([]*database.ConanRevision{
+			{Reference: "zlib/1.3.1", RecipeRevision: rrev, Latest: true},
+		}, nil).Once()
+		mockDB.On("GetArtifactByPath", mock.Anything, "conan", packageDir+"/conaninfo.txt").Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, packageDir+"/conaninfo.txt", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { pushed = args.Get(3).(*artifact.Metadata) }).Return(nil).Once()
+		mockDB.On("SaveConanRevision", mock.Anything, "conan", mock.MatchedBy(func(r *database.ConanRevision) bool {
+			return r.PackageID == pkgID && r.PackageRevision == prev
+		})).Return(nil).Once()
+		w = do("PUT", recipe+"/revisions/"+rrev+"/packages/"+pkgID+"/revisions/"+prev+"/files/conaninfo.txt", []byte(conaninfo))
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	})
+	if pushed == nil {
+		t.FailNow()
+	}
+	assert.JSONEq(t, `{"settings":{"os":"Linux","arch":"x86_64"},"options":{"shared":"False"},"requires":[]}`, pushed.Properties["conaninfo"])
+
+	updated := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockDB.On("GetArtifactsByRepository", mock.Anything, "conan").Return([]*database.ArtifactInfo{
+		{ID: 1, Type: "conan", Name: "zlib", Version: "1.3.1", Path: recipeDir + "/conanfile.py"},
+		{ID: 2, Type: "conan", Name: "zlib", Version: "1.3.1", Path: recipeDir + "/conanmanifest.txt"},
+		{ID: 3, Type: "conan", Name: "zlib", Version: "1.3.1", Path: packageDir + "/conaninfo.txt", Metadata: mustJSON(t, pushed.Properties)},
+	}, nil)
+
+	t.Run("Revisions", func(t *testing.T) {
+		mockDB.On("GetLatestConanRevision", mock.Anything, "conan", "zlib/1.3.1", "", "").Return(
+			&database.ConanRevision{Reference: "zlib/1.3.1", RecipeRevision: rrev, Latest: true, UpdatedAt: updated}, nil)
+		w := do("GET", recipe+"/latest", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"revision":"`+rrev+`","time":"2026-03-01T12:00:00Z"}`, w.Body.String())
+
+		mockDB.On("ListConanRevisions", mock.Anything, "conan", "zlib/1.3.1", rrev, pkgID).Return([]*database.ConanRevision{
+			{Reference: "zlib/1.3.1", RecipeRevision: rrev, PackageID: pkgID, PackageRevision: prev, Latest: true, UpdatedAt: updated},
+			{Reference: "zlib/1.3.1", RecipeRevision: rrev, PackageID: pkgID, PackageRevision: "a0", UpdatedAt: updated.Add(-time.Hour)},
+		}, nil).Once()
+		w = do("GET", recipe+"/revisions/"+rrev+"/packages/"+pkgID+"/revisions", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"reference":"zlib/1.3.1#`+rrev+`:`+pkgID+`"`)
+		assert.Contains(t, w.Body.String(), `{"revision":"a0","time":"2026-03-01T11:00:00Z"}`)
+
+		mockDB.On("GetLatestConanRevision", mock.Anything, "conan", "zlib/1.3.1", rrev, "deadbeef").Return(nil, assert.AnError)
+		assert.Equal(t, http.StatusNotFound, do("GET", recipe+"/revisions/"+rrev+"/packages/deadbeef/latest", nil).Code)
+	})
+
+	t.Run("Files", func(t *testing.T) {
+		w := do("GET", recipe+"/revisions/"+rrev+"/files", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"files":{"conanfile.py":{},"conanmanifest.txt":{}}}`, w.Body.String())
+		assert.Equal(t, http.StatusNotFound, do("GET", recipe+"/revisions/0000/files", nil).Code)
+
+		mockRepo.On("Pull", mock.Anything, packageDir+"/conaninfo.txt").Return(
+			io.NopCloser(strings.NewReader(conaninfo)), &artifact.Metadata{Size: int64(len(conaninfo))}, nil).Once()
+		w = do("GET", recipe+"/revisions/"+rrev+"/packages/"+pkgID+"/revisions/"+prev+"/files/conaninfo.txt", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, conaninfo, w.Body.String())
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		mockDB.On("ListConanRevisions", mock.Anything, "conan", "", "", "").Return([]*database.ConanRevision{
+			{Reference: "zlib/1.3.1", RecipeRevision: rrev},
+			{Reference: "zlib/1.2.13", RecipeRevision: "aa"},
+			{Reference: "zlib/1.2.13", RecipeRevision: "bb"},
+			{Reference: "openssl/3.2.0@acme/stable", RecipeRevision: "cc"},
+		}, nil)
+		w := do("GET", "/conan/v2/conans/search?q=ZLIB*", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"results":["zlib/1.2.13","zlib/1.3.1"]}`, w.Body.String())
+		assert.JSONEq(t, `{"results":[]}`, do("GET", "/conan/v2/conans/search?q=ZLIB*&ignorecase=False", nil).Body.String())
+
+		mockDB.On("ListConanRevisions", mock.Anything, "conan", "zlib/1.3.1", rrev, "").Return([]*database.ConanRevision{
+			{Reference: "zlib/1.3.1", RecipeRevision: rrev, PackageID: pkgID, PackageRevision: prev, Latest: true},
+		}, nil)
+		w = do("GET", recipe+"/search", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"`+pkgID+`":{"settings":{"os":"Linux","arch":"x86_64"},"options":{"shared":"False"},"requires":[]}}`, w.Body.String())
+	})
+
+	t.Run("Delete recipe revision", func(t *testing.T) {
+		for _, path := range []string{recipeDir + "/conanfile.py", recipeDir + "/conanmanifest.txt", packageDir + "/conaninfo.txt"} {
+			mockRepo.On("Delete", mock.Anything, path).Return(nil).Once()
+		}
+		mockDB.On("DeleteConanRevisions", mock.Anything, "conan", "zlib/1.3.1", rrev, "", "").Return(nil).Once()
+		assert.Equal(t, http.StatusOK, do("DELETE", recipe+"/revisions/"+rrev, nil).Code)
+		mockDB.AssertCalled(t, "DeleteConanRevisions", mock.Anything, "conan", "zlib/1.3.1", rrev, "", "")
+	})
+}
+
+func TestLFSRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "lfs", artifact.ArtifactTypeLFS)
+	mockDB, mockRepo := srv.db, srv.repo
+
+	srv.authService.On("ValidateToken", "Bearer writer-token").Return(&auth.Claims{Username: "alice", Realms: []string{"dev"}}, nil)
+	srv.authService.On("ValidateToken", "Bearer reader-token").Return(&auth.Claims{Username: "bob", Realms: []string{"viewers"}}, nil)
+	isAlice := mock.MatchedBy(func(c *auth.Claims) bool { return c.Username == "alice" })
+	isBob := mock.MatchedBy(func(c *auth.Claims) bool { return c.Username == "bob" })
+	srv.authService.On("CheckPermission", isBob, "lfs", auth.PermissionRead).Return(true)
+	srv.authService.On("CheckPermission", isBob, "lfs", mock.Anything).Return(false)
+	srv.authService.On("CheckPermission", isAlice, "lfs", auth.PermissionAdmin).Return(false)
+	srv.authService.On("CheckPermission", isAlice, "lfs", mock.Anything).Return(true)
+
+	do := func(method, path, token string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if token != "" {
+			req.SetBasicAuth("git", token)
+		}
+		req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+		return srv.serve(req)
+	}
+
+	content := []byte("large binary asset")
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	location := oid[:2] + "/" + oid[2:4] + "/" + oid
+	batch := func(operation string) []byte {
+		return []byte(fmt.Sprintf(`{"operation":%q,"transfers":["basic"],"objects":[{"oid":%q,"size":%d},{"oid":"nothex","size":1}]}`, operation, oid, len(content)))
+	}
+
+	t.Run("Authentication challenge", func(t *testing.T) {
+		w := do("POST", "/lfs/objects/batch", "", batch("download"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, `Basic realm="Git LFS"`, w.Header().Get("LFS-Authenticate"))
+	})
+
+	t.Run("Batch upload", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do("POST", "/lfs/objects/batch", "reader-token", batch("upload")).Code)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "lfs", location).Return(nil, assert.AnError).Once()
+		w := do("POST", "/lfs/objects/batch", "writer-token", batch("upload"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/vnd.git-lfs+json", w.Header().Get("Content-Type"))
+		var resp types.LFSBatchResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "basic", resp.Transfer)
+		if assert.Len(t, resp.Objects, 2) {
+			upload := resp.Objects[0].Actions["upload"]
+			if assert.NotNil(t, upload) {
+				assert.Equal(t, "http://example.com/lfs/objects/"+oid, upload.Href)
+				assert.Equal(t, "Bearer writer-token", upload.Header["Authorization"])
+			}
+			assert.NotNil(t, resp.Objects[0].Actions["verify"])
+			assert.Equal(t, http.StatusUnprocessableEntity, resp.Objects[1].Error.Code)
+		}
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "lfs", location).Return(&database.ArtifactInfo{Path: location, Size: int64(len(content))}, nil).Once()
+		w = do("POST", "/lfs/objects/batch", "writer-token", batch("upload"))
+		assert.NotContains(t, w.Body.String(), `"actions"`, "objects the server has need no upload")
+	})
+
+	t.Run("Upload and verify", func(t *testing.T) {
+		mockDB.On("GetArtifactByPath", mock.Anything, "lfs", location).Return(nil, assert.AnError).Twice()
+		assert.Equal(t, http.StatusUnprocessableEntity, do("PUT", "/lfs/objects/"+oid, "writer-token", []byte("tampered")).Code)
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == oid && m.Size == int64(len(content))
+		})).Return(nil).Once()
+		assert.Equal(t, http.StatusOK, do("PUT", "/lfs/objects/"+oid, "writer-token", content).Code)
+		assert.Equal(t, http.StatusForbidden, do("PUT", "/lfs/objects/"+oid, "reader-token", content).Code)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "lfs", location).Return(&database.ArtifactInfo{Path: location, Size: int64(len(content))}, nil).Twice()
+		assert.Equal(t, http.StatusOK, do("POST", "/lfs/objects/verify", "writer-token", []byte(fmt.Sprintf(`{"oid":%q,"size":%d}`, oid, len(content)))).Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, do("POST", "/lfs/objects/verify", "writer-token", []byte(fmt.Sprintf(`{"oid":%q,"size":1}`, oid))).Code)
+	})
+
+	t.Run("Batch download", func(t *testing.T) {
+		mockDB.On("GetArtifactByPath", mock.Anything, "lfs", location).Return(&database.ArtifactInfo{Path: location, Size: int64(len(content))}, nil).Once()
+		w := do("POST", "/lfs/objects/batch", "reader-token", batch("download"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"download":{"href":"http://example.com/lfs/objects/`+oid+`"`)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "lfs", location).Return(nil, assert.AnError).Once()
+		w = do("POST", "/lfs/objects/batch", "reader-token", batch("download"))
+		assert.Contains(t, w.Body.String(), `"error":{"code":404`)
+
+		mockRepo.On("Pull", mock.Anything, location).Return(io.NopCloser(bytes.NewReader(content)), &artifact.Metadata{Size: int64(len(content))}, nil).Once()
+		w = do("GET", "/lfs/objects/"+oid, "reader-token", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.Bytes())
+
+		assert.Equal(t, http.StatusConflict, do("POST", "/lfs/objects/batch", "reader-token", []byte(`{"operation":"download","hash_algo":"sha512","objects":[]}`)).Code)
+	})
+
+	t.Run("Locks", func(t *testing.T) {
+		locked := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+		existing := []*database.LFSLock{
+			{ID: 1, Path: "assets/logo.psd", Owner: "alice", CreatedAt: locked},
+			{ID: 2, Path: "assets/intro.mp4", Owner: "carol", CreatedAt: locked},
+		}
+		mockDB.On("ListLFSLocks", mock.Anything, "lfs").Return(existing, nil)
+
+		w := do("POST", "/lfs/locks", "writer-token", []byte(`{"path":"assets/logo.psd"}`))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"owner":{"name":"alice"}`)
+
+		mockDB.On("CreateLFSLock", mock.Anything, "lfs", mock.MatchedBy(func(l *database.LFSLock) bool {
+			return l.Path == "assets/model.fbx" && l.Owner == "alice" && l.Ref == "refs/heads/main"
+		})).Run(func(args mock.Arguments) { args.Get(2).(*database.LFSLock).ID = 3 }).Return(nil).Once()
+		w = do("POST", "/lfs/locks", "writer-token", []byte(`{"path":"assets/model.fbx","ref":{"name":"refs/heads/main"}}`))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"id":"3"`)
+		assert.Equal(t, http.StatusForbidden, do("POST", "/lfs/locks", "reader-token", []byte(`{"path":"x"}`)).Code)
+
+		w = do("GET", "/lfs/locks?path=assets/intro.mp4", "reader-token", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"locks":[{"id":"2","path":"assets/intro.mp4","locked_at":"2026-05-01T09:00:00Z","owner":{"name":"carol"}}],"next_cursor":""}`, w.Body.String())
+		w = do("GET", "/lfs/locks?limit=1", "reader-token", nil)
+		assert.Contains(t, w.Body.String(), `"next_cursor":"2"`)
+
+		w = do("POST", "/lfs/locks/verify", "writer-token", []byte(`{}`))
+		var verify struct{ Ours, Theirs []map[string]interface{} }
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &verify))
+		assert.Len(t, verify.Ours, 1)
+		assert.Len(t, verify.Theirs, 1)
+
+		assert.Equal(t, http.StatusForbidden, do("POST", "/lfs/locks/2/unlock", "writer-token", []byte(`{}`)).Code)
+		assert.Equal(t, http.StatusForbidden, do("POST", "/lfs/locks/2/unlock", "writer-token", []byte(`{"force":true}`)).Code, "forcing needs admin")
+		assert.Equal(t, http.StatusNotFound, do("POST", "/lfs/locks/9/unlock", "writer-token", []byte(`{}`)).Code)
+		mockDB.On("DeleteLFSLock", mock.Anything, "lfs", uint(1)).Return(nil).Once()
+		w = do("POST", "/lfs/locks/1/unlock", "writer-token", []byte(`{}`))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"path":"assets/logo.psd"`)
+	})
+}
+
+func buildPubArchive(t *testing.T, pubspec string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "pubspec.yaml", Mode: 0644, Size: int64(len(pubspec))}))
+	_, _ = tw.Write([]byte(pubspec))
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestPubRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "dart", artifact.ArtifactTypePub)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.serve
+
+	authed := func(method, target string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		return req
+	}
+	upload := func(uploadID string, archive []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField("upload_id", uploadID)
+		fw, _ := mw.CreateFormFile("file", "package.tar.gz")
+		_, _ = fw.Write(archive)
+		_ = mw.Close()
+		req := httptest.NewRequest("POST", "/dart/api/packages/versions/newUpload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return do(req)
+	}
+	newSession := func() string {
+		w := do(authed("GET", "/dart/api/packages/versions/new"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			URL    string
+			Fields map[string]string
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "http://example.com/dart/api/packages/versions/newUpload", resp.URL)
+		return resp.Fields["upload_id"]
+	}
+
+	archive := buildPubArchive(t, "name: hello\nversion: 1.0.0\ndescription: Says hello\n")
+	sum := sha256.Sum256(archive)
+	location := "packages/hello/versions/1.0.0.tar.gz"
+
+	t.Run("Publish", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, do(httptest.NewRequest("GET", "/dart/api/packages/versions/new", nil)).Code)
+		assert.Equal(t, http.StatusBadRequest, upload("unknown", archive).Code)
+
+		uploadID := newSession()
+		assert.Equal(t, http.StatusBadRequest, upload(uploadID, buildPubArchive(t, "name: hello\n")).Code)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "dart", location).Return(nil, assert.AnError).Twice()
+		w := upload(uploadID, archive)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		finish := w.Header().Get("Location")
+		assert.Equal(t, "http://example.com/dart/api/packages/versions/newUploadFinish?upload_id="+uploadID, finish)
+		assert.Equal(t, http.StatusBadRequest, upload(uploadID, archive).Code, "a session takes one archive")
+
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "hello" && m.Version == "1.0.0" && m.Description == "Says hello" &&
+				m.Checksum == hex.EncodeToString(sum[:]) && m.Properties["pubspec"] != ""
+		})).Return(nil).Once()
+		w = do(authed("GET", strings.TrimPrefix(finish, "http://example.com")))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"success":{"message":"Successfully uploaded hello version 1.0.0."}`)
+		assert.Equal(t, http.StatusBadRequest, do(authed("GET", strings.TrimPrefix(finish, "http://example.com"))).Code, "sessions finish once")
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "dart", location).Return(&database.ArtifactInfo{Path: location}, nil).Once()
+		w = upload(newSession(), archive)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"PackageRejected"`)
+	})
+
+	t.Run("Version listing", func(t *testing.T) {
+		props := `{"name":"hello","version":"1.0.0","pubspec":"{\"name\":\"hello\",\"version\":\"1.0.0\"}","sha256":"` + hex.EncodeToString(sum[:]) + `"}`
+		mockDB.On("GetArtifactsByRepository", mock.Anything, "dart").Return([]*database.ArtifactInfo{
+			{Name: "hello", Version: "1.0.0", Type: "pub", Path: location, Metadata: props},
+		}, nil)
+
+		w := do(authed("GET", "/dart/api/packages/hello"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/vnd.pub.v2+json", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `"archive_url":"http://example.com/dart/`+location+`"`)
+		assert.Contains(t, w.Body.String(), `"archive_sha256":"`+hex.EncodeToString(sum[:])+`"`)
+		assert.Contains(t, w.Body.String(), `"latest":{"version":"1.0.0"`)
+
+		w = do(authed("GET", "/dart/api/packages/missing"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"NotFound"`)
+	})
+
+	t.Run("Download and delete", func(t *testing.T) {
+		mockRepo.On("Pull", mock.Anything, location).Return(io.NopCloser(bytes.NewReader(archive)), &artifact.Metadata{Size: int64(len(archive))}, nil).Once()
+		w := do(authed("GET", "/dart/"+location))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, archive, w.Body.Bytes())
+		assert.Equal(t, http.StatusNotFound, do(authed("GET", "/dart/packages/hello/versions/1.0.0.zip")).Code)
+
+		mockRepo.On("Delete", mock.Anything, location).Return(nil).Once()
+		assert.Equal(t, http.StatusOK, do(authed("DELETE", "/dart/"+location)).Code)
+	})
+}
+
+func buildVagrantBox(t *testing.T, provider string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	metadata := fmt.Sprintf(`{"provider":%q}`, provider)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "metadata.json", Mode: 0644, Size: int64(len(metadata))}))
+	_, _ = tw.Write([]byte(metadata))
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestVagrantRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "boxes", artifact.ArtifactTypeVagrant)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.do
+
+	box := buildVagrantBox(t, "virtualbox")
+	sum := sha256.Sum256(box)
+	checksum := hex.EncodeToString(sum[:])
+	location := "infra/ubuntu/1.0.0/virtualbox.box"
+
+	t.Run("Upload", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do("PUT", "/boxes/infra/ubuntu/1.0.0/virtualbox.iso", box).Code)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "boxes", location).Return(nil, assert.AnError).Times(3)
+		assert.Equal(t, http.StatusBadRequest, do("PUT", "/boxes/"+location+"?checksum=00", box).Code)
+		assert.Equal(t, http.StatusBadRequest, do("PUT", "/boxes/"+location, buildVagrantBox(t, "libvirt")).Code, "the box must be for the provider in the path")
+
+		mockRepo.On("Push", mock.Anything, location, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "infra/ubuntu" && m.Version == "1.0.0" && m.Checksum == checksum &&
+				m.Properties["provider"] == "virtualbox" && m.Properties["description"] == "Ubuntu base box"
+		})).Return(nil).Once()
+		w := do("PUT", "/boxes/"+location+"?checksum="+checksum+"&description=Ubuntu+base+box", box)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "boxes", location).Return(&database.ArtifactInfo{Path: location}, nil).Once()
+		assert.Equal(t, http.StatusConflict, do("PUT", "/boxes/"+location, box).Code)
+	})
+
+	t.Run("Box metadata", func(t *testing.T) {
+		props := fmt.Sprintf(`{"name":"infra/ubuntu","version":"1.0.0","provider":"virtualbox","sha256":%q,"description":"Ubuntu base box"}`, checksum)
+		mockDB.On("GetArtifactsByRepository", mock.Anything, "boxes").Return([]*database.ArtifactInfo{
+			{Name: "infra/ubuntu", Version: "1.0.0", Type: "vagrant", Path: location, Metadata: props},
+		}, nil)
+
+		w := do("GET", "/boxes/infra/ubuntu", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"name":"infra/ubuntu","description":"Ubuntu base box","versions":[{"version":"1.0.0","status":"active","providers":[
+			{"name":"virtualbox","url":"http://example.com/boxes/`+location+`","checksum_type":"sha256","checksum":"`+checksum+`"}]}]}`, w.Body.String())
+		assert.Equal(t, http.StatusNotFound, do("GET", "/boxes/infra/debian", nil).Code)
+	})
+
+	t.Run("Download and delete", func(t *testing.T) {
+		mockRepo.On("Pull", mock.Anything, location).Return(io.NopCloser(bytes.NewReader(box)), &artifact.Metadata{Size: int64(len(box)), Checksum: checksum}, nil).Once()
+		w := do("GET", "/boxes/"+location, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, box, w.Body.Bytes())
+		assert.Equal(t, checksum, w.Header().Get("X-Checksum-SHA256"))
+
+		// Interrupted box downloads resume from where they stopped
+		mockRepo.On("Pull", mock.Anything, location).Return(io.NopCloser(bytes.NewReader(box)), &artifact.Metadata{Size: int64(len(box)), Checksum: checksum}, nil).Once()
+		w = do("GET", "/boxes/"+location, nil, "Range", "bytes=10-")
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, box[10:], w.Body.Bytes())
+		assert.Equal(t, `"`+checksum+`"`, w.Header().Get("ETag"))
+
+		mockRepo.On("Delete", mock.Anything, location).Return(nil).Once()
+		assert.Equal(t, http.StatusOK, do("DELETE", "/boxes/"+location, nil).Code)
+	})
+}
+
+func TestCocoaPodsRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "pods", artifact.ArtifactTypeCocoaPods)
+	mockDB, mockRepo := srv.db, srv.repo
+
+	do := func(method, target, contentType string, body []byte) *httptest.ResponseRecorder {
+		if contentType == "" {
+			return srv.do(method, target, body)
+		}
+		return srv.do(method, target, body, "Content-Type", contentType)
+	}
+
+	podspec := []byte(`{"name":"Alamofire","version":"5.9.1","source":{"git":"https://github.com/Alamofire/Alamofire.git","tag":"5.9.1"}}`)
+	specPath := "Specs/d/a/2/Alamofire/5.9.1/Alamofire.podspec.json"
+	sourcePath := "sources/Alamofire/5.9.1/Alamofire.zip"
+	source := []byte("zip archive")
+	sourceSum := sha256.Sum256(source)
+
+	t.Run("Push podspec", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/pods/api/pods", "application/json", []byte(`{"name":"Alamofire"}`)).Code)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "pods", specPath).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, specPath, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "Alamofire" && m.Properties["type"] == "cocoapods-podspec"
+		})).Return(nil).Once()
+		mockRepo.On("RebuildIndex", mock.Anything).Return(nil).Once()
+		w := do("POST", "/pods/api/pods", "application/json", podspec)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"location":"`+specPath+`"`)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "pods", specPath).Return(&database.ArtifactInfo{Path: specPath}, nil).Once()
+		assert.Equal(t, http.StatusConflict, do("POST", "/pods/api/pods", "application/json", podspec).Code)
+	})
+
+	t.Run("Push podspec with source archive", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("podspec", "Alamofire.podspec.json")
+		_, _ = fw.Write(podspec)
+		fw, _ = mw.CreateFormFile("source", "Alamofire.zip")
+		_, _ = fw.Write(source)
+		_ = mw.Close()
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "pods", specPath).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, sourcePath, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Checksum == hex.EncodeToString(sourceSum[:]) && m.Properties["type"] == "cocoapods-source"
+		})).Return(nil).Once()
+		var stored []byte
+		mockRepo.On("Push", mock.Anything, specPath, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored, _ = io.ReadAll(args.Get(2).(io.Reader))
+		}).Return(nil).Once()
+		mockRepo.On("RebuildIndex", mock.Anything).Return(nil).Once()
+		w := do("POST", "/pods/api/pods", mw.FormDataContentType(), body.Bytes())
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, string(stored), `"http": "http://example.com/pods/`+sourcePath+`"`)
+		assert.Contains(t, string(stored), `"sha256": "`+hex.EncodeToString(sourceSum[:])+`"`)
+		assert.NotContains(t, string(stored), `"git"`)
+	})
+
+	t.Run("CDN layout", func(t *testing.T) {
+		w := do("GET", "/pods/CocoaPods-version.yml", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "prefix_lengths:\n- 1\n- 1\n- 1\n")
+
+		mockRepo.On("GetIndex", mock.Anything, "all_pods_versions_d_a_2.txt").Return(io.NopCloser(strings.NewReader("Alamofire/5.9.1\n")), nil).Once()
+		w = do("GET", "/pods/all_pods_versions_d_a_2.txt", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "Alamofire/5.9.1\n", w.Body.String())
+		assert.Equal(t, http.StatusNotFound, do("GET", "/pods/all_pods_versions_x.txt", "", nil).Code)
+
+		mockRepo.On("Pull", mock.Anything, specPath).Return(io.NopCloser(bytes.NewReader(podspec)), &artifact.Metadata{Size: int64(len(podspec))}, nil).Once()
+		w = do("GET", "/pods/"+specPath, "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, podspec, w.Body.Bytes())
+		assert.Equal(t, http.StatusNotFound, do("GET", "/pods/Specs/0/0/0/Alamofire/5.9.1/Alamofire.podspec.json", "", nil).Code)
+
+		mockRepo.On("Pull", mock.Anything, sourcePath).Return(io.NopCloser(bytes.NewReader(source)), &artifact.Metadata{Size: int64(len(source))}, nil).Once()
+		w = do("GET", "/pods/"+sourcePath, "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, source, w.Body.Bytes())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		mockDB.On("GetArtifactsByRepository", mock.Anything, "pods").Return([]*database.ArtifactInfo{
+			{Type: "cocoapods", Name: "Alamofire", Version: "5.9.1", Path: specPath},
+			{Type: "cocoapods", Name: "Alamofire", Version: "5.9.1", Path: sourcePath},
+		}, nil)
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/pods/api/pods/Alamofire/1.0.0", "", nil).Code)
+
+		mockRepo.On("Delete", mock.Anything, specPath).Return(nil).Once()
+		mockRepo.On("Delete", mock.Anything, sourcePath).Return(nil).Once()
+		mockRepo.On("RebuildIndex", mock.Anything).Return(nil).Once()
+		assert.Equal(t, http.StatusOK, do("DELETE", "/pods/api/pods/Alamofire/5.9.1", "", nil).Code)
+		mockRepo.AssertNumberOfCalls(t, "RebuildIndex", 3)
+	})
+}
+
+func TestHuggingFaceRepositoryHandlers(t *testing.T) {
+	srv := newTypedRepoTestServer(t, "models", artifact.ArtifactTypeHuggingFace)
+	mockDB, mockRepo, do := srv.db, srv.repo, srv.do
+
+	mirror := &MockRepository{name: "hf-mirror", repoType: "remote", artifactType: "huggingface"}
+	mirror.On("GetName").Return("hf-mirror")
+	mirror.On("GetType").Return(repository.Remote)
+	mirror.On("GetArtifactType").Return(artifact.ArtifactTypeHuggingFace)
+	srv.repoManager.On("GetRepository", "hf-mirror").Return(mirror, nil)
+	srv.server.RegisterRepositoryRoutes(&database.Repository{Name: "hf-mirror", Type: "remote", ArtifactType: "huggingface"})
+
+	config := []byte("{\"model_type\":\"bert\"}\n")
+	weights := []byte("safetensors weights")
+	configBlob, _ := types.GitBlobID(bytes.NewReader(config), int64(len(config)))
+	weightsSum := sha256.Sum256(weights)
+	weightsSHA := hex.EncodeToString(weightsSum[:])
+	configPath := "acme/bert/resolve/main/config.json"
+	weightsPath := "acme/bert/resolve/main/model.safetensors"
+
+	t.Run("Upload", func(t *testing.T) {
+		mockDB.On("GetArtifactByPath", mock.Anything, "models", configPath).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, configPath, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "acme/bert" && m.Version == "main" && m.Properties["blob_id"] == configBlob && m.Properties["lfs"] == "false"
+		})).Return(nil).Once()
+		assert.Equal(t, http.StatusCreated, do("PUT", "/models/"+configPath, config).Code)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "models", weightsPath).Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, weightsPath, mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Checksum == weightsSHA && m.Properties["lfs"] == "true"
+		})).Return(nil).Once()
+		w := do("PUT", "/models/"+weightsPath, weights)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"lfs":true`)
+
+		mockDB.On("GetArtifactByPath", mock.Anything, "models", configPath).Return(&database.ArtifactInfo{Path: configPath}, nil).Once()
+		assert.Equal(t, http.StatusConflict, do("PUT", "/models/"+configPath, config).Code)
+		assert.Equal(t, http.StatusBadRequest, do("PUT", "/models/acme/bert/resolve/"+strings.Repeat("a", 40)+"/config.json", config).Code)
+	})
+
+	configFile := &types.HuggingFaceFile{RepoID: "acme/bert", Revision: "main", Path: "config.json", Size: int64(len(config)), BlobID: configBlob}
+	weightsFile := &types.HuggingFaceFile{RepoID: "acme/bert", Revision: "main", Path: "model.safetensors", Size: int64(len(weights)), SHA256: weightsSHA, BlobID: strings.Repeat("c", 40), LFS: true}
+	commit := types.HuggingFaceCommit([]*types.HuggingFaceFile{configFile, weightsFile})
+	record := func(f *types.HuggingFaceFile) *database.ArtifactInfo {
+		props, _ := json.Marshal(f.Properties())
+		return &database.ArtifactInfo{Type: "huggingface", Name: f.RepoID, Version: f.Revision, Path: types.HuggingFaceFilePath(f.RepoID, f.Revision, f.Path), Metadata: string(props)}
+	}
+	mockDB.On("GetArtifactsByRepository", mock.Anything, "models").Return([]*database.ArtifactInfo{record(configFile), record(weightsFile)}, nil)
+
+	t.Run("Model info", func(t *testing.T) {
+		w := do("GET", "/models/api/models/acme/bert/revision/main?blobs=true", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"sha":"`+commit+`"`)
+		assert.Contains(t, w.Body.String(), `"rfilename":"model.safetensors"`)
+		assert.Contains(t, w.Body.String(), `"lfs":{"sha256":"`+weightsSHA+`"`)
+
+		assert.Equal(t, http.StatusOK, do("GET", "/models/api/models/acme/bert", nil).Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/models/api/models/acme/bert/revision/"+commit, nil).Code)
+
+		w = do("GET", "/models/api/models/acme/bert/revision/dev", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "RevisionNotFound", w.Header().Get("X-Error-Code"))
+		w = do("GET", "/models/api/models/acme/gpt/revision/main", nil)
+		assert.Equal(t, "RepoNotFound", w.Header().Get("X-Error-Code"))
+	})
+
+	t.Run("Resolve", func(t *testing.T) {
+		w := do("HEAD", "/models/acme/bert/resolve/main/model.safetensors", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, commit, w.Header().Get("X-Repo-Commit"))
+		assert.Equal(t, `"`+weightsSHA+`"`, w.Header().Get("ETag"))
+		assert.Equal(t, `"`+weightsSHA+`"`, w.Header().Get("X-Linked-Etag"))
+		assert.Equal(t, fmt.Sprint(len(weights)), w.Header().Get("X-Linked-Size"))
+
+		mockRepo.On("Pull", mock.Anything, configPath).Return(io.NopCloser(bytes.NewReader(config)), &artifact.Metadata{Size: int64(len(config))}, nil).Once()
+		w = do("GET", "/models/acme/bert/resolve/"+commit+"/config.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, config, w.Body.Bytes())
+		assert.Equal(t, `"`+configBlob+`"`, w.Header().Get("ETag"))
+		assert.Empty(t, w.Header().Get("X-Linked-Etag"))
+
+		w = do("GET", "/models/acme/bert/resolve/main/missing.json", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "EntryNotFound", w.Header().Get("X-Error-Code"))
+	})
+
+	t.Run("Remote", func(t *testing.T) {
+		upstreamCommit := strings.Repeat("d", 40)
+		info := `{"id":"google/bert","sha":"` + upstreamCommit + `","siblings":[{"rfilename":"config.json"}]}`
+		mirror.On("Pull", mock.Anything, "api/models/google/bert/revision/main").Return(io.NopCloser(strings.NewReader(info)), &artifact.Metadata{}, nil).Once()
+		w := do("GET", "/hf-mirror/api/models/google/bert/revision/main", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, info, w.Body.String())
+
+		mirror.On("Pull", mock.Anything, "api/models/google/bert/revision/main").Return(io.NopCloser(strings.NewReader(info)), &artifact.Metadata{}, nil).Once()
+
+		mirror.On("Pull", mock.Anything, "google/bert/resolve/"+upstreamCommit+"/config.json").Return(io.NopCloser(bytes.NewReader(config)), &artifact.Metadata{Size: int64(len(config)), Checksum: "abc"}, nil).Once()
+		w = do("GET", "/hf-mirror/google/bert/resolve/main/config.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, upstreamCommit, w.Header().Get("X-Repo-Commit"))
+		assert.Equal(t, `"abc"`, w.Header().Get("ETag"))
+		assert.Equal(t, config, w.Body.Bytes())
+		mirror.AssertNumberOfCalls(t, "Pull", 3)
+	})
+
+	t.Run("Models without a namespace", func(t *testing.T) {
+		mockDB.On("GetArtifactByPath", mock.Anything, "models", "gpt2/resolve/main/config.json").Return(nil, assert.AnError).Once()
+		mockRepo.On("Push", mock.Anything, "gpt2/resolve/main/config.json", mock.Anything, mock.MatchedBy(func(m *artifact.Metadata) bool {
+			return m.Name == "gpt2" && m.Version == "main" && m.Properties["file"] == "config.json"
+		})).Return(nil).Once()
+		assert.Equal(t, http.StatusCreated, do("PUT", "/models/gpt2/resolve/main/config.json", config).Code)
+
+		upstreamCommit := strings.Repeat("e", 40)
+		info := `{"id":"gpt2","sha":"` + upstreamCommit + `","siblings":[{"rfilename":"config.json"}]}`
+		mirror.On("Pull", mock.Anything, "api/models/gpt2/revision/main").Return(io.NopCloser(strings.NewReader(info)), &artifact.Metadata{}, nil).Once()
+		w := do("GET", "/hf-mirror/api/models/gpt2", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, info, w.Body.String())
+
+		mirror.On("Pull", mock.Anything, "api/models/gpt2/revision/main").Return(io.NopCloser(strings.NewReader(info)), &artifact.Metadata{}, nil).Once()
+		mirror.On("Pull", mock.Anything, "gpt2/resolve/"+upstreamCommit+"/config.json").Return(io.NopCloser(bytes.NewReader(config)), &artifact.Metadata{Size: int64(len(config))}, nil).Once()
+		w = do("GET", "/hf-mirror/gpt2/resolve/main/config.json", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, upstreamCommit, w.Header().Get("X-Repo-Commit"))
+		assert.Equal(t, config, w.Body.Bytes())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		mockRepo.On("Delete", mock.Anything, weightsPath).Return(nil).Once()
+		assert.Equal(t, http.StatusOK, do("DELETE", "/models/"+weightsPath, nil).Code)
+	})
+}
@@ -0,0 +1,560 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/bazelbuild/remote-apis/build/bazel/semver"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/auth"
+	"github.com/hbahadorzadeh/ganje/internal/config"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// bazelGRPCMaxBatchSize is the batch size advertised to clients for BatchUpdateBlobs/BatchReadBlobs
+const bazelGRPCMaxBatchSize = 4 << 20
+
+// bazelGRPCChunkSize is the size of each ByteStream Read response
+const bazelGRPCChunkSize = 64 << 10
+
+// bazelClaimsKey stores the caller's validated claims in a gRPC request context
+type bazelClaimsKey struct{}
+
+// bazelGRPCService implements the REAPI remote cache services (ContentAddressableStorage,
+// ActionCache, Capabilities) and ByteStream on top of Bazel-type repositories.
+// The REAPI instance name selects the repository, e.g. --remote_instance_name=bazel-cache.
+type bazelGRPCService struct {
+	repb.UnimplementedContentAddressableStorageServer
+	repb.UnimplementedActionCacheServer
+	repb.UnimplementedCapabilitiesServer
+	bytestream.UnimplementedByteStreamServer
+
+	server *Server
+}
+
+// newBazelGRPCServer creates a gRPC server exposing the REAPI cache services, authenticated with Ganje tokens
+func (s *Server) newBazelGRPCServer() *grpc.Server {
+	grpcServer := grpc.NewServer(
+		grpc.MaxRecvMsgSize(2*bazelGRPCMaxBatchSize),
+		grpc.UnaryInterceptor(s.bazelUnaryAuth),
+		grpc.StreamInterceptor(s.bazelStreamAuth),
+	)
+	svc := &bazelGRPCService{server: s}
+	repb.RegisterContentAddressableStorageServer(grpcServer, svc)
+	repb.RegisterActionCacheServer(grpcServer, svc)
+	repb.RegisterCapabilitiesServer(grpcServer, svc)
+	bytestream.RegisterByteStreamServer(grpcServer, svc)
+	return grpcServer
+}
+
+// NewBazelGRPCServer creates a gRPC server exposing the REAPI cache services of the Bazel
+// repositories of repoManager, for binaries that serve HTTP without a Server
+func NewBazelGRPCServer(cfg *config.Config, db database.DatabaseInterface, repoManager repository.Manager, authService auth.AuthInterface, publisher messaging.Publisher) *grpc.Server {
+	s := &Server{config: cfg, db: db, repoManager: repoManager, authService: authService, publisher: publisher}
+	return s.newBazelGRPCServer()
+}
+
+// ServeBazelGRPC serves grpcServer on the gRPC port configured in cfg
+func ServeBazelGRPC(cfg *config.Config, grpcServer *grpc.Server) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.GRPCPort))
+	if err != nil {
+		return err
+	}
+	return grpcServer.Serve(lis)
+}
+
+// startBazelGRPC serves the REAPI cache services on the configured gRPC port
+func (s *Server) startBazelGRPC() error {
+	s.grpcServer = s.newBazelGRPCServer()
+	return ServeBazelGRPC(s.config, s.grpcServer)
+}
+
+// bazelAuthenticate validates the token carried in the "authorization" metadata entry
+func (s *Server) bazelAuthenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || values[0] == "" {
+		return nil, status.Error(codes.Unauthenticated, "authorization metadata required")
+	}
+	claims, err := s.authService.ValidateToken(values[0])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return context.WithValue(ctx, bazelClaimsKey{}, claims), nil
+}
+
+func (s *Server) bazelUnaryAuth(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.bazelAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) bazelStreamAuth(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.bazelAuthenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &bazelAuthenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// bazelAuthenticatedStream carries the authenticated context into streaming handlers
+type bazelAuthenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *bazelAuthenticatedStream) Context() context.Context {
+	return a.ctx
+}
+
+// repository resolves an instance name to a Bazel repository the caller holds the given permission on
+func (g *bazelGRPCService) repository(ctx context.Context, instanceName string, permission auth.Permission) (repository.Repository, error) {
+	if instanceName == "" {
+		return nil, status.Error(codes.InvalidArgument, "instance_name must name a Bazel repository")
+	}
+	claims, _ := ctx.Value(bazelClaimsKey{}).(*auth.Claims)
+	if claims == nil || !g.server.authService.CheckPermission(claims, instanceName, permission) {
+		return nil, status.Error(codes.PermissionDenied, "insufficient permissions")
+	}
+	repo, err := g.server.repoManager.GetRepository(instanceName)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "repository %q not found", instanceName)
+	}
+	if repo.GetArtifactType() != artifact.ArtifactTypeBazel {
+		return nil, status.Errorf(codes.InvalidArgument, "repository %q is not a Bazel repository", instanceName)
+	}
+	return repo, nil
+}
+
+// checkDigestFunction rejects requests for digest functions other than SHA-256
+func checkDigestFunction(fn repb.DigestFunction_Value) error {
+	if fn != repb.DigestFunction_UNKNOWN && fn != repb.DigestFunction_SHA256 {
+		return status.Errorf(codes.InvalidArgument, "unsupported digest function %s", fn)
+	}
+	return nil
+}
+
+// checkDigest validates the shape of a digest
+func checkDigest(d *repb.Digest) error {
+	if d == nil || !bazelSHA256Pattern.MatchString(d.GetHash()) || d.GetSizeBytes() < 0 {
+		return status.Error(codes.InvalidArgument, "malformed digest")
+	}
+	return nil
+}
+
+// GetCapabilities advertises a SHA-256, uncompressed cache without remote execution
+func (g *bazelGRPCService) GetCapabilities(ctx context.Context, req *repb.GetCapabilitiesRequest) (*repb.ServerCapabilities, error) {
+	if _, err := g.repository(ctx, req.GetInstanceName(), auth.PermissionRead); err != nil {
+		return nil, err
+	}
+	claims, _ := ctx.Value(bazelClaimsKey{}).(*auth.Claims)
+	return &repb.ServerCapabilities{
+		CacheCapabilities: &repb.CacheCapabilities{
+			DigestFunctions: []repb.DigestFunction_Value{repb.DigestFunction_SHA256},
+			ActionCacheUpdateCapabilities: &repb.ActionCacheUpdateCapabilities{
+				UpdateEnabled: g.server.authService.CheckPermission(claims, req.GetInstanceName(), auth.PermissionWrite),
+			},
+			MaxBatchTotalSizeBytes:      bazelGRPCMaxBatchSize,
+			SymlinkAbsolutePathStrategy: repb.SymlinkAbsolutePathStrategy_ALLOWED,
+		},
+		LowApiVersion:  &semver.SemVer{Major: 2},
+		HighApiVersion: &semver.SemVer{Major: 2, Minor: 3},
+	}, nil
+}
+
+// FindMissingBlobs resolves all requested digests against the CAS with a single lookup
+func (g *bazelGRPCService) FindMissingBlobs(ctx context.Context, req *repb.FindMissingBlobsRequest) (*repb.FindMissingBlobsResponse, error) {
+	repo, err := g.repository(ctx, req.GetInstanceName(), auth.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDigestFunction(req.GetDigestFunction()); err != nil {
+		return nil, err
+	}
+	for _, d := range req.GetBlobDigests() {
+		if err := checkDigest(d); err != nil {
+			return nil, err
+		}
+	}
+
+	missing, err := g.server.bazelMissingBlobs(ctx, repo.GetName(), req.GetBlobDigests())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &repb.FindMissingBlobsResponse{MissingBlobDigests: missing}, nil
+}
+
+// BatchUpdateBlobs stores small blobs after verifying each against its digest
+func (g *bazelGRPCService) BatchUpdateBlobs(ctx context.Context, req *repb.BatchUpdateBlobsRequest) (*repb.BatchUpdateBlobsResponse, error) {
+	repo, err := g.repository(ctx, req.GetInstanceName(), auth.PermissionWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDigestFunction(req.GetDigestFunction()); err != nil {
+		return nil, err
+	}
+
+	resp := &repb.BatchUpdateBlobsResponse{}
+	for _, r := range req.GetRequests() {
+		st := status.New(codes.OK, "")
+		switch {
+		case checkDigest(r.GetDigest()) != nil:
+			st = status.New(codes.InvalidArgument, "malformed digest")
+		case r.GetCompressor() != repb.Compressor_IDENTITY:
+			st = status.Newf(codes.InvalidArgument, "unsupported compressor %s", r.GetCompressor())
+		case int64(len(r.GetData())) != r.GetDigest().GetSizeBytes() || bazelDigestOf(r.GetData()) != r.GetDigest().GetHash():
+			st = status.New(codes.InvalidArgument, "digest mismatch")
+		default:
+			hash := r.GetDigest().GetHash()
+			if err := g.server.bazelPush(ctx, repo, "cas/"+hash, hash, int64(len(r.GetData())), bytes.NewReader(r.GetData())); err != nil {
+				st = status.New(bazelPushCode(err), err.Error())
+			}
+		}
+		resp.Responses = append(resp.Responses, &repb.BatchUpdateBlobsResponse_Response{
+			Digest: r.GetDigest(),
+			Status: st.Proto(),
+		})
+	}
+	return resp, nil
+}
+
+// BatchReadBlobs returns the content of small blobs, reporting missing ones per digest
+func (g *bazelGRPCService) BatchReadBlobs(ctx context.Context, req *repb.BatchReadBlobsRequest) (*repb.BatchReadBlobsResponse, error) {
+	repo, err := g.repository(ctx, req.GetInstanceName(), auth.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDigestFunction(req.GetDigestFunction()); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, d := range req.GetDigests() {
+		if err := checkDigest(d); err != nil {
+			return nil, err
+		}
+		total += d.GetSizeBytes()
+	}
+	if total > bazelGRPCMaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "batch of %d bytes exceeds the %d byte limit", total, bazelGRPCMaxBatchSize)
+	}
+
+	resp := &repb.BatchReadBlobsResponse{}
+	for _, d := range req.GetDigests() {
+		data, err := g.readBlob(ctx, repo, d)
+		st := status.New(codes.OK, "")
+		if err != nil {
+			st = status.Convert(err)
+		}
+		resp.Responses = append(resp.Responses, &repb.BatchReadBlobsResponse_Response{
+			Digest:     d,
+			Data:       data,
+			Compressor: repb.Compressor_IDENTITY,
+			Status:     st.Proto(),
+		})
+	}
+	return resp, nil
+}
+
+// readBlob reads a whole CAS blob into memory
+func (g *bazelGRPCService) readBlob(ctx context.Context, repo repository.Repository, d *repb.Digest) ([]byte, error) {
+	if d.GetHash() == bazelEmptySHA256 {
+		return nil, nil
+	}
+	reader, _, err := repo.Pull(ctx, "cas/"+d.GetHash())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "blob %s/%d not found", d.GetHash(), d.GetSizeBytes())
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if int64(len(data)) != d.GetSizeBytes() {
+		return nil, status.Errorf(codes.NotFound, "blob %s/%d not found", d.GetHash(), d.GetSizeBytes())
+	}
+	return data, nil
+}
+
+// GetActionResult returns a cached ActionResult for an action digest
+func (g *bazelGRPCService) GetActionResult(ctx context.Context, req *repb.GetActionResultRequest) (*repb.ActionResult, error) {
+	repo, err := g.repository(ctx, req.GetInstanceName(), auth.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDigestFunction(req.GetDigestFunction()); err != nil {
+		return nil, err
+	}
+	if err := checkDigest(req.GetActionDigest()); err != nil {
+		return nil, err
+	}
+
+	reader, _, err := repo.Pull(ctx, "ac/"+req.GetActionDigest().GetHash())
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "action %s not found", req.GetActionDigest().GetHash())
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, bazelMaxActionResultSize))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	result := &repb.ActionResult{}
+	if err := proto.Unmarshal(data, result); err != nil {
+		return nil, status.Errorf(codes.NotFound, "action %s has a corrupt cache entry", req.GetActionDigest().GetHash())
+	}
+	return result, nil
+}
+
+// UpdateActionResult validates and stores an ActionResult, applying the same checks as HTTP uploads
+func (g *bazelGRPCService) UpdateActionResult(ctx context.Context, req *repb.UpdateActionResultRequest) (*repb.ActionResult, error) {
+	repo, err := g.repository(ctx, req.GetInstanceName(), auth.PermissionWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDigestFunction(req.GetDigestFunction()); err != nil {
+		return nil, err
+	}
+	if err := checkDigest(req.GetActionDigest()); err != nil {
+		return nil, err
+	}
+
+	result := req.GetActionResult()
+	if result == nil {
+		return nil, status.Error(codes.InvalidArgument, "action_result is required")
+	}
+	digests, err := bazelActionResultDigests(result)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid ActionResult: %v", err)
+	}
+	if g.server.bazelRequireOutputs(ctx, repo.GetName()) {
+		missing, err := g.server.bazelMissingBlobs(ctx, repo.GetName(), digests)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if len(missing) > 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "referenced output %s/%d is missing from the CAS", missing[0].GetHash(), missing[0].GetSizeBytes())
+		}
+	}
+
+	data, err := proto.Marshal(result)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	hash := req.GetActionDigest().GetHash()
+	if err := g.server.bazelPush(ctx, repo, "ac/"+hash, hash, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return nil, status.Error(bazelPushCode(err), err.Error())
+	}
+	return result, nil
+}
+
+// bazelResource is a parsed ByteStream resource name
+type bazelResource struct {
+	instanceName string
+	hash         string
+	size         int64
+}
+
+// parseBazelResource parses "{instance}/blobs/{hash}/{size}" and
+// "{instance}/uploads/{uuid}/blobs/{hash}/{size}[/{metadata}]" resource names
+func parseBazelResource(name string, upload bool) (*bazelResource, error) {
+	parts := strings.Split(name, "/")
+	marker := "blobs"
+	if upload {
+		marker = "uploads"
+	}
+	i := 0
+	for i < len(parts) && parts[i] != marker {
+		if parts[i] == "compressed-blobs" {
+			return nil, status.Error(codes.InvalidArgument, "compressed blobs are not supported")
+		}
+		i++
+	}
+	if upload {
+		// Skip the upload UUID and expect a plain blobs segment after it
+		if i+2 >= len(parts) || parts[i+2] != "blobs" {
+			if i+2 < len(parts) && parts[i+2] == "compressed-blobs" {
+				return nil, status.Error(codes.InvalidArgument, "compressed blobs are not supported")
+			}
+			return nil, status.Errorf(codes.InvalidArgument, "malformed upload resource name %q", name)
+		}
+		parts = append(parts[:i:i], parts[i+2:]...)
+	}
+	if i+2 >= len(parts) {
+		return nil, status.Errorf(codes.InvalidArgument, "malformed resource name %q", name)
+	}
+	size, err := strconv.ParseInt(parts[i+2], 10, 64)
+	if err != nil || size < 0 || !bazelSHA256Pattern.MatchString(parts[i+1]) {
+		return nil, status.Errorf(codes.InvalidArgument, "malformed resource name %q", name)
+	}
+	return &bazelResource{
+		instanceName: strings.Join(parts[:i], "/"),
+		hash:         parts[i+1],
+		size:         size,
+	}, nil
+}
+
+// Read streams a CAS blob, honouring read_offset and read_limit
+func (g *bazelGRPCService) Read(req *bytestream.ReadRequest, stream bytestream.ByteStream_ReadServer) error {
+	ctx := stream.Context()
+	res, err := parseBazelResource(req.GetResourceName(), false)
+	if err != nil {
+		return err
+	}
+	repo, err := g.repository(ctx, res.instanceName, auth.PermissionRead)
+	if err != nil {
+		return err
+	}
+	if req.GetReadOffset() < 0 || req.GetReadOffset() > res.size || req.GetReadLimit() < 0 {
+		return status.Error(codes.OutOfRange, "read_offset or read_limit out of range")
+	}
+	if res.hash == bazelEmptySHA256 {
+		return nil
+	}
+
+	reader, _, err := repo.Pull(ctx, "cas/"+res.hash)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "blob %s/%d not found", res.hash, res.size)
+	}
+	defer reader.Close()
+
+	if _, err := io.CopyN(io.Discard, reader, req.GetReadOffset()); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	var src io.Reader = reader
+	if req.GetReadLimit() > 0 {
+		src = io.LimitReader(reader, req.GetReadLimit())
+	}
+
+	buf := make([]byte, bazelGRPCChunkSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if sendErr := stream.Send(&bytestream.ReadResponse{Data: buf[:n]}); sendErr != nil {
+				return sendErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+}
+
+// Write receives a CAS blob, verifying its digest before it reaches storage
+func (g *bazelGRPCService) Write(stream bytestream.ByteStream_WriteServer) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	res, err := parseBazelResource(first.GetResourceName(), true)
+	if err != nil {
+		return err
+	}
+	repo, err := g.repository(ctx, res.instanceName, auth.PermissionWrite)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "ganje-bazel-bytestream-*")
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	out := io.MultiWriter(tmp, hasher)
+	var written int64
+	for msg := first; ; {
+		if msg.GetWriteOffset() != written {
+			return status.Errorf(codes.InvalidArgument, "write_offset %d does not match %d bytes received", msg.GetWriteOffset(), written)
+		}
+		n, err := out.Write(msg.GetData())
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		written += int64(n)
+		if written > res.size {
+			return status.Error(codes.InvalidArgument, "upload exceeds declared size")
+		}
+		if msg.GetFinishWrite() {
+			break
+		}
+		if msg, err = stream.Recv(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return status.Error(codes.InvalidArgument, "stream closed before finish_write")
+			}
+			return err
+		}
+	}
+
+	if written != res.size || hex.EncodeToString(hasher.Sum(nil)) != res.hash {
+		return status.Error(codes.InvalidArgument, "digest mismatch")
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if err := g.server.bazelPush(ctx, repo, "cas/"+res.hash, res.hash, written, tmp); err != nil {
+		return status.Error(bazelPushCode(err), err.Error())
+	}
+	return stream.SendAndClose(&bytestream.WriteResponse{CommittedSize: written})
+}
+
+// QueryWriteStatus reports a blob as complete once it is in the CAS; partial uploads are not resumable
+func (g *bazelGRPCService) QueryWriteStatus(ctx context.Context, req *bytestream.QueryWriteStatusRequest) (*bytestream.QueryWriteStatusResponse, error) {
+	res, err := parseBazelResource(req.GetResourceName(), true)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := g.repository(ctx, res.instanceName, auth.PermissionWrite)
+	if err != nil {
+		return nil, err
+	}
+	missing, err := g.server.bazelMissingBlobs(ctx, repo.GetName(), []*repb.Digest{{Hash: res.hash, SizeBytes: res.size}})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if len(missing) > 0 {
+		return &bytestream.QueryWriteStatusResponse{}, nil
+	}
+	return &bytestream.QueryWriteStatusResponse{CommittedSize: res.size, Complete: true}, nil
+}
+
+// bazelPushCode returns the status code of a failed push; exceeded quotas are reported as
+// RESOURCE_EXHAUSTED
+func bazelPushCode(err error) codes.Code {
+	var quotaErr *repository.QuotaError
+	if errors.As(err, &quotaErr) {
+		return codes.ResourceExhausted
+	}
+	return codes.Internal
+}
+
+// bazelDigestOf returns the hex sha256 of data
+func bazelDigestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
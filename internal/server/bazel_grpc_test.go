@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/auth"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestBazelGRPCCache(t *testing.T) {
+	server, mockDB, mockRepoManager, mockAuthService := createTestServer()
+
+	mockAuthService.On("ValidateToken", "Bearer valid-token").Return(&auth.Claims{Username: "builder"}, nil)
+	mockAuthService.On("ValidateToken", mock.Anything).Return(nil, assert.AnError)
+	mockAuthService.On("CheckPermission", mock.AnythingOfType("*auth.Claims"), "bazel-cache", mock.Anything).Return(true)
+
+	mockRepo := &MockRepository{name: "bazel-cache", repoType: "local", artifactType: "bazel"}
+	mockRepo.On("GetName").Return("bazel-cache")
+	mockRepo.On("GetType").Return(repository.Local)
+	mockRepo.On("GetArtifactType").Return(artifact.ArtifactTypeBazel)
+	mockRepoManager.On("GetRepository", "bazel-cache").Return(mockRepo, nil)
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := server.newBazelGRPCServer()
+	go func() { _ = grpcServer.Serve(lis) }()
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer valid-token")
+	cas := repb.NewContentAddressableStorageClient(conn)
+	bs := bytestream.NewByteStreamClient(conn)
+
+	blob := []byte("hello bazel over grpc")
+	blobDigest := &repb.Digest{Hash: bazelDigestOf(blob), SizeBytes: int64(len(blob))}
+	otherDigest := &repb.Digest{Hash: bazelDigestOf([]byte("other")), SizeBytes: 5}
+
+	t.Run("Rejects calls without a token", func(t *testing.T) {
+		_, err := cas.FindMissingBlobs(context.Background(), &repb.FindMissingBlobsRequest{InstanceName: "bazel-cache"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("Capabilities advertise sha256", func(t *testing.T) {
+		caps, err := repb.NewCapabilitiesClient(conn).GetCapabilities(ctx, &repb.GetCapabilitiesRequest{InstanceName: "bazel-cache"})
+		require.NoError(t, err)
+		assert.Equal(t, []repb.DigestFunction_Value{repb.DigestFunction_SHA256}, caps.GetCacheCapabilities().GetDigestFunctions())
+		assert.True(t, caps.GetCacheCapabilities().GetActionCacheUpdateCapabilities().GetUpdateEnabled())
+	})
+
+	t.Run("FindMissingBlobs uses one batched lookup", func(t *testing.T) {
+		mockDB.On("GetArtifactsByPaths", mock.Anything, "bazel-cache", []string{"cas/" + blobDigest.Hash, "cas/" + otherDigest.Hash}).
+			Return([]*database.ArtifactInfo{{Path: "cas/" + blobDigest.Hash, Size: blobDigest.SizeBytes}}, nil).Once()
+
+		resp, err := cas.FindMissingBlobs(ctx, &repb.FindMissingBlobsRequest{
+			InstanceName: "bazel-cache",
+			BlobDigests:  []*repb.Digest{blobDigest, otherDigest, {Hash: bazelEmptySHA256}},
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.GetMissingBlobDigests(), 1)
+		assert.Equal(t, otherDigest.Hash, resp.GetMissingBlobDigests()[0].GetHash())
+	})
+
+	t.Run("BatchUpdateBlobs verifies digests", func(t *testing.T) {
+		mockRepo.On("Push", mock.Anything, "cas/"+blobDigest.Hash, mock.Anything, mock.AnythingOfType("*artifact.Metadata")).Return(nil).Once()
+
+		resp, err := cas.BatchUpdateBlobs(ctx, &repb.BatchUpdateBlobsRequest{
+			InstanceName: "bazel-cache",
+			Requests: []*repb.BatchUpdateBlobsRequest_Request{
+				{Digest: blobDigest, Data: blob},
+				{Digest: otherDigest, Data: []byte("wrong")},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, resp.GetResponses(), 2)
+		assert.Equal(t, int32(codes.OK), resp.GetResponses()[0].GetStatus().GetCode())
+		assert.Equal(t, int32(codes.InvalidArgument), resp.GetResponses()[1].GetStatus().GetCode())
+	})
+
+	t.Run("ByteStream write then read", func(t *testing.T) {
+		var stored bytes.Buffer
+		mockRepo.On("Push", mock.Anything, "cas/"+blobDigest.Hash, mock.Anything, mock.AnythingOfType("*artifact.Metadata")).
+			Run(func(args mock.Arguments) { _, _ = io.Copy(&stored, args.Get(2).(io.Reader)) }).Return(nil).Once()
+
+		stream, err := bs.Write(ctx)
+		require.NoError(t, err)
+		resource := "bazel-cache/uploads/1b4e28ba-2fa1-11d2-883f-0016d3cca427/blobs/" + blobDigest.Hash + "/21"
+		require.NoError(t, stream.Send(&bytestream.WriteRequest{ResourceName: resource, Data: blob[:10]}))
+		require.NoError(t, stream.Send(&bytestream.WriteRequest{WriteOffset: 10, Data: blob[10:], FinishWrite: true}))
+		wresp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(blob)), wresp.GetCommittedSize())
+		assert.Equal(t, blob, stored.Bytes())
+
+		mockRepo.On("Pull", mock.Anything, "cas/"+blobDigest.Hash).Return(io.NopCloser(bytes.NewReader(blob)), &artifact.Metadata{}, nil).Once()
+		rstream, err := bs.Read(ctx, &bytestream.ReadRequest{ResourceName: "bazel-cache/blobs/" + blobDigest.Hash + "/21", ReadOffset: 6})
+		require.NoError(t, err)
+		var got bytes.Buffer
+		for {
+			msg, err := rstream.Recv()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			got.Write(msg.GetData())
+		}
+		assert.Equal(t, "bazel over grpc", got.String())
+	})
+
+	t.Run("ByteStream write with mismatching content is rejected", func(t *testing.T) {
+		stream, err := bs.Write(ctx)
+		require.NoError(t, err)
+		resource := "bazel-cache/uploads/uuid/blobs/" + otherDigest.Hash + "/5"
+		require.NoError(t, stream.Send(&bytestream.WriteRequest{ResourceName: resource, Data: []byte("wrong"), FinishWrite: true}))
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("UpdateActionResult validates outputs", func(t *testing.T) {
+		ac := repb.NewActionCacheClient(conn)
+		actionDigest := &repb.Digest{Hash: bazelDigestOf([]byte("action")), SizeBytes: 6}
+
+		_, err := ac.UpdateActionResult(ctx, &repb.UpdateActionResultRequest{
+			InstanceName: "bazel-cache",
+			ActionDigest: actionDigest,
+			ActionResult: &repb.ActionResult{OutputFiles: []*repb.OutputFile{{Path: "out", Digest: &repb.Digest{Hash: "bad"}}}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		mockDB.On("GetRepository", mock.Anything, "bazel-cache").Return(&database.Repository{Name: "bazel-cache"}, nil)
+		mockRepo.On("Push", mock.Anything, "ac/"+actionDigest.Hash, mock.Anything, mock.AnythingOfType("*artifact.Metadata")).Return(nil).Once()
+		_, err = ac.UpdateActionResult(ctx, &repb.UpdateActionResultRequest{
+			InstanceName: "bazel-cache",
+			ActionDigest: actionDigest,
+			ActionResult: &repb.ActionResult{OutputFiles: []*repb.OutputFile{{Path: "out", Digest: blobDigest}}},
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func TestParseBazelResource(t *testing.T) {
+	hash := bazelEmptySHA256
+
+	res, err := parseBazelResource("team/cache/blobs/"+hash+"/0", false)
+	require.NoError(t, err)
+	assert.Equal(t, "team/cache", res.instanceName)
+	assert.Equal(t, hash, res.hash)
+
+	res, err = parseBazelResource("cache/uploads/uuid/blobs/"+hash+"/12/extra", true)
+	require.NoError(t, err)
+	assert.Equal(t, "cache", res.instanceName)
+	assert.Equal(t, int64(12), res.size)
+
+	_, err = parseBazelResource("cache/uploads/uuid/compressed-blobs/zstd/"+hash+"/12", true)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = parseBazelResource("cache/blobs/nothex/12", false)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
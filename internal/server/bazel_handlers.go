@@ -0,0 +1,294 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"google.golang.org/protobuf/proto"
+)
+
+// bazelMaxActionResultSize bounds the size of an action cache entry accepted on upload
+const bazelMaxActionResultSize = 16 << 20
+
+// bazelEmptySHA256 is the digest of the empty blob, which is implicitly present in every CAS
+const bazelEmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+var bazelSHA256Pattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// bazelCacheKey splits a Bazel cache request path into its namespace (ac or cas) and key
+func bazelCacheKey(c *gin.Context) (kind, key, storagePath string) {
+	trimmed := strings.TrimPrefix(c.Request.URL.Path, "/"+repositoryNameFromPath(c)+"/")
+	kind, key, _ = strings.Cut(trimmed, "/")
+	return kind, key, trimmed
+}
+
+// bazelHead answers existence checks (HEAD /ac/<key>, HEAD /cas/<hash>) without streaming content
+func (s *Server) bazelHead(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	if _, err := s.repoManager.GetRepository(repositoryName); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	kind, key, storagePath := bazelCacheKey(c)
+	if kind == "cas" && key == bazelEmptySHA256 {
+		c.Header("Content-Length", "0")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	info, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath)
+	if err != nil || info == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Status(http.StatusOK)
+}
+
+// bazelGetCAS serves a CAS blob; like HEAD it answers for the empty blob without a stored copy
+func (s *Server) bazelGetCAS(c *gin.Context) {
+	if _, key, _ := bazelCacheKey(c); key == bazelEmptySHA256 {
+		if _, err := s.repoManager.GetRepository(repositoryNameFromPath(c)); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+			return
+		}
+		c.Data(http.StatusOK, "application/octet-stream", nil)
+		return
+	}
+	s.pullArtifact(c)
+}
+
+// bazelPutCAS stores a CAS blob after verifying that its content hashes to the key in the path
+func (s *Server) bazelPutCAS(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	_, hash, storagePath := bazelCacheKey(c)
+	if !bazelSHA256Pattern.MatchString(hash) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CAS key must be a lowercase hex sha256 digest"})
+		return
+	}
+
+	// Spool to disk while hashing so a mismatching blob never reaches storage
+	tmp, err := os.CreateTemp("", "ganje-bazel-cas-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != hash {
+		s.logAccess(c, repositoryName, storagePath, "push", false, "digest mismatch")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("digest mismatch: path declares %s but content hashes to %s", hash, actual)})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.bazelStore(c, repo, storagePath, hash, size, tmp)
+}
+
+// bazelPutAC stores an action cache entry after validating it as an ActionResult
+func (s *Server) bazelPutAC(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	_, key, storagePath := bazelCacheKey(c)
+	if !bazelSHA256Pattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "AC key must be a lowercase hex sha256 digest"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, bazelMaxActionResultSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(body) > bazelMaxActionResultSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "action result too large"})
+		return
+	}
+
+	result := &repb.ActionResult{}
+	if err := proto.Unmarshal(body, result); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ActionResult: %v", err)})
+		return
+	}
+	digests, err := bazelActionResultDigests(result)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid ActionResult: %v", err)})
+		return
+	}
+
+	// Optionally refuse entries whose outputs are not in the CAS, so clients never get a poisoned hit
+	if s.bazelRequireOutputs(c.Request.Context(), repositoryName) {
+		missing, err := s.bazelMissingBlobs(c.Request.Context(), repositoryName, digests)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("referenced output %s/%d is missing from the CAS", missing[0].GetHash(), missing[0].GetSizeBytes())})
+			return
+		}
+	}
+
+	s.bazelStore(c, repo, storagePath, key, int64(len(body)), bytes.NewReader(body))
+}
+
+// bazelStore pushes a verified cache entry and reports the outcome
+func (s *Server) bazelStore(c *gin.Context, repo repository.Repository, storagePath, key string, size int64, content io.Reader) {
+	if err := s.bazelPush(c.Request.Context(), repo, storagePath, key, size, content); err != nil {
+		s.logAccess(c, repo.GetName(), storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repo.GetName(), storagePath, "push", true, "")
+	c.Status(http.StatusOK)
+}
+
+// bazelPush writes a verified AC or CAS entry to the repository and announces it
+func (s *Server) bazelPush(ctx context.Context, repo repository.Repository, storagePath, key string, size int64, content io.Reader) error {
+	err := repo.Push(ctx, storagePath, content, &artifact.Metadata{
+		Name:    key,
+		Version: strings.SplitN(storagePath, "/", 2)[0],
+		Size:    size,
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repo.GetName(),
+			Path:       storagePath,
+			Name:       key,
+			Timestamp:  time.Now(),
+		})
+	}
+	return nil
+}
+
+// bazelRequireOutputs reports whether a repository refuses AC entries with outputs absent from its CAS
+func (s *Server) bazelRequireOutputs(ctx context.Context, repositoryName string) bool {
+	opts, err := s.getRepositoryOptionsMap(ctx, repositoryName)
+	return err == nil && opts["bazel_ac_require_outputs"] == "true"
+}
+
+// bazelMissingBlobs returns the digests that are not present, at the declared size, in the repository's CAS
+func (s *Server) bazelMissingBlobs(ctx context.Context, repositoryName string, digests []*repb.Digest) ([]*repb.Digest, error) {
+	paths := make([]string, 0, len(digests))
+	for _, d := range digests {
+		if d.GetHash() != bazelEmptySHA256 {
+			paths = append(paths, "cas/"+d.GetHash())
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	found, err := s.db.GetArtifactsByPaths(ctx, repositoryName, paths)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(found))
+	for _, a := range found {
+		sizes[a.Path] = a.Size
+	}
+
+	var missing []*repb.Digest
+	for _, d := range digests {
+		if d.GetHash() == bazelEmptySHA256 {
+			continue
+		}
+		if size, ok := sizes["cas/"+d.GetHash()]; !ok || size != d.GetSizeBytes() {
+			missing = append(missing, d)
+		}
+	}
+	return missing, nil
+}
+
+// bazelActionResultDigests validates the digests an ActionResult references and returns them
+func bazelActionResultDigests(result *repb.ActionResult) ([]*repb.Digest, error) {
+	var digests []*repb.Digest
+	add := func(what string, d *repb.Digest, required bool) error {
+		if d == nil {
+			if required {
+				return fmt.Errorf("%s has no digest", what)
+			}
+			return nil
+		}
+		if !bazelSHA256Pattern.MatchString(d.GetHash()) {
+			return fmt.Errorf("%s has malformed digest %q", what, d.GetHash())
+		}
+		if d.GetSizeBytes() < 0 {
+			return fmt.Errorf("%s has negative size", what)
+		}
+		digests = append(digests, d)
+		return nil
+	}
+
+	for _, f := range result.GetOutputFiles() {
+		if f.GetPath() == "" {
+			return nil, fmt.Errorf("output file without path")
+		}
+		if err := add("output file "+f.GetPath(), f.GetDigest(), true); err != nil {
+			return nil, err
+		}
+	}
+	for _, d := range result.GetOutputDirectories() {
+		if d.GetPath() == "" {
+			return nil, fmt.Errorf("output directory without path")
+		}
+		if err := add("output directory "+d.GetPath(), d.GetTreeDigest(), true); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range result.GetOutputSymlinks() {
+		if l.GetPath() == "" || l.GetTarget() == "" {
+			return nil, fmt.Errorf("output symlink without path or target")
+		}
+	}
+	if err := add("stdout", result.GetStdoutDigest(), false); err != nil {
+		return nil, err
+	}
+	if err := add("stderr", result.GetStderrDigest(), false); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
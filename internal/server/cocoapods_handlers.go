@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// cocoapodsRootFile serves GET /:file: CocoaPods-version.yml and the shard and pod list files
+// regenerated on every push and delete
+func (s *Server) cocoapodsRootFile(c *gin.Context) {
+	file := c.Param("file")
+	if file == types.CocoaPodsVersionFile {
+		c.Data(http.StatusOK, "text/yaml", types.CocoaPodsVersionYAML())
+		return
+	}
+	if !types.IsCocoaPodsIndexFile(file) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	repo, err := s.repoManager.GetRepository(repositoryNameFromPath(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+	index, err := repo.GetIndex(c.Request.Context(), file)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer index.Close()
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	storage.ServeContent(c.Writer, c.Request, index, 0, "", time.Time{})
+}
+
+// cocoapodsServe streams a stored podspec or source archive
+func (s *Server) cocoapodsServe(c *gin.Context, storagePath, contentType string) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", contentType)
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// cocoapodsSpec serves GET /Specs/:a/:b/:c/:pod/:version/:file, a podspec at its sharded path
+func (s *Server) cocoapodsSpec(c *gin.Context) {
+	storagePath := strings.TrimPrefix(c.Request.URL.Path, "/"+repositoryNameFromPath(c)+"/")
+	if _, err := types.NewCocoaPodsArtifact(nil).ParsePath(storagePath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	s.cocoapodsServe(c, storagePath, "application/json")
+}
+
+// cocoapodsSource serves GET /sources/:pod/:version/:file, a source archive referenced by a podspec
+func (s *Server) cocoapodsSource(c *gin.Context) {
+	pod, version, file := c.Param("pod"), c.Param("version"), c.Param("file")
+	if !types.ValidCocoaPodsName(pod) || !types.ValidCocoaPodsVersion(version) || !types.ValidCocoaPodsSourceFile(file) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	s.cocoapodsServe(c, types.CocoaPodsSourcePath(pod, version, file), "application/octet-stream")
+}
+
+// cocoapodsPush accepts POST /api/pods with a .podspec.json as the raw body, or as the multipart
+// "podspec" part optionally followed by a "source" archive. An uploaded source archive is hosted
+// in the repository and replaces the podspec's source.
+func (s *Server) cocoapodsPush(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	var podspec []byte
+	multipartUpload := strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data")
+	if multipartUpload {
+		file, _, err := c.Request.FormFile("podspec")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "podspec is required"})
+			return
+		}
+		podspec, err = io.ReadAll(io.LimitReader(file, 1<<20))
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if podspec, err = io.ReadAll(io.LimitReader(c.Request.Body, 1<<20)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	spec, err := types.ParsePodspec(podspec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	specPath := types.CocoaPodsSpecPath(spec.Name, spec.Version)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, specPath); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s %s is already published", spec.Name, spec.Version)})
+		return
+	}
+
+	var sourcePath string
+	if multipartUpload {
+		if file, header, err := c.Request.FormFile("source"); err == nil {
+			defer file.Close()
+			name := path.Base(header.Filename)
+			if !types.ValidCocoaPodsSourceFile(name) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported source archive %q", header.Filename)})
+				return
+			}
+			sourcePath = types.CocoaPodsSourcePath(spec.Name, spec.Version, name)
+			checksum, err := s.cocoapodsPushSource(c, repo, sourcePath, spec, file)
+			if err != nil {
+				c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+				return
+			}
+			url := requestBaseURL(c) + "/" + repositoryName + "/" + sourcePath
+			if podspec, err = types.SetPodspecSource(podspec, url, checksum); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	sum := sha256.Sum256(podspec)
+	if err := repo.Push(c.Request.Context(), specPath, bytes.NewReader(podspec), &artifact.Metadata{
+		Name:       spec.Name,
+		Version:    spec.Version,
+		Size:       int64(len(podspec)),
+		Checksum:   hex.EncodeToString(sum[:]),
+		Properties: spec.Properties(),
+	}); err != nil {
+		s.logAccess(c, repositoryName, specPath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, specPath, "push", true, "")
+
+	// A failed rebuild stays pending and is retried by the next push, delete or reindex
+	_ = repo.RebuildIndex(c.Request.Context())
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       specPath,
+			Name:       spec.Name,
+			Version:    spec.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	resp := gin.H{
+		"name":     spec.Name,
+		"version":  spec.Version,
+		"location": specPath,
+	}
+	if sourcePath != "" {
+		resp["source"] = sourcePath
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// cocoapodsPushSource spools a source archive to disk while hashing it, stores it and returns its SHA-256
+func (s *Server) cocoapodsPushSource(c *gin.Context, repo repository.Repository, storagePath string, spec *types.CocoaPodsSpec, content io.Reader) (string, error) {
+	repositoryName := repositoryNameFromPath(c)
+	tmp, err := os.CreateTemp("", "ganje-cocoapods-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), content)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	checksum := hex.EncodeToString(sum.Sum(nil))
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:       spec.Name,
+		Version:    spec.Version,
+		Size:       size,
+		Checksum:   checksum,
+		Properties: map[string]string{"type": "cocoapods-source", "name": spec.Name, "version": spec.Version},
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		return "", err
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+	return checksum, nil
+}
+
+// cocoapodsDelete serves DELETE /api/pods/:pod/:version, removing the podspec and any source
+// archives of the version; its shard is regenerated without it
+func (s *Server) cocoapodsDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	pod, version := c.Param("pod"), c.Param("version")
+	all, err := s.db.GetArtifactsByRepository(c.Request.Context(), repositoryName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var paths []string
+	for _, a := range all {
+		if a.Type == string(artifact.ArtifactTypeCocoaPods) && a.Name == pod && a.Version == version {
+			paths = append(paths, a.Path)
+		}
+	}
+	if len(paths) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s %s not found", pod, version)})
+		return
+	}
+
+	for _, storagePath := range paths {
+		if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+			s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+
+		if s.publisher != nil {
+			_ = s.publisher.Publish(messaging.Event{
+				Type:       messaging.EventRemove,
+				Repository: repositoryName,
+				Path:       storagePath,
+				Timestamp:  time.Now(),
+			})
+		}
+	}
+	_ = repo.RebuildIndex(c.Request.Context())
+
+	c.JSON(http.StatusOK, gin.H{"message": "Artifact deleted successfully"})
+}
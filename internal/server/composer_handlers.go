@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// composerPackages returns the published versions of a repository grouped by package name
+func (s *Server) composerPackages(ctx context.Context, repositoryName string) (map[string][]*types.ComposerPackage, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	packages := map[string][]*types.ComposerPackage{}
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypeComposer) {
+			continue
+		}
+		pkg, err := types.ComposerPackageFromMetadata(artifactProperties(a))
+		if err != nil {
+			continue
+		}
+		packages[pkg.Name] = append(packages[pkg.Name], pkg)
+	}
+	return packages, nil
+}
+
+// composerPackagesJSON serves GET /packages.json, the Composer v2 repository root
+func (s *Server) composerPackagesJSON(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	packages, err := s.composerPackages(c.Request.Context(), repositoryName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.JSON(http.StatusOK, gin.H{
+		"packages":           []string{},
+		"metadata-url":       "/" + repositoryName + "/p2/%package%.json",
+		"available-packages": names,
+	})
+}
+
+// composerMetadata serves GET /p2/:vendor/:file: the tagged versions of a package from
+// <package>.json and its branch versions from <package>~dev.json
+func (s *Server) composerMetadata(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	file := c.Param("file")
+	if !strings.HasSuffix(file, ".json") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	base := strings.TrimSuffix(file, ".json")
+	dev := strings.HasSuffix(base, "~dev")
+	name := c.Param("vendor") + "/" + strings.TrimSuffix(base, "~dev")
+
+	packages, err := s.composerPackages(c.Request.Context(), repositoryName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	versions, ok := packages[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Package not found"})
+		return
+	}
+
+	var selected []*types.ComposerPackage
+	for _, pkg := range versions {
+		if types.IsComposerDevVersion(pkg.Version) == dev {
+			selected = append(selected, pkg)
+		}
+	}
+	baseURL := requestBaseURL(c) + "/" + repositoryName + "/"
+	metadata, err := types.GenerateComposerMetadata(name, selected, func(p *types.ComposerPackage) string {
+		return baseURL + types.ComposerDistPath(p.Name, p.Version)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", metadata)
+}
+
+// composerDistParamPath returns the storage path addressed by /dists/:vendor/:package/:version/:file
+func composerDistParamPath(c *gin.Context) string {
+	return fmt.Sprintf("dists/%s/%s/%s/%s", c.Param("vendor"), c.Param("package"), c.Param("version"), c.Param("file"))
+}
+
+// composerDist serves GET /dists/:vendor/:package/:version/:file, a dist archive
+func (s *Server) composerDist(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := composerDistParamPath(c)
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", "application/zip")
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// composerUpload accepts POST /api/packages with a zip archive as the raw body or a multipart "file".
+// The version comes from composer.json or, when it declares none, the "version" query or form field.
+func (s *Server) composerUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	version := c.Query("version")
+	if strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+		if v := c.Request.FormValue("version"); v != "" {
+			version = v
+		}
+	}
+
+	// Spool to disk while computing the dist shasum Composer verifies
+	tmp, err := os.CreateTemp("", "ganje-composer-*.zip")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sha1sum, sha256sum := sha1.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sha1sum, sha256sum), body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pkg, err := types.ReadComposerPackage(tmp, size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch {
+	case pkg.Version == "" && version == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version is required when composer.json does not declare one"})
+		return
+	case pkg.Version == "":
+		if err := pkg.SetVersion(version); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	case version != "" && version != pkg.Version:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("version %s does not match composer.json version %s", version, pkg.Version)})
+		return
+	}
+	pkg.Shasum = hex.EncodeToString(sha1sum.Sum(nil))
+	pkg.Time = time.Now().UTC().Format(time.RFC3339)
+
+	storagePath := types.ComposerDistPath(pkg.Name, pkg.Version)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s %s is already published", pkg.Name, pkg.Version)})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+		Description: pkg.Description,
+		Size:        size,
+		Checksum:    hex.EncodeToString(sha256sum.Sum(nil)),
+		Properties:  pkg.Metadata(),
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"name":     pkg.Name,
+		"version":  pkg.Version,
+		"location": storagePath,
+		"shasum":   pkg.Shasum,
+	})
+}
+
+// composerDelete removes a dist archive; the version disappears from the package metadata with it
+func (s *Server) composerDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := composerDistParamPath(c)
+	if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Artifact deleted successfully"})
+}
@@ -0,0 +1,485 @@
+package server
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/auth"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// conanParams validates the reference and revisions addressed by a /v2/conans route. The
+// recipe revision, package ID and package revision are empty when the route has none.
+func conanParams(c *gin.Context) (ref types.ConanReference, rrev, pkgID, prev string, ok bool) {
+	ref = types.NewConanReference(c.Param("name"), c.Param("version"), c.Param("user"), c.Param("channel"))
+	if !ref.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recipe reference"})
+		return ref, "", "", "", false
+	}
+	rrev, pkgID, prev = c.Param("rrev"), c.Param("package_id"), c.Param("prev")
+	for _, v := range []string{rrev, pkgID, prev} {
+		if v != "" && !types.ValidConanRevision(v) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision: " + v})
+			return ref, "", "", "", false
+		}
+	}
+	return ref, rrev, pkgID, prev, true
+}
+
+// conanRevisionDir returns the storage directory of a recipe revision, or of a package revision when pkgID is set
+func conanRevisionDir(ref types.ConanReference, rrev, pkgID, prev string) string {
+	if pkgID != "" {
+		return types.ConanPackageRevisionPath(ref, rrev, pkgID, prev)
+	}
+	return types.ConanRecipeRevisionPath(ref, rrev)
+}
+
+// conanRevisionJSON renders a revision the way the revision endpoints return it
+func conanRevisionJSON(rev *database.ConanRevision) gin.H {
+	revision := rev.RecipeRevision
+	if rev.PackageID != "" {
+		revision = rev.PackageRevision
+	}
+	return gin.H{"revision": revision, "time": rev.UpdatedAt.UTC().Format(time.RFC3339)}
+}
+
+// conanFiles returns the stored files below a storage directory
+func (s *Server) conanFiles(ctx context.Context, repositoryName, dir string) ([]*database.ArtifactInfo, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	var files []*database.ArtifactInfo
+	for _, a := range all {
+		if a.Type == string(artifact.ArtifactTypeConan) && strings.HasPrefix(a.Path, dir+"/") {
+			files = append(files, a)
+		}
+	}
+	return files, nil
+}
+
+// conanPing serves GET /v1/ping. Clients require the revisions capability before using the v2 API
+// and read it before authenticating, so the route is public.
+func (s *Server) conanPing(c *gin.Context) {
+	c.Header("X-Conan-Server-Capabilities", "revisions")
+	c.Status(http.StatusOK)
+}
+
+// conanAuthenticate serves GET /v2/users/authenticate. Clients log in with HTTP basic auth using a
+// Ganje token as the password, and get the same token back to send as a bearer token.
+func (s *Server) conanAuthenticate(c *gin.Context) {
+	_, token, ok := c.Request.BasicAuth()
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="ganje"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Basic authentication required"})
+		return
+	}
+	if _, err := s.authService.ValidateToken(token); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+// conanCheckCredentials serves GET /v2/users/check_credentials, answering with the authenticated user name
+func (s *Server) conanCheckCredentials(c *gin.Context) {
+	authCtx, _ := c.Get("auth_context")
+	c.String(http.StatusOK, authCtx.(*auth.AuthContext).Username)
+}
+
+// conanSearch serves GET /v2/conans/search?q=<pattern>, matching recipe references case-insensitively
+// unless ignorecase=False
+func (s *Server) conanSearch(c *gin.Context) {
+	pattern := c.DefaultQuery("q", "*")
+	ignoreCase := !strings.EqualFold(c.Query("ignorecase"), "false")
+
+	revs, err := s.db.ListConanRevisions(c.Request.Context(), repositoryNameFromPath(c), "", "", "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	seen := map[string]bool{}
+	results := []string{}
+	for _, rev := range revs {
+		if !seen[rev.Reference] && types.MatchConanPattern(pattern, rev.Reference, ignoreCase) {
+			seen[rev.Reference] = true
+			results = append(results, rev.Reference)
+		}
+	}
+	sort.Strings(results)
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// conanLatest serves the latest recipe revision, or the latest package revision on a package route
+func (s *Server) conanLatest(c *gin.Context) {
+	ref, rrev, pkgID, _, ok := conanParams(c)
+	if !ok {
+		return
+	}
+	rev, err := s.db.GetLatestConanRevision(c.Request.Context(), repositoryNameFromPath(c), ref.String(), rrev, pkgID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe or package not found"})
+		return
+	}
+	c.JSON(http.StatusOK, conanRevisionJSON(rev))
+}
+
+// conanRevisions lists the revisions of a recipe, or of a package on a package route, newest first
+func (s *Server) conanRevisions(c *gin.Context) {
+	ref, rrev, pkgID, _, ok := conanParams(c)
+	if !ok {
+		return
+	}
+	revs, err := s.db.ListConanRevisions(c.Request.Context(), repositoryNameFromPath(c), ref.String(), rrev, pkgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(revs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe or package not found"})
+		return
+	}
+
+	reference := ref.String()
+	if pkgID != "" {
+		reference = fmt.Sprintf("%s#%s:%s", reference, rrev, pkgID)
+	}
+	revisions := make([]gin.H, 0, len(revs))
+	for _, rev := range revs {
+		revisions = append(revisions, conanRevisionJSON(rev))
+	}
+	c.JSON(http.StatusOK, gin.H{"reference": reference, "revisions": revisions})
+}
+
+// conanFileList serves the file listing of a recipe or package revision
+func (s *Server) conanFileList(c *gin.Context) {
+	ref, rrev, pkgID, prev, ok := conanParams(c)
+	if !ok {
+		return
+	}
+	dir := conanRevisionDir(ref, rrev, pkgID, prev)
+	files, err := s.conanFiles(c.Request.Context(), repositoryNameFromPath(c), dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+	listing := gin.H{}
+	for _, f := range files {
+		listing[strings.TrimPrefix(f.Path, dir+"/")] = gin.H{}
+	}
+	c.JSON(http.StatusOK, gin.H{"files": listing})
+}
+
+// conanDownload serves a single file of a recipe or package revision
+func (s *Server) conanDownload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+	ref, rrev, pkgID, prev, ok := conanParams(c)
+	if !ok {
+		return
+	}
+
+	storagePath := conanRevisionDir(ref, rrev, pkgID, prev) + "/" + c.Param("file")
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", "application/octet-stream")
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// conanUpload accepts PUT of a recipe or package file and records its revision as the latest.
+// Package files are only accepted for a recipe revision that was uploaded before.
+func (s *Server) conanUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+	ref, rrev, pkgID, prev, ok := conanParams(c)
+	if !ok {
+		return
+	}
+	file := c.Param("file")
+	if !types.ValidConanFileName(file) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file name"})
+		return
+	}
+
+	// Checksum deploys would need a content index to copy from; answering 404 makes the client send the file
+	if strings.EqualFold(c.GetHeader("X-Checksum-Deploy"), "true") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "checksum deploy is not supported"})
+		return
+	}
+
+	if pkgID != "" {
+		revs, err := s.db.ListConanRevisions(c.Request.Context(), repositoryName, ref.String(), "", "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		found := false
+		for _, rev := range revs {
+			found = found || rev.RecipeRevision == rrev
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("recipe revision %s#%s not found", ref, rrev)})
+			return
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "ganje-conan-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sha1sum, sha256sum := sha1.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sha1sum, sha256sum), c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	digest := hex.EncodeToString(sha1sum.Sum(nil))
+	if want := c.GetHeader("X-Checksum-Sha1"); want != "" && !strings.EqualFold(want, digest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "checksum mismatch"})
+		return
+	}
+
+	storagePath := conanRevisionDir(ref, rrev, pkgID, prev) + "/" + file
+	props := map[string]string{
+		"path":            storagePath,
+		"reference":       ref.String(),
+		"recipe_revision": rrev,
+		"file":            file,
+		"sha1":            digest,
+	}
+	if pkgID != "" {
+		props["package_id"] = pkgID
+		props["package_revision"] = prev
+	}
+	if pkgID != "" && file == types.ConanInfoFile {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data, _ := io.ReadAll(tmp)
+		info, err := types.ParseConanInfo(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		encoded, _ := json.Marshal(info)
+		props["conaninfo"] = string(encoded)
+	}
+
+	// A revision is a content hash, so uploading it again carries the same files; replace them
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:       ref.Name,
+		Version:    ref.Version,
+		Size:       size,
+		Checksum:   hex.EncodeToString(sha256sum.Sum(nil)),
+		Properties: props,
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.db.SaveConanRevision(c.Request.Context(), repositoryName, &database.ConanRevision{
+		Reference:       ref.String(),
+		RecipeRevision:  rrev,
+		PackageID:       pkgID,
+		PackageRevision: prev,
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       ref.Name,
+			Version:    ref.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.Status(http.StatusCreated)
+}
+
+// conanSearchPackages serves the package search of a recipe revision, or of the latest one when the
+// route names none: the settings, options and requirements of each package's latest revision
+func (s *Server) conanSearchPackages(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	ref, rrev, _, _, ok := conanParams(c)
+	if !ok {
+		return
+	}
+	if rrev == "" {
+		latest, err := s.db.GetLatestConanRevision(c.Request.Context(), repositoryName, ref.String(), "", "")
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
+			return
+		}
+		rrev = latest.RecipeRevision
+	}
+
+	revs, err := s.db.ListConanRevisions(c.Request.Context(), repositoryName, ref.String(), rrev, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	latestRevision := map[string]string{}
+	for _, rev := range revs {
+		if rev.Latest {
+			latestRevision[rev.PackageID] = rev.PackageRevision
+		}
+	}
+
+	files, err := s.conanFiles(c.Request.Context(), repositoryName, ref.Path()+"/"+rrev+"/package")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	packages := map[string]*types.ConanPackageInfo{}
+	for _, f := range files {
+		props := artifactProperties(f)
+		if props["file"] != types.ConanInfoFile || latestRevision[props["package_id"]] != props["package_revision"] {
+			continue
+		}
+		var info types.ConanPackageInfo
+		if err := json.Unmarshal([]byte(props["conaninfo"]), &info); err == nil {
+			packages[props["package_id"]] = &info
+		}
+	}
+	c.JSON(http.StatusOK, packages)
+}
+
+// conanDelete removes what a DELETE route addresses: a whole recipe, a recipe revision with its
+// packages, all packages of a recipe revision, or a single package revision
+func (s *Server) conanDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+	ref, rrev, pkgID, prev, ok := conanParams(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	var dir string
+	var revisions [][2]string // package ID and package revision pairs removed from the database
+	switch {
+	case pkgID != "":
+		dir = conanRevisionDir(ref, rrev, pkgID, prev)
+		revisions = append(revisions, [2]string{pkgID, prev})
+	case strings.HasSuffix(c.FullPath(), "/packages"):
+		dir = ref.Path() + "/" + rrev + "/package"
+		revs, err := s.db.ListConanRevisions(ctx, repositoryName, ref.String(), rrev, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		seen := map[string]bool{}
+		for _, rev := range revs {
+			if !seen[rev.PackageID] {
+				seen[rev.PackageID] = true
+				revisions = append(revisions, [2]string{rev.PackageID, ""})
+			}
+		}
+	case rrev != "":
+		dir = ref.Path() + "/" + rrev
+		revisions = append(revisions, [2]string{"", ""})
+	default:
+		dir = ref.Path()
+		revisions = append(revisions, [2]string{"", ""})
+	}
+
+	files, err := s.conanFiles(ctx, repositoryName, dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe or package not found"})
+		return
+	}
+	for _, f := range files {
+		if err := repo.Delete(ctx, f.Path); err != nil {
+			s.logAccess(c, repositoryName, f.Path, "delete", false, err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		s.logAccess(c, repositoryName, f.Path, "delete", true, "")
+	}
+	for _, r := range revisions {
+		if err := s.db.DeleteConanRevisions(ctx, repositoryName, ref.String(), rrev, r[0], r[1]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       dir,
+			Name:       ref.Name,
+			Version:    ref.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.Status(http.StatusOK)
+}
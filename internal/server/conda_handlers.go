@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// condaRepodata renders repodata.json (or current_repodata.json) of a subdir from the
+// packages recorded in the database
+func (s *Server) condaRepodata(ctx context.Context, repositoryName, subdir string, current bool) ([]byte, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []*types.CondaPackage
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypeConda) {
+			continue
+		}
+		pkg, err := types.CondaPackageFromMetadata(artifactProperties(a))
+		if err != nil || pkg.Subdir != subdir {
+			continue
+		}
+		if pkg.Size == 0 {
+			pkg.Size = a.Size
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return types.GenerateCondaRepodata(subdir, pkgs, current)
+}
+
+// condaFile serves GET /:subdir/:file: the channel indexes of a subdir or a package.
+// Remote repositories pass every file through to the upstream channel and cache it.
+func (s *Server) condaFile(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	subdir, file := c.Param("subdir"), c.Param("file")
+	if !types.ValidCondaSubdir(subdir) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	storagePath := types.CondaPackagePath(subdir, file)
+
+	if repo.GetType() != repository.Remote && (file == types.CondaRepodataFile || file == types.CondaCurrentRepodataFile) {
+		// Every subdir has a (possibly empty) index so clients can always fetch noarch
+		repodata, err := s.condaRepodata(c.Request.Context(), repositoryName, subdir, file == types.CondaCurrentRepodataFile)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/json", repodata)
+		return
+	}
+
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", inferContentType(artifact.ArtifactTypeConda, storagePath))
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// condaUpload accepts POST /api/packages with a .conda or .tar.bz2 as the raw body or a multipart "file".
+// The subdir and file name are taken from the package's info/index.json.
+func (s *Server) condaUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	// Spool to disk while computing the digests listed in repodata
+	tmp, err := os.CreateTemp("", "ganje-conda-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	md5sum, sha256sum := md5.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, md5sum, sha256sum), body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pkg, err := types.ReadCondaPackage(tmp, size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pkg.MD5 = hex.EncodeToString(md5sum.Sum(nil))
+	pkg.SHA256 = hex.EncodeToString(sha256sum.Sum(nil))
+	pkg.Size = size
+
+	storagePath := types.CondaPackagePath(pkg.Subdir, pkg.Filename())
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is already published", storagePath)})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:       pkg.Name,
+		Version:    pkg.Version,
+		Size:       size,
+		Checksum:   pkg.SHA256,
+		Properties: pkg.Metadata(),
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"name":     pkg.Name,
+		"version":  pkg.Version,
+		"build":    pkg.Build,
+		"subdir":   pkg.Subdir,
+		"location": storagePath,
+		"sha256":   pkg.SHA256,
+	})
+}
+
+// condaDelete removes a package; it disappears from repodata.json with the database record
+func (s *Server) condaDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := types.CondaPackagePath(c.Param("subdir"), c.Param("file"))
+	if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Artifact deleted successfully"})
+}
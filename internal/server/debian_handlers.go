@@ -0,0 +1,386 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+)
+
+// debianNamePattern restricts distribution and component names to safe path segments
+var debianNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// debianPackages returns the packages published to a distribution, keyed for index generation
+func (s *Server) debianPackages(ctx context.Context, repositoryName, distribution string) ([]*database.ArtifactInfo, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	var packages []*database.ArtifactInfo
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypeDebian) {
+			continue
+		}
+		for _, d := range debianDistributions(artifactProperties(a)) {
+			if d == distribution {
+				packages = append(packages, a)
+				break
+			}
+		}
+	}
+	return packages, nil
+}
+
+// debianDistributions returns the distributions a package is published to. Its pool file is
+// stored once, whichever distributions list it; records written before the list was kept only
+// name the distribution the package was uploaded to.
+func debianDistributions(props map[string]string) []string {
+	if list := props["distributions"]; list != "" {
+		return strings.Split(list, ",")
+	}
+	if d := props["distribution"]; d != "" {
+		return []string{d}
+	}
+	return nil
+}
+
+// debianPackagesFile renders the Packages index of one component/architecture.
+// Architecture-independent ("all") packages are listed under every architecture.
+func debianPackagesFile(packages []*database.ArtifactInfo, component, arch string) ([]byte, error) {
+	var infos []*artifact.ArtifactInfo
+	for _, p := range packages {
+		props := artifactProperties(p)
+		if props["component"] != component {
+			continue
+		}
+		if props["architecture"] != arch && props["architecture"] != "all" {
+			continue
+		}
+		infos = append(infos, &artifact.ArtifactInfo{
+			Name:     p.Name,
+			Version:  p.Version,
+			Type:     artifact.ArtifactTypeDebian,
+			Path:     p.Path,
+			Metadata: props,
+		})
+	}
+	return types.NewDebianArtifact(nil).GenerateIndex(infos)
+}
+
+// debianGzip compresses an index deterministically so Release digests stay stable between requests
+func debianGzip(data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(data)
+	_ = gz.Close()
+	return buf.Bytes()
+}
+
+// debianRelease builds the Release file of a distribution from the packages published to it
+func (s *Server) debianRelease(ctx context.Context, repositoryName, distribution string) (*types.DebianRelease, error) {
+	packages, err := s.debianPackages(ctx, repositoryName, distribution)
+	if err != nil {
+		return nil, err
+	}
+	if len(packages) == 0 {
+		return nil, nil
+	}
+
+	components := map[string]bool{}
+	archs := map[string]bool{}
+	var date time.Time
+	for _, p := range packages {
+		props := artifactProperties(p)
+		components[props["component"]] = true
+		if a := props["architecture"]; a != "all" {
+			archs[a] = true
+		}
+		if p.CreatedAt.After(date) {
+			date = p.CreatedAt
+		}
+	}
+	// Let repositories announce architectures they only serve "all" packages for
+	if opts, err := s.getRepositoryOptionsMap(ctx, repositoryName); err == nil {
+		for _, a := range strings.Split(opts["debian_architectures"], ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				archs[a] = true
+			}
+		}
+	}
+	if len(archs) == 0 {
+		archs["all"] = true
+	}
+
+	release := &types.DebianRelease{
+		Origin:        repositoryName,
+		Label:         repositoryName,
+		Suite:         distribution,
+		Codename:      distribution,
+		Date:          date,
+		Architectures: sortedKeys(archs),
+		Components:    sortedKeys(components),
+	}
+	for _, component := range release.Components {
+		for _, arch := range release.Architectures {
+			index, err := debianPackagesFile(packages, component, arch)
+			if err != nil {
+				return nil, err
+			}
+			dir := fmt.Sprintf("%s/binary-%s/", component, arch)
+			release.Files = append(release.Files,
+				types.DebianIndexFile{Path: dir + "Packages", Content: index},
+				types.DebianIndexFile{Path: dir + "Packages.gz", Content: debianGzip(index)},
+			)
+		}
+	}
+	return release, nil
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// debianDists serves GET /dists/*path: Release, InRelease, Release.gpg and Packages[.gz] indexes
+func (s *Server) debianDists(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	parts := strings.Split(strings.Trim(c.Param("path"), "/"), "/")
+	last := parts[len(parts)-1]
+
+	switch {
+	case len(parts) >= 2 && (last == "Release" || last == "InRelease" || last == "Release.gpg"):
+		distribution := strings.Join(parts[:len(parts)-1], "/")
+		release, err := s.debianRelease(c.Request.Context(), repositoryName, distribution)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if release == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Distribution not found"})
+			return
+		}
+		body := release.Bytes()
+		if last == "Release" {
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", body)
+			return
+		}
+
+		entity, err := s.repositorySigningKey(c.Request.Context(), repositoryName)
+		if errors.Is(err, errNoSigningKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sign := detachSign
+		if last == "InRelease" {
+			sign = clearSign
+		}
+		signed, err := sign(entity, body)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", signed)
+
+	case len(parts) >= 4 && (last == "Packages" || last == "Packages.gz") && strings.HasPrefix(parts[len(parts)-2], "binary-"):
+		distribution := strings.Join(parts[:len(parts)-3], "/")
+		component := parts[len(parts)-3]
+		arch := strings.TrimPrefix(parts[len(parts)-2], "binary-")
+
+		packages, err := s.debianPackages(c.Request.Context(), repositoryName, distribution)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		index, err := debianPackagesFile(packages, component, arch)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if last == "Packages.gz" {
+			c.Data(http.StatusOK, "application/gzip", debianGzip(index))
+			return
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", index)
+
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	}
+}
+
+// debianUpload accepts POST /api/packages/:distribution/:component with a .deb as the raw body or a multipart "file"
+func (s *Server) debianUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	distribution := c.Param("distribution")
+	component := c.Param("component")
+	if !debianNamePattern.MatchString(distribution) || !debianNamePattern.MatchString(component) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid distribution or component"})
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	// Spool to disk while computing the digests listed in Packages
+	tmp, err := os.CreateTemp("", "ganje-debian-*.deb")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	md5sum, sha1sum, sha256sum := md5.New(), sha1.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, md5sum, sha1sum, sha256sum), body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	control, err := types.ReadDebControl(tmp)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	storagePath, err := control.PoolPath(component)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	checksum := hex.EncodeToString(sha256sum.Sum(nil))
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		s.debianPublish(c, repositoryName, existing, distribution, checksum)
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	props := control.Metadata()
+	props["distribution"] = distribution
+	props["distributions"] = distribution
+	props["component"] = component
+	props["filename"] = storagePath
+	props["size"] = strconv.FormatInt(size, 10)
+	props["md5"] = hex.EncodeToString(md5sum.Sum(nil))
+	props["sha1"] = hex.EncodeToString(sha1sum.Sum(nil))
+	props["sha256"] = checksum
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:       control.Package,
+		Version:    control.Version,
+		Size:       size,
+		Checksum:   props["sha256"],
+		Properties: props,
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       control.Package,
+			Version:    control.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"package":      control.Package,
+		"version":      control.Version,
+		"architecture": control.Architecture,
+		"distribution": distribution,
+		"component":    component,
+		"filename":     storagePath,
+	})
+}
+
+// debianPublish adds a distribution to a package already in the pool. The same file may be
+// published to several distributions, but a pool path never changes content.
+func (s *Server) debianPublish(c *gin.Context, repositoryName string, existing *database.ArtifactInfo, distribution, checksum string) {
+	props := artifactProperties(existing)
+	if props["sha256"] != checksum {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is already published with different content", existing.Path)})
+		return
+	}
+	distributions := debianDistributions(props)
+	for _, d := range distributions {
+		if d == distribution {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is already published to %s", existing.Path, distribution)})
+			return
+		}
+	}
+	props["distributions"] = strings.Join(append(distributions, distribution), ",")
+	metadata, err := json.Marshal(props)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.db.UpdateArtifactMetadata(c.Request.Context(), existing.ID, string(metadata)); err != nil {
+		s.logAccess(c, repositoryName, existing.Path, "push", false, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, existing.Path, "push", true, "")
+
+	c.JSON(http.StatusOK, gin.H{
+		"package":      existing.Name,
+		"version":      existing.Version,
+		"architecture": props["architecture"],
+		"distribution": distribution,
+		"component":    props["component"],
+		"filename":     existing.Path,
+	})
+}
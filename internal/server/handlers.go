@@ -3,8 +3,8 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,9 +13,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
 	"github.com/hbahadorzadeh/ganje/internal/auth"
+	"github.com/hbahadorzadeh/ganje/internal/controllers"
 	"github.com/hbahadorzadeh/ganje/internal/database"
 	"github.com/hbahadorzadeh/ganje/internal/messaging"
 	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
 )
 
 // pullArtifact handles artifact pull requests
@@ -67,34 +69,55 @@ func (s *Server) pullArtifact(c *gin.Context) {
 	s.logAccess(c, repositoryName, resolvedPath, "pull", true, "")
 
 	// Set headers
-	c.Header("Content-Length", strconv.FormatInt(metadata.Size, 10))
 	c.Header("Content-Type", inferContentType(repo.GetArtifactType(), resolvedPath))
 	if metadata.Checksum != "" {
 		c.Header("X-Checksum-SHA256", metadata.Checksum)
 	}
 
-	// Stream content
-	c.Status(http.StatusOK)
-	io.Copy(c.Writer, content)
+	// Stream content, honouring ranges and conditional requests
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
 }
 
 // terraformDownload handles Terraform download endpoint per Registry spec by setting X-Terraform-Get
 // and then streaming the content. Clients may rely on this header to locate the archive URL.
 func (s *Server) terraformDownload(c *gin.Context) {
-    // Best-effort scheme detection for reverse proxies
-    scheme := c.GetHeader("X-Forwarded-Proto")
-    if scheme == "" {
-        scheme = "http"
-        if c.Request.TLS != nil {
-            scheme = "https"
-        }
-    }
-    absolute := fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, c.Request.URL.Path)
+    absolute := requestBaseURL(c) + c.Request.URL.Path
     c.Header("X-Terraform-Get", absolute)
     // Per Terraform Registry spec, respond with 204 and no body
     c.Status(http.StatusNoContent)
 }
 
+// requestBaseURL returns the externally visible scheme://host of the request
+func requestBaseURL(c *gin.Context) string {
+	// Best-effort scheme detection for reverse proxies
+	scheme := c.GetHeader("X-Forwarded-Proto")
+	if scheme == "" {
+		scheme = "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
+
+// repositoryNameFromPath returns the repository name, i.e. the first segment of /<repo>/<...>
+func repositoryNameFromPath(c *gin.Context) string {
+	trimmed := strings.TrimPrefix(c.Request.URL.Path, "/")
+	if i := strings.Index(trimmed, "/"); i >= 0 {
+		return trimmed[:i]
+	}
+	return trimmed
+}
+
+// artifactProperties decodes the artifact-type specific properties stored with an artifact record
+func artifactProperties(a *database.ArtifactInfo) map[string]string {
+	props := map[string]string{}
+	if strings.TrimSpace(a.Metadata) != "" {
+		_ = json.Unmarshal([]byte(a.Metadata), &props)
+	}
+	return props
+}
+
 // inferContentType returns a best-effort content type based on artifact type and path
 func inferContentType(artType artifact.ArtifactType, path string) string {
 	// Defaults
@@ -120,6 +143,21 @@ func inferContentType(artType artifact.ArtifactType, path string) string {
 		if strings.HasSuffix(path, ".tgz") {
 			return "application/gzip"
 		}
+	case artifact.ArtifactTypeDebian:
+		if strings.HasSuffix(path, ".deb") {
+			return "application/vnd.debian.binary-package"
+		}
+	case artifact.ArtifactTypeRPM:
+		if strings.HasSuffix(path, ".rpm") {
+			return "application/x-rpm"
+		}
+	case artifact.ArtifactTypeConda:
+		if strings.HasSuffix(path, ".json") {
+			return "application/json"
+		}
+		if strings.HasSuffix(path, ".tar.bz2") {
+			return "application/x-bzip2"
+		}
 	case artifact.ArtifactTypeGeneric:
 		if strings.HasSuffix(path, ".pdf") {
 			return "application/pdf"
@@ -192,7 +230,7 @@ func (s *Server) pushArtifact(c *gin.Context) {
 	if err != nil {
 		s.logAccess(c, repositoryName, resolvedPath, "push", false, err.Error())
 		// Return 400 for validation/push errors to match test expectations
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(pushErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -822,7 +860,37 @@ func (s *Server) getRepositoryStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
-// listRepositories returns repositories from DB
+// getDedupSavings reports the storage saved by deduplication, per repository and in total
+func (s *Server) getDedupSavings(c *gin.Context) {
+	controllers.GetDedupSavings(s.db, s.config)(c)
+}
+
+// rotateEncryptionKeys rewraps every data key of encrypted storage with the primary master key
+func (s *Server) rotateEncryptionKeys(c *gin.Context) {
+	controllers.RotateEncryptionKeys(s.keyRotator)(c)
+}
+
+// pushErrorStatus returns the status of a failed push: 413 when it exceeds the quota of the
+// repository, 507 when it exceeds the global quota, and status otherwise
+func pushErrorStatus(err error, status int) int {
+	var quotaErr *repository.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return status
+	}
+	return quotaErr.Status()
+}
+
+// getStorageScrub returns the report of the last storage scrub and whether one is running
+func (s *Server) getStorageScrub(c *gin.Context) {
+	controllers.GetStorageScrub(s.scrubber, s.config)(c)
+}
+
+// startStorageScrub starts verifying stored content against the database in the background
+func (s *Server) startStorageScrub(c *gin.Context) {
+	controllers.StartStorageScrub(s.scrubber)(c)
+}
+
+
 func (s *Server) listRepositories(c *gin.Context) {
     repos, err := s.db.ListRepositories(c.Request.Context())
     if err != nil {
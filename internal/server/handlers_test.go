@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -12,6 +16,7 @@ import (
 	"github.com/hbahadorzadeh/ganje/internal/database"
 	"github.com/hbahadorzadeh/ganje/internal/repository"
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
 )
 
 func TestBulkDeleteRepositories(t *testing.T) {
@@ -486,3 +491,150 @@ func TestGetRepositoryDetailed(t *testing.T) {
 	mockDB.AssertExpectations(t)
 	mockRepo.AssertExpectations(t)
 }
+
+func TestGetDedupSavings(t *testing.T) {
+	server, mockDB, _, mockAuthService := createTestServer()
+	server.config.Storage.Deduplicate = true
+
+	mockAuthService.On("ValidateToken", "Bearer valid-token").Return(&auth.Claims{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Realms:   []string{"admin"},
+	}, nil)
+	mockAuthService.On("CheckPermission", mock.AnythingOfType("*auth.Claims"), "", auth.PermissionAdmin).Return(true)
+
+	mockDB.On("GetDedupSavings", mock.Anything).Return([]*database.DedupSavings{
+		{Repository: "maven-a", Paths: 2, Blobs: 2, LogicalSize: 101, StoredSize: 41, SavedSize: 60},
+		{Repository: "maven-b", Paths: 1, Blobs: 1, LogicalSize: 90, StoredSize: 30, SavedSize: 60},
+	}, nil)
+
+	req := createAuthenticatedRequest("GET", "/api/v1/storage/dedup", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	assert.Equal(t, true, response["enabled"])
+	repos := response["repositories"].([]interface{})
+	assert.Len(t, repos, 2)
+	assert.Equal(t, "maven-a", repos[0].(map[string]interface{})["repository"])
+	assert.Equal(t, float64(60), repos[1].(map[string]interface{})["saved_size"])
+
+	total := response["total"].(map[string]interface{})
+	assert.Equal(t, float64(3), total["paths"])
+	assert.Equal(t, float64(191), total["logical_size"])
+	assert.Equal(t, float64(71), total["stored_size"])
+	assert.Equal(t, float64(120), total["saved_size"])
+
+	mockAuthService.AssertExpectations(t)
+	mockDB.AssertExpectations(t)
+}
+
+// fakeKeyRotator counts key rotations
+type fakeKeyRotator struct {
+	calls int
+}
+
+func (f *fakeKeyRotator) Rotate(ctx context.Context) (int, error) {
+	f.calls++
+	return 3, nil
+}
+
+func TestRotateEncryptionKeys(t *testing.T) {
+	server, _, _, mockAuthService := createTestServer()
+
+	mockAuthService.On("ValidateToken", "Bearer valid-token").Return(&auth.Claims{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Realms:   []string{"admin"},
+	}, nil)
+	mockAuthService.On("CheckPermission", mock.AnythingOfType("*auth.Claims"), "", auth.PermissionAdmin).Return(true)
+
+	req := createAuthenticatedRequest("POST", "/api/v1/storage/encryption/rotate", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "encryption is disabled")
+
+	rotator := &fakeKeyRotator{}
+	server.keyRotator = rotator
+	req = createAuthenticatedRequest("POST", "/api/v1/storage/encryption/rotate", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"rewrapped":3}`, w.Body.String())
+	assert.Equal(t, 1, rotator.calls)
+}
+
+// fakeScrubber starts one scrub, which never finishes
+type fakeScrubber struct {
+	running bool
+	last    *storage.ScrubReport
+}
+
+func (f *fakeScrubber) Start(ctx context.Context) error {
+	if f.running {
+		return storage.ErrScrubRunning
+	}
+	f.running = true
+	return nil
+}
+
+func (f *fakeScrubber) Schedule(ctx context.Context, interval time.Duration) {}
+
+func (f *fakeScrubber) LastReport() *storage.ScrubReport { return f.last }
+
+func (f *fakeScrubber) Running() bool { return f.running }
+
+func TestStorageScrub(t *testing.T) {
+	server, _, _, mockAuthService := createTestServer()
+
+	mockAuthService.On("ValidateToken", "Bearer valid-token").Return(&auth.Claims{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Realms:   []string{"admin"},
+	}, nil)
+	mockAuthService.On("CheckPermission", mock.AnythingOfType("*auth.Claims"), "", auth.PermissionAdmin).Return(true)
+
+	scrubber := &fakeScrubber{last: &storage.ScrubReport{Checked: 2, Mismatched: 1, Findings: []storage.ScrubFinding{
+		{Kind: storage.ScrubMismatch, Path: "libs/a.jar", Expected: "aa", Actual: "bb", Action: "reported"},
+	}}}
+	server.scrubber = scrubber
+
+	req := createAuthenticatedRequest("POST", "/api/v1/storage/scrub", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	req = createAuthenticatedRequest("POST", "/api/v1/storage/scrub", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code, "a scrub is running")
+
+	req = createAuthenticatedRequest("GET", "/api/v1/storage/scrub", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Running bool                `json:"running"`
+		Report  storage.ScrubReport `json:"report"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Running)
+	assert.Equal(t, 1, response.Report.Mismatched)
+	assert.Equal(t, "libs/a.jar", response.Report.Findings[0].Path)
+}
+
+func TestPushErrorStatus(t *testing.T) {
+	repoQuota := &repository.QuotaError{Repository: "builds", Scope: repository.QuotaScopeRepository, Resource: repository.QuotaBytes}
+	globalQuota := &repository.QuotaError{Scope: repository.QuotaScopeGlobal, Resource: repository.QuotaArtifacts}
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, pushErrorStatus(repoQuota, http.StatusBadRequest))
+	assert.Equal(t, http.StatusInsufficientStorage, pushErrorStatus(fmt.Errorf("failed to store artifact: %w", globalQuota), http.StatusBadRequest))
+	assert.Equal(t, http.StatusInternalServerError, pushErrorStatus(errors.New("disk failure"), http.StatusInternalServerError))
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// hexRegistryConfig loads the settings registry resources are built with.
+// Recognized option keys:
+// - hex_signing_key (PEM encoded RSA private key)
+// - hex_signing_key_file (path to a PEM encoded RSA private key)
+// - hex_repository_name (name clients add the repository under, defaults to the repository name)
+func (s *Server) hexRegistryConfig(ctx context.Context, repositoryName string) (string, *rsa.PrivateKey, error) {
+	opts, err := s.getRepositoryOptionsMap(ctx, repositoryName)
+	if err != nil {
+		return repositoryName, nil, nil
+	}
+	name := opts["hex_repository_name"]
+	if name == "" {
+		name = repositoryName
+	}
+
+	keyPEM := opts["hex_signing_key"]
+	if keyPEM == "" && opts["hex_signing_key_file"] != "" {
+		data, err := os.ReadFile(opts["hex_signing_key_file"])
+		if err != nil {
+			return name, nil, fmt.Errorf("failed to read Hex signing key: %w", err)
+		}
+		keyPEM = string(data)
+	}
+	if strings.TrimSpace(keyPEM) == "" {
+		return name, nil, nil
+	}
+	key, err := types.ParseHexSigningKey([]byte(keyPEM))
+	return name, key, err
+}
+
+// hexReleases returns the published releases of a repository grouped by package name
+func (s *Server) hexReleases(ctx context.Context, repositoryName string) (map[string][]*types.HexRelease, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	releases := map[string][]*types.HexRelease{}
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypeHex) {
+			continue
+		}
+		release, err := types.HexReleaseFromMetadata(artifactProperties(a))
+		if err != nil {
+			continue
+		}
+		releases[release.Name] = append(releases[release.Name], release)
+	}
+	return releases, nil
+}
+
+// hexRegistryResource serves the signed registry resources /names, /versions and /packages/:name
+func (s *Server) hexRegistryResource(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	registryName, key, err := s.hexRegistryConfig(c.Request.Context(), repositoryName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	releases, err := s.hexReleases(c.Request.Context(), repositoryName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var payload []byte
+	switch {
+	case c.Param("name") != "":
+		pkg, ok := releases[c.Param("name")]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Package not found"})
+			return
+		}
+		payload = types.HexPackagePayload(registryName, c.Param("name"), pkg)
+	case strings.HasSuffix(c.Request.URL.Path, "/names"):
+		names := make([]string, 0, len(releases))
+		for name := range releases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		payload = types.HexNamesPayload(registryName, names)
+	default:
+		versions := map[string][]string{}
+		for name, pkg := range releases {
+			for _, release := range pkg {
+				versions[name] = append(versions[name], release.Version)
+			}
+		}
+		payload = types.HexVersionsPayload(registryName, versions)
+	}
+
+	resource, err := types.SignHexResource(payload, key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", resource)
+}
+
+// hexTarball serves GET /tarballs/:file, a release tarball
+func (s *Server) hexTarball(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := "tarballs/" + c.Param("file")
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", "application/octet-stream")
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// hexPublicKey serves GET /public_key, the key registry resources are verified with
+func (s *Server) hexPublicKey(c *gin.Context) {
+	_, key, err := s.hexRegistryConfig(c.Request.Context(), repositoryNameFromPath(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if key == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "repository has no signing key configured"})
+		return
+	}
+	pub, err := types.HexPublicKeyPEM(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/x-pem-file", pub)
+}
+
+// hexPublish accepts POST /api/publish with a release tarball as the body, as sent by "mix hex.publish".
+// An existing release is only overwritten when the request sets replace=true.
+func (s *Server) hexPublish(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "ganje-hex-*.tar")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	release, err := types.ReadHexTarball(tmp)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	storagePath := types.HexTarballPath(release.Name, release.Version)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		if c.Query("replace") != "true" {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s %s is already published", release.Name, release.Version)})
+			return
+		}
+		if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:        release.Name,
+		Version:     release.Version,
+		Description: release.Description,
+		Size:        size,
+		Checksum:    hex.EncodeToString(release.OuterChecksum),
+		Properties:  release.Metadata(),
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       release.Name,
+			Version:    release.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"name":           release.Name,
+		"version":        release.Version,
+		"inner_checksum": hex.EncodeToString(release.InnerChecksum),
+		"outer_checksum": hex.EncodeToString(release.OuterChecksum),
+		"url":            fmt.Sprintf("%s/%s/%s", requestBaseURL(c), repositoryName, storagePath),
+	})
+}
+
+// hexRevert serves DELETE /api/packages/:name/releases/:version, removing a release ("mix hex.publish --revert")
+func (s *Server) hexRevert(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := types.HexTarballPath(c.Param("name"), c.Param("version"))
+	if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       c.Param("name"),
+			Version:    c.Param("version"),
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// huggingfaceError writes an error the way the Hub does; huggingface_hub maps the X-Error-Code
+// header to RepositoryNotFoundError, RevisionNotFoundError and EntryNotFoundError
+func huggingfaceError(c *gin.Context, status int, code, message string) {
+	if code != "" {
+		c.Header("X-Error-Code", code)
+	}
+	c.Header("X-Error-Message", message)
+	c.JSON(status, gin.H{"error": message})
+}
+
+// huggingfaceRepoID returns the repository id addressed by the :org and :model parameters; ids
+// without a namespace, such as gpt2, are routed with :org alone
+func huggingfaceRepoID(c *gin.Context) string {
+	if model := c.Param("model"); model != "" {
+		return c.Param("org") + "/" + model
+	}
+	return c.Param("org")
+}
+
+// huggingfaceFileParams returns the repository id, revision and file addressed by
+// /[:org/]:model/resolve/:revision/*file
+func huggingfaceFileParams(c *gin.Context) (id, revision, file string, ok bool) {
+	id = huggingfaceRepoID(c)
+	revision, file = c.Param("revision"), strings.TrimPrefix(c.Param("file"), "/")
+	if !types.ValidHuggingFaceRepoID(id) || !types.ValidHuggingFaceRevision(revision) || !types.ValidHuggingFaceFile(file) {
+		return "", "", "", false
+	}
+	return id, revision, file, true
+}
+
+// huggingfaceBranches returns the files uploaded to a model, keyed by branch
+func (s *Server) huggingfaceBranches(ctx context.Context, repositoryName, id string) (map[string][]*types.HuggingFaceFile, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	branches := map[string][]*types.HuggingFaceFile{}
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypeHuggingFace) || a.Name != id {
+			continue
+		}
+		f, err := types.HuggingFaceFileFromProperties(artifactProperties(a))
+		if err != nil {
+			continue
+		}
+		f.LastModified = a.CreatedAt
+		branches[f.Revision] = append(branches[f.Revision], f)
+	}
+	return branches, nil
+}
+
+// huggingfaceRevision resolves a branch name or commit id of a local model to its branch, files
+// and commit id. It writes the Hub's not-found errors and reports false when there is none.
+func (s *Server) huggingfaceRevision(c *gin.Context, id, revision string) (string, []*types.HuggingFaceFile, string, bool) {
+	branches, err := s.huggingfaceBranches(c.Request.Context(), repositoryNameFromPath(c), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", nil, "", false
+	}
+	if len(branches) == 0 {
+		huggingfaceError(c, http.StatusNotFound, "RepoNotFound", fmt.Sprintf("Repository %s not found", id))
+		return "", nil, "", false
+	}
+	if files, ok := branches[revision]; ok {
+		return revision, files, types.HuggingFaceCommit(files), true
+	}
+	if types.IsHuggingFaceCommit(revision) {
+		for branch, files := range branches {
+			if types.HuggingFaceCommit(files) == revision {
+				return branch, files, revision, true
+			}
+		}
+	}
+	huggingfaceError(c, http.StatusNotFound, "RevisionNotFound", fmt.Sprintf("Revision %s not found in %s", revision, id))
+	return "", nil, "", false
+}
+
+// huggingfaceRemoteCommit returns the commit a revision of an upstream model points at, reading
+// the cached revision info unless the revision already is a commit id
+func (s *Server) huggingfaceRemoteCommit(c *gin.Context, repo repository.Repository, id, revision string) (string, error) {
+	if types.IsHuggingFaceCommit(revision) {
+		return revision, nil
+	}
+	content, _, err := repo.Pull(c.Request.Context(), types.HuggingFaceRevisionPath(id, revision))
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	var info struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(content).Decode(&info); err != nil {
+		return "", fmt.Errorf("invalid revision info: %w", err)
+	}
+	if !types.IsHuggingFaceCommit(info.SHA) {
+		return "", fmt.Errorf("revision info of %s has no commit", revision)
+	}
+	return info.SHA, nil
+}
+
+// huggingfaceModelInfo serves GET /api/models/[:org/]:model[/revision/:revision], the model info
+// huggingface_hub reads before downloading; without a revision the main branch is described.
+// Remote repositories serve the upstream info as is.
+func (s *Server) huggingfaceModelInfo(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	id, revision := huggingfaceRepoID(c), c.Param("revision")
+	if revision == "" {
+		revision = "main"
+	}
+	if !types.ValidHuggingFaceRepoID(id) || !types.ValidHuggingFaceRevision(revision) {
+		huggingfaceError(c, http.StatusNotFound, "RepoNotFound", "Repository not found")
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	if repo.GetType() == repository.Remote {
+		content, _, err := repo.Pull(c.Request.Context(), types.HuggingFaceRevisionPath(id, revision))
+		if err != nil {
+			huggingfaceError(c, http.StatusNotFound, "RevisionNotFound", err.Error())
+			return
+		}
+		defer content.Close()
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", "application/json")
+		_, _ = io.Copy(c.Writer, content)
+		return
+	}
+
+	_, files, _, ok := s.huggingfaceRevision(c, id, revision)
+	if !ok {
+		return
+	}
+	info, err := types.GenerateHuggingFaceRevisionInfo(id, files, c.Query("blobs") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", info)
+}
+
+// huggingfaceResolve serves GET and HEAD /[:org/]:model/resolve/:revision/*file. Like the Hub it
+// answers with the X-Repo-Commit of the revision and the file's ETag; LFS objects also carry
+// X-Linked-Etag and X-Linked-Size. Remote repositories resolve branches through the upstream
+// revision info and cache files per commit.
+func (s *Server) huggingfaceResolve(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	id, revision, file, ok := huggingfaceFileParams(c)
+	if !ok {
+		huggingfaceError(c, http.StatusNotFound, "EntryNotFound", "Not found")
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	var storagePath, commit, etag string
+	var entry *types.HuggingFaceFile
+	if repo.GetType() == repository.Remote {
+		if commit, err = s.huggingfaceRemoteCommit(c, repo, id, revision); err != nil {
+			huggingfaceError(c, http.StatusNotFound, "RevisionNotFound", err.Error())
+			return
+		}
+		storagePath = types.HuggingFaceFilePath(id, commit, file)
+	} else {
+		var branch string
+		var files []*types.HuggingFaceFile
+		if branch, files, commit, ok = s.huggingfaceRevision(c, id, revision); !ok {
+			return
+		}
+		for _, f := range files {
+			if f.Path == file {
+				entry = f
+			}
+		}
+		if entry == nil {
+			huggingfaceError(c, http.StatusNotFound, "EntryNotFound", fmt.Sprintf("%s not found at %s", file, revision))
+			return
+		}
+		storagePath, etag = types.HuggingFaceFilePath(id, branch, file), entry.ETag()
+	}
+
+	c.Header("X-Repo-Commit", commit)
+	c.Header("Content-Type", "application/octet-stream")
+	if entry != nil && entry.LFS {
+		c.Header("X-Linked-Etag", `"`+entry.SHA256+`"`)
+		c.Header("X-Linked-Size", strconv.FormatInt(entry.Size, 10))
+	}
+	if c.Request.Method == http.MethodHead && entry != nil {
+		c.Header("ETag", `"`+etag+`"`)
+		c.Header("Content-Length", strconv.FormatInt(entry.Size, 10))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		huggingfaceError(c, http.StatusNotFound, "EntryNotFound", err.Error())
+		return
+	}
+	defer content.Close()
+	if c.Request.Method == http.MethodGet {
+		s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+	}
+
+	if etag == "" {
+		// Upstream files are identified by the digest of their cached content
+		etag = metadata.Checksum
+	}
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, etag, metadata.UpdatedAt)
+}
+
+// huggingfaceUpload accepts PUT /[:org/]:model/resolve/:branch/*file with the file as the body.
+// Files matching the Hub's LFS patterns, or of HuggingFaceLFSThreshold or more, are recorded as
+// LFS objects; the commit id of the branch changes with every upload.
+func (s *Server) huggingfaceUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	id, branch, file, ok := huggingfaceFileParams(c)
+	if !ok || types.IsHuggingFaceCommit(branch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path must be /[<org>/]<model>/resolve/<branch>/<file>"})
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := types.HuggingFaceFilePath(id, branch, file)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s already exists on %s of %s", file, branch, id)})
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "ganje-huggingface-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entry := &types.HuggingFaceFile{
+		RepoID:   id,
+		Revision: branch,
+		Path:     file,
+		Size:     size,
+		SHA256:   hex.EncodeToString(sum.Sum(nil)),
+		LFS:      types.IsHuggingFaceLFSFile(file, size),
+	}
+
+	// The blob id of an LFS object is that of its pointer; other files are hashed once more
+	if entry.LFS {
+		pointer := types.HuggingFaceLFSPointer(entry.SHA256, size)
+		entry.BlobID, err = types.GitBlobID(bytes.NewReader(pointer), int64(len(pointer)))
+	} else if _, err = tmp.Seek(0, io.SeekStart); err == nil {
+		entry.BlobID, err = types.GitBlobID(tmp, size)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:       id,
+		Version:    branch,
+		Size:       size,
+		Checksum:   entry.SHA256,
+		Properties: entry.Properties(),
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       id,
+			Version:    branch,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":       id,
+		"revision": branch,
+		"file":     file,
+		"location": storagePath,
+		"sha256":   entry.SHA256,
+		"lfs":      entry.LFS,
+	})
+}
+
+// huggingfaceDelete removes a file from a branch; the branch disappears with its last file
+func (s *Server) huggingfaceDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	id, branch, file, ok := huggingfaceFileParams(c)
+	if !ok || types.IsHuggingFaceCommit(branch) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := types.HuggingFaceFilePath(id, branch, file)
+	if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Artifact deleted successfully"})
+}
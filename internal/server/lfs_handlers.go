@@ -0,0 +1,447 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/auth"
+	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// lfsMediaType is the content type of every Git LFS API request and response
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+// lfsError writes an error in the format LFS clients print
+func lfsError(c *gin.Context, status int, message string) {
+	body, _ := json.Marshal(gin.H{"message": message})
+	c.Data(status, lfsMediaType, body)
+}
+
+// lfsAuthMiddleware authenticates like authMiddleware but also accepts the token as the password of
+// HTTP basic auth, which is what git credential helpers send. Missing credentials are answered with
+// the LFS-Authenticate challenge so the client asks the credential helper for them.
+func (s *Server) lfsAuthMiddleware() gin.HandlerFunc {
+	authenticate := s.authMiddleware()
+	return func(c *gin.Context) {
+		if _, token, ok := c.Request.BasicAuth(); ok {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		if c.GetHeader("Authorization") == "" {
+			c.Header("LFS-Authenticate", `Basic realm="Git LFS"`)
+		}
+		authenticate(c)
+	}
+}
+
+// lfsAllowed reports whether the authenticated user holds a permission on the repository
+func (s *Server) lfsAllowed(c *gin.Context, permission auth.Permission) bool {
+	value, ok := c.Get("auth_context")
+	if !ok {
+		return false
+	}
+	authCtx := value.(*auth.AuthContext)
+	claims := &auth.Claims{Username: authCtx.Username, Email: authCtx.Email, Realms: authCtx.Realms}
+	return s.authService.CheckPermission(claims, repositoryNameFromPath(c), permission)
+}
+
+// lfsBatch serves POST /objects/batch. Downloads need read and uploads write permission; objects the
+// repository already has are returned without an upload action.
+func (s *Server) lfsBatch(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	var req types.LFSBatchRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		lfsError(c, http.StatusUnprocessableEntity, "invalid batch request: "+err.Error())
+		return
+	}
+	switch req.Operation {
+	case "download":
+	case "upload":
+		if !s.lfsAllowed(c, auth.PermissionWrite) {
+			lfsError(c, http.StatusForbidden, "write access is required to upload objects")
+			return
+		}
+	default:
+		lfsError(c, http.StatusUnprocessableEntity, "unsupported operation: "+req.Operation)
+		return
+	}
+	if req.HashAlgo != "" && req.HashAlgo != "sha256" {
+		lfsError(c, http.StatusConflict, "unsupported hash algorithm: "+req.HashAlgo)
+		return
+	}
+	if len(req.Transfers) > 0 {
+		basic := false
+		for _, t := range req.Transfers {
+			basic = basic || t == "basic"
+		}
+		if !basic {
+			lfsError(c, http.StatusUnprocessableEntity, "only the basic transfer adapter is supported")
+			return
+		}
+	}
+
+	// Transfers are authenticated with the credentials of the batch request
+	header := map[string]string{}
+	if authorization := c.GetHeader("Authorization"); authorization != "" {
+		header["Authorization"] = authorization
+	}
+	objectsURL := fmt.Sprintf("%s/%s/objects", requestBaseURL(c), repositoryName)
+
+	objects := make([]types.LFSObjectResult, 0, len(req.Objects))
+	for _, obj := range req.Objects {
+		result := types.LFSObjectResult{OID: obj.OID, Size: obj.Size}
+		if !types.ValidLFSOID(obj.OID) || obj.Size < 0 {
+			result.Error = &types.LFSObjectError{Code: http.StatusUnprocessableEntity, Message: "invalid object"}
+			objects = append(objects, result)
+			continue
+		}
+		existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, types.LFSObjectPath(obj.OID))
+		exists := err == nil && existing != nil
+
+		switch {
+		case req.Operation == "download" && !exists:
+			result.Error = &types.LFSObjectError{Code: http.StatusNotFound, Message: "object does not exist"}
+		case req.Operation == "download" && existing.Size != obj.Size:
+			result.Error = &types.LFSObjectError{Code: http.StatusUnprocessableEntity, Message: "object size does not match"}
+		case req.Operation == "download":
+			result.Authenticated = true
+			result.Actions = map[string]*types.LFSAction{
+				"download": {Href: objectsURL + "/" + obj.OID, Header: header},
+			}
+		case !exists:
+			result.Authenticated = true
+			result.Actions = map[string]*types.LFSAction{
+				"upload": {Href: objectsURL + "/" + obj.OID, Header: header},
+				"verify": {Href: objectsURL + "/verify", Header: header},
+			}
+		}
+		objects = append(objects, result)
+	}
+
+	body, _ := json.Marshal(types.LFSBatchResponse{Transfer: "basic", Objects: objects, HashAlgo: "sha256"})
+	c.Data(http.StatusOK, lfsMediaType, body)
+}
+
+// lfsDownload serves GET /objects/:oid, the basic transfer download action
+func (s *Server) lfsDownload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		lfsError(c, http.StatusNotFound, "repository not found")
+		return
+	}
+	oid := c.Param("oid")
+	if !types.ValidLFSOID(oid) {
+		lfsError(c, http.StatusUnprocessableEntity, "invalid object ID")
+		return
+	}
+
+	storagePath := types.LFSObjectPath(oid)
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		lfsError(c, http.StatusNotFound, "object does not exist")
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", "application/octet-stream")
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// lfsUpload serves PUT /objects/:oid, the basic transfer upload action. The content must hash to the OID.
+func (s *Server) lfsUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		lfsError(c, http.StatusNotFound, "repository not found")
+		return
+	}
+	oid := c.Param("oid")
+	if !types.ValidLFSOID(oid) {
+		lfsError(c, http.StatusUnprocessableEntity, "invalid object ID")
+		return
+	}
+
+	storagePath := types.LFSObjectPath(oid)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		_, _ = io.Copy(io.Discard, c.Request.Body)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "ganje-lfs-*")
+	if err != nil {
+		lfsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), c.Request.Body)
+	if err != nil {
+		lfsError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if hex.EncodeToString(sum.Sum(nil)) != oid {
+		lfsError(c, http.StatusUnprocessableEntity, "content does not match the object ID")
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		lfsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:       oid,
+		Size:       size,
+		Checksum:   oid,
+		Properties: map[string]string{"oid": oid, "size": strconv.FormatInt(size, 10)},
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		lfsError(c, pushErrorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       oid,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// lfsVerify serves POST /objects/verify, confirming an upload arrived complete
+func (s *Server) lfsVerify(c *gin.Context) {
+	var obj types.LFSPointer
+	if err := json.NewDecoder(c.Request.Body).Decode(&obj); err != nil || !types.ValidLFSOID(obj.OID) {
+		lfsError(c, http.StatusUnprocessableEntity, "invalid object")
+		return
+	}
+	existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryNameFromPath(c), types.LFSObjectPath(obj.OID))
+	if err != nil || existing == nil {
+		lfsError(c, http.StatusNotFound, "object does not exist")
+		return
+	}
+	if existing.Size != obj.Size {
+		lfsError(c, http.StatusUnprocessableEntity, fmt.Sprintf("object size is %d, expected %d", existing.Size, obj.Size))
+		return
+	}
+	c.Data(http.StatusOK, lfsMediaType, []byte("{}"))
+}
+
+// lfsLockJSON renders a lock the way the locking API returns it
+func lfsLockJSON(lock *database.LFSLock) gin.H {
+	return gin.H{
+		"id":        strconv.FormatUint(uint64(lock.ID), 10),
+		"path":      lock.Path,
+		"locked_at": lock.CreatedAt.UTC().Format(time.RFC3339),
+		"owner":     gin.H{"name": lock.Owner},
+	}
+}
+
+// lfsLockPage returns the locks from the one with ID cursor on, at most limit of them, and the
+// cursor of the next page, or "" on the last page
+func lfsLockPage(locks []*database.LFSLock, cursor string, limit int) ([]*database.LFSLock, string) {
+	if cursor != "" {
+		start, _ := strconv.ParseUint(cursor, 10, 64)
+		for len(locks) > 0 && uint64(locks[0].ID) < start {
+			locks = locks[1:]
+		}
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	if len(locks) > limit {
+		return locks[:limit], strconv.FormatUint(uint64(locks[limit].ID), 10)
+	}
+	return locks, ""
+}
+
+// lfsUsername returns the name locks are owned by for the authenticated user
+func lfsUsername(c *gin.Context) string {
+	value, _ := c.Get("auth_context")
+	return value.(*auth.AuthContext).Username
+}
+
+// lfsListLocks serves GET /locks, filtered by the path, id and refspec query parameters
+func (s *Server) lfsListLocks(c *gin.Context) {
+	locks, err := s.db.ListLFSLocks(c.Request.Context(), repositoryNameFromPath(c))
+	if err != nil {
+		lfsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	path, id, refspec := c.Query("path"), c.Query("id"), c.Query("refspec")
+	var matching []*database.LFSLock
+	for _, lock := range locks {
+		if path != "" && lock.Path != path ||
+			id != "" && strconv.FormatUint(uint64(lock.ID), 10) != id ||
+			refspec != "" && lock.Ref != "" && lock.Ref != refspec {
+			continue
+		}
+		matching = append(matching, lock)
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	page, next := lfsLockPage(matching, c.Query("cursor"), limit)
+	rendered := make([]gin.H, 0, len(page))
+	for _, lock := range page {
+		rendered = append(rendered, lfsLockJSON(lock))
+	}
+	body, _ := json.Marshal(gin.H{"locks": rendered, "next_cursor": next})
+	c.Data(http.StatusOK, lfsMediaType, body)
+}
+
+// lfsCreateLock serves POST /locks; a path already locked answers 409 with the existing lock
+func (s *Server) lfsCreateLock(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	var req struct {
+		Path string        `json:"path"`
+		Ref  *types.LFSRef `json:"ref"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil || req.Path == "" {
+		lfsError(c, http.StatusUnprocessableEntity, "path is required")
+		return
+	}
+
+	conflict := func() bool {
+		locks, err := s.db.ListLFSLocks(c.Request.Context(), repositoryName)
+		if err != nil {
+			return false
+		}
+		for _, lock := range locks {
+			if lock.Path == req.Path {
+				body, _ := json.Marshal(gin.H{"lock": lfsLockJSON(lock), "message": "already created lock"})
+				c.Data(http.StatusConflict, lfsMediaType, body)
+				return true
+			}
+		}
+		return false
+	}
+	if conflict() {
+		return
+	}
+
+	lock := &database.LFSLock{Path: req.Path, Owner: lfsUsername(c)}
+	if req.Ref != nil {
+		lock.Ref = req.Ref.Name
+	}
+	if err := s.db.CreateLFSLock(c.Request.Context(), repositoryName, lock); err != nil {
+		// Lost a race for the path to another client
+		if conflict() {
+			return
+		}
+		lfsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if lock.CreatedAt.IsZero() {
+		lock.CreatedAt = time.Now()
+	}
+	body, _ := json.Marshal(gin.H{"lock": lfsLockJSON(lock)})
+	c.Data(http.StatusCreated, lfsMediaType, body)
+}
+
+// lfsVerifyLocks serves POST /locks/verify, splitting the locks into the user's own and everyone else's
+func (s *Server) lfsVerifyLocks(c *gin.Context) {
+	var req struct {
+		Cursor string `json:"cursor"`
+		Limit  int    `json:"limit"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+			lfsError(c, http.StatusUnprocessableEntity, "invalid request: "+err.Error())
+			return
+		}
+	}
+	locks, err := s.db.ListLFSLocks(c.Request.Context(), repositoryNameFromPath(c))
+	if err != nil {
+		lfsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page, next := lfsLockPage(locks, req.Cursor, req.Limit)
+	username := lfsUsername(c)
+	ours, theirs := []gin.H{}, []gin.H{}
+	for _, lock := range page {
+		if lock.Owner == username {
+			ours = append(ours, lfsLockJSON(lock))
+		} else {
+			theirs = append(theirs, lfsLockJSON(lock))
+		}
+	}
+	body, _ := json.Marshal(gin.H{"ours": ours, "theirs": theirs, "next_cursor": next})
+	c.Data(http.StatusOK, lfsMediaType, body)
+}
+
+// lfsUnlock serves POST /locks/:id/unlock. Releasing another user's lock requires force and admin permission.
+func (s *Server) lfsUnlock(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	var req struct {
+		Force bool `json:"force"`
+	}
+	if c.Request.ContentLength != 0 {
+		_ = json.NewDecoder(c.Request.Body).Decode(&req)
+	}
+
+	locks, err := s.db.ListLFSLocks(c.Request.Context(), repositoryName)
+	if err != nil {
+		lfsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var lock *database.LFSLock
+	for _, l := range locks {
+		if strconv.FormatUint(uint64(l.ID), 10) == c.Param("id") {
+			lock = l
+		}
+	}
+	if lock == nil {
+		lfsError(c, http.StatusNotFound, "lock not found")
+		return
+	}
+	if lock.Owner != lfsUsername(c) {
+		if !req.Force {
+			lfsError(c, http.StatusForbidden, fmt.Sprintf("lock is owned by %s", lock.Owner))
+			return
+		}
+		if !s.lfsAllowed(c, auth.PermissionAdmin) {
+			lfsError(c, http.StatusForbidden, "admin access is required to force unlock")
+			return
+		}
+	}
+
+	if err := s.db.DeleteLFSLock(c.Request.Context(), repositoryName, lock.ID); err != nil {
+		lfsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	body, _ := json.Marshal(gin.H{"lock": lfsLockJSON(lock)})
+	c.Data(http.StatusOK, lfsMediaType, body)
+}
+
+// lfsRequestIsJSON rejects API requests that do not use the LFS media type
+func lfsRequestIsJSON(c *gin.Context) {
+	if ct := c.GetHeader("Content-Type"); ct != "" && !strings.HasPrefix(ct, lfsMediaType) && !strings.HasPrefix(ct, "application/json") {
+		lfsError(c, http.StatusUnsupportedMediaType, "expected "+lfsMediaType)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,392 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// pubMediaType is the content type of hosted pub repository API responses
+const pubMediaType = "application/vnd.pub.v2+json"
+
+// pubUploadTTL bounds how long a publish session may take from "versions/new" to finalize
+const pubUploadTTL = time.Hour
+
+// pubError writes an error in the format the pub client prints
+func pubError(c *gin.Context, status int, code, message string) {
+	body, _ := json.Marshal(gin.H{"error": gin.H{"code": code, "message": message}})
+	c.Data(status, pubMediaType, body)
+}
+
+// pubUpload is a publish session. File is set once the archive has been uploaded.
+type pubUpload struct {
+	ID         string
+	Repository string
+	File       string
+	CreatedAt  time.Time
+}
+
+// pubUploadStore keeps publish sessions in memory; the zero value is ready to use
+type pubUploadStore struct {
+	mu       sync.Mutex
+	sessions map[string]*pubUpload
+}
+
+// create starts a session for a repository, dropping sessions that have expired
+func (st *pubUploadStore) create(repository string) *pubUpload {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	upload := &pubUpload{ID: hex.EncodeToString(buf), Repository: repository, CreatedAt: time.Now()}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.sessions == nil {
+		st.sessions = make(map[string]*pubUpload)
+	}
+	for id, session := range st.sessions {
+		if time.Since(session.CreatedAt) > pubUploadTTL {
+			if session.File != "" {
+				_ = os.Remove(session.File)
+			}
+			delete(st.sessions, id)
+		}
+	}
+	st.sessions[upload.ID] = upload
+	return upload
+}
+
+// get returns an unexpired session of the repository
+func (st *pubUploadStore) get(id, repository string) (pubUpload, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	session, ok := st.sessions[id]
+	if !ok || session.Repository != repository || time.Since(session.CreatedAt) > pubUploadTTL {
+		return pubUpload{}, false
+	}
+	return *session, true
+}
+
+// attach records the uploaded archive of a session; it fails if an archive was already uploaded
+func (st *pubUploadStore) attach(id, file string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	session, ok := st.sessions[id]
+	if !ok || session.File != "" {
+		return false
+	}
+	session.File = file
+	return true
+}
+
+// take ends a session and returns it; the caller owns the uploaded file from then on
+func (st *pubUploadStore) take(id, repository string) (pubUpload, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	session, ok := st.sessions[id]
+	if !ok || session.Repository != repository {
+		return pubUpload{}, false
+	}
+	delete(st.sessions, id)
+	if time.Since(session.CreatedAt) > pubUploadTTL {
+		if session.File != "" {
+			_ = os.Remove(session.File)
+		}
+		return pubUpload{}, false
+	}
+	return *session, true
+}
+
+// pubPackageVersions returns the published versions of a package
+func (s *Server) pubPackageVersions(ctx context.Context, repositoryName, name string) ([]*types.PubPackage, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	var versions []*types.PubPackage
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypePub) || a.Name != name {
+			continue
+		}
+		pkg, err := types.PubPackageFromProperties(artifactProperties(a))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, pkg)
+	}
+	return versions, nil
+}
+
+// pubListVersions serves GET /api/packages/:name, the version listing the client resolves against
+func (s *Server) pubListVersions(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	name := c.Param("name")
+	versions, err := s.pubPackageVersions(c.Request.Context(), repositoryName, name)
+	if err != nil {
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	if len(versions) == 0 {
+		pubError(c, http.StatusNotFound, "NotFound", fmt.Sprintf("package %s not found", name))
+		return
+	}
+
+	baseURL := requestBaseURL(c) + "/" + repositoryName + "/"
+	listing, err := types.GeneratePubListing(name, versions, func(p *types.PubPackage) string {
+		return baseURL + types.PubArchivePath(p.Name, p.Version)
+	})
+	if err != nil {
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, pubMediaType, listing)
+}
+
+// pubArchivePath returns the storage path addressed by /packages/:name/versions/:file
+func pubArchivePath(c *gin.Context) (string, bool) {
+	version, ok := strings.CutSuffix(c.Param("file"), ".tar.gz")
+	if !ok || !types.ValidPubName(c.Param("name")) || !types.ValidPubVersion(version) {
+		return "", false
+	}
+	return types.PubArchivePath(c.Param("name"), version), true
+}
+
+// pubDownload serves GET /packages/:name/versions/:file, a package archive
+func (s *Server) pubDownload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	storagePath, ok := pubArchivePath(c)
+	if !ok {
+		pubError(c, http.StatusNotFound, "NotFound", "archive not found")
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		pubError(c, http.StatusNotFound, "NotFound", "repository not found")
+		return
+	}
+
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		pubError(c, http.StatusNotFound, "NotFound", err.Error())
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", "application/octet-stream")
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// pubNewVersion serves GET /api/packages/versions/new, the first publish step. It opens a session
+// and tells the client where to upload the archive; the session ID travels as a form field.
+func (s *Server) pubNewVersion(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	if _, err := s.repoManager.GetRepository(repositoryName); err != nil {
+		pubError(c, http.StatusNotFound, "NotFound", "repository not found")
+		return
+	}
+	upload := s.pubUploads.create(repositoryName)
+	body, _ := json.Marshal(gin.H{
+		"url":    requestBaseURL(c) + "/" + repositoryName + "/api/packages/versions/newUpload",
+		"fields": gin.H{"upload_id": upload.ID},
+	})
+	c.Data(http.StatusOK, pubMediaType, body)
+}
+
+// pubUploadArchive accepts POST /api/packages/versions/newUpload, the multipart archive upload.
+// The pub client does not authenticate this request, so the session ID stands in for credentials.
+// The pubspec is checked here so the client reports a bad package before finalizing.
+func (s *Server) pubUploadArchive(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	id := c.PostForm("upload_id")
+	session, ok := s.pubUploads.get(id, repositoryName)
+	if !ok {
+		pubError(c, http.StatusBadRequest, "InvalidUpload", "unknown or expired upload session")
+		return
+	}
+	if session.File != "" {
+		pubError(c, http.StatusBadRequest, "InvalidUpload", "an archive was already uploaded in this session")
+		return
+	}
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		pubError(c, http.StatusBadRequest, "InvalidUpload", "file is required")
+		return
+	}
+	defer file.Close()
+
+	tmp, err := os.CreateTemp("", "ganje-pub-*.tar.gz")
+	if err != nil {
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	keep := false
+	defer func() {
+		tmp.Close()
+		if !keep {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := io.Copy(tmp, file); err != nil {
+		pubError(c, http.StatusBadRequest, "InvalidUpload", err.Error())
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	pkg, err := types.ReadPubArchive(tmp)
+	if err != nil {
+		pubError(c, http.StatusBadRequest, "InvalidPackage", err.Error())
+		return
+	}
+	storagePath := types.PubArchivePath(pkg.Name, pkg.Version)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		pubError(c, http.StatusConflict, "PackageRejected", fmt.Sprintf("version %s of package %s already exists", pkg.Version, pkg.Name))
+		return
+	}
+	if !s.pubUploads.attach(id, tmp.Name()) {
+		pubError(c, http.StatusBadRequest, "InvalidUpload", "an archive was already uploaded in this session")
+		return
+	}
+	keep = true
+
+	c.Header("Location", requestBaseURL(c)+"/"+repositoryName+"/api/packages/versions/newUploadFinish?upload_id="+id)
+	c.Status(http.StatusNoContent)
+}
+
+// pubFinishUpload serves GET /api/packages/versions/newUploadFinish, the last publish step,
+// which stores the uploaded archive
+func (s *Server) pubFinishUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	upload, ok := s.pubUploads.take(c.Query("upload_id"), repositoryName)
+	if !ok || upload.File == "" {
+		pubError(c, http.StatusBadRequest, "InvalidUpload", "unknown or expired upload session")
+		return
+	}
+	defer os.Remove(upload.File)
+
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		pubError(c, http.StatusNotFound, "NotFound", "repository not found")
+		return
+	}
+	archive, err := os.Open(upload.File)
+	if err != nil {
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	defer archive.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(sum, archive)
+	if err != nil {
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	pkg, err := types.ReadPubArchive(archive)
+	if err != nil {
+		pubError(c, http.StatusBadRequest, "InvalidPackage", err.Error())
+		return
+	}
+	pkg.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	pkg.Published = time.Now().UTC().Format(time.RFC3339)
+
+	storagePath := types.PubArchivePath(pkg.Name, pkg.Version)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		pubError(c, http.StatusConflict, "PackageRejected", fmt.Sprintf("version %s of package %s already exists", pkg.Version, pkg.Name))
+		return
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	var description string
+	var pubspec map[string]interface{}
+	if json.Unmarshal(pkg.Pubspec, &pubspec) == nil {
+		description, _ = pubspec["description"].(string)
+	}
+	if err := repo.Push(c.Request.Context(), storagePath, archive, &artifact.Metadata{
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+		Description: description,
+		Size:        size,
+		Checksum:    pkg.SHA256,
+		Properties:  pkg.Properties(),
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		pubError(c, pushErrorStatus(err, http.StatusInternalServerError), "InternalError", err.Error())
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	body, _ := json.Marshal(gin.H{"success": gin.H{"message": fmt.Sprintf("Successfully uploaded %s version %s.", pkg.Name, pkg.Version)}})
+	c.Data(http.StatusOK, pubMediaType, body)
+}
+
+// pubDelete serves DELETE /packages/:name/versions/:file; the version disappears from the listing with it
+func (s *Server) pubDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	storagePath, ok := pubArchivePath(c)
+	if !ok {
+		pubError(c, http.StatusNotFound, "NotFound", "archive not found")
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		pubError(c, http.StatusNotFound, "NotFound", "repository not found")
+		return
+	}
+
+	if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+		pubError(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Artifact deleted successfully"})
+}
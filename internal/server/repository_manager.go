@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
 	"github.com/hbahadorzadeh/ganje/internal/config"
 	"github.com/hbahadorzadeh/ganje/internal/database"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
 	"github.com/hbahadorzadeh/ganje/internal/metrics"
 	"github.com/hbahadorzadeh/ganje/internal/repository"
 	"github.com/hbahadorzadeh/ganje/internal/storage"
@@ -19,17 +23,17 @@ type RepositoryManager struct {
 	repositories map[string]repository.Repository
 	config       *config.Config
 	db           *database.DB
-	storage      storage.Storage
+	pools        storage.Pools
 	factory      artifact.Factory
 	metricsService *metrics.MetricsService
+	// quota is the global quota, and publisher receives quota warnings
+	quota        repository.Quota
+	publisher    messaging.Publisher
 	mutex        sync.RWMutex
 }
 
-// NewRepositoryManager creates a new repository manager
-func NewRepositoryManager(cfg *config.Config, db *database.DB, metricsService *metrics.MetricsService) repository.Manager {
-	// Initialize storage
-	localStorage := storage.NewLocalStorage(cfg.Storage.LocalPath)
-	
+// NewRepositoryManager creates a new repository manager binding repositories to pools
+func NewRepositoryManager(cfg *config.Config, db *database.DB, pools storage.Pools, quota repository.Quota, metricsService *metrics.MetricsService, publisher messaging.Publisher) repository.Manager {
 	// Initialize artifact factory
 	artifactFactory := artifact.NewFactory()
 
@@ -37,9 +41,11 @@ func NewRepositoryManager(cfg *config.Config, db *database.DB, metricsService *m
 		repositories: make(map[string]repository.Repository),
 		config:       cfg,
 		db:           db,
-		storage:      localStorage,
+		pools:        pools,
 		factory:      artifactFactory,
 		metricsService: metricsService,
+		quota:        quota,
+		publisher:    publisher,
 	}
 
 	// Load repositories from configuration
@@ -62,6 +68,201 @@ func NewRepositoryManager(cfg *config.Config, db *database.DB, metricsService *m
 	return manager
 }
 
+// NewStoragePools creates the default storage pool and the pools configured in
+// cfg.Storage.Pools, each with the deduplication, encryption and tiering configured
+func NewStoragePools(cfg *config.Config, db *database.DB) (storage.Pools, error) {
+	factory := storage.NewFactory()
+	backend, err := factory.CreateStorage(&storage.Config{
+		Type:      cfg.Storage.Type,
+		LocalPath: cfg.Storage.LocalPath,
+		Options:   cfg.Storage.Options,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Tiering sits at the bottom, so cold content stays encrypted and deduplicated; encryption
+	// sits below deduplication, so identical content still shares one blob
+	var layers storage.PoolLayers
+	if tiering := cfg.Storage.Tiering; tiering.Enabled {
+		layers.Cold, err = factory.CreateStorage(&storage.Config{
+			Type:      tiering.Cold.Type,
+			LocalPath: tiering.Cold.LocalPath,
+			Options:   tiering.Cold.Options,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize cold storage: %w", err)
+		}
+	}
+	if enc := cfg.Storage.Encryption; enc.Enabled {
+		layers.Keys, err = storage.LoadKeyring(enc.Key, enc.KeyFile, enc.PreviousKeys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load storage encryption keys: %w", err)
+		}
+	}
+	if cfg.Storage.Deduplicate {
+		layers.Refs = db
+	}
+
+	pools := storage.Pools{storage.DefaultPool: storage.NewPool(storage.DefaultPool, backend, "", layers)}
+	for name, poolCfg := range cfg.Storage.Pools {
+		if name == "" || name == storage.DefaultPool {
+			return nil, fmt.Errorf("invalid storage pool name %q", name)
+		}
+		poolBackend := backend
+		if poolCfg.Type != "" || poolCfg.LocalPath != "" {
+			poolBackend, err = factory.CreateStorage(&storage.Config{
+				Type:      poolCfg.Type,
+				LocalPath: poolCfg.LocalPath,
+				Options:   poolCfg.Options,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize storage pool %s: %w", name, err)
+			}
+		} else if strings.Trim(poolCfg.Prefix, "/") == "" {
+			return nil, fmt.Errorf("storage pool %s shares the default backend and needs a prefix", name)
+		}
+		pools[name] = storage.NewPool(name, poolBackend, poolCfg.Prefix, layers)
+	}
+	return pools, nil
+}
+
+// defaultScrubIgnore are the patterns of content generated from artifacts, which has no record
+var defaultScrubIgnore = []string{
+	types.APKIndexFile,
+	types.CocoaPodsAllPodsFile,
+	types.CocoaPodsDeprecatedFile,
+	"all_pods_versions_*.txt",
+}
+
+// NewScrubber creates the scrubber of pools configured in cfg.Storage.Scrub, which logs every
+// scrub and records its metrics in metricsService, if any
+func NewScrubber(cfg *config.Config, db *database.DB, pools storage.Pools, metricsService *metrics.MetricsService) (*storage.Scrubber, error) {
+	scrub := cfg.Storage.Scrub
+	for _, policy := range []string{scrub.OnMismatch, scrub.OnOrphan} {
+		switch storage.ScrubPolicy(policy) {
+		case "", storage.ScrubPolicyReport, storage.ScrubPolicyQuarantine, storage.ScrubPolicyRepair:
+		default:
+			return nil, fmt.Errorf("invalid scrub policy %q", policy)
+		}
+	}
+	return storage.NewScrubber(pools, db, storage.ScrubOptions{
+		OnMismatch:     storage.ScrubPolicy(scrub.OnMismatch),
+		OnOrphan:       storage.ScrubPolicy(scrub.OnOrphan),
+		BytesPerSecond: scrub.BytesPerSecond(),
+		Ignore:         append(append([]string{}, defaultScrubIgnore...), scrub.Ignore...),
+		PoolOf: func(ctx context.Context, name string) (string, error) {
+			repo, err := db.GetRepository(ctx, name)
+			if err != nil {
+				return "", fmt.Errorf("failed to get repository %s: %w", name, err)
+			}
+			return storagePoolOf(repo), nil
+		},
+		Done: func(report *storage.ScrubReport, err error) {
+			recordScrub(metricsService, report, err)
+		},
+	}), nil
+}
+
+// recordScrub logs the result of a storage scrub and records its metrics
+func recordScrub(metricsService *metrics.MetricsService, report *storage.ScrubReport, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+		fmt.Printf("Storage scrub failed: %v\n", err)
+	}
+	if report.Mismatched+report.Missing+report.Orphaned+report.Unreadable > 0 {
+		fmt.Printf("Storage scrub found %d mismatched, %d missing, %d orphaned and %d unreadable objects\n",
+			report.Mismatched, report.Missing, report.Orphaned, report.Unreadable)
+	}
+	if metricsService != nil {
+		metricsService.RecordScrub(status, report.Checked, report.Bytes, report.Counts(), report.FinishedAt,
+			report.FinishedAt.Sub(report.StartedAt))
+	}
+}
+
+// storagePoolOf returns the storage pool named by the options of a repository, empty for the
+// default pool
+func storagePoolOf(repo *database.Repository) string {
+	opts := map[string]string{}
+	if strings.TrimSpace(repo.Config) != "" {
+		_ = json.Unmarshal([]byte(repo.Config), &opts)
+	}
+	return opts[repository.StoragePoolOption]
+}
+
+// NewQuota parses the global quota configured in cfg.Storage.Quota
+func NewQuota(cfg *config.Config) (repository.Quota, error) {
+	return repository.NewQuota(cfg.Storage.Quota.MaxBytes, cfg.Storage.Quota.MaxArtifacts, cfg.Storage.Quota.SoftPercent)
+}
+
+// repositoryStorage returns the storage of a repository in the pool named by its options
+func (rm *RepositoryManager) repositoryStorage(config *repository.Config) (storage.Storage, error) {
+	pool, err := rm.pools.Get(config.Options[repository.StoragePoolOption])
+	if err != nil {
+		return nil, err
+	}
+	return pool.ForRepository(config.Name), nil
+}
+
+// ColdStorageMigrator moves the content of artifacts not pulled within the configured age to the
+// cold tier of the storage pool of their repository
+type ColdStorageMigrator struct {
+	config *config.Config
+	db     *database.DB
+	pools  storage.Pools
+}
+
+// NewColdStorageMigrator creates the migrator of pools configured in cfg.Storage.Tiering
+func NewColdStorageMigrator(cfg *config.Config, db *database.DB, pools storage.Pools) *ColdStorageMigrator {
+	return &ColdStorageMigrator{config: cfg, db: db, pools: pools}
+}
+
+// MigrateColdStorage runs one migration, returning the number of artifacts moved
+func (m *ColdStorageMigrator) MigrateColdStorage(ctx context.Context) (int, error) {
+	if !m.config.Storage.Tiering.Enabled {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-m.config.Storage.Tiering.ColdAfter())
+	views := map[string]storage.Storage{}
+	return storage.MigrateCold(ctx, m.db, cutoff, func(ctx context.Context, name string) (storage.Storage, error) {
+		if st, ok := views[name]; ok {
+			return st, nil
+		}
+		repo, err := m.db.GetRepository(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get repository %s: %w", name, err)
+		}
+		pool, err := m.pools.Get(storagePoolOf(repo))
+		if err != nil {
+			return nil, err
+		}
+		views[name] = pool.ForRepository(name)
+		return views[name], nil
+	})
+}
+
+// Run migrates content periodically until ctx is done
+func (m *ColdStorageMigrator) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Storage.Tiering.MigrationInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		moved, err := m.MigrateColdStorage(ctx)
+		if err != nil {
+			fmt.Printf("Cold storage migration failed: %v\n", err)
+		}
+		if moved > 0 {
+			fmt.Printf("Moved %d artifacts to cold storage\n", moved)
+		}
+	}
+}
+
 // GetRepository returns a repository by name
 func (rm *RepositoryManager) GetRepository(name string) (repository.Repository, error) {
 	rm.mutex.RLock()
@@ -101,6 +302,16 @@ func (rm *RepositoryManager) CreateRepository(config *repository.Config) (reposi
 	// Parse artifact type
 	artifactType := artifact.ArtifactType(config.ArtifactType)
 
+	if _, err := repository.QuotaFromOptions(config.Options); err != nil {
+		return nil, err
+	}
+
+	// Bind the repository to its storage pool
+	repoStorage, err := rm.repositoryStorage(config)
+	if err != nil {
+		return nil, err
+	}
+
 	var repo repository.Repository
 	var _ error
 
@@ -109,7 +320,7 @@ func (rm *RepositoryManager) CreateRepository(config *repository.Config) (reposi
 		repo = repository.NewLocalRepository(
 			config.Name,
 			artifactType,
-			rm.storage,
+			repoStorage,
 			rm.factory,
 			rm.db,
 		)
@@ -122,7 +333,7 @@ func (rm *RepositoryManager) CreateRepository(config *repository.Config) (reposi
 			config.Name,
 			artifactType,
 			config.URL,
-			rm.storage,
+			repoStorage,
 			rm.factory,
 			rm.db,
 		)
@@ -142,7 +353,7 @@ func (rm *RepositoryManager) CreateRepository(config *repository.Config) (reposi
 			config.Name,
 			artifactType,
 			upstreams,
-			rm.storage,
+			repoStorage,
 			rm.factory,
 			rm.db,
 		)
@@ -171,6 +382,11 @@ func (rm *RepositoryManager) CreateRepository(config *repository.Config) (reposi
 		return nil, fmt.Errorf("failed to save repository to database: %w", err)
 	}
 
+	// Enforce quotas on pushes to local repositories; virtual repositories push to those
+	if repo.GetType() == repository.Local {
+		repo = repository.NewQuotaWrapper(repo, rm.db, rm.quota, rm.publisher)
+	}
+
 	// Wrap repository with metrics if metrics service is available
 	if rm.metricsService != nil {
 		repo = repository.NewMetricsWrapper(repo, rm.metricsService)
@@ -41,6 +41,19 @@ func (r *RouteRegistry) registerDefaults() {
 	r.registrars[artifact.ArtifactTypeTerraform] = NewTerraformRouteRegistrar()
 	r.registrars[artifact.ArtifactTypeAnsible] = NewAnsibleRouteRegistrar()
 	r.registrars[artifact.ArtifactTypeBazel] = NewBazelRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeDebian] = NewDebianRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeRPM] = NewRPMRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeAPK] = NewAPKRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeConda] = NewCondaRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeComposer] = NewComposerRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeHex] = NewHexRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeSwift] = NewSwiftRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeConan] = NewConanRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeLFS] = NewLFSRouteRegistrar()
+	r.registrars[artifact.ArtifactTypePub] = NewPubRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeVagrant] = NewVagrantRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeCocoaPods] = NewCocoaPodsRouteRegistrar()
+	r.registrars[artifact.ArtifactTypeHuggingFace] = NewHuggingFaceRouteRegistrar()
 	r.registrars[artifact.ArtifactTypeGeneric] = NewGenericRouteRegistrar()
 }
 
@@ -30,6 +30,19 @@ func TestNewRouteRegistry(t *testing.T) {
         artifact.ArtifactTypeTerraform,
         artifact.ArtifactTypeAnsible,
         artifact.ArtifactTypeBazel,
+        artifact.ArtifactTypeDebian,
+        artifact.ArtifactTypeRPM,
+        artifact.ArtifactTypeAPK,
+        artifact.ArtifactTypeConda,
+        artifact.ArtifactTypeComposer,
+        artifact.ArtifactTypeHex,
+        artifact.ArtifactTypeSwift,
+        artifact.ArtifactTypeConan,
+        artifact.ArtifactTypeLFS,
+        artifact.ArtifactTypePub,
+        artifact.ArtifactTypeVagrant,
+        artifact.ArtifactTypeCocoaPods,
+        artifact.ArtifactTypeHuggingFace,
         artifact.ArtifactTypeGeneric,
     }
     
@@ -327,6 +340,19 @@ func TestAllArtifactTypeRegistrars(t *testing.T) {
 		artifact.ArtifactTypeTerraform,
 		artifact.ArtifactTypeAnsible,
 		artifact.ArtifactTypeBazel,
+		artifact.ArtifactTypeDebian,
+		artifact.ArtifactTypeRPM,
+		artifact.ArtifactTypeAPK,
+		artifact.ArtifactTypeConda,
+		artifact.ArtifactTypeComposer,
+		artifact.ArtifactTypeHex,
+		artifact.ArtifactTypeSwift,
+		artifact.ArtifactTypeConan,
+		artifact.ArtifactTypeLFS,
+		artifact.ArtifactTypePub,
+		artifact.ArtifactTypeVagrant,
+		artifact.ArtifactTypeCocoaPods,
+		artifact.ArtifactTypeHuggingFace,
 		artifact.ArtifactTypeGeneric,
 	}
 	
@@ -229,10 +229,15 @@ func NewAnsibleRouteRegistrar() RouteRegistrar {
 	}
 }
 
+// Routes follow the Galaxy v3 API used by `ansible-galaxy collection install/publish`
 func (a *AnsibleRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
-	router.GET("/api/v2/collections/:namespace/:name/", server.authMiddleware(), server.requireRead(), server.getIndex)
+	router.GET("/api/", server.authMiddleware(), server.requireRead(), server.ansibleAPIRoot)
+	router.GET("/api/v3/collections/:namespace/:name/", server.authMiddleware(), server.requireRead(), server.ansibleGetCollection)
+	router.GET("/api/v3/collections/:namespace/:name/versions/", server.authMiddleware(), server.requireRead(), server.ansibleListVersions)
+	router.GET("/api/v3/collections/:namespace/:name/versions/:version/", server.authMiddleware(), server.requireRead(), server.ansibleGetVersion)
+	router.POST("/api/v3/artifacts/collections/", server.authMiddleware(), server.requireWrite(), server.ansiblePublishCollection)
+	router.GET("/api/v3/imports/collections/:id/", server.authMiddleware(), server.requireRead(), server.ansibleGetImportTask)
 	router.GET("/download/:filename", server.authMiddleware(), server.requireRead(), server.pullArtifact)
-	router.POST("/api/v2/collections/", server.authMiddleware(), server.requireWrite(), server.pushArtifact)
 }
 
 // BazelRouteRegistrar handles Bazel Remote Cache routes
@@ -246,16 +251,323 @@ func NewBazelRouteRegistrar() RouteRegistrar {
 	}
 }
 
-// Routes follow Bazel HTTP cache layout: /ac/<key> (action cache), /cas/<hash> (content-addressable store)
+// Routes follow Bazel HTTP cache layout: /ac/<key> (action cache), /cas/<hash> (content-addressable store).
+// CAS uploads must hash to their key and AC uploads must be well-formed ActionResult protobufs.
 func (b *BazelRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
-	// GET/HEAD to read, PUT to write, DELETE optional
-	router.HEAD("/ac/*path", server.authMiddleware(), server.requireRead(), server.pullArtifact)
+	// HEAD for existence checks, GET to read, PUT to write, DELETE optional
+	router.HEAD("/ac/*path", server.authMiddleware(), server.requireRead(), server.bazelHead)
 	router.GET("/ac/*path", server.authMiddleware(), server.requireRead(), server.pullArtifact)
-	router.PUT("/ac/*path", server.authMiddleware(), server.requireWrite(), server.pushArtifact)
+	router.PUT("/ac/*path", server.authMiddleware(), server.requireWrite(), server.bazelPutAC)
 	router.DELETE("/ac/*path", server.authMiddleware(), server.requireWrite(), server.deleteArtifact)
 
-	router.HEAD("/cas/*path", server.authMiddleware(), server.requireRead(), server.pullArtifact)
-	router.GET("/cas/*path", server.authMiddleware(), server.requireRead(), server.pullArtifact)
-	router.PUT("/cas/*path", server.authMiddleware(), server.requireWrite(), server.pushArtifact)
+	router.HEAD("/cas/*path", server.authMiddleware(), server.requireRead(), server.bazelHead)
+	router.GET("/cas/*path", server.authMiddleware(), server.requireRead(), server.bazelGetCAS)
+	router.PUT("/cas/*path", server.authMiddleware(), server.requireWrite(), server.bazelPutCAS)
 	router.DELETE("/cas/*path", server.authMiddleware(), server.requireWrite(), server.deleteArtifact)
 }
+
+// DebianRouteRegistrar handles Debian/APT repository routes
+type DebianRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewDebianRouteRegistrar() RouteRegistrar {
+	return &DebianRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeDebian),
+	}
+}
+
+// Routes follow the APT archive layout (dists/ indexes, pool/ packages) so the repository
+// can be used directly as an apt source; indexes are generated from the published packages.
+func (d *DebianRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/dists/*path", server.authMiddleware(), server.requireRead(), server.debianDists)
+	router.GET("/pool/*path", server.authMiddleware(), server.requireRead(), server.pullArtifact)
+	router.DELETE("/pool/*path", server.authMiddleware(), server.requireWrite(), server.deleteArtifact)
+	router.GET("/public.key", server.authMiddleware(), server.requireRead(), server.signingPublicKey)
+	router.POST("/api/packages/:distribution/:component", server.authMiddleware(), server.requireWrite(), server.debianUpload)
+}
+
+// RPMRouteRegistrar handles RPM (YUM/DNF) repository routes
+type RPMRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewRPMRouteRegistrar() RouteRegistrar {
+	return &RPMRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeRPM),
+	}
+}
+
+// Routes follow the createrepo layout (repodata/ metadata, Packages/ files) so the repository
+// can be used as a dnf/yum baseurl; repodata is regenerated whenever the package set changes.
+func (r *RPMRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/repodata/:file", server.authMiddleware(), server.requireRead(), server.rpmRepodataFile)
+	router.GET("/Packages/*path", server.authMiddleware(), server.requireRead(), server.pullArtifact)
+	router.DELETE("/Packages/*path", server.authMiddleware(), server.requireWrite(), server.deleteArtifact)
+	router.GET("/public.key", server.authMiddleware(), server.requireRead(), server.signingPublicKey)
+	router.POST("/api/packages", server.authMiddleware(), server.requireWrite(), server.rpmUpload)
+}
+
+// APKRouteRegistrar handles Alpine (apk) repository routes
+type APKRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewAPKRouteRegistrar() RouteRegistrar {
+	return &APKRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeAPK),
+	}
+}
+
+// Routes follow the Alpine mirror layout (<branch>/<repo>/<arch>/) so "<base>/<branch>/<repo>"
+// can be added to /etc/apk/repositories; APKINDEX.tar.gz files are kept up to date on push and delete.
+func (a *APKRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/keys/:name", server.authMiddleware(), server.requireRead(), server.apkPublicKey)
+	router.GET("/:branch/:repo/:arch/:file", server.authMiddleware(), server.requireRead(), server.apkFile)
+	router.DELETE("/:branch/:repo/:arch/:file", server.authMiddleware(), server.requireWrite(), server.apkDelete)
+	router.POST("/api/packages/:branch/:repo", server.authMiddleware(), server.requireWrite(), server.apkUpload)
+}
+
+// CondaRouteRegistrar handles conda channel routes
+type CondaRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewCondaRouteRegistrar() RouteRegistrar {
+	return &CondaRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeConda),
+	}
+}
+
+// Routes follow the channel layout (<subdir>/repodata.json next to the packages) so the repository
+// URL can be passed to "conda install -c"; remote repositories proxy a channel such as conda.anaconda.org/conda-forge.
+func (a *CondaRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/:subdir/:file", server.authMiddleware(), server.requireRead(), server.condaFile)
+	router.DELETE("/:subdir/:file", server.authMiddleware(), server.requireWrite(), server.condaDelete)
+	router.POST("/api/packages", server.authMiddleware(), server.requireWrite(), server.condaUpload)
+}
+
+// ComposerRouteRegistrar handles Composer (PHP) repository routes
+type ComposerRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewComposerRouteRegistrar() RouteRegistrar {
+	return &ComposerRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeComposer),
+	}
+}
+
+// Routes implement the Composer v2 repository protocol: packages.json points clients at
+// /p2/<vendor>/<package>.json through metadata-url, and dist archives are served from /dists.
+func (a *ComposerRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/packages.json", server.authMiddleware(), server.requireRead(), server.composerPackagesJSON)
+	router.GET("/p2/:vendor/:file", server.authMiddleware(), server.requireRead(), server.composerMetadata)
+	router.GET("/dists/:vendor/:package/:version/:file", server.authMiddleware(), server.requireRead(), server.composerDist)
+	router.DELETE("/dists/:vendor/:package/:version/:file", server.authMiddleware(), server.requireWrite(), server.composerDelete)
+	router.POST("/api/packages", server.authMiddleware(), server.requireWrite(), server.composerUpload)
+}
+
+// HexRouteRegistrar handles Hex (Elixir/Erlang) repository routes
+type HexRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewHexRouteRegistrar() RouteRegistrar {
+	return &HexRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeHex),
+	}
+}
+
+// Routes serve the Hex registry (v2) to "mix hex.repo add" and the subset of the HTTP API
+// used by "mix hex.publish" when HEX_API_URL points at <repository>/api.
+func (a *HexRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/names", server.authMiddleware(), server.requireRead(), server.hexRegistryResource)
+	router.GET("/versions", server.authMiddleware(), server.requireRead(), server.hexRegistryResource)
+	router.GET("/packages/:name", server.authMiddleware(), server.requireRead(), server.hexRegistryResource)
+	router.GET("/tarballs/:file", server.authMiddleware(), server.requireRead(), server.hexTarball)
+	router.GET("/public_key", server.authMiddleware(), server.requireRead(), server.hexPublicKey)
+	router.POST("/api/publish", server.authMiddleware(), server.requireWrite(), server.hexPublish)
+	router.DELETE("/api/packages/:name/releases/:version", server.authMiddleware(), server.requireWrite(), server.hexRevert)
+}
+
+// SwiftRouteRegistrar handles Swift Package Registry routes
+type SwiftRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewSwiftRouteRegistrar() RouteRegistrar {
+	return &SwiftRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeSwift),
+	}
+}
+
+// Routes implement the SE-0292 registry API so the repository URL can be passed to
+// "swift package-registry set"; source archives are addressed as /<scope>/<name>/<version>.zip.
+func (a *SwiftRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/identifiers", server.authMiddleware(), server.requireRead(), server.swiftAPIVersion(), server.swiftLookup)
+	router.POST("/login", server.authMiddleware(), server.requireRead(), server.swiftAPIVersion(), server.swiftLogin)
+	router.GET("/:scope/:name", server.authMiddleware(), server.requireRead(), server.swiftAPIVersion(), server.swiftListReleases)
+	router.GET("/:scope/:name/:version", server.authMiddleware(), server.requireRead(), server.swiftAPIVersion(), server.swiftRelease)
+	router.GET("/:scope/:name/:version/Package.swift", server.authMiddleware(), server.requireRead(), server.swiftAPIVersion(), server.swiftManifest)
+	router.PUT("/:scope/:name/:version", server.authMiddleware(), server.requireWrite(), server.swiftAPIVersion(), server.swiftPublish)
+	router.DELETE("/:scope/:name/:version", server.authMiddleware(), server.requireWrite(), server.swiftAPIVersion(), server.swiftDelete)
+}
+
+// ConanRouteRegistrar handles Conan v2 routes
+type ConanRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewConanRouteRegistrar() RouteRegistrar {
+	return &ConanRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeConan),
+	}
+}
+
+// Routes implement the Conan v2 REST API with revisions; the repository URL is added with
+// "conan remote add". Recipes without user and channel use "_" for both in the path.
+func (a *ConanRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/v1/ping", server.conanPing)
+	router.GET("/v2/users/authenticate", server.conanAuthenticate)
+	router.GET("/v2/users/check_credentials", server.authMiddleware(), server.requireRead(), server.conanCheckCredentials)
+	router.GET("/v2/conans/search", server.authMiddleware(), server.requireRead(), server.conanSearch)
+
+	recipe := "/v2/conans/:name/:version/:user/:channel"
+	router.DELETE(recipe, server.authMiddleware(), server.requireWrite(), server.conanDelete)
+	router.GET(recipe+"/latest", server.authMiddleware(), server.requireRead(), server.conanLatest)
+	router.GET(recipe+"/revisions", server.authMiddleware(), server.requireRead(), server.conanRevisions)
+	router.GET(recipe+"/search", server.authMiddleware(), server.requireRead(), server.conanSearchPackages)
+
+	recipeRevision := recipe + "/revisions/:rrev"
+	router.DELETE(recipeRevision, server.authMiddleware(), server.requireWrite(), server.conanDelete)
+	router.GET(recipeRevision+"/files", server.authMiddleware(), server.requireRead(), server.conanFileList)
+	router.GET(recipeRevision+"/files/:file", server.authMiddleware(), server.requireRead(), server.conanDownload)
+	router.PUT(recipeRevision+"/files/:file", server.authMiddleware(), server.requireWrite(), server.conanUpload)
+	router.GET(recipeRevision+"/search", server.authMiddleware(), server.requireRead(), server.conanSearchPackages)
+	router.DELETE(recipeRevision+"/packages", server.authMiddleware(), server.requireWrite(), server.conanDelete)
+
+	pkg := recipeRevision + "/packages/:package_id"
+	router.GET(pkg+"/latest", server.authMiddleware(), server.requireRead(), server.conanLatest)
+	router.GET(pkg+"/revisions", server.authMiddleware(), server.requireRead(), server.conanRevisions)
+
+	packageRevision := pkg + "/revisions/:prev"
+	router.DELETE(packageRevision, server.authMiddleware(), server.requireWrite(), server.conanDelete)
+	router.GET(packageRevision+"/files", server.authMiddleware(), server.requireRead(), server.conanFileList)
+	router.GET(packageRevision+"/files/:file", server.authMiddleware(), server.requireRead(), server.conanDownload)
+	router.PUT(packageRevision+"/files/:file", server.authMiddleware(), server.requireWrite(), server.conanUpload)
+}
+
+// LFSRouteRegistrar handles Git LFS routes
+type LFSRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewLFSRouteRegistrar() RouteRegistrar {
+	return &LFSRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeLFS),
+	}
+}
+
+// Routes implement the Git LFS batch API with the basic transfer adapter and the file locking API;
+// the repository URL is set as "lfs.url". Batch uploads additionally require write permission.
+func (a *LFSRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.POST("/objects/batch", server.lfsAuthMiddleware(), server.requireRead(), lfsRequestIsJSON, server.lfsBatch)
+	router.GET("/objects/:oid", server.lfsAuthMiddleware(), server.requireRead(), server.lfsDownload)
+	router.PUT("/objects/:oid", server.lfsAuthMiddleware(), server.requireWrite(), server.lfsUpload)
+	router.POST("/objects/verify", server.lfsAuthMiddleware(), server.requireWrite(), lfsRequestIsJSON, server.lfsVerify)
+
+	router.GET("/locks", server.lfsAuthMiddleware(), server.requireRead(), server.lfsListLocks)
+	router.POST("/locks", server.lfsAuthMiddleware(), server.requireWrite(), lfsRequestIsJSON, server.lfsCreateLock)
+	router.POST("/locks/verify", server.lfsAuthMiddleware(), server.requireWrite(), lfsRequestIsJSON, server.lfsVerifyLocks)
+	router.POST("/locks/:id/unlock", server.lfsAuthMiddleware(), server.requireWrite(), lfsRequestIsJSON, server.lfsUnlock)
+}
+
+// PubRouteRegistrar handles Dart pub routes
+type PubRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewPubRouteRegistrar() RouteRegistrar {
+	return &PubRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypePub),
+	}
+}
+
+// Routes implement the hosted pub repository v2 API; the repository URL is used as PUB_HOSTED_URL
+// or a "hosted" dependency source. The archive upload step is authorized by its publish session.
+func (a *PubRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/api/packages/:name", server.authMiddleware(), server.requireRead(), server.pubListVersions)
+	router.GET("/api/packages/versions/new", server.authMiddleware(), server.requireWrite(), server.pubNewVersion)
+	router.POST("/api/packages/versions/newUpload", server.pubUploadArchive)
+	router.GET("/api/packages/versions/newUploadFinish", server.authMiddleware(), server.requireWrite(), server.pubFinishUpload)
+	router.GET("/packages/:name/versions/:file", server.authMiddleware(), server.requireRead(), server.pubDownload)
+	router.DELETE("/packages/:name/versions/:file", server.authMiddleware(), server.requireWrite(), server.pubDelete)
+}
+
+// VagrantRouteRegistrar handles Vagrant box routes
+type VagrantRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewVagrantRouteRegistrar() RouteRegistrar {
+	return &VagrantRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeVagrant),
+	}
+}
+
+// Routes serve box metadata at /<org>/<box>, the URL passed to "vagrant box add"; with
+// VAGRANT_SERVER_URL set to the repository URL, boxes can also be added as <org>/<box>.
+func (a *VagrantRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/:org/:box", server.authMiddleware(), server.requireRead(), server.vagrantMetadata)
+	router.GET("/:org/:box/:version/:file", server.authMiddleware(), server.requireRead(), server.vagrantDownload)
+	router.PUT("/:org/:box/:version/:file", server.authMiddleware(), server.requireWrite(), server.vagrantUpload)
+	router.DELETE("/:org/:box/:version/:file", server.authMiddleware(), server.requireWrite(), server.vagrantDelete)
+}
+
+// CocoaPodsRouteRegistrar handles CocoaPods spec repository routes
+type CocoaPodsRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewCocoaPodsRouteRegistrar() RouteRegistrar {
+	return &CocoaPodsRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeCocoaPods),
+	}
+}
+
+// Routes serve the CDN spec repository layout, so the repository URL can be used as a Podfile
+// "source"; podspecs and source archives are uploaded through /api/pods.
+func (a *CocoaPodsRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	router.GET("/:file", server.authMiddleware(), server.requireRead(), server.cocoapodsRootFile)
+	router.GET("/Specs/:a/:b/:c/:pod/:version/:file", server.authMiddleware(), server.requireRead(), server.cocoapodsSpec)
+	router.GET("/sources/:pod/:version/:file", server.authMiddleware(), server.requireRead(), server.cocoapodsSource)
+	router.POST("/api/pods", server.authMiddleware(), server.requireWrite(), server.cocoapodsPush)
+	router.DELETE("/api/pods/:pod/:version", server.authMiddleware(), server.requireWrite(), server.cocoapodsDelete)
+}
+
+// HuggingFaceRouteRegistrar handles Hugging Face model repository routes
+type HuggingFaceRouteRegistrar struct {
+	*BaseRouteRegistrar
+}
+
+func NewHuggingFaceRouteRegistrar() RouteRegistrar {
+	return &HuggingFaceRouteRegistrar{
+		BaseRouteRegistrar: NewBaseRouteRegistrar(artifact.ArtifactTypeHuggingFace),
+	}
+}
+
+// Routes implement the read subset of the Hugging Face Hub API, so the repository URL can be used
+// as HF_ENDPOINT; files are uploaded to a branch with PUT on their resolve URL. Model ids are
+// routed with and without a namespace, as in openai/whisper-tiny and gpt2; the wildcard of the
+// first segment is named :org in both, as gin requires.
+func (a *HuggingFaceRouteRegistrar) RegisterRoutes(router *gin.RouterGroup, server *Server) {
+	for _, id := range []string{"/:org/:model", "/:org"} {
+		router.GET("/api/models"+id, server.authMiddleware(), server.requireRead(), server.huggingfaceModelInfo)
+		router.GET("/api/models"+id+"/revision/:revision", server.authMiddleware(), server.requireRead(), server.huggingfaceModelInfo)
+		router.GET(id+"/resolve/:revision/*file", server.authMiddleware(), server.requireRead(), server.huggingfaceResolve)
+		router.HEAD(id+"/resolve/:revision/*file", server.authMiddleware(), server.requireRead(), server.huggingfaceResolve)
+		router.PUT(id+"/resolve/:revision/*file", server.authMiddleware(), server.requireWrite(), server.huggingfaceUpload)
+		router.DELETE(id+"/resolve/:revision/*file", server.authMiddleware(), server.requireWrite(), server.huggingfaceDelete)
+	}
+}
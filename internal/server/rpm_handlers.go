@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+)
+
+// rpmRepodataCache keeps the generated repodata of each repository until its packages change;
+// the zero value is ready to use
+type rpmRepodataCache struct {
+	mu      sync.Mutex
+	entries map[string]rpmRepodataEntry
+}
+
+type rpmRepodataEntry struct {
+	fingerprint string
+	repodata    *types.RPMRepodata
+}
+
+func (rc *rpmRepodataCache) get(repositoryName, fingerprint string) *types.RPMRepodata {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if e, ok := rc.entries[repositoryName]; ok && e.fingerprint == fingerprint {
+		return e.repodata
+	}
+	return nil
+}
+
+func (rc *rpmRepodataCache) put(repositoryName, fingerprint string, repodata *types.RPMRepodata) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.entries == nil {
+		rc.entries = make(map[string]rpmRepodataEntry)
+	}
+	rc.entries[repositoryName] = rpmRepodataEntry{fingerprint: fingerprint, repodata: repodata}
+}
+
+// rpmRepodata returns the repodata of a repository, regenerating it when packages were
+// added or removed since it was last built. Generation only depends on database records,
+// so every server instance produces identical metadata for the same package set.
+func (s *Server) rpmRepodata(ctx context.Context, repositoryName string) (*types.RPMRepodata, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []*types.RPMPackage
+	var latest time.Time
+	fingerprint := sha256.New()
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypeRPM) {
+			continue
+		}
+		pkg, err := types.RPMPackageFromMetadata(artifactProperties(a))
+		if err != nil {
+			continue
+		}
+		pkg.Location = a.Path
+		if pkg.Checksum == "" {
+			pkg.Checksum = a.Checksum
+		}
+		pkg.PackageSize = a.Size
+		pkg.FileTime = a.CreatedAt.Unix()
+		pkgs = append(pkgs, pkg)
+		if a.CreatedAt.After(latest) {
+			latest = a.CreatedAt
+		}
+		fmt.Fprintf(fingerprint, "%d\x00%s\x00%s\x00%d\n", a.ID, a.Path, a.Checksum, a.CreatedAt.UnixNano())
+	}
+
+	key := hex.EncodeToString(fingerprint.Sum(nil))
+	if cached := s.rpmRepodataCache.get(repositoryName, key); cached != nil {
+		return cached, nil
+	}
+	var timestamp int64
+	if !latest.IsZero() {
+		timestamp = latest.Unix()
+	}
+	repodata := types.GenerateRPMRepodata(pkgs, timestamp)
+	s.rpmRepodataCache.put(repositoryName, key, repodata)
+	return repodata, nil
+}
+
+// rpmRepodataFile serves GET /repodata/:file: repomd.xml, its detached signature and the compressed metadata it lists
+func (s *Server) rpmRepodataFile(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	file := c.Param("file")
+
+	repodata, err := s.rpmRepodata(c.Request.Context(), repositoryName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch file {
+	case "repomd.xml":
+		c.Data(http.StatusOK, "application/xml", repodata.RepoMD)
+	case "repomd.xml.asc":
+		entity, err := s.repositorySigningKey(c.Request.Context(), repositoryName)
+		if errors.Is(err, errNoSigningKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		signature, err := detachSign(entity, repodata.RepoMD)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", signature)
+	default:
+		content, ok := repodata.File(file)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.Data(http.StatusOK, "application/gzip", content)
+	}
+}
+
+// rpmUpload accepts POST /api/packages with an .rpm as the raw body or a multipart "file"
+func (s *Server) rpmUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	// Spool to disk while computing the package checksum used as pkgid
+	tmp, err := os.CreateTemp("", "ganje-rpm-*.rpm")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sha256sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sha256sum), body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	pkg, err := types.ReadRPMHeader(tmp)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	storagePath := "Packages/" + pkg.Filename()
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is already published", storagePath)})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	props := pkg.Metadata()
+	props["location"] = storagePath
+	props["size"] = strconv.FormatInt(size, 10)
+	props["sha256"] = hex.EncodeToString(sha256sum.Sum(nil))
+	version := pkg.Version + "-" + pkg.Release
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:        pkg.Name,
+		Version:     version,
+		Description: pkg.Summary,
+		Size:        size,
+		Checksum:    props["sha256"],
+		Properties:  props,
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       pkg.Name,
+			Version:    version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"name":     pkg.Name,
+		"epoch":    pkg.Epoch,
+		"version":  pkg.Version,
+		"release":  pkg.Release,
+		"arch":     pkg.Arch,
+		"location": storagePath,
+	})
+}
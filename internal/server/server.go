@@ -15,6 +15,8 @@ import (
 	"github.com/hbahadorzadeh/ganje/internal/messaging"
 	"github.com/hbahadorzadeh/ganje/internal/metrics"
 	"github.com/hbahadorzadeh/ganje/internal/repository"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+	"google.golang.org/grpc"
 )
 
 // Server represents the HTTP server
@@ -29,7 +31,44 @@ type Server struct {
 	routeRegistry *RouteRegistry
 	metrics       *metrics.MetricsService
 	metricsServer *metrics.MetricsServer
+	grpcServer    *grpc.Server
 	startTime     time.Time
+
+	// ansibleImports tracks asynchronous Galaxy collection imports
+	ansibleImports ansibleImportStore
+
+	// rpmRepodataCache holds generated YUM repodata per repository
+	rpmRepodataCache rpmRepodataCache
+
+	// pubUploads tracks pub publish sessions between the upload and finalize steps
+	pubUploads pubUploadStore
+
+	// keyRotator rewraps the data keys of encrypted storage; nil when encryption is disabled
+	keyRotator keyRotator
+
+	// coldMigrator moves content not pulled recently to cold storage; nil when tiering is disabled
+	coldMigrator coldMigrator
+
+	// scrubber verifies stored content against the database
+	scrubber storageScrubber
+}
+
+// keyRotator rewraps data keys with the primary master key
+type keyRotator interface {
+	Rotate(ctx context.Context) (int, error)
+}
+
+// coldMigrator moves content not pulled recently to cold storage
+type coldMigrator interface {
+	Run(ctx context.Context)
+}
+
+// storageScrubber verifies stored content against the database
+type storageScrubber interface {
+	Start(ctx context.Context) error
+	Schedule(ctx context.Context, interval time.Duration)
+	LastReport() *storage.ScrubReport
+	Running() bool
 }
 
 // New creates a new server instance
@@ -70,15 +109,6 @@ func New(cfg *config.Config) *Server {
 		metricsService.SetSystemInfo("1.0.0", runtime.Version())
 	}
 
-	// Initialize repository manager
-	repoManager := NewRepositoryManager(cfg, db, metricsService)
-
-	// Initialize metrics server if separate server is enabled
-	var metricsServer *metrics.MetricsServer
-	if cfg.Metrics.Enabled && cfg.Metrics.SeparateServer {
-		metricsServer = metrics.NewMetricsServer(cfg.Metrics.Port, metricsService)
-	}
-
 	// Initialize messaging publisher (RabbitMQ or Noop)
 	var publisher messaging.Publisher = &messaging.NoopPublisher{}
 	if cfg.Messaging.RabbitMQ.Enabled {
@@ -95,6 +125,31 @@ func New(cfg *config.Config) *Server {
 		}
 	}
 
+	// Initialize storage pools, shared by the repositories and the storage services
+	pools, err := NewStoragePools(cfg, db)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize storage: %v", err))
+	}
+
+	quota, err := NewQuota(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize storage quota: %v", err))
+	}
+
+	scrubber, err := NewScrubber(cfg, db, pools, metricsService)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize storage scrubber: %v", err))
+	}
+
+	// Initialize repository manager
+	repoManager := NewRepositoryManager(cfg, db, pools, quota, metricsService, publisher)
+
+	// Initialize metrics server if separate server is enabled
+	var metricsServer *metrics.MetricsServer
+	if cfg.Metrics.Enabled && cfg.Metrics.SeparateServer {
+		metricsServer = metrics.NewMetricsServer(cfg.Metrics.Port, metricsService)
+	}
+
 	server := &Server{
 		config:        cfg,
 		db:            db,
@@ -106,6 +161,14 @@ func New(cfg *config.Config) *Server {
 		metrics:       metricsService,
 		metricsServer: metricsServer,
 		startTime:     time.Now(),
+		scrubber:      scrubber,
+	}
+
+	if cfg.Storage.Encryption.Enabled {
+		server.keyRotator = pools
+	}
+	if cfg.Storage.Tiering.Enabled {
+		server.coldMigrator = NewColdStorageMigrator(cfg, db, pools)
 	}
 
 	// Webhook dispatcher now runs as a standalone service.
@@ -172,6 +235,10 @@ func (s *Server) setupRoutes() {
 
 		// Statistics
 		api.GET("/repositories/:name/stats", s.authMiddleware(), s.getRepositoryStats)
+		api.GET("/storage/dedup", s.authMiddleware(), s.requireAdmin(), s.getDedupSavings)
+		api.POST("/storage/encryption/rotate", s.authMiddleware(), s.requireAdmin(), s.rotateEncryptionKeys)
+		api.GET("/storage/scrub", s.authMiddleware(), s.requireAdmin(), s.getStorageScrub)
+		api.POST("/storage/scrub", s.authMiddleware(), s.requireAdmin(), s.startStorageScrub)
 
 		// Artifacts (admin portal)
 		api.GET("/repositories/:name/artifacts", s.authMiddleware(), s.requireRead(), s.listArtifacts)
@@ -221,11 +288,31 @@ func (s *Server) Start() error {
 		fmt.Printf("Metrics server started on port %d\n", s.config.Metrics.Port)
 	}
 
+	// Start Bazel remote cache gRPC listener if configured
+	if s.config.Server.GRPCPort > 0 {
+		go func() {
+			if err := s.startBazelGRPC(); err != nil {
+				fmt.Printf("gRPC server failed to start: %v\n", err)
+			}
+		}()
+		fmt.Printf("gRPC server started on port %d\n", s.config.Server.GRPCPort)
+	}
+
 	// Start uptime tracking
 	if s.metrics != nil {
 		go s.trackUptime()
 	}
 
+	// Start moving content not pulled recently to cold storage
+	if s.coldMigrator != nil {
+		go s.coldMigrator.Run(context.Background())
+	}
+
+	// Start verifying stored content periodically
+	if s.scrubber != nil && s.config.Storage.Scrub.Enabled {
+		go s.scrubber.Schedule(context.Background(), s.config.Storage.Scrub.Interval())
+	}
+
 	// Start main server
 	addr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)
 	return s.router.Run(addr)
@@ -242,6 +329,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// Stop accepting gRPC calls and let in-flight ones finish
+	if s.grpcServer != nil {
+		s.grpcServer.GracefulStop()
+	}
+
 	// Close messaging publisher
 	if s.publisher != nil {
 		if closeErr := s.publisher.Close(); closeErr != nil && err == nil {
@@ -355,26 +447,7 @@ func (s *Server) requirePermission(permission auth.Permission) gin.HandlerFunc {
 		}
 
 		authContext := authCtx.(*auth.AuthContext)
-        // Prefer explicit route params set for admin/API endpoints
-        repository := c.Param("name")
-        if repository == "" {
-            repository = c.Param("repository")
-        }
-        // For non-API dynamic routes (e.g., repoName/... at root), derive from path
-        if repository == "" {
-            fullPath := c.Request.URL.Path
-            // If this is an API path, do not guess a repository from "/api/..."
-            if !strings.HasPrefix(fullPath, "/api/") {
-                if len(fullPath) > 1 {
-                    trimmed := strings.TrimPrefix(fullPath, "/")
-                    if i := strings.Index(trimmed, "/"); i >= 0 {
-                        repository = trimmed[:i]
-                    } else {
-                        repository = trimmed
-                    }
-                }
-            }
-        }
+		repository := permissionRepository(c)
 
 		claims := &auth.Claims{
 			Username: authContext.Username,
@@ -392,6 +465,21 @@ func (s *Server) requirePermission(permission auth.Permission) gin.HandlerFunc {
 	}
 }
 
+// permissionRepository returns the repository a request is authorized against. API endpoints
+// name it in a :name or :repository parameter; other requests are repository routes whose first
+// path segment is the repository, and whose :name parameter, if any, is a package name.
+func permissionRepository(c *gin.Context) string {
+	fullPath := c.Request.URL.Path
+	if strings.HasPrefix(fullPath, "/api/") {
+		if repository := c.Param("name"); repository != "" {
+			return repository
+		}
+		return c.Param("repository")
+	}
+	repository, _, _ := strings.Cut(strings.TrimPrefix(fullPath, "/"), "/")
+	return repository
+}
+
 // handleAuthCallback handles OIDC authentication callback
 func (s *Server) handleAuthCallback(c *gin.Context) {
 	if s.oidcService == nil {
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -124,6 +125,14 @@ func (m *MockDB) GetArtifactByPath(ctx context.Context, repositoryName, path str
 	return args.Get(0).(*database.ArtifactInfo), args.Error(1)
 }
 
+func (m *MockDB) GetArtifactsByPaths(ctx context.Context, repositoryName string, paths []string) ([]*database.ArtifactInfo, error) {
+	args := m.Called(ctx, repositoryName, paths)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*database.ArtifactInfo), args.Error(1)
+}
+
 func (m *MockDB) DeleteArtifactByPath(ctx context.Context, repositoryName, path string) error {
 	args := m.Called(ctx, repositoryName, path)
 	return args.Error(0)
@@ -142,6 +151,14 @@ func (m *MockDB) GetRepositoryStatistics(ctx context.Context, repositoryName str
 	return args.Get(0).(*database.Statistics), args.Error(1)
 }
 
+func (m *MockDB) GetStorageStatistics(ctx context.Context) (*database.Statistics, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*database.Statistics), args.Error(1)
+}
+
 func (m *MockDB) LogAccess(ctx context.Context, log *database.AccessLog) error {
 	args := m.Called(ctx, log)
 	return args.Error(0)
@@ -152,6 +169,11 @@ func (m *MockDB) UpdateArtifactYanked(ctx context.Context, repositoryName, name,
 	return args.Error(0)
 }
 
+func (m *MockDB) UpdateArtifactMetadata(ctx context.Context, id uint, metadata string) error {
+	args := m.Called(ctx, id, metadata)
+	return args.Error(0)
+}
+
 // Webhook methods to satisfy DatabaseInterface
 func (m *MockDB) CreateWebhook(ctx context.Context, repoName string, hook *database.Webhook) error {
 	args := m.Called(ctx, repoName, hook)
@@ -189,6 +211,60 @@ func (m *MockDB) RecordWebhookDelivery(ctx context.Context, delivery *database.W
 	return args.Error(0)
 }
 
+// Conan revision methods to satisfy DatabaseInterface
+func (m *MockDB) SaveConanRevision(ctx context.Context, repoName string, rev *database.ConanRevision) error {
+	args := m.Called(ctx, repoName, rev)
+	return args.Error(0)
+}
+
+func (m *MockDB) ListConanRevisions(ctx context.Context, repoName, reference, recipeRevision, packageID string) ([]*database.ConanRevision, error) {
+	args := m.Called(ctx, repoName, reference, recipeRevision, packageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*database.ConanRevision), args.Error(1)
+}
+
+func (m *MockDB) GetLatestConanRevision(ctx context.Context, repoName, reference, recipeRevision, packageID string) (*database.ConanRevision, error) {
+	args := m.Called(ctx, repoName, reference, recipeRevision, packageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*database.ConanRevision), args.Error(1)
+}
+
+func (m *MockDB) DeleteConanRevisions(ctx context.Context, repoName, reference, recipeRevision, packageID, packageRevision string) error {
+	args := m.Called(ctx, repoName, reference, recipeRevision, packageID, packageRevision)
+	return args.Error(0)
+}
+
+// Git LFS lock methods to satisfy DatabaseInterface
+func (m *MockDB) CreateLFSLock(ctx context.Context, repoName string, lock *database.LFSLock) error {
+	args := m.Called(ctx, repoName, lock)
+	return args.Error(0)
+}
+
+func (m *MockDB) ListLFSLocks(ctx context.Context, repoName string) ([]*database.LFSLock, error) {
+	args := m.Called(ctx, repoName)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*database.LFSLock), args.Error(1)
+}
+
+func (m *MockDB) DeleteLFSLock(ctx context.Context, repoName string, id uint) error {
+	args := m.Called(ctx, repoName, id)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetDedupSavings(ctx context.Context) ([]*database.DedupSavings, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*database.DedupSavings), args.Error(1)
+}
+
 // MockRepositoryManager is a mock implementation of the repository manager
 type MockRepositoryManager struct {
 	mock.Mock
@@ -627,3 +703,66 @@ func TestUnauthorizedAccess(t *testing.T) {
 	
 	mockAuthService.AssertExpectations(t)
 }
+
+func TestPermissionRepository(t *testing.T) {
+	var repository string
+	router := gin.New()
+	capture := func(c *gin.Context) { repository = permissionRepository(c) }
+	router.GET("/api/v1/repositories/:name", capture)
+	router.GET("/api/v1/repositories/:name/artifacts", capture)
+	router.GET("/api/v1/storage/:repository/usage", capture)
+	router.GET("/api/v1/statistics", capture)
+	router.GET("/galaxy/api/v3/collections/:namespace/:name/", capture)
+	router.GET("/npm/*path", capture)
+
+	for target, expected := range map[string]string{
+		"/api/v1/repositories/maven":           "maven",
+		"/api/v1/repositories/maven/artifacts": "maven",
+		"/api/v1/storage/docker/usage":         "docker",
+		"/api/v1/statistics":                   "",
+		// A collection name is not the repository the request is authorized against
+		"/galaxy/api/v3/collections/acme/tools/": "galaxy",
+		"/npm/lodash":                            "npm",
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, expected, repository, target)
+	}
+}
+
+func TestStoragePools(t *testing.T) {
+	ctx := context.Background()
+	base, bulk := t.TempDir(), t.TempDir()
+	cfg := &config.Config{Storage: config.StorageConfig{
+		Type:      "local",
+		LocalPath: base,
+		Pools: map[string]config.StoragePoolConfig{
+			"bulk":     {Type: "local", LocalPath: bulk},
+			"releases": {Prefix: "releases"},
+		},
+	}}
+	pools, err := NewStoragePools(cfg, nil)
+	assert.NoError(t, err)
+	rm := &RepositoryManager{pools: pools}
+
+	for _, tc := range []struct {
+		options map[string]string
+		file    string
+	}{
+		{nil, filepath.Join(base, "a.txt")},
+		{map[string]string{repository.StoragePoolOption: "bulk"}, filepath.Join(bulk, "a.txt")},
+		{map[string]string{repository.StoragePoolOption: "releases"}, filepath.Join(base, "releases", "a.txt")},
+	} {
+		st, err := rm.repositoryStorage(&repository.Config{Name: "repo", Options: tc.options})
+		assert.NoError(t, err)
+		_, err = st.Store(ctx, "a.txt", bytes.NewReader([]byte("content")))
+		assert.NoError(t, err)
+		assert.FileExists(t, tc.file)
+	}
+
+	_, err = rm.repositoryStorage(&repository.Config{Name: "repo", Options: map[string]string{repository.StoragePoolOption: "missing"}})
+	assert.Error(t, err)
+
+	cfg.Storage.Pools = map[string]config.StoragePoolConfig{"shared": {}}
+	_, err = NewStoragePools(cfg, nil)
+	assert.Error(t, err, "a pool sharing the default backend needs a prefix")
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/gin-gonic/gin"
+)
+
+// errNoSigningKey is returned when a repository has no GPG signing key configured
+var errNoSigningKey = errors.New("repository has no signing key configured")
+
+// repositorySigningKey loads the GPG key used to sign repository metadata.
+// Recognized option keys:
+// - gpg_signing_key (ASCII-armored private key)
+// - gpg_signing_key_file (path to an ASCII-armored private key)
+// - gpg_signing_passphrase (optional passphrase protecting the key)
+func (s *Server) repositorySigningKey(ctx context.Context, repositoryName string) (*openpgp.Entity, error) {
+	opts, err := s.getRepositoryOptionsMap(ctx, repositoryName)
+	if err != nil {
+		return nil, errNoSigningKey
+	}
+
+	armored := opts["gpg_signing_key"]
+	if armored == "" && opts["gpg_signing_key_file"] != "" {
+		data, err := os.ReadFile(opts["gpg_signing_key_file"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		armored = string(data)
+	}
+	if strings.TrimSpace(armored) == "" {
+		return nil, errNoSigningKey
+	}
+	return loadSigningKey(armored, opts["gpg_signing_passphrase"])
+}
+
+// loadSigningKey parses an armored private key, decrypting it with passphrase when protected
+func loadSigningKey(armored, passphrase string) (*openpgp.Entity, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	if len(keyring) == 0 || keyring[0].PrivateKey == nil {
+		return nil, fmt.Errorf("invalid signing key: no private key found")
+	}
+	entity := keyring[0]
+	if entity.PrivateKey.Encrypted {
+		if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key: %w", err)
+		}
+	}
+	return entity, nil
+}
+
+// clearSign wraps data in an inline OpenPGP signature (as used by InRelease)
+func clearSign(entity *openpgp.Entity, data []byte) ([]byte, error) {
+	key, ok := entity.SigningKey(time.Now())
+	if !ok {
+		return nil, fmt.Errorf("signing key cannot sign")
+	}
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, key.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// detachSign returns an armored detached OpenPGP signature of data
+func detachSign(entity *openpgp.Entity, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, entity, bytes.NewReader(data), nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// armoredPublicKey exports the public half of a signing key
+func armoredPublicKey(entity *openpgp.Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := entity.Serialize(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// signingPublicKey serves the repository's public signing key so clients can trust its metadata
+func (s *Server) signingPublicKey(c *gin.Context) {
+	entity, err := s.repositorySigningKey(c.Request.Context(), repositoryNameFromPath(c))
+	if errors.Is(err, errNoSigningKey) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	key, err := armoredPublicKey(entity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/pgp-keys", key)
+}
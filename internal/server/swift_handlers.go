@@ -0,0 +1,439 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// swiftAcceptPattern extracts the API version requested through the Accept header
+var swiftAcceptPattern = regexp.MustCompile(`application/vnd\.swift\.registry\.v(\d+)`)
+
+// swiftProblem writes an RFC 7807 problem details response, the error format of SE-0292
+func swiftProblem(c *gin.Context, status int, detail string) {
+	body, _ := json.Marshal(gin.H{"detail": detail})
+	c.Data(status, "application/problem+json", body)
+}
+
+// swiftAPIVersion rejects requests for registry API versions other than 1 and marks
+// every response with the version it implements
+func (s *Server) swiftAPIVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Version", "1")
+		if m := swiftAcceptPattern.FindStringSubmatch(c.GetHeader("Accept")); m != nil && m[1] != "1" {
+			swiftProblem(c, http.StatusUnsupportedMediaType, "unsupported API version v"+m[1])
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// swiftReleases returns the releases of a repository; with scope and name set, only those of
+// that package, compared case-insensitively as identifiers are
+func (s *Server) swiftReleases(ctx context.Context, repositoryName, scope, name string) ([]*types.SwiftRelease, error) {
+	all, err := s.db.GetArtifactsByRepository(ctx, repositoryName)
+	if err != nil {
+		return nil, err
+	}
+	var releases []*types.SwiftRelease
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypeSwift) {
+			continue
+		}
+		release, err := types.SwiftReleaseFromProperties(artifactProperties(a))
+		if err != nil {
+			continue
+		}
+		if scope != "" && (!strings.EqualFold(release.Scope, scope) || !strings.EqualFold(release.Name, name)) {
+			continue
+		}
+		releases = append(releases, release)
+	}
+	sort.Slice(releases, func(i, j int) bool { return types.CompareVersions(releases[i].Version, releases[j].Version) < 0 })
+	return releases, nil
+}
+
+// swiftReleaseURL returns the URL of a release's metadata
+func swiftReleaseURL(c *gin.Context, repositoryName, scope, name, version string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", requestBaseURL(c), repositoryName, scope, name, version)
+}
+
+// swiftListReleases serves GET /:scope/:name, the releases of a package
+func (s *Server) swiftListReleases(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	scope, name := c.Param("scope"), strings.TrimSuffix(c.Param("name"), ".json")
+
+	releases, err := s.swiftReleases(c.Request.Context(), repositoryName, scope, name)
+	if err != nil {
+		swiftProblem(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(releases) == 0 {
+		swiftProblem(c, http.StatusNotFound, "package not found")
+		return
+	}
+
+	listed := map[string]gin.H{}
+	for _, r := range releases {
+		listed[r.Version] = gin.H{"url": swiftReleaseURL(c, repositoryName, scope, name, r.Version)}
+	}
+	latest := releases[len(releases)-1].Version
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="latest-version"`, swiftReleaseURL(c, repositoryName, scope, name, latest)))
+	c.JSON(http.StatusOK, gin.H{"releases": listed})
+}
+
+// swiftRelease serves GET /:scope/:name/:version: the release metadata, or the source archive
+// when the version is suffixed with .zip
+func (s *Server) swiftRelease(c *gin.Context) {
+	version := c.Param("version")
+	if strings.HasSuffix(version, ".zip") {
+		s.swiftSourceArchive(c, strings.TrimSuffix(version, ".zip"))
+		return
+	}
+	version = strings.TrimSuffix(version, ".json")
+
+	repositoryName := repositoryNameFromPath(c)
+	scope, name := c.Param("scope"), c.Param("name")
+	releases, err := s.swiftReleases(c.Request.Context(), repositoryName, scope, name)
+	if err != nil {
+		swiftProblem(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	index := -1
+	for i, r := range releases {
+		if r.Version == version {
+			index = i
+		}
+	}
+	if index < 0 {
+		swiftProblem(c, http.StatusNotFound, "release not found")
+		return
+	}
+	release := releases[index]
+
+	links := []string{fmt.Sprintf(`<%s>; rel="latest-version"`, swiftReleaseURL(c, repositoryName, scope, name, releases[len(releases)-1].Version))}
+	if index+1 < len(releases) {
+		links = append(links, fmt.Sprintf(`<%s>; rel="successor-version"`, swiftReleaseURL(c, repositoryName, scope, name, releases[index+1].Version)))
+	}
+	if index > 0 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="predecessor-version"`, swiftReleaseURL(c, repositoryName, scope, name, releases[index-1].Version)))
+	}
+	c.Header("Link", strings.Join(links, ", "))
+
+	resource := gin.H{
+		"name":     "source-archive",
+		"type":     "application/zip",
+		"checksum": release.Checksum,
+	}
+	if release.Signature != "" {
+		resource["signing"] = gin.H{
+			"signatureBase64Encoded": release.Signature,
+			"signatureFormat":        release.SignatureFormat,
+		}
+	}
+	response := gin.H{
+		"id":          release.ID(),
+		"version":     release.Version,
+		"resources":   []gin.H{resource},
+		"metadata":    gin.H{},
+		"publishedAt": release.PublishedAt,
+	}
+	if len(release.Metadata) > 0 {
+		response["metadata"] = release.Metadata
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// swiftManifest serves GET /:scope/:name/:version/Package.swift. With a swift-version query the
+// matching Package@swift-<version>.swift is returned, or a redirect to the unqualified manifest.
+func (s *Server) swiftManifest(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	scope, name, version := c.Param("scope"), c.Param("name"), c.Param("version")
+	releases, err := s.swiftReleases(c.Request.Context(), repositoryName, scope, name)
+	if err != nil {
+		swiftProblem(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var release *types.SwiftRelease
+	for _, r := range releases {
+		if r.Version == version {
+			release = r
+		}
+	}
+	if release == nil {
+		swiftProblem(c, http.StatusNotFound, "release not found")
+		return
+	}
+
+	file := types.SwiftManifestFile
+	if swiftVersion := c.Query("swift-version"); swiftVersion != "" {
+		if file = types.SwiftManifestFor(release.Manifests, swiftVersion); file == "" {
+			c.Redirect(http.StatusSeeOther, c.Request.URL.Path)
+			return
+		}
+	} else {
+		var alternates []string
+		for alternate := range release.Manifests {
+			if alternate == types.SwiftManifestFile {
+				continue
+			}
+			toolsVersion := strings.TrimSuffix(strings.TrimPrefix(alternate, "Package@swift-"), ".swift")
+			alternates = append(alternates, fmt.Sprintf(`<%s%s?swift-version=%s>; rel="alternate"; filename="%s"; swift-tools-version="%s"`,
+				requestBaseURL(c), c.Request.URL.Path, toolsVersion, alternate, toolsVersion))
+		}
+		if len(alternates) > 0 {
+			sort.Strings(alternates)
+			c.Header("Link", strings.Join(alternates, ", "))
+		}
+	}
+
+	manifest, ok := release.Manifests[file]
+	if !ok {
+		swiftProblem(c, http.StatusNotFound, "manifest not found")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file))
+	c.Data(http.StatusOK, "text/x-swift", []byte(manifest))
+}
+
+// swiftSourceArchive serves GET /:scope/:name/:version.zip
+func (s *Server) swiftSourceArchive(c *gin.Context, version string) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		swiftProblem(c, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	storagePath := types.SwiftArchivePath(c.Param("scope"), c.Param("name"), version)
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		swiftProblem(c, http.StatusNotFound, "release not found")
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.zip"`, c.Param("name"), version))
+	if sum, err := hex.DecodeString(metadata.Checksum); err == nil && len(sum) == sha256.Size {
+		c.Header("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// swiftLookup serves GET /identifiers?url=, the packages published from a source repository
+func (s *Server) swiftLookup(c *gin.Context) {
+	url := c.Query("url")
+	if url == "" {
+		swiftProblem(c, http.StatusBadRequest, "url is required")
+		return
+	}
+	releases, err := s.swiftReleases(c.Request.Context(), repositoryNameFromPath(c), "", "")
+	if err != nil {
+		swiftProblem(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	wanted := types.NormalizeSwiftRepositoryURL(url)
+	seen := map[string]bool{}
+	identifiers := []string{}
+	for _, r := range releases {
+		for _, u := range r.RepositoryURLs {
+			if types.NormalizeSwiftRepositoryURL(u) == wanted && !seen[strings.ToLower(r.ID())] {
+				seen[strings.ToLower(r.ID())] = true
+				identifiers = append(identifiers, r.ID())
+			}
+		}
+	}
+	if len(identifiers) == 0 {
+		swiftProblem(c, http.StatusNotFound, "no packages found for "+url)
+		return
+	}
+	sort.Strings(identifiers)
+	c.JSON(http.StatusOK, gin.H{"identifiers": identifiers})
+}
+
+// swiftLogin serves POST /login; reaching it means the credentials were accepted
+func (s *Server) swiftLogin(c *gin.Context) {
+	c.Status(http.StatusOK)
+}
+
+// swiftPublish accepts PUT /:scope/:name/:version with a multipart body holding the
+// "source-archive" zip and optionally the "metadata" document and a "source-archive-signature"
+func (s *Server) swiftPublish(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		swiftProblem(c, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	scope, name, version := c.Param("scope"), c.Param("name"), c.Param("version")
+	switch {
+	case !types.ValidSwiftScope(scope):
+		swiftProblem(c, http.StatusBadRequest, "invalid package scope")
+		return
+	case !types.ValidSwiftName(name):
+		swiftProblem(c, http.StatusBadRequest, "invalid package name")
+		return
+	case !types.ValidSwiftVersion(version):
+		swiftProblem(c, http.StatusBadRequest, "invalid version")
+		return
+	}
+	if !strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		swiftProblem(c, http.StatusUnsupportedMediaType, "expected multipart/form-data")
+		return
+	}
+
+	archive, _, err := c.Request.FormFile("source-archive")
+	if err != nil {
+		swiftProblem(c, http.StatusUnprocessableEntity, "source-archive is required")
+		return
+	}
+	defer archive.Close()
+
+	release := &types.SwiftRelease{
+		Scope:       scope,
+		Name:        name,
+		Version:     version,
+		PublishedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if metadata := multipartValue(c.Request.MultipartForm, "metadata"); len(metadata) > 0 {
+		urls, err := types.ParseSwiftReleaseMetadata(metadata)
+		if err != nil {
+			swiftProblem(c, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		release.Metadata = metadata
+		release.RepositoryURLs = urls
+	}
+	if signature := multipartValue(c.Request.MultipartForm, "source-archive-signature"); len(signature) > 0 {
+		release.Signature = base64.StdEncoding.EncodeToString(signature)
+		release.SignatureFormat = c.GetHeader("X-Swift-Package-Signature-Format")
+	}
+
+	tmp, err := os.CreateTemp("", "ganje-swift-*.zip")
+	if err != nil {
+		swiftProblem(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), archive)
+	if err != nil {
+		swiftProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if release.Manifests, err = types.ReadSwiftSourceArchive(tmp, size); err != nil {
+		swiftProblem(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	release.Checksum = hex.EncodeToString(sum.Sum(nil))
+
+	storagePath := types.SwiftArchivePath(scope, name, version)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		swiftProblem(c, http.StatusConflict, fmt.Sprintf("%s %s is already published", release.ID(), version))
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		swiftProblem(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, &artifact.Metadata{
+		Name:       release.ID(),
+		Version:    version,
+		Size:       size,
+		Checksum:   release.Checksum,
+		Properties: release.Properties(),
+	}); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		swiftProblem(c, pushErrorStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       release.ID(),
+			Version:    version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.Header("Location", swiftReleaseURL(c, repositoryName, scope, name, version))
+	c.Status(http.StatusCreated)
+}
+
+// swiftDelete removes a release
+func (s *Server) swiftDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		swiftProblem(c, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	storagePath := types.SwiftArchivePath(c.Param("scope"), c.Param("name"), c.Param("version"))
+	if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+		swiftProblem(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// multipartValue returns a form part sent either as a plain field or as a file
+func multipartValue(form *multipart.Form, name string) []byte {
+	if form == nil {
+		return nil
+	}
+	if values := form.Value[name]; len(values) > 0 {
+		return []byte(values[0])
+	}
+	if files := form.File[name]; len(files) > 0 {
+		f, err := files[0].Open()
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(io.LimitReader(f, 1<<20))
+		return data
+	}
+	return nil
+}
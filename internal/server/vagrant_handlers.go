@@ -0,0 +1,221 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hbahadorzadeh/ganje/internal/artifact"
+	"github.com/hbahadorzadeh/ganje/internal/artifact/types"
+	"github.com/hbahadorzadeh/ganje/internal/messaging"
+	"github.com/hbahadorzadeh/ganje/internal/storage"
+)
+
+// vagrantBoxParams returns the box name, version and provider addressed by /:org/:box/:version/:file
+func vagrantBoxParams(c *gin.Context) (name, version, provider string, ok bool) {
+	provider, ok = strings.CutSuffix(c.Param("file"), ".box")
+	if !ok || !types.ValidVagrantName(c.Param("org")) || !types.ValidVagrantName(c.Param("box")) ||
+		!types.ValidVagrantVersion(c.Param("version")) || !types.ValidVagrantProvider(provider) {
+		return "", "", "", false
+	}
+	return c.Param("org") + "/" + c.Param("box"), c.Param("version"), provider, true
+}
+
+// vagrantMetadata serves GET /:org/:box, the box metadata generated from the uploaded box files
+func (s *Server) vagrantMetadata(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	name := c.Param("org") + "/" + c.Param("box")
+	all, err := s.db.GetArtifactsByRepository(c.Request.Context(), repositoryName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var boxes []*types.VagrantBox
+	for _, a := range all {
+		if a.Type != string(artifact.ArtifactTypeVagrant) || a.Name != name {
+			continue
+		}
+		box, err := types.VagrantBoxFromProperties(artifactProperties(a))
+		if err != nil {
+			continue
+		}
+		boxes = append(boxes, box)
+	}
+	if len(boxes) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Box not found"})
+		return
+	}
+
+	baseURL := requestBaseURL(c) + "/" + repositoryName + "/"
+	metadata, err := types.GenerateVagrantMetadata(name, boxes, func(b *types.VagrantBox) string {
+		return baseURL + types.VagrantBoxPath(b.Name, b.Version, b.Provider)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/json", metadata)
+}
+
+// vagrantDownload serves GET /:org/:box/:version/:file, a box file
+func (s *Server) vagrantDownload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	name, version, provider, ok := vagrantBoxParams(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := types.VagrantBoxPath(name, version, provider)
+	content, metadata, err := repo.Pull(c.Request.Context(), storagePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	s.logAccess(c, repositoryName, storagePath, "pull", true, "")
+
+	c.Header("Content-Type", "application/octet-stream")
+	if metadata.Checksum != "" {
+		c.Header("X-Checksum-SHA256", metadata.Checksum)
+	}
+	storage.ServeContent(c.Writer, c.Request, content, metadata.Size, metadata.Checksum, metadata.UpdatedAt)
+}
+
+// vagrantUpload accepts PUT /:org/:box/:version/:file with the box file as the body. An optional
+// "checksum" query parameter is compared with the SHA-256 of the body, and "description" sets
+// the box description.
+func (s *Server) vagrantUpload(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	name, version, provider, ok := vagrantBoxParams(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path must be /<org>/<box>/<version>/<provider>.box"})
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := types.VagrantBoxPath(name, version, provider)
+	if existing, err := s.db.GetArtifactByPath(c.Request.Context(), repositoryName, storagePath); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s %s is already published for %s", name, version, provider)})
+		return
+	}
+
+	// Spool to disk while computing the checksum the box metadata advertises
+	tmp, err := os.CreateTemp("", "ganje-vagrant-*.box")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	checksum := hex.EncodeToString(sum.Sum(nil))
+	if expected := c.Query("checksum"); expected != "" && !strings.EqualFold(expected, checksum) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "checksum mismatch"})
+		return
+	}
+
+	box := &types.VagrantBox{Name: name, Version: version, Provider: provider, SHA256: checksum, Description: c.Query("description")}
+	meta := &artifact.Metadata{
+		Name:        name,
+		Version:     version,
+		Description: box.Description,
+		Size:        size,
+		Checksum:    checksum,
+		Properties:  box.Properties(),
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := types.NewVagrantArtifact(meta).ValidateArtifact(tmp); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repo.Push(c.Request.Context(), storagePath, tmp, meta); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "push", false, err.Error())
+		c.JSON(pushErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "push", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventAdd,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Name:       name,
+			Version:    version,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"name":     name,
+		"version":  version,
+		"provider": provider,
+		"location": storagePath,
+		"checksum": checksum,
+	})
+}
+
+// vagrantDelete removes a box file; the provider disappears from the box metadata with it
+func (s *Server) vagrantDelete(c *gin.Context) {
+	repositoryName := repositoryNameFromPath(c)
+	name, version, provider, ok := vagrantBoxParams(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	repo, err := s.repoManager.GetRepository(repositoryName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repository not found"})
+		return
+	}
+
+	storagePath := types.VagrantBoxPath(name, version, provider)
+	if err := repo.Delete(c.Request.Context(), storagePath); err != nil {
+		s.logAccess(c, repositoryName, storagePath, "delete", false, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logAccess(c, repositoryName, storagePath, "delete", true, "")
+
+	if s.publisher != nil {
+		_ = s.publisher.Publish(messaging.Event{
+			Type:       messaging.EventRemove,
+			Repository: repositoryName,
+			Path:       storagePath,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Artifact deleted successfully"})
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// casBlobPrefix is the directory blobs are stored under in the underlying storage
+const casBlobPrefix = "blobs"
+
+// BlobRef is the reference of a logical path to the blob holding its content
+type BlobRef struct {
+	Path string
+	// Hash is the hex encoded SHA-256 of the content
+	Hash string
+	Size int64
+	// Repository is the repository that stored the path, if known
+	Repository string
+	// Pool is the storage pool holding the blob, empty for the default pool
+	Pool string
+}
+
+// RefStore persists the references of a CASStorage. References are kept per pool and
+// repository, as pools and repositories may hold the same path.
+type RefStore interface {
+	// GetBlobRef returns the reference of path in a repository of a pool, or nil when path has none
+	GetBlobRef(ctx context.Context, pool, repository, path string) (*BlobRef, error)
+	// SaveBlobRef creates or replaces the reference of ref.Path in ref.Repository of ref.Pool
+	SaveBlobRef(ctx context.Context, ref *BlobRef) error
+	DeleteBlobRef(ctx context.Context, pool, repository, path string) error
+	// CountBlobRefs returns how many paths of any repository reference the blob with the given
+	// hash in a pool
+	CountBlobRefs(ctx context.Context, pool, hash string) (int64, error)
+	// ListBlobRefs returns the references of the paths of every repository of a pool starting
+	// with prefix
+	ListBlobRefs(ctx context.Context, pool, prefix string) ([]*BlobRef, error)
+}
+
+// CASStorage is a content-addressable decorator: content is stored once per SHA-256 under
+// BlobPath(hash) of the underlying storage, and logical paths reference blobs through a
+// RefStore. A blob is deleted with the last path referencing it. Paths stored before the
+// decorator was enabled are still read from their location in the underlying storage.
+type CASStorage struct {
+	inner      Storage
+	refs       RefStore
+	repository string
+	// pool is the storage pool of inner; blobs are only shared within a pool
+	pool string
+
+	// locks serialize storing and releasing blobs that share a lock stripe, so a blob being
+	// referenced again is never deleted by a concurrent release
+	locks *[256]sync.Mutex
+}
+
+// NewCASStorage creates a deduplicating storage on top of inner
+func NewCASStorage(inner Storage, refs RefStore) *CASStorage {
+	return &CASStorage{inner: inner, refs: refs, locks: new([256]sync.Mutex)}
+}
+
+// ForRepository returns a view of the storage holding the paths of repository name, which share
+// blobs with the other repositories of the pool but not their references
+func (c *CASStorage) ForRepository(name string) Storage {
+	return &CASStorage{inner: c.inner, refs: c.refs, repository: name, pool: c.pool, locks: c.locks}
+}
+
+// BlobPath returns the location of the blob with the given SHA-256 in the underlying storage
+func BlobPath(hash string) string {
+	return casBlobPrefix + "/" + filepath.ToSlash(ShardedPath(hash))
+}
+
+func (c *CASStorage) lock(hash string) *sync.Mutex {
+	stripe, _ := strconv.ParseUint(hash[:2], 16, 8)
+	return &c.locks[stripe]
+}
+
+// ref returns the reference of path in the repository and pool of c, or nil when path has none
+func (c *CASStorage) ref(ctx context.Context, path string) (*BlobRef, error) {
+	ref, err := c.refs.GetBlobRef(ctx, c.pool, c.repository, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob reference: %w", err)
+	}
+	return ref, nil
+}
+
+// Store saves content as a blob, unless a blob with the same content exists, and points path
+// at it. The blob previously referenced by path is released.
+func (c *CASStorage) Store(ctx context.Context, path string, content io.Reader) (*Digests, error) {
+	// Spool locally while hashing, as the blob location depends on the digest
+	tmp, err := os.CreateTemp("", "ganje-cas-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	digester := newDigester(false, false)
+	if _, err := io.Copy(io.MultiWriter(tmp, digester), content); err != nil {
+		return nil, fmt.Errorf("failed to write content: %w", err)
+	}
+	digests := digester.Digests()
+	hash, size := digests.SHA256, digests.Size
+
+	previous, err := c.ref(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	mu := c.lock(hash)
+	mu.Lock()
+	exists, err := c.inner.Exists(ctx, BlobPath(hash))
+	if err == nil && !exists {
+		if _, err = tmp.Seek(0, io.SeekStart); err == nil {
+			_, err = c.inner.Store(ctx, BlobPath(hash), tmp)
+		}
+	}
+	if err == nil {
+		err = c.refs.SaveBlobRef(ctx, &BlobRef{Path: path, Hash: hash, Size: size, Repository: c.repository, Pool: c.pool})
+	}
+	mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	if previous != nil && previous.Hash != hash {
+		if err := c.release(ctx, previous.Hash); err != nil {
+			return nil, err
+		}
+	}
+	if previous == nil {
+		// Content stored at the logical path before deduplication is now shadowed by the blob
+		if exists, err := c.inner.Exists(ctx, path); err == nil && exists {
+			_ = c.inner.Delete(ctx, path)
+		}
+	}
+	return digests, nil
+}
+
+// release deletes a blob when no path references it anymore
+func (c *CASStorage) release(ctx context.Context, hash string) error {
+	mu := c.lock(hash)
+	mu.Lock()
+	defer mu.Unlock()
+
+	count, err := c.refs.CountBlobRefs(ctx, c.pool, hash)
+	if err != nil {
+		return fmt.Errorf("failed to count blob references: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if exists, err := c.inner.Exists(ctx, BlobPath(hash)); err != nil || !exists {
+		return err
+	}
+	return c.inner.Delete(ctx, BlobPath(hash))
+}
+
+// Demote moves the blob path references to the cold tier of the underlying storage, along with
+// the content of every other path referencing it
+func (c *CASStorage) Demote(ctx context.Context, path string) error {
+	ref, err := c.ref(ctx, path)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return Demote(ctx, c.inner, path)
+	}
+	mu := c.lock(ref.Hash)
+	mu.Lock()
+	defer mu.Unlock()
+	return Demote(ctx, c.inner, BlobPath(ref.Hash))
+}
+
+// Retrieve gets the content of the blob path references
+func (c *CASStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	ref, err := c.ref(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return c.inner.Retrieve(ctx, path)
+	}
+	return c.inner.Retrieve(ctx, BlobPath(ref.Hash))
+}
+
+// RetrieveRange gets part of the content of the blob path references
+func (c *CASStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	ref, err := c.ref(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return c.inner.RetrieveRange(ctx, path, offset, length)
+	}
+	return c.inner.RetrieveRange(ctx, BlobPath(ref.Hash), offset, length)
+}
+
+// Delete removes the reference of path, and its blob when nothing else references it
+func (c *CASStorage) Delete(ctx context.Context, path string) error {
+	ref, err := c.ref(ctx, path)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return c.inner.Delete(ctx, path)
+	}
+	if err := c.refs.DeleteBlobRef(ctx, c.pool, c.repository, path); err != nil {
+		return fmt.Errorf("failed to delete blob reference: %w", err)
+	}
+	return c.release(ctx, ref.Hash)
+}
+
+// Exists checks if path references a blob or has content in the underlying storage
+func (c *CASStorage) Exists(ctx context.Context, path string) (bool, error) {
+	ref, err := c.ref(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	if ref != nil {
+		return true, nil
+	}
+	return c.inner.Exists(ctx, path)
+}
+
+// List returns the logical paths at or below prefix
+func (c *CASStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	refs, err := c.refs.ListBlobRefs(ctx, c.pool, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blob references: %w", err)
+	}
+	dir := strings.TrimSuffix(prefix, "/")
+	seen := map[string]bool{}
+	var paths []string
+	for _, ref := range refs {
+		if ref.Repository != c.repository {
+			continue
+		}
+		if dir == "" || ref.Path == dir || strings.HasPrefix(ref.Path, dir+"/") {
+			seen[ref.Path] = true
+			paths = append(paths, ref.Path)
+		}
+	}
+
+	stored, err := c.inner.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range stored {
+		if !seen[p] && p != casBlobPrefix && !strings.HasPrefix(p, casBlobPrefix+"/") {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// GetSize returns the size recorded with the reference of path
+func (c *CASStorage) GetSize(ctx context.Context, path string) (int64, error) {
+	ref, err := c.ref(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if ref == nil {
+		return c.inner.GetSize(ctx, path)
+	}
+	return ref.Size, nil
+}
+
+// GetChecksum returns the SHA256 checksum of path, which is the hash of its blob
+func (c *CASStorage) GetChecksum(ctx context.Context, path string) (string, error) {
+	ref, err := c.ref(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if ref == nil {
+		return c.inner.GetChecksum(ctx, path)
+	}
+	return ref.Hash, nil
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRefStore keeps blob references in memory, keyed by pool, repository and path
+type memoryRefStore struct {
+	mu   sync.Mutex
+	refs map[[3]string]BlobRef
+}
+
+func newMemoryRefStore() *memoryRefStore {
+	return &memoryRefStore{refs: map[[3]string]BlobRef{}}
+}
+
+func (m *memoryRefStore) GetBlobRef(ctx context.Context, pool, repository, path string) (*BlobRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ref, ok := m.refs[[3]string{pool, repository, path}]
+	if !ok {
+		return nil, nil
+	}
+	return &ref, nil
+}
+
+func (m *memoryRefStore) SaveBlobRef(ctx context.Context, ref *BlobRef) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refs[[3]string{ref.Pool, ref.Repository, ref.Path}] = *ref
+	return nil
+}
+
+func (m *memoryRefStore) DeleteBlobRef(ctx context.Context, pool, repository, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.refs, [3]string{pool, repository, path})
+	return nil
+}
+
+func (m *memoryRefStore) CountBlobRefs(ctx context.Context, pool, hash string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int64
+	for _, ref := range m.refs {
+		if ref.Pool == pool && ref.Hash == hash {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryRefStore) ListBlobRefs(ctx context.Context, pool, prefix string) ([]*BlobRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var refs []*BlobRef
+	for key, ref := range m.refs {
+		if key[0] == pool && strings.HasPrefix(key[2], prefix) {
+			ref := ref
+			refs = append(refs, &ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Path < refs[j].Path })
+	return refs, nil
+}
+
+func TestCASStorage(t *testing.T) {
+	ctx := context.Background()
+	inner := NewLocalStorage(t.TempDir())
+	refs := newMemoryRefStore()
+	cas := NewCASStorage(inner, refs)
+
+	const jar = "jar content"
+	hash, err := GenerateHash(strings.NewReader(jar))
+	require.NoError(t, err)
+
+	mavenA, mavenB, mavenC := cas.ForRepository("maven-a"), cas.ForRepository("maven-b"), cas.ForRepository("maven-c")
+	store := func(s Storage, path, content string) {
+		_, err := s.Store(ctx, path, strings.NewReader(content))
+		require.NoError(t, err)
+	}
+	read := func(s Storage, path string) string {
+		rc, err := s.Retrieve(ctx, path)
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("StoreOnce", func(t *testing.T) {
+		store(mavenA, "com/example/lib/1.0/lib-1.0.jar", jar)
+		store(mavenB, "mirror/com/example/lib/1.0/lib-1.0.jar", jar)
+		digests, err := mavenC.Store(ctx, "other/lib.jar", strings.NewReader(jar))
+		require.NoError(t, err)
+		assert.Equal(t, &Digests{Size: int64(len(jar)), SHA256: hash}, digests)
+
+		assert.Equal(t, "blobs/"+hash[:2]+"/"+hash[2:4]+"/"+hash, BlobPath(hash))
+		blobs, err := inner.List(ctx, "blobs/"+hash[:2]+"/"+hash[2:4])
+		require.NoError(t, err)
+		assert.Equal(t, []string{BlobPath(hash)}, blobs)
+
+		exists, err := inner.Exists(ctx, "other/lib.jar")
+		require.NoError(t, err)
+		assert.False(t, exists, "logical paths are not written to the underlying storage")
+
+		assert.Equal(t, jar, read(mavenC, "other/lib.jar"))
+		part, err := mavenC.RetrieveRange(ctx, "other/lib.jar", 4, 3)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(part)
+		part.Close()
+		assert.Equal(t, "con", string(data))
+		size, err := mavenC.GetSize(ctx, "other/lib.jar")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(jar)), size)
+		checksum, err := mavenC.GetChecksum(ctx, "other/lib.jar")
+		require.NoError(t, err)
+		assert.Equal(t, hash, checksum)
+
+		ref, err := refs.GetBlobRef(ctx, "", "maven-b", "mirror/com/example/lib/1.0/lib-1.0.jar")
+		require.NoError(t, err)
+		assert.Equal(t, "maven-b", ref.Repository)
+		exists, err = mavenA.Exists(ctx, "other/lib.jar")
+		require.NoError(t, err)
+		assert.False(t, exists, "repositories only see their own paths")
+	})
+
+	t.Run("List", func(t *testing.T) {
+		store(mavenC, "other/lib-sources.jar", jar)
+		paths, err := mavenC.List(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"other/lib-sources.jar", "other/lib.jar"}, paths)
+
+		paths, err = mavenA.List(ctx, "com")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"com/example/lib/1.0/lib-1.0.jar"}, paths)
+		require.NoError(t, mavenC.Delete(ctx, "other/lib-sources.jar"))
+	})
+
+	t.Run("DeleteKeepsReferencedBlob", func(t *testing.T) {
+		require.NoError(t, mavenA.Delete(ctx, "com/example/lib/1.0/lib-1.0.jar"))
+		require.NoError(t, mavenB.Delete(ctx, "mirror/com/example/lib/1.0/lib-1.0.jar"))
+
+		exists, err := mavenB.Exists(ctx, "mirror/com/example/lib/1.0/lib-1.0.jar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = inner.Exists(ctx, BlobPath(hash))
+		require.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, jar, read(mavenC, "other/lib.jar"))
+	})
+
+	t.Run("RepositoriesHoldingTheSamePath", func(t *testing.T) {
+		store(mavenA, "other/lib.jar", jar)
+		store(mavenA, "other/lib.jar", "new content")
+		assert.Equal(t, "new content", read(mavenA, "other/lib.jar"))
+		assert.Equal(t, jar, read(mavenC, "other/lib.jar"))
+
+		ref, err := refs.GetBlobRef(ctx, "", "maven-c", "other/lib.jar")
+		require.NoError(t, err)
+		assert.Equal(t, hash, ref.Hash, "overwriting a path keeps the reference of other repositories")
+
+		require.NoError(t, mavenA.Delete(ctx, "other/lib.jar"))
+		assert.Equal(t, jar, read(mavenC, "other/lib.jar"))
+		exists, err := inner.Exists(ctx, BlobPath(hash))
+		require.NoError(t, err)
+		assert.True(t, exists, "deleting a path keeps the blob other repositories reference")
+	})
+
+	t.Run("OverwriteReleasesBlob", func(t *testing.T) {
+		store(mavenC, "other/lib.jar", "new content")
+		assert.Equal(t, "new content", read(mavenC, "other/lib.jar"))
+
+		exists, err := inner.Exists(ctx, BlobPath(hash))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		require.NoError(t, mavenC.Delete(ctx, "other/lib.jar"))
+		paths, err := inner.List(ctx, "blobs")
+		require.NoError(t, err)
+		assert.Empty(t, paths)
+	})
+
+	t.Run("LegacyPaths", func(t *testing.T) {
+		store(inner, "legacy/app.tar", "legacy")
+		assert.Equal(t, "legacy", read(cas, "legacy/app.tar"))
+		checksum, err := cas.GetChecksum(ctx, "legacy/app.tar")
+		require.NoError(t, err)
+		assert.NotEmpty(t, checksum)
+
+		// Storing again moves the content into the blob store
+		store(cas, "legacy/app.tar", "legacy")
+		exists, err := inner.Exists(ctx, "legacy/app.tar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.Equal(t, "legacy", read(cas, "legacy/app.tar"))
+
+		store(inner, "legacy/old.tar", "old")
+		require.NoError(t, cas.Delete(ctx, "legacy/old.tar"))
+		exists, err = cas.Exists(ctx, "legacy/old.tar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
@@ -0,0 +1,588 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// encryptionKeyPrefix is the directory the envelopes of encrypted objects are stored under
+	encryptionKeyPrefix = ".keys"
+	// encryptionObjectPrefix is the directory the ciphertext of encrypted objects is stored under
+	encryptionObjectPrefix = ".objects"
+
+	// encryptionMagic starts every encrypted object, so ciphertext is never served as plaintext
+	encryptionMagic = "GANJEv1\x00"
+
+	// encryptionChunkSize is the plaintext size of each sealed chunk
+	encryptionChunkSize = 64 << 10
+
+	// encryptionKeySize is the size of master and data keys (AES-256)
+	encryptionKeySize = 32
+)
+
+// Keyring holds the master keys wrapping data keys. The primary key wraps new data keys; the
+// others only unwrap data keys until Rotate rewraps them.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from 256-bit master keys; the first one is the primary key
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one master key is required")
+	}
+	ring := &Keyring{keys: map[string]cipher.AEAD{}}
+	for i, key := range keys {
+		if len(key) != encryptionKeySize {
+			return nil, fmt.Errorf("master key %d must be %d bytes, got %d", i+1, encryptionKeySize, len(key))
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		id := hex.EncodeToString(sum[:8])
+		if i == 0 {
+			ring.primary = id
+		}
+		ring.keys[id] = aead
+	}
+	return ring, nil
+}
+
+// LoadKeyring creates a keyring from base64 encoded master keys: key and the lines of keyFile,
+// followed by previous. The first key found is the primary key.
+func LoadKeyring(key, keyFile string, previous []string) (*Keyring, error) {
+	var encoded []string
+	if key != "" {
+		encoded = append(encoded, key)
+	}
+	if keyFile != "" {
+		file, err := os.Open(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				encoded = append(encoded, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+	}
+	encoded = append(encoded, previous...)
+
+	keys := make([][]byte, len(encoded))
+	for i, e := range encoded {
+		k, err := base64.StdEncoding.DecodeString(strings.TrimSpace(e))
+		if err != nil {
+			return nil, fmt.Errorf("master key %d is not valid base64: %w", i+1, err)
+		}
+		keys[i] = k
+	}
+	return NewKeyring(keys...)
+}
+
+// PrimaryKeyID returns the ID of the key wrapping new data keys
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary
+}
+
+// wrap seals a data key with the primary key
+func (k *Keyring) wrap(dataKey []byte) (string, string, error) {
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+	sealed := aead.Seal(nonce, nonce, dataKey, []byte(k.primary))
+	return k.primary, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// unwrap opens a data key sealed with the key of the given ID
+func (k *Keyring) unwrap(keyID, wrapped string) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %s is not configured", keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid wrapped data key")
+	}
+	dataKey, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelope describes an encrypted object; it is stored under .keys/<path>
+type envelope struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey string `json:"wrapped_key"`
+	ChunkSize  int    `json:"chunk_size"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	// Object is the location of the ciphertext in the underlying storage; envelopes written
+	// before content was versioned leave it empty, as their ciphertext is at the path itself
+	Object string `json:"object,omitempty"`
+}
+
+// object returns the location of the ciphertext of path
+func (env *envelope) object(path string) string {
+	if env.Object == "" {
+		return path
+	}
+	return env.Object
+}
+
+// EncryptedStorage encrypts content at rest on top of any storage. Each object has its own
+// AES-256 data key, wrapped by the master key of a Keyring and kept with the plaintext size and
+// digest in an envelope next to the object, so rotating master keys only rewrites envelopes.
+// Every store writes the ciphertext to a new location under .objects and then switches the
+// envelope to it, so readers see either the previous or the new content in full.
+// Content is sealed with AES-GCM in chunks of 64 KiB, which keeps ranged reads cheap; the last
+// chunk is marked so truncated objects fail to decrypt. Objects stored before encryption was
+// enabled are read as they are.
+type EncryptedStorage struct {
+	inner Storage
+	keys  *Keyring
+}
+
+// NewEncryptedStorage creates an encrypting storage on top of inner
+func NewEncryptedStorage(inner Storage, keys *Keyring) *EncryptedStorage {
+	return &EncryptedStorage{inner: inner, keys: keys}
+}
+
+func envelopePath(path string) string {
+	return encryptionKeyPrefix + "/" + strings.TrimPrefix(path, "/")
+}
+
+// newObjectPath returns a location for a new version of the ciphertext of path
+func newObjectPath(path string) (string, error) {
+	version := make([]byte, 8)
+	if _, err := rand.Read(version); err != nil {
+		return "", err
+	}
+	return encryptionObjectPrefix + "/" + strings.TrimPrefix(path, "/") + "@" + hex.EncodeToString(version), nil
+}
+
+// hidden reports whether a path of the underlying storage holds envelopes or ciphertext
+// rather than an object of its own
+func hidden(path string) bool {
+	for _, prefix := range []string{encryptionKeyPrefix, encryptionObjectPrefix} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// envelope returns the envelope of path, or nil when path is not encrypted
+func (e *EncryptedStorage) envelope(ctx context.Context, path string) (*envelope, error) {
+	exists, err := e.inner.Exists(ctx, envelopePath(path))
+	if err != nil || !exists {
+		return nil, err
+	}
+	rc, err := e.inner.Retrieve(ctx, envelopePath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var env envelope
+	if err := json.NewDecoder(rc).Decode(&env); err != nil {
+		return nil, fmt.Errorf("invalid encryption envelope of %s: %w", path, err)
+	}
+	if env.ChunkSize <= 0 {
+		return nil, fmt.Errorf("invalid encryption envelope of %s", path)
+	}
+	return &env, nil
+}
+
+func (e *EncryptedStorage) saveEnvelope(ctx context.Context, path string, env *envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	_, err = e.inner.Store(ctx, envelopePath(path), bytes.NewReader(data))
+	return err
+}
+
+// Store encrypts content with a new data key and stores it with its envelope. The previous
+// content of path is only deleted once the envelope points at the new one.
+func (e *EncryptedStorage) Store(ctx context.Context, path string, content io.Reader) (*Digests, error) {
+	previous, err := e.envelope(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	object, err := newObjectPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate object version: %w", err)
+	}
+	dataKey := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := e.keys.wrap(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	digester := newDigester(false, false)
+	sealer := &sealingReader{aead: aead, plain: io.TeeReader(content, digester), out: []byte(encryptionMagic)}
+	if _, err := e.inner.Store(ctx, object, sealer); err != nil {
+		e.remove(ctx, object)
+		return nil, err
+	}
+	digests := digester.Digests()
+
+	err = e.saveEnvelope(ctx, path, &envelope{
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		ChunkSize:  encryptionChunkSize,
+		Size:       digests.Size,
+		SHA256:     digests.SHA256,
+		Object:     object,
+	})
+	if err != nil {
+		e.remove(ctx, object)
+		return nil, fmt.Errorf("failed to store encryption envelope: %w", err)
+	}
+
+	// The previous ciphertext, or content stored before encryption, is no longer referenced
+	if previous != nil {
+		e.remove(ctx, previous.object(path))
+	} else {
+		e.remove(ctx, path)
+	}
+	return digests, nil
+}
+
+// remove deletes an object of the underlying storage if it exists. Failures leave the object
+// unreferenced, which only costs space.
+func (e *EncryptedStorage) remove(ctx context.Context, path string) {
+	if exists, err := e.inner.Exists(ctx, path); err == nil && exists {
+		_ = e.inner.Delete(ctx, path)
+	}
+}
+
+// Retrieve decrypts content
+func (e *EncryptedStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	return e.RetrieveRange(ctx, path, 0, -1)
+}
+
+// RetrieveRange decrypts part of content, reading only the chunks holding it
+func (e *EncryptedStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	env, err := e.envelope(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return e.plaintext(ctx, path, offset, length)
+	}
+	dataKey, err := e.keys.unwrap(env.KeyID, env.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := int64(env.ChunkSize)
+	chunk := offset / chunkSize
+	if offset > env.Size {
+		chunk = env.Size / chunkSize
+	}
+	sealedChunk := chunkSize + int64(aead.Overhead())
+	body, err := e.inner.RetrieveRange(ctx, env.object(path), int64(len(encryptionMagic))+chunk*sealedChunk, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	opener := &openingReader{aead: aead, sealed: body, chunkSize: env.ChunkSize, counter: uint64(chunk)}
+	if skip := offset - chunk*chunkSize; skip > 0 {
+		if _, err := io.CopyN(io.Discard, opener, skip); err != nil && err != io.EOF {
+			body.Close()
+			return nil, err
+		}
+	}
+	var reader io.Reader = opener
+	if length >= 0 {
+		reader = io.LimitReader(opener, length)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, body}, nil
+}
+
+// plaintext reads an object stored without encryption, refusing encrypted objects whose
+// envelope is missing
+func (e *EncryptedStorage) plaintext(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	head, err := e.inner.RetrieveRange(ctx, path, 0, int64(len(encryptionMagic)))
+	if err != nil {
+		return nil, err
+	}
+	magic, _ := io.ReadAll(head)
+	head.Close()
+	if string(magic) == encryptionMagic {
+		return nil, fmt.Errorf("encryption envelope of %s is missing", path)
+	}
+	return e.inner.RetrieveRange(ctx, path, offset, length)
+}
+
+// Demote moves content to the cold tier of the underlying storage. Envelopes are small and read
+// for every size and checksum lookup, so they stay in the hot tier.
+func (e *EncryptedStorage) Demote(ctx context.Context, path string) error {
+	env, err := e.envelope(ctx, path)
+	if err != nil {
+		return err
+	}
+	if env != nil {
+		path = env.object(path)
+	}
+	return Demote(ctx, e.inner, path)
+}
+
+// Delete removes content and its envelope
+func (e *EncryptedStorage) Delete(ctx context.Context, path string) error {
+	env, err := e.envelope(ctx, path)
+	if err != nil {
+		return err
+	}
+	if env != nil && env.Object != "" {
+		// Without its envelope the path is gone at once; its ciphertext goes next
+		if err := e.inner.Delete(ctx, envelopePath(path)); err != nil {
+			return err
+		}
+		return e.inner.Delete(ctx, env.Object)
+	}
+	if err := e.inner.Delete(ctx, path); err != nil {
+		return err
+	}
+	if exists, err := e.inner.Exists(ctx, envelopePath(path)); err == nil && exists {
+		return e.inner.Delete(ctx, envelopePath(path))
+	}
+	return nil
+}
+
+// Exists checks if content exists, encrypted or stored before encryption
+func (e *EncryptedStorage) Exists(ctx context.Context, path string) (bool, error) {
+	exists, err := e.inner.Exists(ctx, envelopePath(path))
+	if err != nil || exists {
+		return exists, err
+	}
+	return e.inner.Exists(ctx, path)
+}
+
+// List returns the paths with the given prefix: those with an envelope, and those stored
+// before encryption
+func (e *EncryptedStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	paths, err := e.inner.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	envelopes, err := e.inner.List(ctx, envelopePath(prefix))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var result []string
+	for _, p := range paths {
+		if !hidden(p) {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	for _, p := range envelopes {
+		if name := strings.TrimPrefix(p, encryptionKeyPrefix+"/"); !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// GetSize returns the plaintext size of content
+func (e *EncryptedStorage) GetSize(ctx context.Context, path string) (int64, error) {
+	env, err := e.envelope(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if env == nil {
+		return e.inner.GetSize(ctx, path)
+	}
+	return env.Size, nil
+}
+
+// GetChecksum returns the SHA256 checksum of the plaintext
+func (e *EncryptedStorage) GetChecksum(ctx context.Context, path string) (string, error) {
+	env, err := e.envelope(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if env == nil {
+		return e.inner.GetChecksum(ctx, path)
+	}
+	return env.SHA256, nil
+}
+
+// Rotate rewraps every data key not wrapped by the primary master key, without touching the
+// encrypted content. It returns the number of envelopes rewritten; once it succeeds, retired
+// master keys can be removed from the keyring.
+func (e *EncryptedStorage) Rotate(ctx context.Context) (int, error) {
+	paths, err := e.inner.List(ctx, encryptionKeyPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list encryption envelopes: %w", err)
+	}
+	rewrapped := 0
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return rewrapped, err
+		}
+		path := strings.TrimPrefix(p, encryptionKeyPrefix+"/")
+		env, err := e.envelope(ctx, path)
+		if err != nil {
+			return rewrapped, err
+		}
+		if env == nil || env.KeyID == e.keys.primary {
+			continue
+		}
+		dataKey, err := e.keys.unwrap(env.KeyID, env.WrappedKey)
+		if err != nil {
+			return rewrapped, fmt.Errorf("failed to rotate %s: %w", path, err)
+		}
+		if env.KeyID, env.WrappedKey, err = e.keys.wrap(dataKey); err != nil {
+			return rewrapped, fmt.Errorf("failed to rotate %s: %w", path, err)
+		}
+		if err := e.saveEnvelope(ctx, path, env); err != nil {
+			return rewrapped, fmt.Errorf("failed to rotate %s: %w", path, err)
+		}
+		rewrapped++
+	}
+	return rewrapped, nil
+}
+
+// chunkNonce derives the nonce of a chunk from its index; data keys are never reused, so
+// counters are unique per key
+func chunkNonce(size int, counter uint64) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-8:], counter)
+	return nonce
+}
+
+// chunkAAD marks the last chunk of an object, so dropping trailing chunks is detected
+func chunkAAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// sealingReader encrypts plain into chunks. Full chunks are never last: content whose size is
+// a multiple of the chunk size ends with an empty last chunk.
+type sealingReader struct {
+	aead    cipher.AEAD
+	plain   io.Reader
+	counter uint64
+	buf     []byte
+	out     []byte
+	done    bool
+}
+
+func (s *sealingReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if s.buf == nil {
+			s.buf = make([]byte, encryptionChunkSize)
+		}
+		n, err := io.ReadFull(s.plain, s.buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		last := n < encryptionChunkSize
+		s.out = s.aead.Seal(s.out[:0], chunkNonce(s.aead.NonceSize(), s.counter), s.buf[:n], chunkAAD(last))
+		s.counter++
+		s.done = last
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// openingReader decrypts chunks starting at chunk index counter
+type openingReader struct {
+	aead      cipher.AEAD
+	sealed    io.Reader
+	chunkSize int
+	counter   uint64
+	buf       []byte
+	out       []byte
+	done      bool
+}
+
+func (o *openingReader) Read(p []byte) (int, error) {
+	for len(o.out) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		full := o.chunkSize + o.aead.Overhead()
+		if o.buf == nil {
+			o.buf = make([]byte, full)
+		}
+		n, err := io.ReadFull(o.sealed, o.buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, errors.New("encrypted content is truncated")
+		}
+		last := n < full
+		plain, err := o.aead.Open(o.buf[:0], chunkNonce(o.aead.NonceSize(), o.counter), o.buf[:n], chunkAAD(last))
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt content: %w", err)
+		}
+		o.out = plain
+		o.counter++
+		o.done = last
+	}
+	n := copy(p, o.out)
+	o.out = o.out[n:]
+	return n, nil
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKey(t *testing.T) []byte {
+	key := make([]byte, encryptionKeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	inner := NewLocalStorage(base)
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	keys, err := NewKeyring(oldKey)
+	require.NoError(t, err)
+	enc := NewEncryptedStorage(inner, keys)
+
+	// Two chunks and a bit, so reads cross chunk boundaries
+	content := bytes.Repeat([]byte("licensed binary "), (2*encryptionChunkSize+100)/16)
+	sum := sha256.Sum256(content)
+
+	read := func(st Storage, path string, offset, length int64) []byte {
+		rc, err := st.RetrieveRange(ctx, path, offset, length)
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return data
+	}
+	// object returns where the envelope of path keeps its ciphertext
+	object := func(path string) string {
+		env, err := enc.envelope(ctx, path)
+		require.NoError(t, err)
+		require.NotNil(t, env)
+		return env.Object
+	}
+
+	t.Run("Store encrypts content", func(t *testing.T) {
+		digests, err := enc.Store(ctx, "vendor/tool.bin", bytes.NewReader(content))
+		require.NoError(t, err)
+		assert.Equal(t, &Digests{Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])}, digests)
+
+		raw, err := os.ReadFile(filepath.Join(base, object("vendor/tool.bin")))
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(raw), encryptionMagic))
+		assert.False(t, bytes.Contains(raw, []byte("licensed binary")), "content is not stored in plaintext")
+
+		assert.Equal(t, content, read(enc, "vendor/tool.bin", 0, -1))
+	})
+
+	t.Run("Plaintext size and checksum", func(t *testing.T) {
+		size, err := enc.GetSize(ctx, "vendor/tool.bin")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), size)
+		checksum, err := enc.GetChecksum(ctx, "vendor/tool.bin")
+		require.NoError(t, err)
+		assert.Equal(t, hex.EncodeToString(sum[:]), checksum)
+	})
+
+	t.Run("Ranged reads", func(t *testing.T) {
+		for _, r := range [][2]int64{{0, 10}, {encryptionChunkSize - 5, 10}, {2*encryptionChunkSize + 3, -1}, {int64(len(content)), -1}} {
+			want := content[r[0]:]
+			if r[1] >= 0 {
+				want = want[:r[1]]
+			}
+			assert.Equal(t, want, read(enc, "vendor/tool.bin", r[0], r[1]), "range %v", r)
+		}
+	})
+
+	t.Run("Chunk-sized and empty content", func(t *testing.T) {
+		for _, size := range []int{0, encryptionChunkSize} {
+			data := bytes.Repeat([]byte{7}, size)
+			_, err := enc.Store(ctx, "edge.bin", bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, len(data), len(read(enc, "edge.bin", 0, -1)))
+		}
+	})
+
+	t.Run("Tampered and truncated content fails", func(t *testing.T) {
+		ciphertext := object("vendor/tool.bin")
+		raw, err := os.ReadFile(filepath.Join(base, ciphertext))
+		require.NoError(t, err)
+		sealedChunk := encryptionChunkSize + 16
+
+		_, err = inner.Store(ctx, ciphertext, bytes.NewReader(raw[:len(encryptionMagic)+2*sealedChunk]))
+		require.NoError(t, err)
+		rc, err := enc.Retrieve(ctx, "vendor/tool.bin")
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		rc.Close()
+		assert.Error(t, err, "dropping the last chunk is detected")
+
+		tampered := append([]byte(nil), raw...)
+		tampered[len(encryptionMagic)+10] ^= 1
+		_, err = inner.Store(ctx, ciphertext, bytes.NewReader(tampered))
+		require.NoError(t, err)
+		rc, err = enc.Retrieve(ctx, "vendor/tool.bin")
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		rc.Close()
+		assert.Error(t, err)
+
+		_, err = inner.Store(ctx, ciphertext, bytes.NewReader(raw))
+		require.NoError(t, err)
+	})
+
+	t.Run("Objects stored before encryption", func(t *testing.T) {
+		_, err := inner.Store(ctx, "legacy.txt", strings.NewReader("plain"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("plain"), read(enc, "legacy.txt", 0, -1))
+
+		// Ciphertext at the path itself, as stored before content was versioned, whose
+		// envelope is lost
+		_, err = inner.Store(ctx, "edge.bin", bytes.NewReader(read(inner, object("edge.bin"), 0, -1)))
+		require.NoError(t, err)
+		require.NoError(t, inner.Delete(ctx, envelopePath("edge.bin")))
+		_, err = enc.Retrieve(ctx, "edge.bin")
+		assert.Error(t, err, "ciphertext without its envelope is never served")
+	})
+
+	t.Run("List hides envelopes", func(t *testing.T) {
+		paths, err := enc.List(ctx, "")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"vendor/tool.bin", "edge.bin", "legacy.txt"}, paths)
+	})
+
+	t.Run("Rotate rewraps data keys only", func(t *testing.T) {
+		before, err := os.ReadFile(filepath.Join(base, object("vendor/tool.bin")))
+		require.NoError(t, err)
+
+		rotated, err := NewKeyring(newKey, oldKey)
+		require.NoError(t, err)
+		enc = NewEncryptedStorage(inner, rotated)
+		count, err := enc.Rotate(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		after, err := os.ReadFile(filepath.Join(base, object("vendor/tool.bin")))
+		require.NoError(t, err)
+		assert.Equal(t, before, after, "content is not rewritten")
+
+		// The retired key is no longer needed
+		current, err := NewKeyring(newKey)
+		require.NoError(t, err)
+		enc = NewEncryptedStorage(inner, current)
+		assert.Equal(t, content, read(enc, "vendor/tool.bin", 0, -1))
+		count, err = enc.Rotate(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+
+		other, err := NewKeyring(newTestKey(t))
+		require.NoError(t, err)
+		_, err = NewEncryptedStorage(inner, other).Retrieve(ctx, "vendor/tool.bin")
+		assert.Error(t, err)
+	})
+
+	t.Run("Overwrites switch the envelope last", func(t *testing.T) {
+		previous := object("vendor/tool.bin")
+
+		failing := &failingEnvelopes{Storage: inner}
+		_, err := NewEncryptedStorage(failing, enc.keys).Store(ctx, "vendor/tool.bin", strings.NewReader("new release"))
+		assert.Error(t, err)
+		assert.Equal(t, content, read(enc, "vendor/tool.bin", 0, -1), "the previous content is still served")
+		assert.Equal(t, previous, object("vendor/tool.bin"))
+		objects, err := inner.List(ctx, encryptionObjectPrefix+"/vendor")
+		require.NoError(t, err)
+		assert.Equal(t, []string{previous}, objects, "the new ciphertext is removed")
+
+		_, err = enc.Store(ctx, "vendor/tool.bin", strings.NewReader("new release"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new release"), read(enc, "vendor/tool.bin", 0, -1))
+		exists, err := inner.Exists(ctx, previous)
+		require.NoError(t, err)
+		assert.False(t, exists, "the replaced ciphertext is removed")
+	})
+
+	t.Run("Delete removes the envelope", func(t *testing.T) {
+		ciphertext := object("vendor/tool.bin")
+		require.NoError(t, enc.Delete(ctx, "vendor/tool.bin"))
+		for _, path := range []string{envelopePath("vendor/tool.bin"), ciphertext} {
+			exists, err := inner.Exists(ctx, path)
+			require.NoError(t, err)
+			assert.False(t, exists, path)
+		}
+	})
+}
+
+// failingEnvelopes fails to store envelopes
+type failingEnvelopes struct {
+	Storage
+}
+
+func (f *failingEnvelopes) Store(ctx context.Context, path string, content io.Reader) (*Digests, error) {
+	if strings.HasPrefix(path, encryptionKeyPrefix+"/") {
+		return nil, errors.New("disk full")
+	}
+	return f.Storage.Store(ctx, path, content)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	primary, previous := newTestKey(t), newTestKey(t)
+	file := filepath.Join(t.TempDir(), "master.key")
+	require.NoError(t, os.WriteFile(file, []byte("# rotated 2024-05\n"+base64.StdEncoding.EncodeToString(primary)+"\n\n"+base64.StdEncoding.EncodeToString(previous)+"\n"), 0600))
+
+	keys, err := LoadKeyring("", file, nil)
+	require.NoError(t, err)
+	expected, err := NewKeyring(primary)
+	require.NoError(t, err)
+	assert.Equal(t, expected.PrimaryKeyID(), keys.PrimaryKeyID())
+	assert.Len(t, keys.keys, 2)
+
+	_, err = LoadKeyring("", "", nil)
+	assert.Error(t, err)
+	_, err = LoadKeyring(base64.StdEncoding.EncodeToString([]byte("short")), "", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultFactory implements the Factory interface
+type DefaultFactory struct{}
+
+// NewFactory creates a new storage factory
+func NewFactory() Factory {
+	return &DefaultFactory{}
+}
+
+// CreateStorage creates the storage selected by config.Type: "local" (the default) stores under
+// LocalPath, also computing the digests listed in the "digests" option, and "s3" in the bucket
+// described by Options
+func (f *DefaultFactory) CreateStorage(config *Config) (Storage, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	switch config.Type {
+	case "", "local":
+		if config.LocalPath == "" {
+			return nil, fmt.Errorf("local_path is required for local storage")
+		}
+		var sha1, md5 bool
+		if digests := config.Options["digests"]; digests != "" {
+			for _, name := range strings.Split(digests, ",") {
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "sha1":
+					sha1 = true
+				case "md5":
+					md5 = true
+				case "sha256", "":
+				default:
+					return nil, fmt.Errorf("unsupported digest for local storage: %s", name)
+				}
+			}
+		}
+		return NewLocalStorageWithDigests(config.LocalPath, sha1, md5), nil
+	case "s3":
+		s3Config, err := S3ConfigFromOptions(config.Options)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Storage(s3Config)
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", config.Type)
+	}
+}
@@ -10,9 +10,14 @@ import (
 	"strings"
 )
 
+// localTempPrefix starts the names of files being written, which List skips
+const localTempPrefix = ".ganje-tmp-"
+
 // LocalStorage implements local file system storage
 type LocalStorage struct {
 	basePath string
+	sha1     bool
+	md5      bool
 }
 
 // NewLocalStorage creates a new local storage instance
@@ -20,29 +25,64 @@ func NewLocalStorage(basePath string) Storage {
 	return &LocalStorage{basePath: basePath}
 }
 
-// Store saves content to local file system
-func (l *LocalStorage) Store(ctx context.Context, path string, content io.Reader) error {
+// NewLocalStorageWithDigests creates a local storage that also computes the SHA-1 and/or MD5
+// of the content it stores
+func NewLocalStorageWithDigests(basePath string, sha1, md5 bool) Storage {
+	return &LocalStorage{basePath: basePath, sha1: sha1, md5: md5}
+}
+
+// Store saves content to local file system. Content is written to a temporary file in the
+// target directory, synced and renamed into place, so an aborted write never leaves a truncated
+// file at path.
+func (l *LocalStorage) Store(ctx context.Context, path string, content io.Reader) (*Digests, error) {
 	fullPath := filepath.Join(l.basePath, path)
 	
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 	
-	// Create file
-	file, err := os.Create(fullPath)
+	// Create temporary file next to the target, so the rename stays on one file system
+	file, err := os.CreateTemp(dir, localTempPrefix+"*")
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
+	tmpPath := file.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			file.Close()
+			os.Remove(tmpPath)
+		}
+	}()
 	
-	// Copy content to file
-	if _, err := io.Copy(file, content); err != nil {
-		return fmt.Errorf("failed to write content: %w", err)
+	// Copy content to file, computing digests on the way
+	digester := newDigester(l.sha1, l.md5)
+	if _, err := io.Copy(io.MultiWriter(file, digester), content); err != nil {
+		return nil, fmt.Errorf("failed to write content: %w", err)
 	}
+	if err := file.Chmod(0644); err != nil {
+		return nil, fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Rename(tmpPath, fullPath); err != nil {
+		return nil, fmt.Errorf("failed to move file into place: %w", err)
+	}
+	committed = true
 	
-	return nil
+	// Persist the rename; not every platform can sync a directory, so this is best effort
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	
+	return digester.Digests(), nil
 }
 
 // Retrieve gets content from local file system
@@ -60,6 +100,25 @@ func (l *LocalStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser
 	return file, nil
 }
 
+// RetrieveRange gets part of content from local file system
+func (l *LocalStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	file, err := l.Retrieve(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.(*os.File).Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
 // Delete removes content from local file system
 func (l *LocalStorage) Delete(ctx context.Context, path string) error {
 	fullPath := filepath.Join(l.basePath, path)
@@ -99,7 +158,7 @@ func (l *LocalStorage) List(ctx context.Context, prefix string) ([]string, error
 			return err
 		}
 		
-		if !info.IsDir() {
+		if !info.IsDir() && !strings.HasPrefix(info.Name(), localTempPrefix) {
 			// Convert absolute path to relative path
 			relPath, err := filepath.Rel(l.basePath, path)
 			if err != nil {
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	st := NewLocalStorageWithDigests(base, true, true)
+
+	t.Run("Store returns digests", func(t *testing.T) {
+		digests, err := st.Store(ctx, "maven/lib.jar", strings.NewReader("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, &Digests{
+			Size:   5,
+			SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			SHA1:   "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d",
+			MD5:    "5d41402abc4b2a76b9719d911017c592",
+		}, digests)
+
+		checksum, err := st.GetChecksum(ctx, "maven/lib.jar")
+		require.NoError(t, err)
+		assert.Equal(t, digests.SHA256, checksum)
+
+		info, err := os.Stat(filepath.Join(base, "maven", "lib.jar"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	})
+
+	t.Run("SHA-1 and MD5 are optional", func(t *testing.T) {
+		digests, err := NewLocalStorage(base).Store(ctx, "maven/other.jar", strings.NewReader("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), digests.Size)
+		assert.NotEmpty(t, digests.SHA256)
+		assert.Empty(t, digests.SHA1)
+		assert.Empty(t, digests.MD5)
+	})
+
+	t.Run("Failed write keeps the previous content", func(t *testing.T) {
+		content := io.MultiReader(bytes.NewReader([]byte("partial")), &failingReader{})
+		_, err := st.Store(ctx, "maven/lib.jar", content)
+		assert.Error(t, err)
+
+		rc, err := st.Retrieve(ctx, "maven/lib.jar")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		assert.Equal(t, "hello", string(data))
+
+		_, err = st.Store(ctx, "maven/new.jar", io.MultiReader(strings.NewReader("partial"), &failingReader{}))
+		assert.Error(t, err)
+		exists, err := st.Exists(ctx, "maven/new.jar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		entries, err := os.ReadDir(filepath.Join(base, "maven"))
+		require.NoError(t, err)
+		for _, entry := range entries {
+			assert.False(t, strings.HasPrefix(entry.Name(), localTempPrefix), "temporary file %s left behind", entry.Name())
+		}
+	})
+
+	t.Run("List skips files being written", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(base, "maven", localTempPrefix+"123"), []byte("x"), 0600))
+		paths, err := st.List(ctx, "maven")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"maven/lib.jar", "maven/other.jar"}, paths)
+	})
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultPool is the name of the storage pool of repositories that do not name one
+const DefaultPool = "default"
+
+// PrefixedStorage keeps content under a path prefix of another storage, so several pools can
+// share a backend
+type PrefixedStorage struct {
+	inner  Storage
+	prefix string
+}
+
+// NewPrefixedStorage creates a storage keeping content under prefix in inner; inner is returned
+// as is when prefix is empty
+func NewPrefixedStorage(inner Storage, prefix string) Storage {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return inner
+	}
+	return &PrefixedStorage{inner: inner, prefix: prefix}
+}
+
+func (p *PrefixedStorage) path(name string) string {
+	return p.prefix + "/" + strings.TrimPrefix(name, "/")
+}
+
+// Store saves content under the prefix
+func (p *PrefixedStorage) Store(ctx context.Context, path string, content io.Reader) (*Digests, error) {
+	return p.inner.Store(ctx, p.path(path), content)
+}
+
+// Retrieve gets content from under the prefix
+func (p *PrefixedStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	return p.inner.Retrieve(ctx, p.path(path))
+}
+
+// RetrieveRange gets part of content from under the prefix
+func (p *PrefixedStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	return p.inner.RetrieveRange(ctx, p.path(path), offset, length)
+}
+
+// Delete removes content from under the prefix
+func (p *PrefixedStorage) Delete(ctx context.Context, path string) error {
+	return p.inner.Delete(ctx, p.path(path))
+}
+
+// Exists checks if content exists under the prefix
+func (p *PrefixedStorage) Exists(ctx context.Context, path string) (bool, error) {
+	return p.inner.Exists(ctx, p.path(path))
+}
+
+// List returns the paths with the given prefix, relative to the storage prefix
+func (p *PrefixedStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	paths, err := p.inner.List(ctx, p.path(prefix))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(paths))
+	for _, name := range paths {
+		if rel, ok := strings.CutPrefix(name, p.prefix+"/"); ok {
+			result = append(result, rel)
+		}
+	}
+	return result, nil
+}
+
+// GetSize returns the size of content under the prefix
+func (p *PrefixedStorage) GetSize(ctx context.Context, path string) (int64, error) {
+	return p.inner.GetSize(ctx, p.path(path))
+}
+
+// GetChecksum returns the checksum of content under the prefix
+func (p *PrefixedStorage) GetChecksum(ctx context.Context, path string) (string, error) {
+	return p.inner.GetChecksum(ctx, p.path(path))
+}
+
+// Demote moves content under the prefix to the cold tier of the underlying storage
+func (p *PrefixedStorage) Demote(ctx context.Context, path string) error {
+	return Demote(ctx, p.inner, p.path(path))
+}
+
+// PoolLayers selects the decorators stacked on the backend of every pool, from the bottom up
+type PoolLayers struct {
+	// Cold enables tiering with Cold as the cold tier; each pool keeps its content under its
+	// own prefix of it
+	Cold Storage
+	// Keys enables encryption at rest
+	Keys *Keyring
+	// Refs enables deduplication; blobs are shared within a pool
+	Refs RefStore
+}
+
+// Pool is a storage pool: a backend with a path prefix, and the decorators stacked on it
+type Pool struct {
+	Name    string
+	Storage Storage
+
+	// Encrypted and CAS are the decorators of the pool, nil when disabled
+	Encrypted *EncryptedStorage
+	CAS       *CASStorage
+
+	// backend and cold are the storages the pool keeps content in, under prefix and coldPrefix
+	backend    Storage
+	prefix     string
+	cold       Storage
+	coldPrefix string
+}
+
+// NewPool stacks layers on the prefix of backend
+func NewPool(name string, backend Storage, prefix string, layers PoolLayers) *Pool {
+	prefix = strings.Trim(prefix, "/")
+	pool := &Pool{Name: name, Storage: NewPrefixedStorage(backend, prefix), backend: backend, prefix: prefix}
+	if layers.Cold != nil {
+		pool.cold, pool.coldPrefix = layers.Cold, prefix
+		if name != DefaultPool {
+			// Pools sharing the cold storage must not overwrite each other's content
+			pool.coldPrefix = path.Join("pools", name, prefix)
+		}
+		pool.Storage = NewTieredStorage(pool.Storage, NewPrefixedStorage(layers.Cold, pool.coldPrefix))
+	}
+	if layers.Keys != nil {
+		pool.Encrypted = NewEncryptedStorage(pool.Storage, layers.Keys)
+		pool.Storage = pool.Encrypted
+	}
+	if layers.Refs != nil {
+		pool.CAS = NewCASStorage(pool.Storage, layers.Refs)
+		if name != DefaultPool {
+			// References stored before pools existed belong to the default pool
+			pool.CAS.pool = name
+		}
+		pool.Storage = pool.CAS
+	}
+	return pool
+}
+
+// ForRepository returns the storage of a repository bound to the pool; with deduplication
+// enabled, the references it stores are attributed to the repository
+func (p *Pool) ForRepository(name string) Storage {
+	if p.CAS != nil {
+		return p.CAS.ForRepository(name)
+	}
+	return p.Storage
+}
+
+// Pools are the storage pools of a deployment by name, including DefaultPool
+type Pools map[string]*Pool
+
+// Get returns a pool by name; an empty name selects the default pool
+func (p Pools) Get(name string) (*Pool, error) {
+	if name == "" {
+		name = DefaultPool
+	}
+	pool, ok := p[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage pool: %s", name)
+	}
+	return pool, nil
+}
+
+// foreign reports whether a path listed by pool is content of another pool sharing its backend
+// or cold storage under a nested prefix
+func (p Pools) foreign(pool *Pool, name string) bool {
+	within := func(prefix, nested string) bool {
+		if prefix != "" {
+			var ok bool
+			if nested, ok = strings.CutPrefix(nested, prefix+"/"); !ok {
+				return false
+			}
+		}
+		return nested != "" && (name == nested || strings.HasPrefix(name, nested+"/"))
+	}
+	for _, other := range p {
+		if other == pool {
+			continue
+		}
+		if other.backend == pool.backend && within(pool.prefix, other.prefix) {
+			return true
+		}
+		if pool.cold != nil && other.cold == pool.cold && within(pool.coldPrefix, other.coldPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sorted returns the pools ordered by name
+func (p Pools) sorted() []*Pool {
+	pools := make([]*Pool, 0, len(p))
+	for _, pool := range p {
+		pools = append(pools, pool)
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+	return pools
+}
+
+// Rotate rewraps the data keys of every encrypted pool with the primary master key, returning
+// the number of envelopes rewritten
+func (p Pools) Rotate(ctx context.Context) (int, error) {
+	rewrapped := 0
+	for _, pool := range p.sorted() {
+		if pool.Encrypted == nil {
+			continue
+		}
+		n, err := pool.Encrypted.Rotate(ctx)
+		rewrapped += n
+		if err != nil {
+			return rewrapped, fmt.Errorf("storage pool %s: %w", pool.Name, err)
+		}
+	}
+	return rewrapped, nil
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixedStorage(t *testing.T) {
+	ctx := context.Background()
+	backend := NewLocalStorage(t.TempDir())
+	st := NewPrefixedStorage(backend, "/bulk/")
+
+	_, err := st.Store(ctx, "layers/a", strings.NewReader("alpha"))
+	require.NoError(t, err)
+	exists, err := backend.Exists(ctx, "bulk/layers/a")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	paths, err := st.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"layers/a"}, paths)
+	size, err := st.GetSize(ctx, "layers/a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+
+	require.NoError(t, st.Delete(ctx, "layers/a"))
+	exists, err = backend.Exists(ctx, "bulk/layers/a")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Same(t, backend, NewPrefixedStorage(backend, ""))
+}
+
+func TestPools(t *testing.T) {
+	ctx := context.Background()
+	backend := NewLocalStorage(t.TempDir())
+	cold := NewLocalStorage(t.TempDir())
+	keys, err := NewKeyring(make([]byte, 32))
+	require.NoError(t, err)
+	refs := newMemoryRefStore()
+	layers := PoolLayers{Cold: cold, Keys: keys, Refs: refs}
+	pools := Pools{
+		DefaultPool: NewPool(DefaultPool, backend, "", layers),
+		"bulk":      NewPool("bulk", backend, "bulk", layers),
+	}
+
+	def, err := pools.Get("")
+	require.NoError(t, err)
+	bulk, err := pools.Get("bulk")
+	require.NoError(t, err)
+	_, err = pools.Get("missing")
+	assert.Error(t, err)
+
+	// ciphertext returns where a pool keeps the encrypted blob of hash
+	ciphertext := func(pool *Pool, hash string) string {
+		env, err := pool.Encrypted.envelope(ctx, BlobPath(hash))
+		require.NoError(t, err)
+		require.NotNil(t, env)
+		return env.Object
+	}
+
+	t.Run("Content stays in its pool", func(t *testing.T) {
+		_, err := def.ForRepository("maven").Store(ctx, "a.jar", strings.NewReader("same"))
+		require.NoError(t, err)
+		_, err = bulk.ForRepository("docker").Store(ctx, "b.tar", strings.NewReader("same"))
+		require.NoError(t, err)
+
+		ref, err := refs.GetBlobRef(ctx, "bulk", "docker", "b.tar")
+		require.NoError(t, err)
+		assert.Equal(t, "bulk", ref.Pool)
+		exists, err := backend.Exists(ctx, "bulk/"+ciphertext(bulk, ref.Hash))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		paths, err := bulk.ForRepository("docker").List(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b.tar"}, paths)
+	})
+
+	t.Run("Deleting keeps blobs of other pools", func(t *testing.T) {
+		require.NoError(t, def.ForRepository("maven").Delete(ctx, "a.jar"))
+		content, err := bulk.ForRepository("docker").Retrieve(ctx, "b.tar")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(content)
+		content.Close()
+		assert.Equal(t, "same", string(data))
+	})
+
+	t.Run("Pools holding the same path keep their own content", func(t *testing.T) {
+		_, err := def.ForRepository("rpm-a").Store(ctx, "Packages/foo.rpm", strings.NewReader("default content"))
+		require.NoError(t, err)
+		_, err = bulk.ForRepository("rpm-b").Store(ctx, "Packages/foo.rpm", strings.NewReader("bulk content"))
+		require.NoError(t, err)
+
+		read := func(pool *Pool, repository string) string {
+			content, err := pool.ForRepository(repository).Retrieve(ctx, "Packages/foo.rpm")
+			require.NoError(t, err)
+			defer content.Close()
+			data, _ := io.ReadAll(content)
+			return string(data)
+		}
+		assert.Equal(t, "default content", read(def, "rpm-a"))
+		assert.Equal(t, "bulk content", read(bulk, "rpm-b"))
+
+		ref, err := refs.GetBlobRef(ctx, "bulk", "rpm-b", "Packages/foo.rpm")
+		require.NoError(t, err)
+		require.NoError(t, bulk.ForRepository("rpm-b").Delete(ctx, "Packages/foo.rpm"))
+		assert.Equal(t, "default content", read(def, "rpm-a"))
+		exists, err := bulk.Encrypted.Exists(ctx, BlobPath(ref.Hash))
+		require.NoError(t, err)
+		assert.False(t, exists, "the blob of the bulk pool is released")
+		require.NoError(t, def.ForRepository("rpm-a").Delete(ctx, "Packages/foo.rpm"))
+	})
+
+	t.Run("Pools share the cold storage under their own prefix", func(t *testing.T) {
+		ref, err := refs.GetBlobRef(ctx, "bulk", "docker", "b.tar")
+		require.NoError(t, err)
+		require.NoError(t, Demote(ctx, bulk.ForRepository("docker"), "b.tar"))
+		exists, err := cold.Exists(ctx, "pools/bulk/bulk/"+ciphertext(bulk, ref.Hash))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Rotate covers every pool", func(t *testing.T) {
+		primary := make([]byte, 32)
+		primary[0] = 1
+		rotatedKeys, err := NewKeyring(primary, make([]byte, 32))
+		require.NoError(t, err)
+		rotated := Pools{
+			DefaultPool: NewPool(DefaultPool, backend, "", PoolLayers{Keys: rotatedKeys}),
+			"bulk":      NewPool("bulk", backend, "bulk", PoolLayers{Keys: rotatedKeys}),
+		}
+		rewrapped, err := rotated.Rotate(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, rewrapped, "only the blob of b.tar is left")
+	})
+}
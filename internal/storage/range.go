@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rangeReader reads content of a known size through RetrieveRange, so storages that stream
+// content can still be seeked: a seek drops the current body and the next read reopens the
+// content at the new offset
+type rangeReader struct {
+	ctx    context.Context
+	st     Storage
+	path   string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// newRangeReader creates a seekable reader of path; body, if not nil, is the content read from
+// offset 0
+func newRangeReader(ctx context.Context, st Storage, path string, size int64, body io.ReadCloser) *rangeReader {
+	return &rangeReader{ctx: ctx, st: st, path: path, size: size, body: body}
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.st.RetrieveRange(r.ctx, r.path, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of content")
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+// forwardSeeker makes a stream of known size usable by http.ServeContent: seeks are recorded and
+// applied on the next read by skipping content, so only seeks forward of what was read succeed
+type forwardSeeker struct {
+	r    io.Reader
+	size int64
+	pos  int64
+	read int64
+}
+
+func (f *forwardSeeker) Read(p []byte) (int, error) {
+	if f.pos < f.read {
+		return 0, fmt.Errorf("cannot seek back to offset %d of a stream", f.pos)
+	}
+	if f.pos > f.read {
+		n, err := io.CopyN(io.Discard, f.r, f.pos-f.read)
+		f.read += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.r.Read(p)
+	f.read += int64(n)
+	f.pos = f.read
+	return n, err
+}
+
+func (f *forwardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of content")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// ServeContent writes content as the response to r. It answers conditional requests
+// (If-None-Match, If-Modified-Since, If-Range) and single and multiple byte ranges with
+// 206 Partial Content. The ETag is the quoted checksum and Last-Modified is modTime, or the
+// modification time of content when it is a file.
+// Content that cannot seek is read forward only: such streams are sent whole when size is not
+// positive or when the requested ranges are out of order or overlap.
+func ServeContent(w http.ResponseWriter, r *http.Request, content io.Reader, size int64, checksum string, modTime time.Time) {
+	// Files know when they were written
+	if file, ok := content.(interface{ Stat() (os.FileInfo, error) }); ok && modTime.IsZero() {
+		if info, err := file.Stat(); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+
+	etag := ""
+	if checksum != "" {
+		etag = `"` + checksum + `"`
+		w.Header().Set("ETag", etag)
+	}
+
+	seeker, ok := content.(io.ReadSeeker)
+	if !ok && size <= 0 {
+		if !modTime.IsZero() {
+			w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+		}
+		if notModified(r, etag, modTime) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			_, _ = io.Copy(w, content)
+		}
+		return
+	}
+	if !ok {
+		seeker = &forwardSeeker{r: content, size: size}
+		// Ranges that need seeking back would fail after the headers are sent
+		if !rangesForward(r.Header.Get("Range"), size) {
+			r = r.Clone(r.Context())
+			r.Header.Del("Range")
+		}
+		// Sniffing the type reads ahead and seeks back, which a stream cannot do
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+	}
+	http.ServeContent(w, r, "", modTime, seeker)
+}
+
+// rangesForward reports whether the ranges of a Range header can be read from content of size
+// in a single forward pass, that is each starts past the end of the previous one. Headers that
+// do not parse are left to http.ServeContent to reject.
+func rangesForward(header string, size int64) bool {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return true
+	}
+	next := int64(0)
+	for _, part := range strings.Split(spec, ",") {
+		first, last, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return true
+		}
+		var start, end int64
+		if first == "" {
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil {
+				return true
+			}
+			start, end = max(size-n, 0), size-1
+		} else {
+			var err error
+			if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+				return true
+			}
+			end = size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil {
+					return true
+				}
+			}
+		}
+		if start < next {
+			return false
+		}
+		next = end + 1
+	}
+	return true
+}
+
+// notModified reports whether a GET or HEAD request is answered by the cached copy of the client
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modTime.IsZero() && !modTime.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeContent(t *testing.T) {
+	ctx := context.Background()
+	st := NewLocalStorage(t.TempDir())
+	digests, err := st.Store(ctx, "installer.bin", strings.NewReader("0123456789"))
+	require.NoError(t, err)
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	serve := func(content io.Reader, size int64, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/installer.bin", nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		ServeContent(w, req, content, size, digests.SHA256, modTime)
+		return w
+	}
+	open := func() io.ReadCloser {
+		content, err := st.Retrieve(ctx, "installer.bin")
+		require.NoError(t, err)
+		t.Cleanup(func() { content.Close() })
+		return content
+	}
+
+	t.Run("Full download", func(t *testing.T) {
+		w := serve(open(), 10, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0123456789", w.Body.String())
+		assert.Equal(t, `"`+digests.SHA256+`"`, w.Header().Get("ETag"))
+		assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+		assert.Equal(t, "Wed, 01 May 2024 12:00:00 GMT", w.Header().Get("Last-Modified"))
+	})
+
+	t.Run("Single range", func(t *testing.T) {
+		w := serve(open(), 10, http.Header{"Range": {"bytes=4-"}})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "456789", w.Body.String())
+		assert.Equal(t, "bytes 4-9/10", w.Header().Get("Content-Range"))
+	})
+
+	t.Run("Multiple ranges", func(t *testing.T) {
+		w := serve(open(), 10, http.Header{"Range": {"bytes=0-1,8-9"}})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/byteranges", mediaType)
+
+		reader := multipart.NewReader(w.Body, params["boundary"])
+		var parts []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, _ := io.ReadAll(part)
+			parts = append(parts, part.Header.Get("Content-Range")+" "+string(data))
+		}
+		assert.Equal(t, []string{"bytes 0-1/10 01", "bytes 8-9/10 89"}, parts)
+	})
+
+	t.Run("Unsatisfiable range", func(t *testing.T) {
+		w := serve(open(), 10, http.Header{"Range": {"bytes=20-"}})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	})
+
+	t.Run("Conditional requests", func(t *testing.T) {
+		w := serve(open(), 10, http.Header{"If-None-Match": {`"` + digests.SHA256 + `"`}})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+
+		w = serve(open(), 10, http.Header{"If-Modified-Since": {"Wed, 01 May 2024 12:00:00 GMT"}})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		w = serve(open(), 10, http.Header{"If-None-Match": {`"other"`}})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// A range of a changed artifact restarts the download
+		w = serve(open(), 10, http.Header{"Range": {"bytes=4-"}, "If-Range": {`"other"`}})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0123456789", w.Body.String())
+	})
+
+	t.Run("Streams of known size", func(t *testing.T) {
+		w := serve(io.NopCloser(strings.NewReader("0123456789")), 10, http.Header{"Range": {"bytes=2-3,6-7"}})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Contains(t, w.Body.String(), "23")
+		assert.Contains(t, w.Body.String(), "67")
+
+		// Reading these would need seeking back, so the whole stream is sent instead
+		for _, ranges := range []string{"bytes=6-7,2-3", "bytes=2-5,4-7", "bytes=-2,0-1"} {
+			w = serve(io.NopCloser(strings.NewReader("0123456789")), 10, http.Header{"Range": {ranges}})
+			assert.Equal(t, http.StatusOK, w.Code, ranges)
+			assert.Equal(t, "0123456789", w.Body.String(), ranges)
+		}
+	})
+
+	t.Run("Streams of unknown size", func(t *testing.T) {
+		w := serve(io.NopCloser(strings.NewReader("0123456789")), 0, http.Header{"Range": {"bytes=4-"}})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0123456789", w.Body.String())
+
+		w = serve(io.NopCloser(strings.NewReader("0123456789")), 0, http.Header{"If-None-Match": {`W/"` + digests.SHA256 + `"`}})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	})
+}
+
+func TestLocalStorageRetrieveRange(t *testing.T) {
+	ctx := context.Background()
+	st := NewLocalStorage(t.TempDir())
+	_, err := st.Store(ctx, "blob", strings.NewReader("0123456789"))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		offset, length int64
+		want           string
+	}{{0, 3, "012"}, {7, -1, "789"}, {8, 10, "89"}} {
+		part, err := st.RetrieveRange(ctx, "blob", tc.offset, tc.length)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(part)
+		part.Close()
+		assert.Equal(t, tc.want, string(data))
+	}
+
+	_, err = st.RetrieveRange(ctx, "missing", 0, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,644 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// s3MinPartSize is the smallest part S3 accepts for any but the last part of a multipart upload
+	s3MinPartSize = 5 << 20
+	// s3DefaultPartSize is the part size used when none is configured; content smaller than a
+	// part is stored with a single PUT
+	s3DefaultPartSize = 16 << 20
+
+	// s3ChecksumHeader is the user metadata holding the SHA-256 of an object written by S3Storage
+	s3ChecksumHeader = "X-Amz-Meta-Sha256"
+	// s3StorageClassHeader selects the storage class of uploaded objects
+	s3StorageClassHeader = "X-Amz-Storage-Class"
+
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Config configures an S3Storage
+type S3Config struct {
+	// Endpoint is the service URL, such as http://minio:9000; it defaults to the AWS endpoint
+	// of Region
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to every key, so several deployments can share a bucket
+	Prefix string
+	// PathStyle addresses the bucket in the URL path rather than the host name, as MinIO and
+	// most other S3-compatible services require
+	PathStyle bool
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// PartSize is the size of multipart upload parts, at least 5 MiB
+	PartSize int64
+
+	// StorageClass is the storage class of uploaded objects, such as STANDARD_IA or GLACIER_IR;
+	// the bucket default applies when empty
+	StorageClass string
+
+	// HTTPClient sends the requests; http.DefaultClient is used when nil
+	HTTPClient *http.Client
+}
+
+// S3ConfigFromOptions reads an S3Config from storage options. Recognized keys:
+// - endpoint, region (defaults to "us-east-1"), bucket (required), prefix
+// - path_style ("true" to address the bucket in the URL path)
+// - access_key_id, secret_access_key, session_token (default to the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables)
+// - part_size (multipart upload part size in bytes)
+// - storage_class (storage class of uploaded objects)
+func S3ConfigFromOptions(options map[string]string) (*S3Config, error) {
+	cfg := &S3Config{
+		Endpoint:        options["endpoint"],
+		Region:          options["region"],
+		Bucket:          options["bucket"],
+		Prefix:          options["prefix"],
+		AccessKeyID:     options["access_key_id"],
+		SecretAccessKey: options["secret_access_key"],
+		SessionToken:    options["session_token"],
+		StorageClass:    options["storage_class"],
+	}
+	if v := options["path_style"]; v != "" {
+		pathStyle, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_style %q", v)
+		}
+		cfg.PathStyle = pathStyle
+	}
+	if v := options["part_size"]; v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid part_size %q", v)
+		}
+		cfg.PartSize = size
+	}
+	if cfg.AccessKeyID == "" && cfg.SecretAccessKey == "" {
+		cfg.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		cfg.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if cfg.SessionToken == "" {
+			cfg.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+	return cfg, nil
+}
+
+// S3Storage implements storage on an S3-compatible object store. Requests are signed with
+// AWS Signature Version 4; without credentials they are sent anonymously.
+type S3Storage struct {
+	endpoint *url.URL
+	config   S3Config
+	client   *http.Client
+	// parts holds buffers of PartSize bytes, reused between uploads
+	parts *sync.Pool
+}
+
+// NewS3Storage creates a new S3 storage instance
+func NewS3Storage(cfg *S3Config) (Storage, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is required")
+	}
+	c := *cfg
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	if c.PartSize == 0 {
+		c.PartSize = s3DefaultPartSize
+	}
+	if c.PartSize < s3MinPartSize {
+		return nil, fmt.Errorf("S3 part size must be at least %d bytes", s3MinPartSize)
+	}
+	c.Prefix = strings.Trim(c.Prefix, "/")
+
+	endpoint, err := url.Parse(strings.TrimSuffix(c.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", c.Endpoint)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	parts := &sync.Pool{New: func() any {
+		buf := make([]byte, c.PartSize)
+		return &buf
+	}}
+	return &S3Storage{endpoint: endpoint, config: c, client: client, parts: parts}, nil
+}
+
+// key returns the object key of a storage path
+func (s *S3Storage) key(path string) string {
+	path = strings.TrimPrefix(strings.ReplaceAll(path, "\\", "/"), "/")
+	if s.config.Prefix == "" {
+		return path
+	}
+	return s.config.Prefix + "/" + path
+}
+
+// objectURL returns the URL of an object, or of the bucket when key is empty
+func (s *S3Storage) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	path := "/" + key
+	if s.config.PathStyle {
+		path = "/" + s.config.Bucket + path
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(s.endpoint.Path, "/") + path
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+	return &u
+}
+
+// do sends a signed request for an object. A body must be given as a byte slice so its
+// digest can be signed and the request retried by the transport.
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, query).String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	payloadHash := s3EmptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+	if s.config.AccessKeyID == "" {
+		return
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-") || lk == "content-type" || lk == "content-md5" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := now.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.config.SecretAccessKey)
+	for _, part := range []string{now.Format("20060102"), s.config.Region, "s3", "aws4_request"} {
+		key = s3HMAC(key, part)
+	}
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes s as Signature Version 4 requires: everything but unreserved
+// characters, and "/" unless encodeSlash is set
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// s3CanonicalQuery encodes query sorted by key, as both the request and its signature use it
+func s3CanonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3Error is the error document S3 returns
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3ResponseError reads a failed response into an error
+func s3ResponseError(resp *http.Response) error {
+	var e s3Error
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return fmt.Errorf("S3 returned status %d: %s: %s", resp.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Errorf("S3 returned status %d", resp.StatusCode)
+}
+
+// expectDocument closes resp and returns an error unless it succeeded. CompleteMultipartUpload
+// can fail after responding 200, with an error document as the body.
+func expectDocument(resp *http.Response) error {
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var e s3Error
+	if resp.StatusCode != http.StatusOK || (xml.Unmarshal(data, &e) == nil && e.Code != "") {
+		return fmt.Errorf("S3 returned status %d: %s: %s", resp.StatusCode, e.Code, e.Message)
+	}
+	return nil
+}
+
+// expect closes resp and returns an error unless it has the given status
+func expect(resp *http.Response, status int) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		return s3ResponseError(resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Store uploads content with a single PUT when it is smaller than a part, and as a multipart
+// upload otherwise. The SHA-256 of the content is kept in the object's metadata for GetChecksum.
+func (s *S3Storage) Store(ctx context.Context, path string, content io.Reader) (*Digests, error) {
+	key := s.key(path)
+	part := s.parts.Get().(*[]byte)
+	defer s.parts.Put(part)
+	buf := *part
+	n, err := io.ReadFull(content, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read content: %w", err)
+	}
+	if err != nil {
+		sum := sha256.Sum256(buf[:n])
+		checksum := hex.EncodeToString(sum[:])
+		header := s.uploadHeader()
+		header.Set(s3ChecksumHeader, checksum)
+		resp, err := s.do(ctx, http.MethodPut, key, nil, header, buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload object: %w", err)
+		}
+		if err := expect(resp, http.StatusOK); err != nil {
+			return nil, fmt.Errorf("failed to upload object: %w", err)
+		}
+		return &Digests{Size: int64(n), SHA256: checksum}, nil
+	}
+	return s.storeMultipart(ctx, key, buf, content)
+}
+
+// uploadHeader returns the headers of requests creating objects
+func (s *S3Storage) uploadHeader() http.Header {
+	header := http.Header{}
+	if s.config.StorageClass != "" {
+		header.Set(s3StorageClassHeader, s.config.StorageClass)
+	}
+	return header
+}
+
+// storeMultipart uploads content whose first part is already in buf; the upload is aborted
+// when any part fails. The content is spooled to a temporary file first, so its digest is known
+// when the upload is created and is stored in the upload's metadata.
+func (s *S3Storage) storeMultipart(ctx context.Context, key string, buf []byte, content io.Reader) (*Digests, error) {
+	spool, err := os.CreateTemp("", "ganje-s3-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to buffer content: %w", err)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hasher), io.MultiReader(bytes.NewReader(buf), content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %w", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to buffer content: %w", err)
+	}
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+
+	header := s.uploadHeader()
+	header.Set(s3ChecksumHeader, checksum)
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("failed to start multipart upload: %w", s3ResponseError(resp))
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return nil, fmt.Errorf("failed to start multipart upload: invalid response")
+	}
+	uploadID := initiated.UploadID
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []completedPart
+	upload := func() error {
+		for number := 1; ; number++ {
+			n, readErr := io.ReadFull(spool, buf)
+			if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+				return readErr
+			}
+			if n == 0 {
+				break
+			}
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+			resp, err := s.do(ctx, http.MethodPut, key, query, nil, buf[:n])
+			if err != nil {
+				return err
+			}
+			etag := resp.Header.Get("ETag")
+			if err := expect(resp, http.StatusOK); err != nil {
+				return err
+			}
+			parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+		}
+
+		body, err := xml.Marshal(struct {
+			XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+			Parts   []completedPart `xml:"Part"`
+		}{Parts: parts})
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+		if err != nil {
+			return err
+		}
+		return expectDocument(resp)
+	}
+	if err := upload(); err != nil {
+		if resp, abortErr := s.do(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return nil, fmt.Errorf("failed to upload object: %w", err)
+	}
+	return &Digests{Size: size, SHA256: checksum}, nil
+}
+
+// Retrieve gets an object. The returned reader can seek, which reopens the object with a ranged
+// request at the new offset.
+func (s *S3Storage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.key(path), nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if resp.ContentLength < 0 {
+			return resp.Body, nil
+		}
+		return newRangeReader(ctx, s, path, resp.ContentLength, resp.Body), nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("file not found: %s", path)
+	default:
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("failed to get object: %w", s3ResponseError(resp))
+	}
+}
+
+// RetrieveRange gets part of an object with a Range request
+func (s *S3Storage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange += strconv.FormatInt(offset+length-1, 10)
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.key(path), nil, http.Header{"Range": {byteRange}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// Servers without range support send the whole object
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to get object: %w", err)
+		}
+		if length < 0 {
+			return resp.Body, nil
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, length), resp.Body}, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("file not found: %s", path)
+	default:
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("failed to get object: %w", s3ResponseError(resp))
+	}
+}
+
+// head returns the headers of an object, or nil when it does not exist
+func (s *S3Storage) head(ctx context.Context, path string) (http.Header, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.key(path), nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object info: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Header, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to get object info: S3 returned status %d", resp.StatusCode)
+	}
+}
+
+// Delete removes an object. S3 does not report deleting a missing object, so its existence
+// is checked first to fail like LocalStorage does.
+func (s *S3Storage) Delete(ctx context.Context, path string) error {
+	header, err := s.head(ctx, path)
+	if err != nil {
+		return err
+	}
+	if header == nil {
+		return fmt.Errorf("file not found: %s", path)
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.key(path), nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	if err := expect(resp, http.StatusNoContent); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// Exists checks if an object exists
+func (s *S3Storage) Exists(ctx context.Context, path string) (bool, error) {
+	header, err := s.head(ctx, path)
+	return header != nil, err
+}
+
+// List returns the paths of the objects at or below prefix, treating it as a directory like
+// LocalStorage does
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	dir := strings.TrimSuffix(s.key(prefix), "/")
+	var paths []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {dir}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = s3ResponseError(resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			if dir != "" && object.Key != dir && !strings.HasPrefix(object.Key, dir+"/") {
+				continue
+			}
+			path := object.Key
+			if s.config.Prefix != "" {
+				path = strings.TrimPrefix(path, s.config.Prefix+"/")
+			}
+			paths = append(paths, path)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return paths, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// GetSize returns the size of an object without reading it
+func (s *S3Storage) GetSize(ctx context.Context, path string) (int64, error) {
+	header, err := s.head(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, fmt.Errorf("file not found: %s", path)
+	}
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get object size: %w", err)
+	}
+	return size, nil
+}
+
+// GetChecksum returns the SHA256 checksum of an object. The digest recorded by Store is returned
+// without reading the object; objects written by other clients are downloaded and hashed.
+func (s *S3Storage) GetChecksum(ctx context.Context, path string) (string, error) {
+	header, err := s.head(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if header == nil {
+		return "", fmt.Errorf("file not found: %s", path)
+	}
+	if checksum := header.Get(s3ChecksumHeader); len(checksum) == sha256.Size*2 {
+		return strings.ToLower(checksum), nil
+	}
+
+	content, err := s.Retrieve(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	checksum, err := GenerateHash(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+	return checksum, nil
+}
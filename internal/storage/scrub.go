@@ -0,0 +1,592 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScrubPolicy selects what a scrub does with the problems it finds
+type ScrubPolicy string
+
+const (
+	// ScrubPolicyReport only reports problems
+	ScrubPolicyReport ScrubPolicy = "report"
+	// ScrubPolicyQuarantine moves objects with problems under QuarantinePrefix of their pool
+	ScrubPolicyQuarantine ScrubPolicy = "quarantine"
+	// ScrubPolicyRepair drops cached upstream copies with problems so they are fetched again, and
+	// quarantines other objects
+	ScrubPolicyRepair ScrubPolicy = "repair"
+)
+
+// QuarantinePrefix is where a scrub moves objects it quarantines, within their pool
+const QuarantinePrefix = ".quarantine"
+
+// Kinds of scrub findings
+const (
+	ScrubMismatch   = "mismatch"
+	ScrubMissing    = "missing"
+	ScrubOrphan     = "orphan"
+	ScrubUnreadable = "unreadable"
+)
+
+// ErrScrubRunning is returned when starting a scrub while another one runs
+var ErrScrubRunning = errors.New("a scrub is already running")
+
+// scrubBatchSize is how many records or paths a scrub looks up at once
+const scrubBatchSize = 500
+
+// scrubMaxFindings bounds the findings a report lists; its counters stay exact
+const scrubMaxFindings = 1000
+
+// ScrubRecord is an object the database expects in storage
+type ScrubRecord struct {
+	ID         uint
+	Repository string
+	Path       string
+	Size       int64
+	Checksum   string
+	// Cached marks the copy of an upstream artifact kept by a remote repository
+	Cached bool
+}
+
+// ScrubIndex gives a scrub the objects the database knows about
+type ScrubIndex interface {
+	// ListScrubRecords returns up to limit artifact records, or cache records when cached is
+	// set, with an ID above after, ordered by ID
+	ListScrubRecords(ctx context.Context, cached bool, after uint, limit int) ([]ScrubRecord, error)
+	// GetScrubRecord returns a record as it is now, or nil when it was deleted
+	GetScrubRecord(ctx context.Context, cached bool, id uint) (*ScrubRecord, error)
+	// KnownPaths returns the paths among paths that an artifact or cache record points at
+	KnownPaths(ctx context.Context, paths []string) (map[string]bool, error)
+	// DropCacheRecord deletes a cache record, so the next pull fetches the artifact again
+	DropCacheRecord(ctx context.Context, id uint) error
+}
+
+// ScrubOptions configures a Scrubber
+type ScrubOptions struct {
+	// OnMismatch applies to objects whose content does not match their record, and to cached
+	// copies that are missing
+	OnMismatch ScrubPolicy
+	// OnOrphan applies to objects no record points at. Repairing an orphan quarantines it.
+	OnOrphan ScrubPolicy
+	// BytesPerSecond limits how fast content is re-hashed; zero disables the limit
+	BytesPerSecond int64
+	// Ignore are path.Match patterns of objects that have no record by design, such as
+	// generated indexes. A pattern without a slash is matched against the base name; one with a
+	// slash against the path and each of its directories.
+	Ignore []string
+	// PoolOf returns the name of the storage pool of a repository, which holds the objects of
+	// its records; without it every record is looked up in the default pool
+	PoolOf func(ctx context.Context, repository string) (string, error)
+	// Done is called with the report of every scrub, whether run, started or scheduled
+	Done func(*ScrubReport, error)
+}
+
+// ScrubFinding is a problem found by a scrub
+type ScrubFinding struct {
+	Kind string `json:"kind"`
+	Pool string `json:"pool,omitempty"`
+	// Repository is the repository of the object, when known
+	Repository string `json:"repository,omitempty"`
+	Path       string `json:"path"`
+	Expected   string `json:"expected,omitempty"`
+	Actual     string `json:"actual,omitempty"`
+	// Action is what was done about the finding: reported, quarantined or dropped
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ScrubReport is the result of a scrub
+type ScrubReport struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Checked    int            `json:"checked"`
+	Bytes      int64          `json:"bytes"`
+	Mismatched int            `json:"mismatched"`
+	Missing    int            `json:"missing"`
+	Orphaned   int            `json:"orphaned"`
+	Unreadable int            `json:"unreadable"`
+	Findings   []ScrubFinding `json:"findings"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Counts returns the number of findings by kind
+func (r *ScrubReport) Counts() map[string]int {
+	return map[string]int{ScrubMismatch: r.Mismatched, ScrubMissing: r.Missing, ScrubOrphan: r.Orphaned, ScrubUnreadable: r.Unreadable}
+}
+
+func (r *ScrubReport) add(f ScrubFinding) {
+	switch f.Kind {
+	case ScrubMismatch:
+		r.Mismatched++
+	case ScrubMissing:
+		r.Missing++
+	case ScrubOrphan:
+		r.Orphaned++
+	case ScrubUnreadable:
+		r.Unreadable++
+	}
+	if len(r.Findings) < scrubMaxFindings {
+		r.Findings = append(r.Findings, f)
+	}
+}
+
+// Scrubber verifies that stored objects match the checksums recorded in the database, and
+// finds records without objects and objects without records. Reads bypass tier promotion.
+type Scrubber struct {
+	pools Pools
+	index ScrubIndex
+	opts  ScrubOptions
+
+	running sync.Mutex
+
+	mu   sync.Mutex
+	last *ScrubReport
+	// orphans are the orphans of the previous scrub; an orphan is only quarantined when two
+	// scrubs in a row find it, so objects whose record is being written are left alone
+	orphans map[string]bool
+}
+
+// NewScrubber creates a scrubber of pools
+func NewScrubber(pools Pools, index ScrubIndex, opts ScrubOptions) *Scrubber {
+	if opts.OnMismatch == "" {
+		opts.OnMismatch = ScrubPolicyReport
+	}
+	if opts.OnOrphan == "" {
+		opts.OnOrphan = ScrubPolicyReport
+	}
+	return &Scrubber{pools: pools, index: index, opts: opts}
+}
+
+// LastReport returns the report of the last scrub, or nil before the first one completes
+func (s *Scrubber) LastReport() *ScrubReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Running reports whether a scrub is running
+func (s *Scrubber) Running() bool {
+	if s.running.TryLock() {
+		s.running.Unlock()
+		return false
+	}
+	return true
+}
+
+// Run scrubs every pool. It returns ErrScrubRunning when another scrub is running; otherwise the
+// report is returned, with the error that stopped the scrub early, if any.
+func (s *Scrubber) Run(ctx context.Context) (*ScrubReport, error) {
+	if !s.running.TryLock() {
+		return nil, ErrScrubRunning
+	}
+	defer s.running.Unlock()
+	return s.run(ctx)
+}
+
+// Start scrubs every pool in the background. It returns ErrScrubRunning when another scrub is
+// running.
+func (s *Scrubber) Start(ctx context.Context) error {
+	if !s.running.TryLock() {
+		return ErrScrubRunning
+	}
+	go func() {
+		defer s.running.Unlock()
+		_, _ = s.run(ctx)
+	}()
+	return nil
+}
+
+// Schedule scrubs every pool at every interval until ctx is done. A scrub that is due while
+// another one runs is skipped.
+func (s *Scrubber) Schedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_, _ = s.Run(ctx)
+	}
+}
+
+func (s *Scrubber) run(ctx context.Context) (*ScrubReport, error) {
+	run := &scrubRun{Scrubber: s, report: &ScrubReport{StartedAt: time.Now()}, found: map[string]bool{}, poolOf: map[string]string{}}
+	ctx = WithoutPromotion(ctx)
+	err := run.records(ctx, false)
+	if err == nil {
+		err = run.records(ctx, true)
+	}
+	if err == nil {
+		err = run.scanOrphans(ctx)
+	}
+	run.report.FinishedAt = time.Now()
+	if err != nil {
+		run.report.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	s.last = run.report
+	if err == nil {
+		s.orphans = run.found
+	}
+	s.mu.Unlock()
+
+	if s.opts.Done != nil {
+		s.opts.Done(run.report, err)
+	}
+	return run.report, err
+}
+
+// scrubRun is the state of one scrub
+type scrubRun struct {
+	*Scrubber
+	report *ScrubReport
+	// found are the orphans of this scrub
+	found map[string]bool
+	// poolOf caches the pool names of repositories
+	poolOf map[string]string
+}
+
+// records verifies the objects of every artifact record, or of every cache record when cached
+// is set
+func (r *scrubRun) records(ctx context.Context, cached bool) error {
+	var after uint
+	for {
+		records, err := r.index.ListScrubRecords(ctx, cached, after, scrubBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list records: %w", err)
+		}
+		for _, record := range records {
+			after = record.ID
+			if err := r.verify(ctx, record); err != nil {
+				return err
+			}
+		}
+		if len(records) < scrubBatchSize {
+			return nil
+		}
+	}
+}
+
+// locate returns the pool of the repository of a record
+func (r *scrubRun) locate(ctx context.Context, record ScrubRecord) (*Pool, error) {
+	if r.opts.PoolOf == nil || record.Repository == "" {
+		return r.pools.Get(DefaultPool)
+	}
+	name, ok := r.poolOf[record.Repository]
+	if !ok {
+		var err error
+		if name, err = r.opts.PoolOf(ctx, record.Repository); err != nil {
+			return nil, err
+		}
+		r.poolOf[record.Repository] = name
+	}
+	return r.pools.Get(name)
+}
+
+// unreadable reports a record whose object could not be checked. Only a cancelled scrub stops;
+// other objects are still checked.
+func (r *scrubRun) unreadable(ctx context.Context, pool *Pool, record ScrubRecord, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	finding := ScrubFinding{Kind: ScrubUnreadable, Repository: record.Repository, Path: record.Path, Expected: record.Checksum, Action: "reported", Error: err.Error()}
+	if pool != nil {
+		finding.Pool = pool.Name
+	}
+	r.report.add(finding)
+	return nil
+}
+
+// verify re-hashes the object of a record
+func (r *scrubRun) verify(ctx context.Context, record ScrubRecord) error {
+	pool, err := r.locate(ctx, record)
+	if err != nil {
+		return r.unreadable(ctx, nil, record, fmt.Errorf("failed to locate: %w", err))
+	}
+	st := pool.ForRepository(record.Repository)
+	exists, err := st.Exists(ctx, record.Path)
+	if err != nil {
+		return r.unreadable(ctx, pool, record, err)
+	}
+	if !exists {
+		finding := ScrubFinding{Kind: ScrubMissing, Pool: pool.Name, Repository: record.Repository, Path: record.Path, Expected: record.Checksum, Action: "reported"}
+		if record.Cached && r.opts.OnMismatch == ScrubPolicyRepair {
+			r.drop(ctx, nil, record, &finding)
+		}
+		r.report.add(finding)
+		return nil
+	}
+
+	content, err := st.Retrieve(ctx, record.Path)
+	if err != nil {
+		return r.unreadable(ctx, pool, record, err)
+	}
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, &limitedReader{ctx: ctx, r: content, run: r})
+	content.Close()
+	if err != nil {
+		return r.unreadable(ctx, pool, record, err)
+	}
+	r.report.Checked++
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if record.Checksum == "" || strings.EqualFold(actual, record.Checksum) {
+		return nil
+	}
+
+	// The object may have been replaced while it was read
+	current, err := r.index.GetScrubRecord(ctx, record.Cached, record.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get record of %s: %w", record.Path, err)
+	}
+	if current == nil || current.Checksum != record.Checksum || current.Path != record.Path {
+		return nil
+	}
+
+	finding := ScrubFinding{Kind: ScrubMismatch, Pool: pool.Name, Repository: record.Repository, Path: record.Path, Expected: record.Checksum, Actual: actual, Action: "reported"}
+	if n != record.Size && record.Size > 0 {
+		finding.Error = fmt.Sprintf("size is %d bytes, recorded %d", n, record.Size)
+	}
+	switch {
+	case record.Cached && r.opts.OnMismatch == ScrubPolicyRepair:
+		r.drop(ctx, pool, record, &finding)
+	case r.opts.OnMismatch != ScrubPolicyReport:
+		r.quarantine(ctx, st, record.Path, &finding)
+	}
+	r.report.add(finding)
+	return nil
+}
+
+// scanOrphans finds the objects of every pool that no record points at, and the blobs of
+// deduplicating pools that no path references
+func (r *scrubRun) scanOrphans(ctx context.Context) error {
+	for _, pool := range r.pools.sorted() {
+		if pool.CAS != nil {
+			if err := r.scanBlobs(ctx, pool); err != nil {
+				return err
+			}
+		}
+		objects, err := r.objects(ctx, pool)
+		if err != nil {
+			return err
+		}
+		var candidates []scrubObject
+		for _, object := range objects {
+			name := object.path
+			if name == QuarantinePrefix || strings.HasPrefix(name, QuarantinePrefix+"/") || r.ignored(name) || r.pools.foreign(pool, name) {
+				continue
+			}
+			candidates = append(candidates, object)
+		}
+		for start := 0; start < len(candidates); start += scrubBatchSize {
+			batch := candidates[start:min(start+scrubBatchSize, len(candidates))]
+			names := make([]string, len(batch))
+			for i, object := range batch {
+				names[i] = object.path
+			}
+			known, err := r.index.KnownPaths(ctx, names)
+			if err != nil {
+				return fmt.Errorf("failed to look up records: %w", err)
+			}
+			for _, object := range batch {
+				if !known[object.path] {
+					r.orphan(ctx, pool, object, false)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scrubObject is an object of a pool, and the storage it is read through
+type scrubObject struct {
+	storage    Storage
+	repository string
+	path       string
+}
+
+// objects lists the objects of a pool. The paths of a deduplicating pool are referenced per
+// repository, so they are listed through the view of their repository.
+func (r *scrubRun) objects(ctx context.Context, pool *Pool) ([]scrubObject, error) {
+	paths, err := pool.Storage.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage pool %s: %w", pool.Name, err)
+	}
+	objects := make([]scrubObject, 0, len(paths))
+	for _, name := range paths {
+		objects = append(objects, scrubObject{storage: pool.Storage, path: name})
+	}
+	if pool.CAS == nil {
+		return objects, nil
+	}
+
+	refs, err := pool.CAS.refs.ListBlobRefs(ctx, pool.CAS.pool, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blob references of storage pool %s: %w", pool.Name, err)
+	}
+	views := map[string]Storage{}
+	for _, ref := range refs {
+		// Paths stored without a repository are listed by the pool itself
+		if ref.Repository == "" {
+			continue
+		}
+		view, ok := views[ref.Repository]
+		if !ok {
+			view = pool.CAS.ForRepository(ref.Repository)
+			views[ref.Repository] = view
+		}
+		objects = append(objects, scrubObject{storage: view, repository: ref.Repository, path: ref.Path})
+	}
+	return objects, nil
+}
+
+// scanBlobs finds the blobs of a deduplicating pool that no path references. Blobs are only
+// listed by the storage under the CAS decorator, and are matched against the references
+// rather than the records.
+func (r *scrubRun) scanBlobs(ctx context.Context, pool *Pool) error {
+	blobs, err := pool.CAS.inner.List(ctx, casBlobPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list blobs of storage pool %s: %w", pool.Name, err)
+	}
+	for _, name := range blobs {
+		hash := path.Base(name)
+		if len(hash) != 2*sha256.Size || name != BlobPath(hash) || r.ignored(name) || r.pools.foreign(pool, name) {
+			continue
+		}
+		count, err := pool.CAS.refs.CountBlobRefs(ctx, pool.CAS.pool, hash)
+		if err != nil {
+			return fmt.Errorf("failed to count blob references: %w", err)
+		}
+		if count == 0 {
+			r.orphan(ctx, pool, scrubObject{storage: pool.CAS.inner, path: name}, true)
+		}
+	}
+	return nil
+}
+
+// orphan reports an object without a record, or a blob without references when blob is set
+func (r *scrubRun) orphan(ctx context.Context, pool *Pool, object scrubObject, blob bool) {
+	key := pool.Name + "\x00" + object.repository + "\x00" + object.path
+	r.found[key] = true
+	finding := ScrubFinding{Kind: ScrubOrphan, Pool: pool.Name, Repository: object.repository, Path: object.path, Action: "reported"}
+	r.mu.Lock()
+	seen := r.orphans[key]
+	r.mu.Unlock()
+	if seen && r.opts.OnOrphan != ScrubPolicyReport {
+		if blob {
+			r.quarantineBlob(ctx, pool, object.path, &finding)
+		} else {
+			r.quarantine(ctx, object.storage, object.path, &finding)
+		}
+	}
+	r.report.add(finding)
+}
+
+// ignored reports whether name matches an ignore pattern
+func (r *scrubRun) ignored(name string) bool {
+	for _, pattern := range r.opts.Ignore {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return true
+			}
+			continue
+		}
+		for subject := name; subject != "." && subject != "/"; subject = path.Dir(subject) {
+			if ok, _ := path.Match(pattern, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// quarantine moves an object of st, the storage of a pool, under its QuarantinePrefix
+func (r *scrubRun) quarantine(ctx context.Context, st Storage, name string, finding *ScrubFinding) {
+	err := func() error {
+		content, err := st.Retrieve(ctx, name)
+		if err != nil {
+			return err
+		}
+		_, err = st.Store(ctx, QuarantinePrefix+"/"+name, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+		return st.Delete(ctx, name)
+	}()
+	if err != nil {
+		finding.Error = fmt.Sprintf("failed to quarantine: %v", err)
+		return
+	}
+	finding.Action = "quarantined"
+}
+
+// quarantineBlob quarantines a blob of a deduplicating pool, unless a path referenced it since
+// it was found. The blob is locked so it cannot be referenced while it moves.
+func (r *scrubRun) quarantineBlob(ctx context.Context, pool *Pool, name string, finding *ScrubFinding) {
+	hash := path.Base(name)
+	mu := pool.CAS.lock(hash)
+	mu.Lock()
+	defer mu.Unlock()
+	count, err := pool.CAS.refs.CountBlobRefs(ctx, pool.CAS.pool, hash)
+	if err != nil {
+		finding.Error = fmt.Sprintf("failed to count blob references: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	r.quarantine(ctx, pool.CAS.inner, name, finding)
+}
+
+// drop deletes a cached copy and its record, so the next pull fetches the artifact again
+func (r *scrubRun) drop(ctx context.Context, pool *Pool, record ScrubRecord, finding *ScrubFinding) {
+	if pool != nil {
+		if err := pool.ForRepository(record.Repository).Delete(ctx, record.Path); err != nil {
+			finding.Error = fmt.Sprintf("failed to delete: %v", err)
+			return
+		}
+	}
+	if err := r.index.DropCacheRecord(ctx, record.ID); err != nil {
+		finding.Error = fmt.Sprintf("failed to drop cache record: %v", err)
+		return
+	}
+	finding.Action = "dropped"
+}
+
+// limitedReader reads no faster than the configured rate, counting the bytes of the run
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	run *scrubRun
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.run.report.Bytes += int64(n)
+	if rate := l.run.opts.BytesPerSecond; rate > 0 && n > 0 {
+		due := l.run.report.StartedAt.Add(time.Duration(float64(l.run.report.Bytes) / float64(rate) * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-l.ctx.Done():
+				timer.Stop()
+				return n, l.ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryScrubIndex keeps scrub records in memory
+type memoryScrubIndex struct {
+	records []ScrubRecord
+	dropped []uint
+}
+
+func (m *memoryScrubIndex) add(cached bool, repository, path, content string) {
+	sum := sha256.Sum256([]byte(content))
+	m.records = append(m.records, ScrubRecord{
+		ID:         uint(len(m.records) + 1),
+		Repository: repository,
+		Path:       path,
+		Size:       int64(len(content)),
+		Checksum:   hex.EncodeToString(sum[:]),
+		Cached:     cached,
+	})
+}
+
+func (m *memoryScrubIndex) ListScrubRecords(ctx context.Context, cached bool, after uint, limit int) ([]ScrubRecord, error) {
+	var records []ScrubRecord
+	for _, r := range m.records {
+		if r.Cached == cached && r.ID > after && len(records) < limit {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+func (m *memoryScrubIndex) GetScrubRecord(ctx context.Context, cached bool, id uint) (*ScrubRecord, error) {
+	for _, r := range m.records {
+		if r.Cached == cached && r.ID == id {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryScrubIndex) KnownPaths(ctx context.Context, paths []string) (map[string]bool, error) {
+	known := map[string]bool{}
+	for _, r := range m.records {
+		known[r.Path] = true
+	}
+	return known, nil
+}
+
+func (m *memoryScrubIndex) DropCacheRecord(ctx context.Context, id uint) error {
+	m.dropped = append(m.dropped, id)
+	for i, r := range m.records {
+		if r.ID == id {
+			m.records = append(m.records[:i], m.records[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func findings(report *ScrubReport, kind string) map[string]string {
+	found := map[string]string{}
+	for _, f := range report.Findings {
+		if f.Kind == kind {
+			found[f.Path] = f.Action
+		}
+	}
+	return found
+}
+
+func TestScrubber(t *testing.T) {
+	ctx := context.Background()
+	backend := NewLocalStorage(t.TempDir())
+	pools := Pools{
+		DefaultPool: NewPool(DefaultPool, backend, "", PoolLayers{}),
+		"bulk":      NewPool("bulk", backend, "bulk", PoolLayers{}),
+	}
+	index := &memoryScrubIndex{}
+	store := func(pool, path, content string) {
+		_, err := pools[pool].Storage.Store(ctx, path, strings.NewReader(content))
+		require.NoError(t, err)
+	}
+
+	store(DefaultPool, "libs/good.jar", "good")
+	index.add(false, "libs", "libs/good.jar", "good")
+	store("bulk", "libs/large.bin", "large")
+	index.add(false, "bulk-libs", "libs/large.bin", "large")
+	store(DefaultPool, "libs/bad.jar", "corrupted")
+	index.add(false, "libs", "libs/bad.jar", "original")
+	index.add(false, "libs", "libs/gone.jar", "gone")
+	store(DefaultPool, "cache/remote/bad.jar", "corrupted")
+	index.add(true, "remote", "cache/remote/bad.jar", "original")
+	index.add(true, "remote", "cache/remote/gone.jar", "gone")
+	store(DefaultPool, "libs/stray.jar", "stray")
+	store(DefaultPool, "alpine/APKINDEX.tar.gz", "index")
+	store(DefaultPool, "generic/tools/v1/tool.tgz", "tool")
+
+	poolOf := func(ctx context.Context, repository string) (string, error) {
+		if repository == "bulk-libs" {
+			return "bulk", nil
+		}
+		return "", nil
+	}
+	scrubber := NewScrubber(pools, index, ScrubOptions{
+		OnMismatch: ScrubPolicyRepair,
+		OnOrphan:   ScrubPolicyQuarantine,
+		Ignore:     []string{"APKINDEX.tar.gz", "generic/*"},
+		PoolOf:     poolOf,
+	})
+
+	t.Run("Problems are found and handled by policy", func(t *testing.T) {
+		report, err := scrubber.Run(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 4, report.Checked)
+		assert.Equal(t, int64(len("good")+len("large")+2*len("corrupted")), report.Bytes)
+		assert.Equal(t, map[string]string{"libs/bad.jar": "quarantined", "cache/remote/bad.jar": "dropped"}, findings(report, ScrubMismatch))
+		assert.Equal(t, map[string]string{"libs/gone.jar": "reported", "cache/remote/gone.jar": "dropped"}, findings(report, ScrubMissing))
+		assert.Equal(t, map[string]string{"libs/stray.jar": "reported"}, findings(report, ScrubOrphan),
+			"content of other pools and ignored content are not orphans, and orphans are left alone the first time")
+		assert.Equal(t, map[string]int{ScrubMismatch: 2, ScrubMissing: 2, ScrubOrphan: 1, ScrubUnreadable: 0}, report.Counts())
+		assert.Equal(t, []uint{5, 6}, index.dropped)
+		assert.Same(t, report, scrubber.LastReport())
+
+		exists, err := backend.Exists(ctx, QuarantinePrefix+"/libs/bad.jar")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = backend.Exists(ctx, "cache/remote/bad.jar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Orphans found twice are quarantined", func(t *testing.T) {
+		report, err := scrubber.Run(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"libs/stray.jar": "quarantined"}, findings(report, ScrubOrphan))
+		assert.Equal(t, map[string]string{"libs/bad.jar": "reported", "libs/gone.jar": "reported"}, findings(report, ScrubMissing))
+
+		report, err = scrubber.Run(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, findings(report, ScrubOrphan), "quarantined content is not scrubbed")
+	})
+
+	t.Run("Records are looked up in the pool of their repository", func(t *testing.T) {
+		// The same path in another pool neither satisfies nor hides a record
+		store("bulk", "libs/shadow.jar", "shadow")
+		index.add(false, "libs", "libs/shadow.jar", "shadow")
+		store(DefaultPool, "libs/large.bin", "other")
+		report, err := NewScrubber(pools, index, ScrubOptions{PoolOf: poolOf}).Run(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "reported", findings(report, ScrubMissing)["libs/shadow.jar"])
+		assert.NotContains(t, findings(report, ScrubMismatch), "libs/large.bin")
+		require.NoError(t, pools[DefaultPool].Storage.Delete(ctx, "libs/large.bin"))
+		index.records = index.records[:len(index.records)-1]
+	})
+
+	t.Run("Reports only by default", func(t *testing.T) {
+		store(DefaultPool, "libs/good.jar", "changed")
+		report, err := NewScrubber(pools, index, ScrubOptions{PoolOf: poolOf}).Run(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"libs/good.jar": "reported"}, findings(report, ScrubMismatch))
+		exists, err := backend.Exists(ctx, "libs/good.jar")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+}
+
+func TestScrubberBlobs(t *testing.T) {
+	ctx := context.Background()
+	backend := NewLocalStorage(t.TempDir())
+	pool := NewPool(DefaultPool, backend, "", PoolLayers{Refs: newMemoryRefStore()})
+	_, err := pool.ForRepository("libs").Store(ctx, "libs/a.jar", strings.NewReader("kept"))
+	require.NoError(t, err)
+	index := &memoryScrubIndex{}
+	index.add(false, "libs", "libs/a.jar", "kept")
+
+	// A blob whose references were lost is hidden from the deduplicating view of the pool
+	sum := sha256.Sum256([]byte("stray"))
+	stray := BlobPath(hex.EncodeToString(sum[:]))
+	_, err = backend.Store(ctx, stray, strings.NewReader("stray"))
+	require.NoError(t, err)
+
+	scrubber := NewScrubber(Pools{DefaultPool: pool}, index, ScrubOptions{OnOrphan: ScrubPolicyQuarantine})
+	report, err := scrubber.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{stray: "reported"}, findings(report, ScrubOrphan))
+
+	report, err = scrubber.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{stray: "quarantined"}, findings(report, ScrubOrphan))
+	exists, err := backend.Exists(ctx, QuarantinePrefix+"/"+stray)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = backend.Exists(ctx, stray)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	report, err = scrubber.Run(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, findings(report, ScrubOrphan))
+	assert.Equal(t, 1, report.Checked)
+}
+
+func TestScrubberReferences(t *testing.T) {
+	ctx := context.Background()
+	pool := NewPool(DefaultPool, NewLocalStorage(t.TempDir()), "", PoolLayers{Refs: newMemoryRefStore()})
+	libs, docs := pool.ForRepository("libs"), pool.ForRepository("docs")
+	_, err := libs.Store(ctx, "a.jar", strings.NewReader("kept"))
+	require.NoError(t, err)
+	_, err = docs.Store(ctx, "a.jar", strings.NewReader("corrupted"))
+	require.NoError(t, err)
+	_, err = docs.Store(ctx, "stray.txt", strings.NewReader("stray"))
+	require.NoError(t, err)
+	index := &memoryScrubIndex{}
+	index.add(false, "libs", "a.jar", "kept")
+	index.add(false, "docs", "a.jar", "original")
+
+	scrubber := NewScrubber(Pools{DefaultPool: pool}, index, ScrubOptions{OnMismatch: ScrubPolicyQuarantine, OnOrphan: ScrubPolicyQuarantine})
+	report, err := scrubber.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Checked)
+	require.Len(t, report.Findings, 2)
+	mismatch := report.Findings[0]
+	assert.Equal(t, ScrubMismatch, mismatch.Kind)
+	assert.Equal(t, "docs", mismatch.Repository)
+	assert.Equal(t, "a.jar", mismatch.Path)
+	assert.Equal(t, "quarantined", mismatch.Action)
+	assert.Equal(t, ScrubFinding{Kind: ScrubOrphan, Pool: DefaultPool, Repository: "docs", Path: "stray.txt", Action: "reported"}, report.Findings[1])
+
+	// The path of the other repository keeps its content
+	content, err := libs.Retrieve(ctx, "a.jar")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, "kept", string(data))
+
+	report, err = scrubber.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"stray.txt": "quarantined"}, findings(report, ScrubOrphan))
+	exists, err := docs.Exists(ctx, QuarantinePrefix+"/stray.txt")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = libs.Exists(ctx, QuarantinePrefix+"/stray.txt")
+	require.NoError(t, err)
+	assert.False(t, exists, "objects are quarantined within their repository")
+}
+
+func TestScrubberUnreadable(t *testing.T) {
+	ctx := context.Background()
+	backend := NewLocalStorage(t.TempDir())
+	keys, err := NewKeyring(make([]byte, 32))
+	require.NoError(t, err)
+	pool := NewPool(DefaultPool, backend, "", PoolLayers{Keys: keys})
+	index := &memoryScrubIndex{}
+	for _, name := range []string{"a.bin", "b.bin"} {
+		_, err := pool.Storage.Store(ctx, name, strings.NewReader("content of "+name))
+		require.NoError(t, err)
+		index.add(false, "files", name, "content of "+name)
+	}
+
+	// Tampered ciphertext fails to decrypt
+	env, err := pool.Encrypted.envelope(ctx, "a.bin")
+	require.NoError(t, err)
+	_, err = backend.Store(ctx, env.Object, strings.NewReader(encryptionMagic+strings.Repeat("x", 64)))
+	require.NoError(t, err)
+
+	report, err := NewScrubber(Pools{DefaultPool: pool}, index, ScrubOptions{}).Run(ctx)
+	require.NoError(t, err, "one unreadable object does not stop the scrub")
+	assert.Equal(t, map[string]string{"a.bin": "reported"}, findings(report, ScrubUnreadable))
+	assert.Equal(t, 1, report.Unreadable)
+	assert.Equal(t, 1, report.Checked)
+}
+
+func TestScrubberRateLimit(t *testing.T) {
+	ctx := context.Background()
+	pool := NewPool(DefaultPool, NewLocalStorage(t.TempDir()), "", PoolLayers{})
+	content := strings.Repeat("x", 2048)
+	_, err := pool.Storage.Store(ctx, "a.bin", strings.NewReader(content))
+	require.NoError(t, err)
+	index := &memoryScrubIndex{}
+	index.add(false, "files", "a.bin", content)
+
+	scrubber := NewScrubber(Pools{DefaultPool: pool}, index, ScrubOptions{BytesPerSecond: 10 << 10})
+	start := time.Now()
+	report, err := scrubber.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Checked)
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = NewScrubber(Pools{DefaultPool: pool}, index, ScrubOptions{BytesPerSecond: 1}).Run(cancelled)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestScrubberSchedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := NewPool(DefaultPool, NewLocalStorage(t.TempDir()), "", PoolLayers{})
+	content := strings.Repeat("x", 2048)
+	_, err := pool.Storage.Store(ctx, "a.bin", strings.NewReader(content))
+	require.NoError(t, err)
+	index := &memoryScrubIndex{}
+	index.add(false, "files", "a.bin", content)
+
+	reports := make(chan *ScrubReport, 10)
+	scrubber := NewScrubber(Pools{DefaultPool: pool}, index, ScrubOptions{
+		BytesPerSecond: 10 << 10,
+		Done:           func(report *ScrubReport, err error) { reports <- report },
+	})
+	next := func() *ScrubReport {
+		select {
+		case report := <-reports:
+			return report
+		case <-time.After(5 * time.Second):
+			t.Fatal("no scrub finished")
+			return nil
+		}
+	}
+
+	require.NoError(t, scrubber.Start(ctx))
+	assert.ErrorIs(t, scrubber.Start(ctx), ErrScrubRunning)
+	go scrubber.Schedule(ctx, 10*time.Millisecond)
+
+	// Scheduled scrubs that are due while the started one runs are skipped
+	started := next()
+	assert.Equal(t, 1, started.Checked)
+	scheduled := next()
+	assert.Equal(t, 1, scheduled.Checked)
+	assert.False(t, scheduled.StartedAt.Before(started.FinishedAt))
+}
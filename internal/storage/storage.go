@@ -2,20 +2,29 @@ package storage
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"path/filepath"
 )
 
 // Storage represents an abstract storage interface
 type Storage interface {
-	// Store saves content to the storage with the given path
-	Store(ctx context.Context, path string, content io.Reader) error
+	// Store saves content to the storage with the given path and returns the digests computed
+	// while writing it
+	Store(ctx context.Context, path string, content io.Reader) (*Digests, error)
 	
 	// Retrieve gets content from the storage
 	Retrieve(ctx context.Context, path string) (io.ReadCloser, error)
 	
+	// RetrieveRange gets length bytes of content starting at offset; a negative length reads
+	// to the end
+	RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+	
 	// Delete removes content from the storage
 	Delete(ctx context.Context, path string) error
 	
@@ -32,6 +41,58 @@ type Storage interface {
 	GetChecksum(ctx context.Context, path string) (string, error)
 }
 
+// Digests describes content as it was stored
+type Digests struct {
+	Size int64
+	// SHA256 is the hex encoded SHA-256 of the content; it is what GetChecksum returns
+	SHA256 string
+	// SHA1 and MD5 are only set by storages configured to compute them
+	SHA1 string
+	MD5  string
+}
+
+// digester computes Digests of the content written to it
+type digester struct {
+	size   int64
+	sha256 hash.Hash
+	sha1   hash.Hash
+	md5    hash.Hash
+	writer io.Writer
+}
+
+// newDigester creates a digester for SHA-256 and, when requested, SHA-1 and MD5
+func newDigester(sha1Sum, md5Sum bool) *digester {
+	d := &digester{sha256: sha256.New()}
+	writers := []io.Writer{d.sha256}
+	if sha1Sum {
+		d.sha1 = sha1.New()
+		writers = append(writers, d.sha1)
+	}
+	if md5Sum {
+		d.md5 = md5.New()
+		writers = append(writers, d.md5)
+	}
+	d.writer = io.MultiWriter(writers...)
+	return d
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.writer.Write(p)
+}
+
+// Digests returns the digests of the content written so far
+func (d *digester) Digests() *Digests {
+	digests := &Digests{Size: d.size, SHA256: hex.EncodeToString(d.sha256.Sum(nil))}
+	if d.sha1 != nil {
+		digests.SHA1 = hex.EncodeToString(d.sha1.Sum(nil))
+	}
+	if d.md5 != nil {
+		digests.MD5 = hex.EncodeToString(d.md5.Sum(nil))
+	}
+	return digests
+}
+
 // ShardedPath generates a sharded path based on hash
 func ShardedPath(hash string) string {
 	if len(hash) < 4 {
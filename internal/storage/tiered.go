@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotTiered is returned when demoting content of a storage without a cold tier
+var ErrNotTiered = errors.New("storage is not tiered")
+
+// Demoter is implemented by storages that can move content to a colder tier. Decorators
+// implement it by demoting the location their path maps to in the storage they wrap.
+type Demoter interface {
+	// Demote moves the content of path to the cold tier; content already there is left as is
+	Demote(ctx context.Context, path string) error
+}
+
+// Demote moves the content of path to the cold tier of st
+func Demote(ctx context.Context, st Storage, path string) error {
+	if d, ok := st.(Demoter); ok {
+		return d.Demote(ctx, path)
+	}
+	return ErrNotTiered
+}
+
+// TieredStorage writes content to a hot storage and keeps content moved away with Demote in a
+// cold one, such as a cheaper disk or an S3 bucket with an infrequent access storage class.
+// Reading cold content promotes it back to the hot storage.
+type TieredStorage struct {
+	hot  Storage
+	cold Storage
+
+	// locks serialize moving a path between tiers with storing and deleting it
+	locks [256]sync.Mutex
+}
+
+// NewTieredStorage creates a storage with the given hot and cold tiers
+func NewTieredStorage(hot, cold Storage) *TieredStorage {
+	return &TieredStorage{hot: hot, cold: cold}
+}
+
+func (t *TieredStorage) lock(path string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return &t.locks[h.Sum32()%uint32(len(t.locks))]
+}
+
+// move copies path from one tier to the other and removes it from the source once the copy is
+// complete
+func move(ctx context.Context, from, to Storage, path string) error {
+	size, err := from.GetSize(ctx, path)
+	if err != nil {
+		return err
+	}
+	content, err := from.Retrieve(ctx, path)
+	if err != nil {
+		return err
+	}
+	digests, err := to.Store(ctx, path, content)
+	content.Close()
+	if err != nil {
+		return err
+	}
+	if digests.Size != size {
+		_ = to.Delete(ctx, path)
+		return fmt.Errorf("copied %d of %d bytes", digests.Size, size)
+	}
+	return from.Delete(ctx, path)
+}
+
+// Store saves content to the hot tier, replacing any cold copy
+func (t *TieredStorage) Store(ctx context.Context, path string, content io.Reader) (*Digests, error) {
+	mu := t.lock(path)
+	mu.Lock()
+	defer mu.Unlock()
+
+	digests, err := t.hot.Store(ctx, path, content)
+	if err != nil {
+		return nil, err
+	}
+	if exists, err := t.cold.Exists(ctx, path); err == nil && exists {
+		_ = t.cold.Delete(ctx, path)
+	}
+	return digests, nil
+}
+
+// noPromoteKey is the context key of WithoutPromotion
+type noPromoteKey struct{}
+
+// WithoutPromotion returns a context in which reading cold content leaves it in the cold tier,
+// for reads that are not a sign of use, such as integrity checks
+func WithoutPromotion(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noPromoteKey{}, true)
+}
+
+// promote moves path to the hot tier when it is only in the cold one. It returns the tier to
+// read path from: the cold one when promoting fails, so content stays readable.
+func (t *TieredStorage) promote(ctx context.Context, path string) (Storage, error) {
+	if ctx.Value(noPromoteKey{}) != nil {
+		return t.tier(ctx, path)
+	}
+	if exists, err := t.hot.Exists(ctx, path); err != nil || exists {
+		return t.hot, err
+	}
+
+	mu := t.lock(path)
+	mu.Lock()
+	defer mu.Unlock()
+	if exists, err := t.hot.Exists(ctx, path); err != nil || exists {
+		return t.hot, err
+	}
+	exists, err := t.cold.Exists(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// Let the hot tier report the missing path
+		return t.hot, nil
+	}
+	if err := move(ctx, t.cold, t.hot, path); err != nil {
+		if exists, _ := t.hot.Exists(ctx, path); exists {
+			// The copy is complete; the cold copy is replaced by the next demotion
+			return t.hot, nil
+		}
+		return t.cold, nil
+	}
+	return t.hot, nil
+}
+
+// Retrieve gets content, promoting it to the hot tier when it is cold
+func (t *TieredStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	tier, err := t.promote(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return tier.Retrieve(ctx, path)
+}
+
+// RetrieveRange gets part of content, promoting it to the hot tier when it is cold
+func (t *TieredStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	tier, err := t.promote(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return tier.RetrieveRange(ctx, path, offset, length)
+}
+
+// Demote moves the content of path from the hot tier to the cold one
+func (t *TieredStorage) Demote(ctx context.Context, path string) error {
+	mu := t.lock(path)
+	mu.Lock()
+	defer mu.Unlock()
+
+	exists, err := t.hot.Exists(ctx, path)
+	if err != nil || !exists {
+		return err
+	}
+	if err := move(ctx, t.hot, t.cold, path); err != nil {
+		return fmt.Errorf("failed to move %s to cold storage: %w", path, err)
+	}
+	return nil
+}
+
+// Delete removes content from both tiers
+func (t *TieredStorage) Delete(ctx context.Context, path string) error {
+	mu := t.lock(path)
+	mu.Lock()
+	defer mu.Unlock()
+
+	deleted := false
+	for _, tier := range []Storage{t.hot, t.cold} {
+		exists, err := tier.Exists(ctx, path)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := tier.Delete(ctx, path); err != nil {
+				return err
+			}
+			deleted = true
+		}
+	}
+	if !deleted {
+		// Let the hot tier report the missing path
+		return t.hot.Delete(ctx, path)
+	}
+	return nil
+}
+
+// Exists checks if content exists in either tier
+func (t *TieredStorage) Exists(ctx context.Context, path string) (bool, error) {
+	exists, err := t.hot.Exists(ctx, path)
+	if err != nil || exists {
+		return exists, err
+	}
+	return t.cold.Exists(ctx, path)
+}
+
+// List returns the paths with the given prefix in either tier
+func (t *TieredStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	hot, err := t.hot.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := t.cold.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(hot))
+	paths := make([]string, 0, len(hot)+len(cold))
+	for _, p := range append(hot, cold...) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// tier returns the tier holding path, without promoting it
+func (t *TieredStorage) tier(ctx context.Context, path string) (Storage, error) {
+	exists, err := t.hot.Exists(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if exists, err := t.cold.Exists(ctx, path); err == nil && exists {
+			return t.cold, nil
+		}
+	}
+	return t.hot, nil
+}
+
+// GetSize returns the size of content in the tier holding it
+func (t *TieredStorage) GetSize(ctx context.Context, path string) (int64, error) {
+	tier, err := t.tier(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	return tier.GetSize(ctx, path)
+}
+
+// GetChecksum returns the checksum of content in the tier holding it
+func (t *TieredStorage) GetChecksum(ctx context.Context, path string) (string, error) {
+	tier, err := t.tier(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return tier.GetChecksum(ctx, path)
+}
+
+// ColdArtifact is an artifact whose content was not read recently
+type ColdArtifact struct {
+	ID         uint
+	Repository string
+	Path       string
+}
+
+// AccessIndex finds content that was not read recently
+type AccessIndex interface {
+	// ListColdArtifacts returns up to limit artifacts not read since cutoff and not moved to
+	// cold storage since they were last read or written
+	ListColdArtifacts(ctx context.Context, cutoff time.Time, limit int) ([]ColdArtifact, error)
+	// MarkArtifactCold records that the content of an artifact moved to cold storage
+	MarkArtifactCold(ctx context.Context, id uint) error
+}
+
+// migrateBatchSize is how many artifacts MigrateCold looks up at once
+const migrateBatchSize = 500
+
+// MigrateCold demotes the content of the artifacts index reports as not read since cutoff, each
+// in the storage storageOf returns for its repository. An artifact that fails to move is
+// skipped and tried again by the next migration. It returns the number of artifacts moved.
+func MigrateCold(ctx context.Context, index AccessIndex, cutoff time.Time, storageOf func(ctx context.Context, repository string) (Storage, error)) (int, error) {
+	moved := 0
+	for {
+		artifacts, err := index.ListColdArtifacts(ctx, cutoff, migrateBatchSize)
+		if err != nil {
+			return moved, fmt.Errorf("failed to list cold artifacts: %w", err)
+		}
+		batch := 0
+		var lastErr error
+		for _, a := range artifacts {
+			if err := ctx.Err(); err != nil {
+				return moved, err
+			}
+			st, err := storageOf(ctx, a.Repository)
+			if err == nil {
+				err = Demote(ctx, st, a.Path)
+			}
+			if errors.Is(err, ErrNotTiered) {
+				return moved, err
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if err := index.MarkArtifactCold(ctx, a.ID); err != nil {
+				return moved, fmt.Errorf("failed to mark %s of %s cold: %w", a.Path, a.Repository, err)
+			}
+			batch++
+		}
+		moved += batch
+		// Failed artifacts are listed again, so stop once a batch makes no progress
+		if len(artifacts) < migrateBatchSize || batch == 0 {
+			return moved, lastErr
+		}
+	}
+}
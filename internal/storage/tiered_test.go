@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTieredStorage(t *testing.T) (*TieredStorage, Storage, Storage) {
+	hot := NewLocalStorage(t.TempDir())
+	cold := NewLocalStorage(t.TempDir())
+	return NewTieredStorage(hot, cold), hot, cold
+}
+
+func TestTieredStorage(t *testing.T) {
+	ctx := context.Background()
+	st, hot, cold := newTestTieredStorage(t)
+
+	t.Run("Store writes to the hot tier", func(t *testing.T) {
+		digests, err := st.Store(ctx, "libs/a.jar", strings.NewReader("alpha"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), digests.Size)
+		exists, err := hot.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Demote moves content to the cold tier", func(t *testing.T) {
+		require.NoError(t, st.Demote(ctx, "libs/a.jar"))
+		exists, err := hot.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		exists, err = cold.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = st.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		size, err := st.GetSize(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), size)
+		paths, err := st.List(ctx, "libs")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"libs/a.jar"}, paths)
+
+		assert.NoError(t, st.Demote(ctx, "libs/a.jar"), "demoting cold content does nothing")
+	})
+
+	t.Run("Reading without promotion leaves content cold", func(t *testing.T) {
+		content, err := st.Retrieve(WithoutPromotion(ctx), "libs/a.jar")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(content)
+		content.Close()
+		assert.Equal(t, "alpha", string(data))
+		exists, err := hot.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Reading cold content promotes it", func(t *testing.T) {
+		content, err := st.RetrieveRange(ctx, "libs/a.jar", 1, 3)
+		require.NoError(t, err)
+		data, err := io.ReadAll(content)
+		content.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "lph", string(data))
+
+		exists, err := hot.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = cold.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Store replaces the cold copy", func(t *testing.T) {
+		require.NoError(t, st.Demote(ctx, "libs/a.jar"))
+		_, err := st.Store(ctx, "libs/a.jar", strings.NewReader("beta"))
+		require.NoError(t, err)
+		exists, err := cold.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		content, err := st.Retrieve(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(content)
+		content.Close()
+		assert.Equal(t, "beta", string(data))
+	})
+
+	t.Run("Delete removes both tiers", func(t *testing.T) {
+		require.NoError(t, st.Demote(ctx, "libs/a.jar"))
+		require.NoError(t, st.Delete(ctx, "libs/a.jar"))
+		exists, err := st.Exists(ctx, "libs/a.jar")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
+
+func TestDemoteThroughDecorators(t *testing.T) {
+	ctx := context.Background()
+	tiered, hot, cold := newTestTieredStorage(t)
+	keys, err := NewKeyring(make([]byte, 32))
+	require.NoError(t, err)
+	enc := NewEncryptedStorage(tiered, keys)
+	st := NewCASStorage(enc, newMemoryRefStore())
+
+	_, err = st.Store(ctx, "a.txt", strings.NewReader("shared"))
+	require.NoError(t, err)
+	_, err = st.Store(ctx, "b.txt", strings.NewReader("shared"))
+	require.NoError(t, err)
+	checksum, err := st.GetChecksum(ctx, "a.txt")
+	require.NoError(t, err)
+	env, err := enc.envelope(ctx, BlobPath(checksum))
+	require.NoError(t, err)
+	blob := env.Object
+
+	require.NoError(t, Demote(ctx, st, "a.txt"))
+	exists, err := cold.Exists(ctx, blob)
+	require.NoError(t, err)
+	assert.True(t, exists, "the shared blob moves")
+	exists, err = hot.Exists(ctx, envelopePath(BlobPath(checksum)))
+	require.NoError(t, err)
+	assert.True(t, exists, "the envelope stays hot")
+
+	content, err := st.Retrieve(ctx, "b.txt")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, "shared", string(data))
+	exists, err = hot.Exists(ctx, blob)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.ErrorIs(t, Demote(ctx, NewLocalStorage(t.TempDir()), "a.txt"), ErrNotTiered)
+}
+
+// memoryAccessIndex reports fixed artifacts as cold until they are marked
+type memoryAccessIndex struct {
+	cold   []ColdArtifact
+	marked []uint
+}
+
+func (m *memoryAccessIndex) ListColdArtifacts(ctx context.Context, cutoff time.Time, limit int) ([]ColdArtifact, error) {
+	var artifacts []ColdArtifact
+	for _, a := range m.cold {
+		if len(artifacts) < limit && !slices.Contains(m.marked, a.ID) {
+			artifacts = append(artifacts, a)
+		}
+	}
+	return artifacts, nil
+}
+
+func (m *memoryAccessIndex) MarkArtifactCold(ctx context.Context, id uint) error {
+	m.marked = append(m.marked, id)
+	return nil
+}
+
+// failingDemoter fails to demote one path
+type failingDemoter struct {
+	*TieredStorage
+	fail string
+}
+
+func (f *failingDemoter) Demote(ctx context.Context, path string) error {
+	if path == f.fail {
+		return errors.New("cold storage unavailable")
+	}
+	return f.TieredStorage.Demote(ctx, path)
+}
+
+func TestMigrateCold(t *testing.T) {
+	ctx := context.Background()
+	tiered, _, cold := newTestTieredStorage(t)
+	other, _, otherCold := newTestTieredStorage(t)
+	for _, st := range []Storage{tiered, other} {
+		for _, p := range []string{"a", "b", "c"} {
+			_, err := st.Store(ctx, p, strings.NewReader(p))
+			require.NoError(t, err)
+		}
+	}
+	failing := &failingDemoter{TieredStorage: tiered, fail: "b"}
+	storageOf := func(ctx context.Context, repository string) (Storage, error) {
+		switch repository {
+		case "maven":
+			return failing, nil
+		case "npm":
+			return other, nil
+		}
+		return nil, errors.New("repository not found")
+	}
+	index := &memoryAccessIndex{cold: []ColdArtifact{
+		{ID: 1, Repository: "maven", Path: "a"},
+		{ID: 2, Repository: "maven", Path: "b"},
+		{ID: 3, Repository: "maven", Path: "missing"},
+		{ID: 4, Repository: "npm", Path: "c"},
+		{ID: 5, Repository: "deleted", Path: "a"},
+	}}
+
+	moved, err := MigrateCold(ctx, index, time.Now(), storageOf)
+	assert.Error(t, err)
+	assert.Equal(t, 3, moved)
+	assert.Equal(t, []uint{1, 3, 4}, index.marked)
+	paths, err := cold.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, paths)
+	paths, err = otherCold.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, paths, "artifacts move in the storage of their repository only")
+
+	failing.fail = ""
+	moved, err = MigrateCold(ctx, index, time.Now(), storageOf)
+	assert.Error(t, err, "the artifact of a deleted repository is still listed")
+	assert.Equal(t, 1, moved)
+	paths, err = cold.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, paths)
+
+	untiered := func(ctx context.Context, repository string) (Storage, error) {
+		return NewLocalStorage(t.TempDir()), nil
+	}
+	_, err = MigrateCold(ctx, &memoryAccessIndex{cold: []ColdArtifact{{ID: 1, Path: "a"}}}, time.Now(), untiered)
+	assert.ErrorIs(t, err, ErrNotTiered)
+}